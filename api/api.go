@@ -234,9 +234,15 @@ func New(requiredUserAgent string, requiredPassword string, cs modules.Consensus
 	if api.renter != nil {
 		router.GET("/renter", api.renterHandlerGET)
 		router.POST("/renter", RequirePassword(api.renterHandlerPOST, requiredPassword))
+		router.GET("/renter/buckets", RequirePassword(api.renterBucketsHandler, requiredPassword))
+		router.POST("/renter/buckets/:bucket", RequirePassword(api.renterBucketCreateHandler, requiredPassword))
+		router.POST("/renter/buckets/:bucket/delete", RequirePassword(api.renterBucketDeleteHandler, requiredPassword))
 		router.GET("/renter/contracts", api.renterContractsHandler)
-		router.GET("/renter/downloads", api.renterDownloadsHandler)
-		router.GET("/renter/files", api.renterFilesHandler)
+		router.GET("/renter/downloads", api.requireBucket(api.renterDownloadsHandler, ""))
+		router.POST("/renter/downloads/:id", api.requireBucket(api.renterDownloadPriorityHandler, requiredPassword))
+		router.POST("/renter/downloads/:id/cancel", api.requireBucket(api.renterDownloadCancelHandler, requiredPassword))
+		router.GET("/renter/files", api.requireBucket(api.renterFilesHandler, ""))
+		router.GET("/renter/migrations", api.renterMigrationsHandler)
 		router.GET("/renter/prices", api.renterPricesHandler)
 
 		// TODO: re-enable these routes once the new .sia format has been
@@ -246,16 +252,28 @@ func New(requiredUserAgent string, requiredPassword string, cs modules.Consensus
 		// router.GET("/renter/share", RequirePassword(api.renterShareHandler, requiredPassword))
 		// router.GET("/renter/shareascii", RequirePassword(api.renterShareAsciiHandler, requiredPassword))
 
-		router.POST("/renter/delete/*siapath", RequirePassword(api.renterDeleteHandler, requiredPassword))
-		router.GET("/renter/download/*siapath", RequirePassword(api.renterDownloadHandler, requiredPassword))
-		router.GET("/renter/downloadasync/*siapath", RequirePassword(api.renterDownloadAsyncHandler, requiredPassword))
-		router.POST("/renter/rename/*siapath", RequirePassword(api.renterRenameHandler, requiredPassword))
-		router.POST("/renter/upload/*siapath", RequirePassword(api.renterUploadHandler, requiredPassword))
+		router.POST("/renter/delete/*siapath", api.requireBucket(api.renterDeleteHandler, requiredPassword))
+		router.GET("/renter/download/*siapath", api.requireBucket(api.renterDownloadHandler, requiredPassword))
+		router.GET("/renter/downloadasync/*siapath", api.requireBucket(api.renterDownloadAsyncHandler, requiredPassword))
+		router.GET("/renter/stream/*siapath", api.requireBucket(api.renterStreamHandler, requiredPassword))
+		router.HEAD("/renter/stream/*siapath", api.requireBucket(api.renterStreamHandler, requiredPassword))
+		router.POST("/renter/rename/*siapath", api.requireBucket(api.renterRenameHandler, requiredPassword))
+		router.POST("/renter/renamebatch", RequirePassword(api.renterRenameBatchHandler, requiredPassword))
+		router.POST("/renter/metadata/*siapath", RequirePassword(api.renterMetadataHandler, requiredPassword))
+		router.POST("/renter/upload/*siapath", api.requireBucket(api.renterUploadHandler, requiredPassword))
+		router.GET("/renter/uploadprogress/*siapath", api.renterUploadProgressHandler)
+		router.GET("/renter/versions/*siapath", api.renterVersionsHandler)
+		router.POST("/renter/prune/*siapath", RequirePassword(api.renterPruneHandler, requiredPassword))
+		router.POST("/renter/repairfromdisk/*siapath", RequirePassword(api.renterRepairFromDiskHandler, requiredPassword))
+		router.POST("/renter/redundancy/*siapath", RequirePassword(api.renterRedundancyHandler, requiredPassword))
+		router.GET("/renter/verify/*siapath", RequirePassword(api.renterVerifyHandler, requiredPassword))
 
 		// HostDB endpoints.
 		router.GET("/hostdb/active", api.hostdbActiveHandler)
 		router.GET("/hostdb/all", api.hostdbAllHandler)
 		router.GET("/hostdb/hosts/:pubkey", api.hostdbHostsHandler)
+		router.GET("/hostdb/scoreweights", api.hostdbScoreWeightsHandlerGET)
+		router.POST("/hostdb/scoreweights", RequirePassword(api.hostdbScoreWeightsHandlerPOST, requiredPassword))
 	}
 
 	// Transaction pool API Calls
@@ -292,8 +310,16 @@ func New(requiredUserAgent string, requiredPassword string, cs modules.Consensus
 		router.POST("/wallet/changepassword", RequirePassword(api.walletChangePasswordHandler, requiredPassword))
 	}
 
-	// Apply UserAgent middleware and return the API
-	api.router = cleanCloseHandler(RequireUserAgent(router, requiredUserAgent))
+	// Apply UserAgent middleware and return the API. Authenticated requests to
+	// /renter/stream do not need the user agent.
+	uaRouter := RequireUserAgent(router, requiredUserAgent)
+	api.router = cleanCloseHandler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if api.renter != nil && strings.HasPrefix(req.URL.Path, "/renter/stream/") && api.streamAuthenticated(req, requiredPassword) {
+			router.ServeHTTP(w, req)
+			return
+		}
+		uaRouter.ServeHTTP(w, req)
+	}))
 	return api
 }
 
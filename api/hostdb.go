@@ -1,6 +1,7 @@
 package api
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 
@@ -35,6 +36,12 @@ type (
 		Entry          ExtendedHostDBEntry        `json:"entry"`
 		ScoreBreakdown modules.HostScoreBreakdown `json:"scorebreakdown"`
 	}
+
+	// HostdbScoreWeightsGET contains the weights of the components of the
+	// host scores.
+	HostdbScoreWeightsGET struct {
+		modules.HostScoreWeights
+	}
 )
 
 // hostdbActiveHandler handles the API call asking for the list of active
@@ -114,3 +121,51 @@ func (api *API) hostdbHostsHandler(w http.ResponseWriter, req *http.Request, ps
 		ScoreBreakdown: breakdown,
 	})
 }
+
+// hostdbScoreWeightsHandlerGET handles the API call asking for the weights of
+// the components of the host scores.
+func (api *API) hostdbScoreWeightsHandlerGET(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	WriteJSON(w, HostdbScoreWeightsGET{
+		HostScoreWeights: api.renter.HostScoreWeights(),
+	})
+}
+
+// hostdbScoreWeightsHandlerPOST handles the API call changing the weights of
+// the components of the host scores. Weights that are not provided keep their
+// current values.
+func (api *API) hostdbScoreWeightsHandlerPOST(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	weights, err := scanScoreWeights(req, api.renter.HostScoreWeights())
+	if err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
+	if err := api.renter.SetHostScoreWeights(weights); err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
+	WriteSuccess(w)
+}
+
+// scanScoreWeights returns weights with the score weight parameters of req
+// applied to it.
+func scanScoreWeights(req *http.Request, weights modules.HostScoreWeights) (modules.HostScoreWeights, error) {
+	params := []struct {
+		name   string
+		weight *float64
+	}{
+		{"age", &weights.Age},
+		{"collateral", &weights.Collateral},
+		{"interactions", &weights.Interactions},
+		{"price", &weights.Price},
+		{"uptime", &weights.Uptime},
+	}
+	for _, p := range params {
+		if req.FormValue(p.name) == "" {
+			continue
+		}
+		if _, err := fmt.Sscan(req.FormValue(p.name), p.weight); err != nil {
+			return modules.HostScoreWeights{}, errors.New("unable to parse " + p.name + ": " + err.Error())
+		}
+	}
+	return weights, nil
+}
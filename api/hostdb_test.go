@@ -195,6 +195,9 @@ func TestHostDBHostsHandler(t *testing.T) {
 	if hh.ScoreBreakdown.CollateralAdjustment == 0 {
 		t.Error("Zero value in host score breakdown")
 	}
+	if hh.ScoreBreakdown.InteractionAdjustment == 0 {
+		t.Error("Zero value in host score breakdown")
+	}
 	if hh.ScoreBreakdown.PriceAdjustment == 0 {
 		t.Error("Zero value in host score breakdown")
 	}
@@ -236,6 +239,66 @@ func TestHostDBHostsHandler(t *testing.T) {
 	}
 }
 
+// TestHostDBScoreWeights checks that the score weights can be changed through
+// the API, and that they are applied to the score breakdowns of hosts.
+func TestHostDBScoreWeights(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	st, err := createServerTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.panicClose()
+	if err = st.announceHost(); err != nil {
+		t.Fatal(err)
+	}
+	var ah HostdbActiveGET
+	if err = st.getAPI("/hostdb/active", &ah); err != nil {
+		t.Fatal(err)
+	}
+	if len(ah.Hosts) != 1 {
+		t.Fatalf("expected 1 host, got %v", len(ah.Hosts))
+	}
+
+	var sw HostdbScoreWeightsGET
+	if err = st.getAPI("/hostdb/scoreweights", &sw); err != nil {
+		t.Fatal(err)
+	}
+	if sw.Price != 1 || sw.Collateral != 1 || sw.Uptime != 1 || sw.Age != 1 || sw.Interactions != 0 {
+		t.Fatal("unexpected default score weights:", sw)
+	}
+
+	// Weights that are not provided keep their values.
+	values := url.Values{}
+	values.Set("price", "0")
+	values.Set("interactions", "2.5")
+	if err = st.stdPostAPI("/hostdb/scoreweights", values); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.getAPI("/hostdb/scoreweights", &sw); err != nil {
+		t.Fatal(err)
+	}
+	if sw.Price != 0 || sw.Interactions != 2.5 || sw.Collateral != 1 {
+		t.Fatal("score weights were not set:", sw)
+	}
+	var hh HostdbHostsGET
+	if err = st.getAPI("/hostdb/hosts/"+ah.Hosts[0].PublicKeyString, &hh); err != nil {
+		t.Fatal(err)
+	}
+	if hh.ScoreBreakdown.PriceAdjustment != 1 {
+		t.Error("price was not ignored:", hh.ScoreBreakdown.PriceAdjustment)
+	}
+
+	// Invalid weights are rejected.
+	for _, price := range []string{"-1", "11", "cheap"} {
+		values.Set("price", price)
+		if err = st.stdPostAPI("/hostdb/scoreweights", values); err == nil {
+			t.Fatalf("price weight %v was accepted", price)
+		}
+	}
+}
+
 // assembleHostHostname is assembleServerTester but you can specify which
 // hostname the host should use.
 func assembleHostPort(key crypto.TwofishKey, hostHostname string, testdir string) (*serverTester, error) {
@@ -4,7 +4,10 @@ package api
 // zeroing them out.
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"path/filepath"
 	"sort"
@@ -130,9 +133,29 @@ type (
 		Downloads []DownloadInfo `json:"downloads"`
 	}
 
-	// RenterFiles lists the files known to the renter.
+	// RenterFiles lists the files known to the renter. Total is the number
+	// of files that match the requested prefix, including those outside the
+	// requested page.
 	RenterFiles struct {
 		Files []modules.FileInfo `json:"files"`
+		Total int                `json:"total"`
+	}
+
+	// RenterBuckets lists the names of the renter's buckets.
+	RenterBuckets struct {
+		Buckets []string `json:"buckets"`
+	}
+
+	// RenterBucketKey contains the key of a newly created bucket.
+	RenterBucketKey struct {
+		Key string `json:"key"`
+	}
+
+	// RenterRename is one of the renames in the body of a POST call to
+	// /renter/renamebatch.
+	RenterRename struct {
+		SiaPath    string `json:"siapath"`
+		NewSiaPath string `json:"newsiapath"`
 	}
 
 	// RenterLoad lists files that were loaded into the renter.
@@ -146,6 +169,29 @@ type (
 		modules.RenterPriceEstimation
 	}
 
+	// RenterUploadProgress lists the data that is returned when a GET call is
+	// made to /renter/uploadprogress.
+	RenterUploadProgress struct {
+		modules.UploadProgress
+	}
+
+	// RenterMigrations lists the renter's recent migrations of pieces away
+	// from failing hosts.
+	RenterMigrations struct {
+		Migrations []modules.HostMigration `json:"migrations"`
+	}
+
+	// RenterVersions lists the previous versions of a file.
+	RenterVersions struct {
+		Versions []modules.FileVersion `json:"versions"`
+	}
+
+	// RenterVerify lists the results of challenging the hosts of a file to
+	// prove that they store its pieces.
+	RenterVerify struct {
+		Pieces []modules.PieceVerification `json:"pieces"`
+	}
+
 	// RenterShareASCII contains an ASCII-encoded .sia file.
 	RenterShareASCII struct {
 		ASCIIsia string `json:"asciisia"`
@@ -153,15 +199,70 @@ type (
 
 	// DownloadInfo contains all client-facing information of a file.
 	DownloadInfo struct {
+		ID          uint64    `json:"id"`
 		SiaPath     string    `json:"siapath"`
 		Destination string    `json:"destination"`
 		Filesize    uint64    `json:"filesize"`
 		Received    uint64    `json:"received"`
 		StartTime   time.Time `json:"starttime"`
 		Error       string    `json:"error"`
+		Priority    int       `json:"priority"`
+		State       string    `json:"state"`
 	}
 )
 
+// requireBucket is middleware for the renter's file endpoints. Requests that
+// authenticate using HTTP basic auth with the name of a bucket as their
+// username must use the bucket's key as their password, and only act on the
+// bucket's files. The bucket is passed to h as the "bucket" parameter. Other
+// requests require the API password, as with RequirePassword, and act on the
+// files in the default namespace.
+func (api *API) requireBucket(h httprouter.Handle, password string) httprouter.Handle {
+	withPassword := RequirePassword(h, password)
+	return func(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+		user, pass, ok := req.BasicAuth()
+		if !ok || user == "" {
+			withPassword(w, req, ps)
+			return
+		}
+		switch err := api.renter.AuthenticateBucket(user, pass); err {
+		case nil:
+			h(w, req, append(ps, httprouter.Param{Key: "bucket", Value: user}))
+		case renter.ErrUnknownBucket:
+			withPassword(w, req, ps)
+		default:
+			w.Header().Set("WWW-Authenticate", "Basic realm=\"SiaAPI\"")
+			WriteError(w, Error{"bucket authentication failed."}, http.StatusUnauthorized)
+		}
+	}
+}
+
+// renterBucketsHandler handles the API call to list the renter's buckets.
+func (api *API) renterBucketsHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	WriteJSON(w, RenterBuckets{
+		Buckets: api.renter.Buckets(),
+	})
+}
+
+// renterBucketCreateHandler handles the API call to create a bucket.
+func (api *API) renterBucketCreateHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	key, err := api.renter.CreateBucket(ps.ByName("bucket"))
+	if err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
+	WriteJSON(w, RenterBucketKey{Key: key})
+}
+
+// renterBucketDeleteHandler handles the API call to delete a bucket.
+func (api *API) renterBucketDeleteHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	if err := api.renter.DeleteBucket(ps.ByName("bucket")); err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
+	WriteSuccess(w)
+}
+
 // renterHandlerGET handles the API call to /renter.
 func (api *API) renterHandlerGET(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
 	settings := api.renter.Settings()
@@ -244,6 +345,65 @@ func (api *API) renterHandlerPOST(w http.ResponseWriter, req *http.Request, _ ht
 		renewWindow = period / 2
 	}
 
+	// Scan the bandwidth limits. (optional parameters)
+	settings := api.renter.Settings()
+	maxDownloadSpeed, maxUploadSpeed := settings.MaxDownloadSpeed, settings.MaxUploadSpeed
+	if req.FormValue("maxdownloadspeed") != "" {
+		_, err = fmt.Sscan(req.FormValue("maxdownloadspeed"), &maxDownloadSpeed)
+		if err != nil {
+			WriteError(w, Error{"unable to parse maxdownloadspeed: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+	}
+	if req.FormValue("maxuploadspeed") != "" {
+		_, err = fmt.Sscan(req.FormValue("maxuploadspeed"), &maxUploadSpeed)
+		if err != nil {
+			WriteError(w, Error{"unable to parse maxuploadspeed: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Scan the chunk cache size. (optional parameter)
+	cacheSize := settings.CacheSize
+	if req.FormValue("cachesize") != "" {
+		_, err = fmt.Sscan(req.FormValue("cachesize"), &cacheSize)
+		if err != nil {
+			WriteError(w, Error{"unable to parse cachesize: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Scan the worker limits. (optional parameters)
+	maxUploadWorkers, maxDownloadWorkers := settings.MaxUploadWorkers, settings.MaxDownloadWorkers
+	if req.FormValue("maxuploadworkers") != "" {
+		_, err = fmt.Sscan(req.FormValue("maxuploadworkers"), &maxUploadWorkers)
+		if err != nil {
+			WriteError(w, Error{"unable to parse maxuploadworkers: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+	}
+	if req.FormValue("maxdownloadworkers") != "" {
+		_, err = fmt.Sscan(req.FormValue("maxdownloadworkers"), &maxDownloadWorkers)
+		if err != nil {
+			WriteError(w, Error{"unable to parse maxdownloadworkers: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Scan the redundancy policy. (optional parameters)
+	policy, err := scanRedundancyPolicy(req, settings.Redundancy)
+	if err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	// Scan the repair schedule. (optional parameters)
+	schedule, err := scanRepairSchedule(req, settings.RepairSchedule)
+	if err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
+
 	// Set the settings in the renter.
 	err = api.renter.SetSettings(modules.RenterSettings{
 		Allowance: modules.Allowance{
@@ -252,6 +412,13 @@ func (api *API) renterHandlerPOST(w http.ResponseWriter, req *http.Request, _ ht
 			Period:      period,
 			RenewWindow: renewWindow,
 		},
+		MaxDownloadSpeed:   maxDownloadSpeed,
+		MaxUploadSpeed:     maxUploadSpeed,
+		CacheSize:          cacheSize,
+		MaxUploadWorkers:   maxUploadWorkers,
+		MaxDownloadWorkers: maxDownloadWorkers,
+		Redundancy:         policy,
+		RepairSchedule:     schedule,
 	})
 	if err != nil {
 		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
@@ -260,6 +427,52 @@ func (api *API) renterHandlerPOST(w http.ResponseWriter, req *http.Request, _ ht
 	WriteSuccess(w)
 }
 
+// scanRepairSchedule returns schedule with the repair schedule parameters of
+// req applied to it.
+func scanRepairSchedule(req *http.Request, schedule modules.RepairSchedule) (modules.RepairSchedule, error) {
+	if req.FormValue("repairstarthour") != "" {
+		if _, err := fmt.Sscan(req.FormValue("repairstarthour"), &schedule.StartHour); err != nil {
+			return modules.RepairSchedule{}, errors.New("unable to parse repairstarthour: " + err.Error())
+		}
+	}
+	if req.FormValue("repairendhour") != "" {
+		if _, err := fmt.Sscan(req.FormValue("repairendhour"), &schedule.EndHour); err != nil {
+			return modules.RepairSchedule{}, errors.New("unable to parse repairendhour: " + err.Error())
+		}
+	}
+	if req.FormValue("lowpriority") != "" {
+		lowPriority, err := scanBool(req.FormValue("lowpriority"))
+		if err != nil {
+			return modules.RepairSchedule{}, errors.New("unable to parse lowpriority: " + err.Error())
+		}
+		schedule.LowPriority = lowPriority
+	}
+	return schedule, nil
+}
+
+// scanRedundancyPolicy returns policy with the redundancy parameters of req
+// applied to it.
+func scanRedundancyPolicy(req *http.Request, policy modules.RedundancyPolicy) (modules.RedundancyPolicy, error) {
+	if req.FormValue("minredundancy") != "" {
+		if _, err := fmt.Sscan(req.FormValue("minredundancy"), &policy.MinRedundancy); err != nil {
+			return modules.RedundancyPolicy{}, errors.New("unable to parse minredundancy: " + err.Error())
+		}
+	}
+	if req.FormValue("targetredundancy") != "" {
+		if _, err := fmt.Sscan(req.FormValue("targetredundancy"), &policy.TargetRedundancy); err != nil {
+			return modules.RedundancyPolicy{}, errors.New("unable to parse targetredundancy: " + err.Error())
+		}
+	}
+	if req.FormValue("archival") != "" {
+		archival, err := scanBool(req.FormValue("archival"))
+		if err != nil {
+			return modules.RedundancyPolicy{}, errors.New("unable to parse archival: " + err.Error())
+		}
+		policy.Archival = archival
+	}
+	return policy, nil
+}
+
 // renterContractsHandler handles the API call to request the Renter's contracts.
 func (api *API) renterContractsHandler(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
 	contracts := []RenterContract{}
@@ -286,16 +499,22 @@ func (api *API) renterContractsHandler(w http.ResponseWriter, _ *http.Request, _
 }
 
 // renterDownloadsHandler handles the API call to request the download queue.
-func (api *API) renterDownloadsHandler(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+func (api *API) renterDownloadsHandler(w http.ResponseWriter, _ *http.Request, ps httprouter.Params) {
 	var downloads []DownloadInfo
 	for _, d := range api.renter.DownloadQueue() {
+		if d.Namespace != ps.ByName("bucket") {
+			continue
+		}
 		downloads = append(downloads, DownloadInfo{
+			ID:          d.ID,
 			SiaPath:     d.SiaPath,
 			Destination: d.Destination.Destination(),
 			Filesize:    d.Filesize,
 			StartTime:   d.StartTime,
 			Received:    d.Received,
 			Error:       d.Error,
+			Priority:    d.Priority,
+			State:       d.State,
 		})
 	}
 	// sort the downloads by newest first
@@ -305,6 +524,56 @@ func (api *API) renterDownloadsHandler(w http.ResponseWriter, _ *http.Request, _
 	})
 }
 
+// scanDownloadID parses the "id" parameter of ps, and checks that it is the id
+// of a download in the caller's bucket.
+func (api *API) scanDownloadID(ps httprouter.Params) (uint64, error) {
+	var id uint64
+	if _, err := fmt.Sscan(ps.ByName("id"), &id); err != nil {
+		return 0, errors.New("could not decode the download id: " + err.Error())
+	}
+	for _, d := range api.renter.DownloadQueue() {
+		if d.ID == id && d.Namespace == ps.ByName("bucket") {
+			return id, nil
+		}
+	}
+	return 0, errors.New("no download with that id")
+}
+
+// renterDownloadPriorityHandler handles the API call to change the priority of
+// a download in the download queue.
+func (api *API) renterDownloadPriorityHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	id, err := api.scanDownloadID(ps)
+	if err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
+	var priority int
+	if _, err := fmt.Sscan(req.FormValue("priority"), &priority); err != nil {
+		WriteError(w, Error{"could not decode the priority: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	if err := api.renter.SetDownloadPriority(id, priority); err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
+	WriteSuccess(w)
+}
+
+// renterDownloadCancelHandler handles the API call to cancel a download in the
+// download queue.
+func (api *API) renterDownloadCancelHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	id, err := api.scanDownloadID(ps)
+	if err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
+	if err := api.renter.CancelDownload(id); err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
+	WriteSuccess(w)
+}
+
 // renterLoadHandler handles the API call to load a '.sia' file.
 func (api *API) renterLoadHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
 	source := req.FormValue("source")
@@ -335,9 +604,28 @@ func (api *API) renterLoadAsciiHandler(w http.ResponseWriter, req *http.Request,
 }
 
 // renterRenameHandler handles the API call to rename a file entry in the
-// renter.
+// renter, or every file entry whose siapath starts with a prefix.
 func (api *API) renterRenameHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
-	err := api.renter.RenameFile(strings.TrimPrefix(ps.ByName("siapath"), "/"), req.FormValue("newsiapath"))
+	var prefix bool
+	if req.FormValue("prefix") != "" {
+		var err error
+		if prefix, err = scanBool(req.FormValue("prefix")); err != nil {
+			WriteError(w, Error{"unable to read parameter 'prefix': " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+	}
+
+	var err error
+	siapath := strings.TrimPrefix(ps.ByName("siapath"), "/")
+	bucket := ps.ByName("bucket")
+	if prefix && bucket != "" {
+		WriteError(w, Error{"prefix renames are not supported in buckets"}, http.StatusBadRequest)
+		return
+	} else if prefix {
+		_, err = api.renter.RenamePrefix(siapath, req.FormValue("newsiapath"))
+	} else {
+		err = api.renter.RenameNS(bucket, siapath, req.FormValue("newsiapath"))
+	}
 	if err != nil {
 		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
 		return
@@ -346,10 +634,80 @@ func (api *API) renterRenameHandler(w http.ResponseWriter, req *http.Request, ps
 	WriteSuccess(w)
 }
 
+// renterMetadataHandler handles the API call to update the metadata of a
+// file.
+func (api *API) renterMetadataHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	var metadata map[string]string
+	if err := json.Unmarshal([]byte(req.FormValue("metadata")), &metadata); err != nil {
+		WriteError(w, Error{"unable to read parameter 'metadata': " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	if err := api.renter.SetMetadata(strings.TrimPrefix(ps.ByName("siapath"), "/"), metadata); err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	WriteSuccess(w)
+}
+
+// renterRenameBatchHandler handles the API call to rename many file entries
+// in the renter at once.
+func (api *API) renterRenameBatchHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	var batch []RenterRename
+	if err := json.NewDecoder(req.Body).Decode(&batch); err != nil {
+		WriteError(w, Error{"could not decode renames: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	renames := make(map[string]string, len(batch))
+	for _, rename := range batch {
+		if _, exists := renames[rename.SiaPath]; exists {
+			WriteError(w, Error{"siapath listed more than once: " + rename.SiaPath}, http.StatusBadRequest)
+			return
+		}
+		renames[rename.SiaPath] = rename.NewSiaPath
+	}
+	if err := api.renter.RenameFiles(renames); err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	WriteSuccess(w)
+}
+
 // renterFilesHandler handles the API call to list all of the files.
-func (api *API) renterFilesHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+func (api *API) renterFilesHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	opts := modules.FileListOptions{
+		Namespace: ps.ByName("bucket"),
+		Prefix:    req.FormValue("prefix"),
+		SortBy:    req.FormValue("sortby"),
+	}
+	reverse, err := scanBool(req.FormValue("reverse"))
+	if err != nil {
+		WriteError(w, Error{"unable to parse reverse: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	opts.Reverse = reverse
+	if req.FormValue("offset") != "" {
+		if _, err := fmt.Sscan(req.FormValue("offset"), &opts.Offset); err != nil {
+			WriteError(w, Error{"unable to parse offset: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+	}
+	if req.FormValue("limit") != "" {
+		if _, err := fmt.Sscan(req.FormValue("limit"), &opts.Limit); err != nil {
+			WriteError(w, Error{"unable to parse limit: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+	}
+
+	files, total, err := api.renter.FileListPage(opts)
+	if err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
 	WriteJSON(w, RenterFiles{
-		Files: api.renter.FileList(),
+		Files: files,
+		Total: total,
 	})
 }
 
@@ -361,10 +719,93 @@ func (api *API) renterPricesHandler(w http.ResponseWriter, req *http.Request, _
 	})
 }
 
+// renterUploadProgressHandler handles the API call to report how much of a
+// file has been uploaded.
+func (api *API) renterUploadProgressHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	progress, err := api.renter.UploadProgress(strings.TrimPrefix(ps.ByName("siapath"), "/"))
+	if err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
+	WriteJSON(w, RenterUploadProgress{progress})
+}
+
+// renterVersionsHandler handles the API call to list the previous versions of
+// a file.
+func (api *API) renterVersionsHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	WriteJSON(w, RenterVersions{
+		Versions: api.renter.FileVersions(strings.TrimPrefix(ps.ByName("siapath"), "/")),
+	})
+}
+
+// renterPruneHandler handles the API call to delete the oldest previous
+// versions of a file.
+func (api *API) renterPruneHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	var keep int
+	if _, err := fmt.Sscan(req.FormValue("keep"), &keep); err != nil {
+		WriteError(w, Error{"could not decode the number of versions to keep: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	if err := api.renter.PruneVersions(strings.TrimPrefix(ps.ByName("siapath"), "/"), keep); err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
+	WriteSuccess(w)
+}
+
+// renterRepairFromDiskHandler handles the API call to set the local copy of a
+// file that the file is repaired from.
+func (api *API) renterRepairFromDiskHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	source := req.FormValue("source")
+	if !filepath.IsAbs(source) {
+		WriteError(w, Error{"source must be an absolute path"}, http.StatusBadRequest)
+		return
+	}
+	if err := api.renter.RepairFromDisk(strings.TrimPrefix(ps.ByName("siapath"), "/"), source); err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
+	WriteSuccess(w)
+}
+
+// renterMigrationsHandler handles the API call to list the renter's recent
+// migrations of pieces away from failing hosts.
+func (api *API) renterMigrationsHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	WriteJSON(w, RenterMigrations{
+		Migrations: api.renter.Migrations(),
+	})
+}
+
+// renterVerifyHandler handles the API call to verify that the hosts of a file
+// still store its pieces.
+func (api *API) renterVerifyHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	pieces, err := api.renter.VerifyFile(strings.TrimPrefix(ps.ByName("siapath"), "/"))
+	if err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
+	WriteJSON(w, RenterVerify{pieces})
+}
+
+// renterRedundancyHandler handles the API call to set the redundancy policy
+// of a file.
+func (api *API) renterRedundancyHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	policy, err := scanRedundancyPolicy(req, modules.RedundancyPolicy{})
+	if err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
+	if err := api.renter.SetRedundancyPolicy(strings.TrimPrefix(ps.ByName("siapath"), "/"), policy); err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
+	WriteSuccess(w)
+}
+
 // renterDeleteHandler handles the API call to delete a file entry from the
 // renter.
 func (api *API) renterDeleteHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
-	err := api.renter.DeleteFile(strings.TrimPrefix(ps.ByName("siapath"), "/"))
+	err := api.renter.DeleteNS(ps.ByName("bucket"), strings.TrimPrefix(ps.ByName("siapath"), "/"))
 	if err != nil {
 		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
 		return
@@ -381,6 +822,33 @@ func (api *API) renterDownloadHandler(w http.ResponseWriter, req *http.Request,
 		return
 	}
 
+	// Files in buckets can only be downloaded to the response, so that the
+	// holder of a bucket key cannot write to the local files of the renter.
+	if params.Namespace != "" && params.Httpwriter == nil {
+		WriteError(w, Error{"files in buckets must be downloaded with httpresp"}, http.StatusBadRequest)
+		return
+	}
+
+	// Range requests are served from a streamer, which only downloads the
+	// chunks that cover the requested bytes.
+	if params.Httpwriter != nil && req.Header.Get("Range") != "" {
+		if params.Offset != 0 || params.Length != 0 {
+			WriteError(w, Error{"offset and length cannot be combined with a Range header"}, http.StatusBadRequest)
+			return
+		}
+		if params.Version != 0 {
+			WriteError(w, Error{"previous versions cannot be downloaded with a Range header"}, http.StatusBadRequest)
+			return
+		}
+		streamer, err := api.renter.StreamerNS(params.Namespace, params.Siapath)
+		if err != nil {
+			WriteError(w, Error{"download failed: " + err.Error()}, http.StatusInternalServerError)
+			return
+		}
+		http.ServeContent(w, req, params.Siapath, time.Time{}, streamer)
+		return
+	}
+
 	if params.Async { // Create goroutine if `async` param set.
 		// check for errors for 5 seconds to catch validation errors (no file with
 		// that path, invalid parameters, insufficient hosts, etc)
@@ -413,6 +881,39 @@ func (api *API) renterDownloadHandler(w http.ResponseWriter, req *http.Request,
 	}
 }
 
+// renterStreamHandler handles the API call to stream a file, such as to a
+// media player. Range requests only download the chunks that cover the
+// requested bytes. The file's Content-Type is taken from its "mimetype"
+// metadata, or else from its extension or contents.
+func (api *API) renterStreamHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	siapath := strings.TrimPrefix(ps.ByName("siapath"), "/")
+	bucket := ps.ByName("bucket")
+	streamer, err := api.renter.StreamerNS(bucket, siapath)
+	if err != nil {
+		WriteError(w, Error{"stream failed: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	if fi, err := api.renter.FileInfoNS(bucket, siapath); err == nil && fi.Metadata["mimetype"] != "" {
+		w.Header().Set("Content-Type", fi.Metadata["mimetype"])
+	}
+	http.ServeContent(w, req, siapath, time.Time{}, streamer)
+}
+
+// streamAuthenticated reports whether req authenticates with the API password
+// or with the key of a bucket. Media players and browsers cannot set the
+// required user agent, so authenticated requests to /renter/stream are served
+// without it. Without an API password, only bucket keys are accepted.
+func (api *API) streamAuthenticated(req *http.Request, password string) bool {
+	user, pass, ok := req.BasicAuth()
+	if !ok {
+		return false
+	} else if user != "" && api.renter.AuthenticateBucket(user, pass) == nil {
+		return true
+	}
+	return password != "" && pass == password
+}
+
 // renterDownloadAsyncHandler handles the API call to download a file asynchronously.
 func (api *API) renterDownloadAsyncHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
 	req.ParseForm()
@@ -437,6 +938,12 @@ func parseDownloadParameters(w http.ResponseWriter, req *http.Request, ps httpro
 	// If httprespparam is present, this parameter is ignored.
 	asyncparam := req.FormValue("async")
 
+	// The priority of the download in the download queue.
+	priorityparam := req.FormValue("priority")
+
+	// The previous version of the file to download.
+	versionparam := req.FormValue("version")
+
 	// Parse the offset and length parameters.
 	var offset, length uint64
 	if len(offsetparam) > 0 {
@@ -452,6 +959,22 @@ func parseDownloadParameters(w http.ResponseWriter, req *http.Request, ps httpro
 		}
 	}
 
+	var priority int
+	if len(priorityparam) > 0 {
+		_, err := fmt.Sscan(priorityparam, &priority)
+		if err != nil {
+			return modules.RenterDownloadParameters{}, build.ExtendErr("could not decode the priority as int: ", err)
+		}
+	}
+
+	var version uint64
+	if len(versionparam) > 0 {
+		_, err := fmt.Sscan(versionparam, &version)
+		if err != nil {
+			return modules.RenterDownloadParameters{}, build.ExtendErr("could not decode the version as uint64: ", err)
+		}
+	}
+
 	// Parse the httpresp parameter.
 	httpresp, err := scanBool(httprespparam)
 	if err != nil {
@@ -471,7 +994,10 @@ func parseDownloadParameters(w http.ResponseWriter, req *http.Request, ps httpro
 		Async:       async,
 		Length:      length,
 		Offset:      offset,
+		Priority:    priority,
 		Siapath:     siapath,
+		Version:     version,
+		Namespace:   ps.ByName("bucket"),
 	}
 	if httpresp {
 		dp.Httpwriter = w
@@ -514,8 +1040,17 @@ func (api *API) renterShareAsciiHandler(w http.ResponseWriter, req *http.Request
 
 // renterUploadHandler handles the API call to upload a file.
 func (api *API) renterUploadHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	// Files in buckets are uploaded from the request body, so that the
+	// holder of a bucket key cannot upload the local files of the renter.
 	source := req.FormValue("source")
-	if !filepath.IsAbs(source) {
+	var data io.Reader
+	if ps.ByName("bucket") != "" {
+		if source != "" {
+			WriteError(w, Error{"files in buckets must be uploaded from the request body"}, http.StatusBadRequest)
+			return
+		}
+		data = req.Body
+	} else if !filepath.IsAbs(source) {
 		WriteError(w, Error{"source must be an absolute path"}, http.StatusBadRequest)
 		return
 	}
@@ -562,11 +1097,55 @@ func (api *API) renterUploadHandler(w http.ResponseWriter, req *http.Request, ps
 		}
 	}
 
+	// Check whether previous versions of the file should be kept.
+	var keepVersions int
+	if req.FormValue("keepversions") != "" {
+		if _, err := fmt.Sscan(req.FormValue("keepversions"), &keepVersions); err != nil {
+			WriteError(w, Error{"unable to read parameter 'keepversions': " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Check whether the file's chunks should be deduplicated.
+	var dedup bool
+	if req.FormValue("dedup") != "" {
+		var err error
+		if dedup, err = scanBool(req.FormValue("dedup")); err != nil {
+			WriteError(w, Error{"unable to read parameter 'dedup': " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Check whether the file should be compressed.
+	var compress bool
+	if req.FormValue("compress") != "" {
+		var err error
+		if compress, err = scanBool(req.FormValue("compress")); err != nil {
+			WriteError(w, Error{"unable to read parameter 'compress': " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Read the file's metadata, a JSON object of strings.
+	var metadata map[string]string
+	if req.FormValue("metadata") != "" {
+		if err := json.Unmarshal([]byte(req.FormValue("metadata")), &metadata); err != nil {
+			WriteError(w, Error{"unable to read parameter 'metadata': " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+	}
+
 	// Call the renter to upload the file.
 	err := api.renter.Upload(modules.FileUploadParams{
-		Source:      source,
-		SiaPath:     strings.TrimPrefix(ps.ByName("siapath"), "/"),
-		ErasureCode: ec,
+		Source:       source,
+		SiaPath:      strings.TrimPrefix(ps.ByName("siapath"), "/"),
+		ErasureCode:  ec,
+		KeepVersions: keepVersions,
+		Dedup:        dedup,
+		Compress:     compress,
+		Metadata:     metadata,
+		Namespace:    ps.ByName("bucket"),
+		Data:         data,
 	})
 	if err != nil {
 		WriteError(w, Error{"upload failed: " + err.Error()}, http.StatusInternalServerError)
@@ -2,10 +2,12 @@ package api
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
@@ -282,6 +284,853 @@ func TestValidDownloads(t *testing.T) {
 	}
 }
 
+// TestRenterDownloadRange checks that an httpresp download with a Range header
+// returns only the requested bytes.
+func TestRenterDownloadRange(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	sectorSize := int64(modules.SectorSize)
+	st, path := setupTestDownload(t, int(sectorSize*3), "test.dat", true)
+	defer func() {
+		st.server.panicClose()
+		os.Remove(path)
+	}()
+	original, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Request a range that spans the boundary between the first two chunks.
+	start, end := sectorSize-100, sectorSize+99
+	req, err := http.NewRequest("GET", "http://"+st.server.listener.Addr().String()+"/renter/download/test.dat?httpresp=true", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("User-Agent", "Sia-Agent")
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		t.Fatal("expected status 206, got", resp.Status)
+	}
+	downloaded, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(downloaded, original[start:end+1]) {
+		t.Fatal("downloaded range differs from the original content")
+	}
+}
+
+// TestRenterStream checks that /renter/stream serves files with their
+// Content-Type and Content-Length, that it serves Range requests, and that
+// requests without the Sia user agent are only served with a bucket key when
+// there is no API password.
+func TestRenterStream(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	st, path := setupTestDownload(t, 1e4, "test.dat", true)
+	defer func() {
+		st.server.panicClose()
+		os.Remove(path)
+	}()
+	original, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := st.stdPostAPI("/renter/metadata/test.dat", url.Values{"metadata": {`{"mimetype":"video/mp4"}`}}); err != nil {
+		t.Fatal(err)
+	}
+
+	stream := func(siapath, userAgent, rangeHeader string) *http.Response {
+		req, err := http.NewRequest("GET", "http://"+st.server.listener.Addr().String()+"/renter/stream/"+siapath, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("User-Agent", userAgent)
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	resp := stream("test.dat", "Sia-Agent", "")
+	contents, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal("expected status 200, got", resp.Status)
+	} else if resp.Header.Get("Content-Type") != "video/mp4" || resp.Header.Get("Content-Length") != "10000" || resp.Header.Get("Accept-Ranges") != "bytes" {
+		t.Fatal("wrong headers:", resp.Header)
+	} else if !bytes.Equal(contents, original) {
+		t.Fatal("streamed file differs from the original content")
+	}
+
+	resp = stream("test.dat", "Sia-Agent", "bytes=100-199")
+	contents, err = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		t.Fatal("expected status 206, got", resp.Status)
+	} else if !bytes.Equal(contents, original[100:200]) {
+		t.Fatal("streamed range differs from the original content")
+	}
+
+	// Without the user agent, requests are rejected unless they use a
+	// bucket's key.
+	resp = stream("test.dat", "VLC", "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatal("expected status 400 without the user agent, got", resp.Status)
+	}
+	var bk RenterBucketKey
+	if err := st.postAPI("/renter/buckets/media", url.Values{}, &bk); err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest("GET", "http://"+st.server.listener.Addr().String()+"/renter/stream/test.dat", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("User-Agent", "VLC")
+	req.SetBasicAuth("media", bk.Key)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if err := decodeError(resp); err == nil || !strings.Contains(err.Error(), renter.ErrUnknownPath.Error()) {
+		t.Fatal("expected the bucket's test.dat to be unknown, got", err)
+	}
+}
+
+// TestRenterDownloadPriority checks that downloads are listed with their
+// priority and state, that their priority can be changed, and that finished
+// downloads cannot be cancelled.
+func TestRenterDownloadPriority(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	st, path := setupTestDownload(t, 1e4, "test.dat", true)
+	defer func() {
+		st.server.panicClose()
+		os.Remove(path)
+	}()
+
+	downpath := filepath.Join(st.dir, "priority.dat")
+	if err := st.getAPI(fmt.Sprintf("/renter/download/test.dat?destination=%s&priority=5", downpath), nil); err != nil {
+		t.Fatal(err)
+	}
+	var queue RenterDownloadQueue
+	if err := st.getAPI("/renter/downloads", &queue); err != nil {
+		t.Fatal(err)
+	}
+	if len(queue.Downloads) != 1 {
+		t.Fatal("expected 1 download, got", len(queue.Downloads))
+	}
+	d := queue.Downloads[0]
+	if d.ID != 1 || d.Priority != 5 || d.State != modules.DownloadComplete {
+		t.Fatalf("unexpected download info: %+v", d)
+	}
+
+	// Change the priority of the download.
+	if err := st.stdPostAPI("/renter/downloads/1", url.Values{"priority": {"-1"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.getAPI("/renter/downloads", &queue); err != nil {
+		t.Fatal(err)
+	}
+	if queue.Downloads[0].Priority != -1 {
+		t.Fatal("priority was not changed:", queue.Downloads[0].Priority)
+	}
+	if err := st.stdPostAPI("/renter/downloads/2", url.Values{"priority": {"1"}}); err == nil {
+		t.Fatal("expected an error when changing the priority of an unknown download")
+	}
+	if err := st.stdPostAPI("/renter/downloads/1", url.Values{"priority": {"high"}}); err == nil {
+		t.Fatal("expected an error for an invalid priority")
+	}
+
+	// Finished and unknown downloads cannot be cancelled.
+	if err := st.stdPostAPI("/renter/downloads/1/cancel", nil); err == nil {
+		t.Fatal("expected an error when cancelling a finished download")
+	}
+	if err := st.stdPostAPI("/renter/downloads/2/cancel", nil); err == nil {
+		t.Fatal("expected an error when cancelling an unknown download")
+	}
+}
+
+// TestRenterUploadProgress checks that /renter/uploadprogress reports the
+// pieces of a file uploaded to the tester's only host.
+func TestRenterUploadProgress(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	st, path := setupTestDownload(t, 1e4, "test.dat", true)
+	defer func() {
+		st.server.panicClose()
+		os.Remove(path)
+	}()
+
+	var progress RenterUploadProgress
+	if err := st.getAPI("/renter/uploadprogress/test.dat", &progress); err != nil {
+		t.Fatal(err)
+	}
+	if progress.SiaPath != "test.dat" || progress.Chunks == 0 || len(progress.Hosts) != 1 {
+		t.Fatalf("unexpected upload progress: %+v", progress)
+	}
+	// The host stores one piece of each chunk, which is half of the
+	// erasure-coded data.
+	host := progress.Hosts[0]
+	if !host.Online || uint64(host.Pieces) != progress.Chunks || progress.BytesUploaded*2 != progress.BytesTotal {
+		t.Fatalf("unexpected upload progress: %+v", progress)
+	}
+	if err := st.getAPI("/renter/uploadprogress/dne.dat", &progress); err == nil {
+		t.Fatal("expected an error for an unknown file")
+	}
+}
+
+// TestRenterVerify checks that /renter/verify reports the pieces that the
+// host proves it stores as intact, and the pieces that it has lost as not.
+func TestRenterVerify(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	st, path := setupTestDownload(t, 1e4, "test.dat", true)
+	defer func() {
+		st.server.panicClose()
+		os.Remove(path)
+	}()
+
+	var rv RenterVerify
+	if err := st.getAPI("/renter/verify/test.dat", &rv); err != nil {
+		t.Fatal(err)
+	}
+	contracts := st.renter.Contracts()
+	if len(contracts) != 1 || len(rv.Pieces) != len(contracts[0].MerkleRoots) {
+		t.Fatalf("expected a verification for each of the host's sectors, got %v", rv.Pieces)
+	}
+	for _, v := range rv.Pieces {
+		if !v.Intact || v.Error != "" {
+			t.Fatalf("piece was not verified: %+v", v)
+		}
+	}
+
+	// Delete a sector from the host. Its piece can no longer be proven.
+	if err := st.host.DeleteSector(contracts[0].MerkleRoots[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.getAPI("/renter/verify/test.dat", &rv); err != nil {
+		t.Fatal(err)
+	}
+	lost := 0
+	for _, v := range rv.Pieces {
+		if !v.Intact {
+			lost++
+		}
+	}
+	if lost != 1 {
+		t.Fatalf("expected 1 piece to fail verification, got %v", rv.Pieces)
+	}
+
+	if err := st.getAPI("/renter/verify/dne.dat", &rv); err == nil {
+		t.Fatal("expected an error for an unknown file")
+	}
+}
+
+// TestRenterUploadDedup checks that a file uploaded with dedup set reuses the
+// pieces of an identical file instead of uploading new sectors, and that it
+// can be downloaded.
+func TestRenterUploadDedup(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	st, path := setupTestDownload(t, 1e4, "test.dat", true)
+	defer func() {
+		st.server.panicClose()
+		os.Remove(path)
+	}()
+
+	upload := func(siapath string) {
+		uploadValues := url.Values{}
+		uploadValues.Set("source", path)
+		uploadValues.Set("datapieces", "1")
+		uploadValues.Set("paritypieces", "1")
+		uploadValues.Set("dedup", "true")
+		if err := st.stdPostAPI("/renter/upload/"+siapath, uploadValues); err != nil {
+			t.Fatal(err)
+		}
+		err := retry(200, time.Second, func() error {
+			var rf RenterFiles
+			st.getAPI("/renter/files", &rf)
+			for _, f := range rf.Files {
+				if f.SiaPath == siapath && f.Available {
+					return nil
+				}
+			}
+			return errors.New(siapath + " is not available")
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	sectors := func() int {
+		contracts := st.renter.Contracts()
+		if len(contracts) != 1 {
+			t.Fatal("expected 1 contract, got", len(contracts))
+		}
+		return len(contracts[0].MerkleRoots)
+	}
+
+	// The first file is uploaded, since none of its chunks are in the chunk
+	// index. The second shares its pieces.
+	upload("a.dat")
+	uploaded := sectors()
+	upload("b.dat")
+	if n := sectors(); n != uploaded {
+		t.Fatalf("expected %v sectors after the duplicate upload, got %v", uploaded, n)
+	}
+
+	downpath := filepath.Join(st.dir, "b-download.dat")
+	if err := st.getAPI("/renter/download/b.dat?destination="+downpath, nil); err != nil {
+		t.Fatal(err)
+	}
+	orig, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	download, err := ioutil.ReadFile(downpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(orig, download) {
+		t.Fatal("deduplicated file does not match the original")
+	}
+}
+
+// TestRenterUploadCompressed checks that a file uploaded with compress set is
+// listed at its uncompressed size, and that whole and partial downloads return
+// its decompressed contents.
+func TestRenterUploadCompressed(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	st, path := setupTestDownload(t, 1e4, "test.dat", true)
+	defer func() {
+		st.server.panicClose()
+		os.Remove(path)
+	}()
+
+	// Upload a highly compressible file.
+	logpath := filepath.Join(st.dir, "test.log")
+	contents := bytes.Repeat([]byte("GET /renter/files 200\n"), 1e4)
+	if err := ioutil.WriteFile(logpath, contents, 0600); err != nil {
+		t.Fatal(err)
+	}
+	uploadValues := url.Values{}
+	uploadValues.Set("source", logpath)
+	uploadValues.Set("datapieces", "1")
+	uploadValues.Set("paritypieces", "1")
+	uploadValues.Set("compress", "true")
+	if err := st.stdPostAPI("/renter/upload/test.log", uploadValues); err != nil {
+		t.Fatal(err)
+	}
+	err := retry(200, time.Second, func() error {
+		var rf RenterFiles
+		st.getAPI("/renter/files", &rf)
+		for _, f := range rf.Files {
+			if f.SiaPath == "test.log" && f.Available {
+				if f.Filesize != uint64(len(contents)) || !f.Compressed {
+					t.Fatalf("expected a compressed file of size %v, got %+v", len(contents), f)
+				}
+				return nil
+			}
+		}
+		return errors.New("test.log is not available")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, section := range []struct{ offset, length int }{{0, len(contents)}, {1000, 5000}} {
+		downpath := filepath.Join(st.dir, "test-download.log")
+		dlURL := fmt.Sprintf("/renter/download/test.log?offset=%d&length=%d&destination=%s", section.offset, section.length, downpath)
+		if err := st.getAPI(dlURL, nil); err != nil {
+			t.Fatal(err)
+		}
+		download, err := ioutil.ReadFile(downpath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(download, contents[section.offset:section.offset+section.length]) {
+			t.Fatalf("downloaded section %+v does not match the original", section)
+		}
+		os.Remove(downpath)
+	}
+}
+
+// TestRenterHandlerMetadata checks that the metadata of files can be set
+// when they are uploaded and updated with /renter/metadata.
+func TestRenterHandlerMetadata(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	st, path := setupTestDownload(t, 1e4, "test.dat", false)
+	defer func() {
+		st.server.panicClose()
+		os.Remove(path)
+	}()
+
+	uploadValues := url.Values{}
+	uploadValues.Set("source", path)
+	uploadValues.Set("metadata", "not json")
+	if err := st.stdPostAPI("/renter/upload/b.dat", uploadValues); err == nil {
+		t.Fatal("upload with invalid metadata succeeded")
+	}
+	uploadValues.Set("metadata", `{"mimetype":"application/octet-stream","mtime":"1500000000"}`)
+	if err := st.stdPostAPI("/renter/upload/b.dat", uploadValues); err != nil {
+		t.Fatal(err)
+	}
+	metadataValues := url.Values{}
+	metadataValues.Set("metadata", `{"mtime":"","source":"/tmp/b.dat"}`)
+	if err := st.stdPostAPI("/renter/metadata/b.dat", metadataValues); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.stdPostAPI("/renter/metadata/dne", metadataValues); err == nil || err.Error() != renter.ErrUnknownPath.Error() {
+		t.Fatalf("expected error to be %v; got %v", renter.ErrUnknownPath, err)
+	}
+
+	var rf RenterFiles
+	if err := st.getAPI("/renter/files", &rf); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range rf.Files {
+		if f.SiaPath == "b.dat" {
+			if len(f.Metadata) != 2 || f.Metadata["mimetype"] != "application/octet-stream" || f.Metadata["source"] != "/tmp/b.dat" {
+				t.Fatal("wrong metadata:", f.Metadata)
+			}
+			return
+		}
+	}
+	t.Fatal("b.dat is not listed")
+}
+
+// TestRenterBuckets checks that files uploaded to a bucket can only be listed,
+// downloaded, renamed and deleted using the bucket's key.
+func TestRenterBuckets(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	st, path := setupTestDownload(t, 1e4, "test.dat", true)
+	defer func() {
+		st.server.panicClose()
+		os.Remove(path)
+	}()
+
+	var bk RenterBucketKey
+	if err := st.postAPI("/renter/buckets/app", url.Values{}, &bk); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.stdPostAPI("/renter/buckets/app", url.Values{}); err == nil {
+		t.Fatal("bucket was created twice")
+	}
+	var rb RenterBuckets
+	if err := st.getAPI("/renter/buckets", &rb); err != nil {
+		t.Fatal(err)
+	} else if len(rb.Buckets) != 1 || rb.Buckets[0] != "app" {
+		t.Fatal("expected the app bucket, got", rb.Buckets)
+	}
+
+	// Upload a file with the same siapath as the existing file to the bucket.
+	// Files in buckets can only be uploaded from the request body.
+	contents := fastrand.Bytes(1e4)
+	upload := "/renter/upload/test.dat?datapieces=1&paritypieces=1"
+	if err := st.bucketAPI("POST", "/renter/upload/test.dat", url.Values{"source": {path}}, "app", bk.Key, nil); err == nil {
+		t.Fatal("bucket upload from a local file succeeded")
+	}
+	if _, err := st.bucketBodyAPI("POST", upload, contents, "app", "wrong"); err == nil {
+		t.Fatal("upload with the wrong bucket key succeeded")
+	}
+	if _, err := st.bucketBodyAPI("POST", upload, contents, "app", bk.Key); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.bucketAPI("POST", "/renter/rename/test.dat", url.Values{"newsiapath": {"app.dat"}}, "app", bk.Key, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each listing only contains its own file.
+	var rf RenterFiles
+	if err := st.bucketAPI("GET", "/renter/files", url.Values{}, "app", bk.Key, &rf); err != nil {
+		t.Fatal(err)
+	} else if len(rf.Files) != 1 || rf.Files[0].SiaPath != "app.dat" {
+		t.Fatal("expected app.dat in the bucket, got", rf.Files)
+	}
+	if err := st.getAPI("/renter/files", &rf); err != nil {
+		t.Fatal(err)
+	} else if len(rf.Files) != 1 || rf.Files[0].SiaPath != "test.dat" {
+		t.Fatal("expected test.dat in the default namespace, got", rf.Files)
+	}
+
+	// Files in buckets can only be downloaded to the response, and their
+	// downloads are only listed in the bucket.
+	err := retry(200, time.Second, func() error {
+		if err := st.bucketAPI("GET", "/renter/files", url.Values{}, "app", bk.Key, &rf); err != nil {
+			return err
+		} else if !rf.Files[0].Available {
+			return errors.New("app.dat is not available")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	destination := filepath.Join(st.dir, "app.dat")
+	if _, err := st.bucketBodyAPI("GET", "/renter/download/app.dat?destination="+destination, nil, "app", bk.Key); err == nil {
+		t.Fatal("bucket download to a local file succeeded")
+	}
+	if downloaded, err := st.bucketBodyAPI("GET", "/renter/download/app.dat?httpresp=true", nil, "app", bk.Key); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(downloaded, contents) {
+		t.Fatal("downloaded file differs from the uploaded contents")
+	}
+	var queue RenterDownloadQueue
+	if err := st.bucketAPI("GET", "/renter/downloads", url.Values{}, "app", bk.Key, &queue); err != nil {
+		t.Fatal(err)
+	} else if len(queue.Downloads) != 1 || queue.Downloads[0].SiaPath != "app.dat" {
+		t.Fatal("expected the bucket's download, got", queue.Downloads)
+	}
+	id := queue.Downloads[0].ID
+	if err := st.getAPI("/renter/downloads", &queue); err != nil {
+		t.Fatal(err)
+	} else if len(queue.Downloads) != 0 {
+		t.Fatal("bucket's download was listed in the default namespace:", queue.Downloads)
+	}
+	if err := st.stdPostAPI(fmt.Sprintf("/renter/downloads/%v/cancel", id), url.Values{}); err == nil || !strings.Contains(err.Error(), "no download with that id") {
+		t.Fatal("expected the bucket's download to be unknown, got", err)
+	}
+
+	// The bucket's file cannot be downloaded or deleted without the key, and
+	// the bucket cannot be deleted while it has files.
+	if err := st.stdGetAPI("/renter/download/app.dat?httpresp=true"); err == nil {
+		t.Fatal("bucket's file was downloaded without the bucket's key")
+	}
+	if err := st.stdPostAPI("/renter/delete/app.dat", url.Values{}); err == nil {
+		t.Fatal("bucket's file was deleted without the bucket's key")
+	}
+	if err := st.stdPostAPI("/renter/buckets/app/delete", url.Values{}); err == nil {
+		t.Fatal("bucket with files was deleted")
+	}
+	if err := st.bucketAPI("POST", "/renter/delete/app.dat", url.Values{}, "app", bk.Key, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.stdPostAPI("/renter/buckets/app/delete", url.Values{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestRenterFileVersions checks that a file uploaded over an existing file
+// with keepversions set keeps the existing file as a previous version, which
+// can be listed, downloaded, and pruned.
+func TestRenterFileVersions(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	st, path := setupTestDownload(t, 1e4, "test.dat", true)
+	defer func() {
+		st.server.panicClose()
+		os.Remove(path)
+	}()
+	original, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Upload a new version of the file.
+	if err := createRandFile(path, 1e4); err != nil {
+		t.Fatal(err)
+	}
+	uploadValues := url.Values{}
+	uploadValues.Set("source", path)
+	if err := st.stdPostAPI("/renter/upload/test.dat", uploadValues); err == nil {
+		t.Fatal("expected an error when uploading over a file without keepversions")
+	}
+	uploadValues.Set("keepversions", "1")
+	if err := st.stdPostAPI("/renter/upload/test.dat", uploadValues); err != nil {
+		t.Fatal(err)
+	}
+
+	var versions RenterVersions
+	if err := st.getAPI("/renter/versions/test.dat", &versions); err != nil {
+		t.Fatal(err)
+	}
+	if len(versions.Versions) != 1 || versions.Versions[0].Version != 1 || versions.Versions[0].SiaPath != "test.dat" {
+		t.Fatalf("unexpected versions: %+v", versions.Versions)
+	}
+
+	// The previous version can be downloaded.
+	downpath := filepath.Join(st.dir, "version.dat")
+	if err := st.getAPI(fmt.Sprintf("/renter/download/test.dat?destination=%s&version=1", downpath), nil); err != nil {
+		t.Fatal(err)
+	}
+	downloaded, err := ioutil.ReadFile(downpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(downloaded, original) {
+		t.Fatal("downloaded version does not match the original file")
+	}
+
+	// Prune the previous version.
+	if err := st.stdPostAPI("/renter/prune/test.dat", url.Values{"keep": {"0"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.getAPI("/renter/versions/test.dat", &versions); err != nil {
+		t.Fatal(err)
+	}
+	if len(versions.Versions) != 0 {
+		t.Fatalf("versions were not pruned: %+v", versions.Versions)
+	}
+}
+
+// TestRenterChunkCache checks that files downloaded with the chunk cache
+// enabled are downloaded correctly, both before and after their chunks are
+// cached.
+func TestRenterChunkCache(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	st, path := setupTestDownload(t, 1e4, "test.dat", true)
+	defer func() {
+		st.server.panicClose()
+		os.Remove(path)
+	}()
+	original, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := st.stdPostAPI("/renter", url.Values{"funds": {testFunds}, "period": {"10"}, "cachesize": {"1000000"}}); err != nil {
+		t.Fatal(err)
+	}
+	var rg RenterGET
+	if err := st.getAPI("/renter", &rg); err != nil {
+		t.Fatal(err)
+	}
+	if rg.Settings.CacheSize != 1e6 {
+		t.Fatal("cache size was not set:", rg.Settings.CacheSize)
+	}
+
+	for i := 0; i < 2; i++ {
+		downpath := filepath.Join(st.dir, fmt.Sprintf("cached%d.dat", i))
+		if err := st.getAPI(fmt.Sprintf("/renter/download/test.dat?destination=%s", downpath), nil); err != nil {
+			t.Fatal(err)
+		}
+		downloaded, err := ioutil.ReadFile(downpath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(downloaded, original) {
+			t.Fatal("download", i, "does not match the original file")
+		}
+	}
+}
+
+// TestRenterWorkerLimits checks that the worker limits can be set using
+// /renter, and that files can be downloaded under the lowest limits.
+func TestRenterWorkerLimits(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	st, path := setupTestDownload(t, 1e4, "test.dat", true)
+	defer func() {
+		st.server.panicClose()
+		os.Remove(path)
+	}()
+	original, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := st.stdPostAPI("/renter", url.Values{"funds": {testFunds}, "period": {"10"}, "maxdownloadworkers": {"-1"}}); err == nil {
+		t.Fatal("expected an error for a negative worker limit")
+	}
+	if err := st.stdPostAPI("/renter", url.Values{"funds": {testFunds}, "period": {"10"}, "maxuploadworkers": {"1"}, "maxdownloadworkers": {"1"}}); err != nil {
+		t.Fatal(err)
+	}
+	var rg RenterGET
+	if err := st.getAPI("/renter", &rg); err != nil {
+		t.Fatal(err)
+	}
+	if rg.Settings.MaxUploadWorkers != 1 || rg.Settings.MaxDownloadWorkers != 1 {
+		t.Fatal("worker limits were not set:", rg.Settings.MaxUploadWorkers, rg.Settings.MaxDownloadWorkers)
+	}
+
+	downpath := filepath.Join(st.dir, "limited.dat")
+	if err := st.getAPI(fmt.Sprintf("/renter/download/test.dat?destination=%s", downpath), nil); err != nil {
+		t.Fatal(err)
+	}
+	downloaded, err := ioutil.ReadFile(downpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(downloaded, original) {
+		t.Fatal("download does not match the original file")
+	}
+}
+
+// TestRenterRepairFromDisk checks that /renter/repairfromdisk accepts the
+// file's original source, and rejects relative paths and other files.
+func TestRenterRepairFromDisk(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	st, path := setupTestDownload(t, 1e4, "test.dat", true)
+	defer func() {
+		st.server.panicClose()
+		os.Remove(path)
+	}()
+
+	if err := st.stdPostAPI("/renter/repairfromdisk/test.dat", url.Values{"source": {path}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.stdPostAPI("/renter/repairfromdisk/test.dat", url.Values{"source": {"test.dat"}}); err == nil {
+		t.Fatal("expected an error for a relative source")
+	}
+	other := filepath.Join(st.dir, "other.dat")
+	if err := createRandFile(other, 1e4); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.stdPostAPI("/renter/repairfromdisk/test.dat", url.Values{"source": {other}}); err == nil {
+		t.Fatal("expected an error for a source with different contents")
+	}
+}
+
+// TestRenterRedundancyPolicy checks that the redundancy policies of the renter
+// and of its files can be set.
+func TestRenterRedundancyPolicy(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	st, path := setupTestDownload(t, 1e4, "test.dat", true)
+	defer func() {
+		st.server.panicClose()
+		os.Remove(path)
+	}()
+
+	if err := st.stdPostAPI("/renter", url.Values{"funds": {testFunds}, "period": {"10"}, "targetredundancy": {"1.5"}, "archival": {"true"}}); err != nil {
+		t.Fatal(err)
+	}
+	var rg RenterGET
+	if err := st.getAPI("/renter", &rg); err != nil {
+		t.Fatal(err)
+	}
+	if exp := (modules.RedundancyPolicy{TargetRedundancy: 1.5, Archival: true}); rg.Settings.Redundancy != exp {
+		t.Fatalf("expected redundancy policy %+v, got %+v", exp, rg.Settings.Redundancy)
+	}
+
+	// The repair schedule is set without changing the redundancy policy.
+	if err := st.stdPostAPI("/renter", url.Values{"funds": {testFunds}, "period": {"10"}, "repairstarthour": {"24"}}); err == nil {
+		t.Fatal("expected an error for a repair start hour of 24")
+	}
+	if err := st.stdPostAPI("/renter", url.Values{"funds": {testFunds}, "period": {"10"}, "repairstarthour": {"22"}, "repairendhour": {"6"}, "lowpriority": {"true"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.getAPI("/renter", &rg); err != nil {
+		t.Fatal(err)
+	}
+	if exp := (modules.RepairSchedule{StartHour: 22, EndHour: 6, LowPriority: true}); rg.Settings.RepairSchedule != exp || !rg.Settings.Redundancy.Archival {
+		t.Fatalf("expected repair schedule %+v, got %+v", exp, rg.Settings)
+	}
+
+	if err := st.stdPostAPI("/renter/redundancy/test.dat", url.Values{"minredundancy": {"0.5"}}); err == nil {
+		t.Fatal("expected an error for a minimum redundancy below 1")
+	}
+	if err := st.stdPostAPI("/renter/redundancy/test.dat", url.Values{"minredundancy": {"1"}, "targetredundancy": {"2"}}); err != nil {
+		t.Fatal(err)
+	}
+	var rf RenterFiles
+	if err := st.getAPI("/renter/files", &rf); err != nil {
+		t.Fatal(err)
+	}
+	if exp := (modules.RedundancyPolicy{MinRedundancy: 1, TargetRedundancy: 2}); len(rf.Files) != 1 || rf.Files[0].RedundancyPolicy != exp {
+		t.Fatalf("expected the file's redundancy policy to be %+v, got %+v", exp, rf.Files)
+	}
+}
+
+// TestRenterFilesPage checks that the files listed by /renter/files can be
+// filtered, sorted and paged.
+func TestRenterFilesPage(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	st, path := setupTestDownload(t, 1e4, "test.dat", true)
+	defer func() {
+		st.server.panicClose()
+		os.Remove(path)
+	}()
+
+	var rf RenterFiles
+	if err := st.getAPI("/renter/files?sortby=health&limit=1", &rf); err != nil {
+		t.Fatal(err)
+	}
+	if len(rf.Files) != 1 || rf.Total != 1 || rf.Files[0].SiaPath != "test.dat" {
+		t.Fatalf("expected test.dat, got %v files of %v", rf.Files, rf.Total)
+	}
+	if err := st.getAPI("/renter/files?prefix=foo/", &rf); err != nil {
+		t.Fatal(err)
+	}
+	if len(rf.Files) != 0 || rf.Total != 0 {
+		t.Fatalf("expected no files, got %v files of %v", rf.Files, rf.Total)
+	}
+	if err := st.getAPI("/renter/files?sortby=age", &rf); err == nil {
+		t.Fatal("expected an error for an unknown sort order")
+	}
+	if err := st.getAPI("/renter/files?offset=-1", &rf); err == nil {
+		t.Fatal("expected an error for a negative offset")
+	}
+}
+
 func runDownloadParamTest(t *testing.T, length, offset, filesize int) error {
 	ulSiaPath := "test.dat"
 
@@ -834,8 +1683,9 @@ func TestRenterLoadNonexistent(t *testing.T) {
 	}
 }
 
-// TestRenterHandlerRename checks that valid /renter/rename calls are
-// successful, and that invalid calls fail with the appropriate error.
+// TestRenterHandlerRename checks that valid /renter/rename and
+// /renter/renamebatch calls are successful, and that invalid calls fail with
+// the appropriate error.
 func TestRenterHandlerRename(t *testing.T) {
 	if testing.Short() {
 		t.SkipNow()
@@ -929,6 +1779,38 @@ func TestRenterHandlerRename(t *testing.T) {
 	if err == nil || err.Error() != renter.ErrPathOverload.Error() {
 		t.Errorf("expected error to be %v; got %v", renter.ErrPathOverload, err)
 	}
+
+	// Rename both files with a batch, and then move them by their prefix.
+	renameBatch := func(batch []RenterRename) error {
+		body, err := json.Marshal(batch)
+		if err != nil {
+			return err
+		}
+		resp, err := HttpPOST("http://"+st.server.listener.Addr().String()+"/renter/renamebatch", string(body))
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if non2xx(resp.StatusCode) {
+			return decodeError(resp)
+		}
+		return nil
+	}
+	if err = renameBatch([]RenterRename{{"newtest1", "dir/a"}, {"newtest1", "dir/b"}}); err == nil {
+		t.Fatal("batch that renames a file twice was accepted")
+	}
+	if err = renameBatch([]RenterRename{{"newtest1", "dir/a"}, {"test2", "dir/b"}}); err != nil {
+		t.Fatal(err)
+	}
+	renameValues.Set("newsiapath", "moved/")
+	renameValues.Set("prefix", "true")
+	if err = st.stdPostAPI("/renter/rename/dir/", renameValues); err != nil {
+		t.Fatal(err)
+	}
+	st.getAPI("/renter/files", &rf)
+	if len(rf.Files) != 2 || !strings.HasPrefix(rf.Files[0].SiaPath, "moved/") || !strings.HasPrefix(rf.Files[1].SiaPath, "moved/") {
+		t.Fatal("files were not moved:", rf.Files)
+	}
 }
 
 // TestRenterHandlerDelete checks that deleting a valid file from the renter
@@ -1,10 +1,12 @@
 package api
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"net/url"
@@ -659,6 +661,53 @@ func (st *serverTester) stdGetAPIUA(call string, userAgent string) error {
 	return nil
 }
 
+// bucketAPI makes an API call authenticated with the name and key of a bucket,
+// and decodes the response into obj, unless obj is nil.
+func (st *serverTester) bucketAPI(method, call string, values url.Values, bucket, key string, obj interface{}) error {
+	req, err := http.NewRequest(method, "http://"+st.server.listener.Addr().String()+call, strings.NewReader(values.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "Sia-Agent")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(bucket, key)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if non2xx(resp.StatusCode) {
+		return decodeError(resp)
+	}
+	if obj == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(obj)
+}
+
+// bucketBodyAPI makes an API call authenticated with the name and key of a
+// bucket, with body as the raw request body, and returns the response body.
+func (st *serverTester) bucketBodyAPI(method, call string, body []byte, bucket, key string) ([]byte, error) {
+	req, err := http.NewRequest(method, "http://"+st.server.listener.Addr().String()+call, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "Sia-Agent")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.SetBasicAuth(bucket, key)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if non2xx(resp.StatusCode) {
+		return nil, decodeError(resp)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
 // stdPostAPI makes an API call and discards the response.
 func (st *serverTester) stdPostAPI(call string, values url.Values) error {
 	resp, err := HttpPOST("http://"+st.server.listener.Addr().String()+call, values.Encode())
@@ -152,6 +152,21 @@ var (
 		Testing:  time.Second * 90,
 	}).(time.Duration)
 
+	// segmentProofLimit is the number of sectors that the host will read to
+	// answer segment proof requests for a file contract in each
+	// segmentProofWindow. Segment proofs are not paid for, so the limit keeps
+	// a renter from making the host read its disk without end.
+	segmentProofLimit = build.Select(build.Var{
+		Dev:      256,
+		Standard: 256,
+		Testing:  64,
+	}).(int)
+	segmentProofWindow = build.Select(build.Var{
+		Dev:      time.Minute * 10,
+		Standard: time.Hour,
+		Testing:  time.Second * 10,
+	}).(time.Duration)
+
 	// defaultWindowSize is the size of the proof of storage window requested
 	// by the host. The host will not delete any obligations until the window
 	// has closed and buried under several confirmations. For release builds,
@@ -119,6 +119,7 @@ type Host struct {
 	atomicDownloadCalls       uint64
 	atomicErroredCalls        uint64
 	atomicFormContractCalls   uint64
+	atomicProveSegmentsCalls  uint64
 	atomicRenewCalls          uint64
 	atomicReviseCalls         uint64
 	atomicRecentRevisionCalls uint64
@@ -166,6 +167,10 @@ type Host struct {
 	// be locked separately.
 	lockedStorageObligations map[types.FileContractID]*siasync.TryMutex
 
+	// The number of sectors read to answer segment proof requests for each
+	// file contract in the current segment proof window.
+	segmentProofReads map[types.FileContractID]segmentProofReads
+
 	// Utilities.
 	db         *persist.BoltDatabase
 	listener   net.Listener
@@ -224,6 +229,7 @@ func newHost(dependencies dependencies, cs modules.ConsensusSet, tpool modules.T
 		dependencies: dependencies,
 
 		lockedStorageObligations: make(map[types.FileContractID]*siasync.TryMutex),
+		segmentProofReads:        make(map[types.FileContractID]segmentProofReads),
 
 		persistDir: persistDir,
 	}
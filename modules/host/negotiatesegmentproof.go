@@ -0,0 +1,141 @@
+package host
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+	"github.com/NebulousLabs/fastrand"
+)
+
+var (
+	// errTooManySegmentChallenges is returned if the renter challenges more
+	// segments than are allowed in a single segment proof request.
+	errTooManySegmentChallenges = errors.New("renter challenged too many segments")
+
+	// errSegmentProofLimit is returned if the renter has challenged more
+	// segments of a file contract than the host answers in a segment proof
+	// window.
+	errSegmentProofLimit = errors.New("renter has challenged too many segments of the contract recently")
+)
+
+// segmentProofReads counts the sectors that the host has read to answer
+// segment proof requests for a file contract since the start of a segment
+// proof window.
+type segmentProofReads struct {
+	windowStart time.Time
+	sectors     int
+}
+
+// managedReserveSegmentProofs reserves n sector reads from the segment proof
+// limit of a file contract, returning errSegmentProofLimit if the limit would
+// be exceeded. The counts of contracts whose windows have ended are dropped.
+func (h *Host) managedReserveSegmentProofs(fcid types.FileContractID, n int) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := time.Now()
+	for id, reads := range h.segmentProofReads {
+		if now.Sub(reads.windowStart) >= segmentProofWindow {
+			delete(h.segmentProofReads, id)
+		}
+	}
+	reads, exists := h.segmentProofReads[fcid]
+	if !exists {
+		reads.windowStart = now
+	}
+	if reads.sectors+n > segmentProofLimit {
+		return errSegmentProofLimit
+	}
+	reads.sectors += n
+	h.segmentProofReads[fcid] = reads
+	return nil
+}
+
+// managedRPCProveSegments answers the renter's challenges to prove that the
+// host stores segments of the sectors of a file contract. The renter proves
+// that it owns the contract in the same way as for RPCRecentRevision. Each
+// challenged segment is answered with a Merkle proof, or with an empty proof
+// if the contract does not have the sector or the host cannot read it. The
+// proofs are not paid for, so the number of segments that can be challenged
+// for each contract is limited by segmentProofLimit.
+func (h *Host) managedRPCProveSegments(conn net.Conn) error {
+	// Set the negotiation deadline.
+	conn.SetDeadline(time.Now().Add(modules.NegotiateSegmentProofTime))
+
+	// Receive the file contract id from the renter, and challenge the renter
+	// to prove that it owns the contract.
+	var fcid types.FileContractID
+	err := encoding.ReadObject(conn, &fcid, uint64(len(fcid)))
+	if err != nil {
+		return extendErr("could not read file contract id: ", ErrorConnection(err.Error()))
+	}
+	var challenge crypto.Hash
+	fastrand.Read(challenge[16:])
+	err = encoding.WriteObject(conn, challenge)
+	if err != nil {
+		return extendErr("cound not write challenge: ", ErrorConnection(err.Error()))
+	}
+	var challengeResponse crypto.Signature
+	err = encoding.ReadObject(conn, &challengeResponse, uint64(len(challengeResponse)))
+	if err != nil {
+		return extendErr("could not read challenge response: ", ErrorConnection(err.Error()))
+	}
+	so, _, _, err := h.managedVerifyChallengeResponse(fcid, challenge, challengeResponse)
+	if err != nil {
+		modules.WriteNegotiationRejection(conn, err) // Error not reported to preserve error type in extendErr.
+		return extendErr("challenge failed: ", err)
+	}
+	// The storage obligation is not modified, so it can be unlocked
+	// immediately.
+	h.managedUnlockStorageObligation(fcid)
+	err = modules.WriteNegotiationAcceptance(conn)
+	if err != nil {
+		return extendErr("failed to write challenge acceptance: ", ErrorConnection(err.Error()))
+	}
+
+	// Read the segment challenges.
+	var challenges []modules.SegmentChallenge
+	err = encoding.ReadObject(conn, &challenges, modules.NegotiateMaxSegmentChallengesSize)
+	if err != nil {
+		return extendErr("could not read segment challenges: ", ErrorConnection(err.Error()))
+	}
+	if len(challenges) > modules.NegotiateMaxSegmentChallenges {
+		modules.WriteNegotiationRejection(conn, errTooManySegmentChallenges)
+		return extendErr("bad segment challenges: ", ErrorCommunication(errTooManySegmentChallenges.Error()))
+	}
+	if err := h.managedReserveSegmentProofs(fcid, len(challenges)); err != nil {
+		modules.WriteNegotiationRejection(conn, err)
+		return extendErr("bad segment challenges: ", ErrorCommunication(err.Error()))
+	}
+
+	// Prove each challenged segment of the sectors in the contract.
+	sectors := make(map[crypto.Hash]struct{}, len(so.SectorRoots))
+	for _, root := range so.SectorRoots {
+		sectors[root] = struct{}{}
+	}
+	proofs := make([]modules.SegmentProof, len(challenges))
+	for i, c := range challenges {
+		if _, exists := sectors[c.MerkleRoot]; !exists || c.SegmentIndex >= modules.SectorSize/crypto.SegmentSize {
+			continue
+		}
+		sector, err := h.ReadSector(c.MerkleRoot)
+		if err != nil {
+			h.log.Debugln("could not read a challenged sector:", err)
+			continue
+		}
+		proofs[i].Base, proofs[i].HashSet = crypto.MerkleProof(sector, c.SegmentIndex)
+	}
+	err = modules.WriteNegotiationAcceptance(conn)
+	if err != nil {
+		return extendErr("failed to write challenge acceptance: ", ErrorConnection(err.Error()))
+	}
+	err = encoding.WriteObject(conn, proofs)
+	if err != nil {
+		return extendErr("failed to write segment proofs: ", ErrorConnection(err.Error()))
+	}
+	return nil
+}
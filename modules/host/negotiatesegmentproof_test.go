@@ -0,0 +1,37 @@
+package host
+
+import (
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestReserveSegmentProofs checks that the host limits the number of segments
+// that can be challenged for each file contract in a segment proof window.
+func TestReserveSegmentProofs(t *testing.T) {
+	h := &Host{segmentProofReads: make(map[types.FileContractID]segmentProofReads)}
+	if err := h.managedReserveSegmentProofs(types.FileContractID{1}, segmentProofLimit-1); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.managedReserveSegmentProofs(types.FileContractID{1}, 2); err != errSegmentProofLimit {
+		t.Fatal("expected errSegmentProofLimit, got", err)
+	}
+	if err := h.managedReserveSegmentProofs(types.FileContractID{1}, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// Other contracts have their own limits.
+	if err := h.managedReserveSegmentProofs(types.FileContractID{2}, segmentProofLimit); err != nil {
+		t.Fatal(err)
+	}
+
+	// The limit is reset once the window has ended.
+	h.segmentProofReads[types.FileContractID{1}] = segmentProofReads{
+		windowStart: time.Now().Add(-segmentProofWindow),
+		sectors:     segmentProofLimit,
+	}
+	if err := h.managedReserveSegmentProofs(types.FileContractID{1}, segmentProofLimit); err != nil {
+		t.Fatal(err)
+	}
+}
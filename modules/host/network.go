@@ -300,6 +300,9 @@ func (h *Host) threadedHandleConn(conn net.Conn) {
 			// the storage obligation that gets returned.
 			h.managedUnlockStorageObligation(so.id())
 		}
+	case modules.RPCProveSegments:
+		atomic.AddUint64(&h.atomicProveSegmentsCalls, 1)
+		err = extendErr("incoming RPCProveSegments failed: ", h.managedRPCProveSegments(conn))
 	case modules.RPCSettings:
 		atomic.AddUint64(&h.atomicSettingsCalls, 1)
 		err = extendErr("incoming RPCSettings failed: ", h.managedRPCSettings(conn))
@@ -356,12 +359,13 @@ func (h *Host) NetworkMetrics() modules.HostNetworkMetrics {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 	return modules.HostNetworkMetrics{
-		DownloadCalls:     atomic.LoadUint64(&h.atomicDownloadCalls),
-		ErrorCalls:        atomic.LoadUint64(&h.atomicErroredCalls),
-		FormContractCalls: atomic.LoadUint64(&h.atomicFormContractCalls),
-		RenewCalls:        atomic.LoadUint64(&h.atomicRenewCalls),
-		ReviseCalls:       atomic.LoadUint64(&h.atomicReviseCalls),
-		SettingsCalls:     atomic.LoadUint64(&h.atomicSettingsCalls),
-		UnrecognizedCalls: atomic.LoadUint64(&h.atomicUnrecognizedCalls),
+		DownloadCalls:      atomic.LoadUint64(&h.atomicDownloadCalls),
+		ErrorCalls:         atomic.LoadUint64(&h.atomicErroredCalls),
+		FormContractCalls:  atomic.LoadUint64(&h.atomicFormContractCalls),
+		ProveSegmentsCalls: atomic.LoadUint64(&h.atomicProveSegmentsCalls),
+		RenewCalls:         atomic.LoadUint64(&h.atomicRenewCalls),
+		ReviseCalls:        atomic.LoadUint64(&h.atomicReviseCalls),
+		SettingsCalls:      atomic.LoadUint64(&h.atomicSettingsCalls),
+		UnrecognizedCalls:  atomic.LoadUint64(&h.atomicUnrecognizedCalls),
 	}
 }
@@ -54,6 +54,12 @@ const (
 	// tree calculations that may be involved with renewing a file contract.
 	NegotiateRenewContractTime = 600 * time.Second
 
+	// NegotiateSegmentProofTime defines the amount of time that the renter
+	// and host have to complete a segment proof request. The host reads a
+	// full sector from disk for each challenged segment, so the time is set
+	// as high as for downloads.
+	NegotiateSegmentProofTime = 600 * time.Second
+
 	// NegotiateSettingsTime establishes the minimum amount of time that the
 	// connection deadline is expected to be set to when settings are being
 	// requested from the host. The deadline is long enough that the connection
@@ -66,6 +72,17 @@ const (
 	// data being requested.
 	NegotiateMaxDownloadActionRequestSize = 50e3
 
+	// NegotiateMaxSegmentChallenges is the maximum number of segments that
+	// the renter can challenge the host to prove in a single segment proof
+	// request.
+	NegotiateMaxSegmentChallenges = 32
+
+	// NegotiateMaxSegmentChallengesSize and NegotiateMaxSegmentProofsSize
+	// define the maximum sizes of the challenges and the proofs of a segment
+	// proof request when being sent over the wire.
+	NegotiateMaxSegmentChallengesSize = 2e3
+	NegotiateMaxSegmentProofsSize     = 50e3
+
 	// NegotiateMaxErrorSize indicates the maximum number of bytes that can be
 	// used to encode an error being sent during negotiation.
 	NegotiateMaxErrorSize = 256
@@ -160,6 +177,10 @@ var (
 	// contract revision for a given file contract.
 	RPCRecentRevision = types.Specifier{'R', 'e', 'c', 'e', 'n', 't', 'R', 'e', 'v', 'i', 's', 'i', 'o', 'n', 2}
 
+	// RPCProveSegments is the specifier for requesting Merkle proofs of
+	// segments of the sectors stored under a file contract.
+	RPCProveSegments = types.Specifier{'P', 'r', 'o', 'v', 'e', 'S', 'e', 'g', 'm', 'e', 'n', 't', 's', 2}
+
 	// RPCSettings is the specifier for requesting settings from the host.
 	RPCSettings = types.Specifier{'S', 'e', 't', 't', 'i', 'n', 'g', 's', 2}
 
@@ -276,6 +297,22 @@ type (
 		Offset      uint64
 		Data        []byte
 	}
+
+	// A SegmentChallenge asks the host to prove that it stores the segment
+	// with the given index of the sector with the given Merkle root.
+	SegmentChallenge struct {
+		MerkleRoot   crypto.Hash
+		SegmentIndex uint64
+	}
+
+	// A SegmentProof is the host's answer to a SegmentChallenge: the
+	// challenged segment, and the hashes needed to verify it against the
+	// sector's Merkle root. A host that does not have the sector answers with
+	// an empty proof.
+	SegmentProof struct {
+		Base    []byte
+		HashSet []crypto.Hash
+	}
 )
 
 // ReadNegotiationAcceptance reads an accept/reject response from r (usually a
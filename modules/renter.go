@@ -14,6 +14,24 @@ const (
 	// RenterDir is the name of the directory that is used to store the
 	// renter's persistent data.
 	RenterDir = "renter"
+
+	// DownloadQueued, DownloadActive, DownloadComplete and DownloadFailed are
+	// the states of a download. A download is queued until the renter starts
+	// fetching its data.
+	DownloadQueued   = "queued"
+	DownloadActive   = "active"
+	DownloadComplete = "complete"
+	DownloadFailed   = "failed"
+
+	// FileSortName, FileSortSize, FileSortExpiration and FileSortHealth are
+	// the orders in which FileListPage can return files. Files are sorted by
+	// SiaPath, Filesize, Expiration and Redundancy respectively, in
+	// ascending order, so sorting by health lists the least redundant files
+	// first.
+	FileSortName       = "name"
+	FileSortSize       = "size"
+	FileSortExpiration = "expiration"
+	FileSortHealth     = "health"
 )
 
 // An ErasureCoder is an error-correcting encoder and decoder.
@@ -50,12 +68,18 @@ type Allowance struct {
 // DownloadInfo provides information about a file that has been requested for
 // download.
 type DownloadInfo struct {
+	ID          uint64         `json:"id"`
 	SiaPath     string         `json:"siapath"`
 	Destination DownloadWriter `json:"destination"`
 	Filesize    uint64         `json:"filesize"`
 	Received    uint64         `json:"received"`
 	StartTime   time.Time      `json:"starttime"`
 	Error       string         `json:"error"`
+	Priority    int            `json:"priority"`
+	State       string         `json:"state"`
+
+	// Namespace is the namespace of the downloaded file.
+	Namespace string `json:"namespace"`
 }
 
 // DownloadWriter provides an interface which all output writers have to implement.
@@ -70,6 +94,43 @@ type FileUploadParams struct {
 	Source      string
 	SiaPath     string
 	ErasureCode ErasureCoder
+
+	// Namespace is the namespace of the uploaded file. Files in different
+	// namespaces may share a SiaPath. The empty string is the default
+	// namespace.
+	Namespace string
+
+	// KeepVersions is the number of previous versions of the file to retain.
+	// If it is nonzero, uploading to the SiaPath of an existing file in the
+	// default namespace turns the existing file into its latest previous
+	// version, and the oldest versions beyond KeepVersions are deleted.
+	KeepVersions int
+
+	// Dedup makes the renter reuse the pieces of chunks that were already
+	// uploaded with the same contents and erasure code, instead of uploading
+	// the chunks again.
+	Dedup bool
+
+	// Compress makes the renter compress the file before it is split into
+	// chunks, encrypted and erasure coded. Only the compressed data is stored
+	// on hosts, and it is decompressed when the file is downloaded.
+	Compress bool
+
+	// Metadata is the user metadata of the file, such as its MIME type or
+	// original modification time. It is not used by the renter.
+	Metadata map[string]string
+
+	// Data, if not nil, is read for the contents of the file instead of the
+	// file at Source. The renter keeps a copy of the contents in its persist
+	// directory, which the file is repaired from.
+	Data io.Reader
+}
+
+// FileVersion describes a previous version of a file. Versions are numbered
+// from 1 in the order they were created.
+type FileVersion struct {
+	Version uint64 `json:"version"`
+	FileInfo
 }
 
 // FileInfo provides information about a file.
@@ -81,6 +142,93 @@ type FileInfo struct {
 	Redundancy     float64           `json:"redundancy"`
 	UploadProgress float64           `json:"uploadprogress"`
 	Expiration     types.BlockHeight `json:"expiration"`
+	Pinned         bool              `json:"pinned"`
+	Sealed         bool              `json:"sealed"`
+	Compressed     bool              `json:"compressed"`
+
+	// Metadata is the user metadata of the file, which is not used by the
+	// renter.
+	Metadata map[string]string `json:"metadata"`
+
+	// RedundancyPolicy is the file's own redundancy policy. If it is the
+	// zero policy, the renter's policy applies.
+	RedundancyPolicy RedundancyPolicy `json:"redundancypolicy"`
+
+	// ActivePieces is the number of pieces stored in contracts that are
+	// online, and Hosts lists the hosts storing them. LastRepair is the last
+	// time that a chunk of the file was brought to full redundancy, or the
+	// zero time if none has been since the renter started.
+	ActivePieces int          `json:"activepieces"`
+	Hosts        []NetAddress `json:"hosts"`
+	LastRepair   time.Time    `json:"lastrepair"`
+
+	// Spending is an estimate of how much has been spent on the file.
+	Spending FileSpending `json:"spending"`
+}
+
+// FileSpending is an estimate of how much has been spent on a file, aggregated
+// from the contracts that store its pieces. Each contract contributes the
+// share of its spending and fees that matches the share of its sectors that
+// hold the file's pieces.
+type FileSpending struct {
+	StorageSpending types.Currency `json:"storagespending"`
+	UploadSpending  types.Currency `json:"uploadspending"`
+	ContractFees    types.Currency `json:"contractfees"`
+}
+
+// FileListOptions selects and orders the files returned by FileListPage. Only
+// the files whose SiaPath starts with Prefix are listed. They are sorted by
+// SortBy, which defaults to FileSortName, and Reverse reverses the order. The
+// first Offset files are skipped, and at most Limit files are returned, or
+// every remaining file if Limit is 0. Only the files in Namespace are listed,
+// and the empty string is the default namespace.
+type FileListOptions struct {
+	Namespace string
+
+	Prefix  string
+	SortBy  string
+	Reverse bool
+	Offset  int
+	Limit   int
+}
+
+// UploadProgress describes how much of a file has been uploaded. A chunk is
+// completed once all of its pieces have been uploaded.
+type UploadProgress struct {
+	SiaPath         string               `json:"siapath"`
+	BytesUploaded   uint64               `json:"bytesuploaded"`
+	BytesTotal      uint64               `json:"bytestotal"`
+	ChunksCompleted uint64               `json:"chunkscompleted"`
+	Chunks          uint64               `json:"chunks"`
+	Hosts           []HostUploadProgress `json:"hosts"`
+}
+
+// HostUploadProgress describes the pieces of a file that have been uploaded
+// to a host.
+type HostUploadProgress struct {
+	NetAddress NetAddress `json:"netaddress"`
+	Pieces     int        `json:"pieces"`
+	Online     bool       `json:"online"`
+}
+
+// A HostMigration records that the renter started to move the pieces stored on
+// a host to other hosts, because most of its interactions with the host
+// failed.
+type HostMigration struct {
+	NetAddress NetAddress `json:"netaddress"`
+	Pieces     int        `json:"pieces"`
+	Time       time.Time  `json:"time"`
+}
+
+// A PieceVerification reports whether the host storing a piece of a file
+// proved that it has the piece. Error explains why a piece was not proven
+// intact.
+type PieceVerification struct {
+	Chunk      uint64     `json:"chunk"`
+	Piece      uint64     `json:"piece"`
+	NetAddress NetAddress `json:"netaddress"`
+	Intact     bool       `json:"intact"`
+	Error      string     `json:"error"`
 }
 
 // A HostDBEntry represents one host entry in the Renter's host DB. It
@@ -103,8 +251,22 @@ type HostDBEntry struct {
 	RecentSuccessfulInteractions   uint64 `json:"recentSuccessfulInteractions"`
 	RecentFailedInteractions       uint64 `json:"recentFailedInteractions"`
 
+	// RecentSuccessfulWeight and RecentFailedWeight hold the fractional
+	// weight accumulated by the recent interactions. The integer counters
+	// above are kept at the rounded value of these weights, and only the
+	// integer counters are persisted.
+	RecentSuccessfulWeight float64 `json:"-"`
+	RecentFailedWeight     float64 `json:"-"`
+
 	LastHistoricUpdate types.BlockHeight
 
+	// ConsecutiveFailures is the number of failed interactions with the host
+	// since the last successful one. CooldownUntil is the height until which
+	// the host will not be selected, and grows exponentially with the number
+	// of consecutive failures.
+	ConsecutiveFailures uint64            `json:"consecutivefailures"`
+	CooldownUntil       types.BlockHeight `json:"cooldownuntil"`
+
 	// The public key of the host, stored separately to minimize risk of certain
 	// MitM based vulnerabilities.
 	PublicKey types.SiaPublicKey `json:"publickey"`
@@ -130,12 +292,24 @@ type HostScoreBreakdown struct {
 	AgeAdjustment              float64 `json:"ageadjustment"`
 	BurnAdjustment             float64 `json:"burnadjustment"`
 	CollateralAdjustment       float64 `json:"collateraladjustment"`
+	InteractionAdjustment      float64 `json:"interactionadjustment"`
 	PriceAdjustment            float64 `json:"pricesmultiplier"`
 	StorageRemainingAdjustment float64 `json:"storageremainingadjustment"`
 	UptimeAdjustment           float64 `json:"uptimeadjustment"`
 	VersionAdjustment          float64 `json:"versionadjustment"`
 }
 
+// HostScoreWeights are the exponents that the hostdb applies to the components
+// of a host's score. A weight of 1 uses a component as is, larger weights make
+// it count for more, and a weight of 0 ignores it.
+type HostScoreWeights struct {
+	Age          float64 `json:"age"`
+	Collateral   float64 `json:"collateral"`
+	Interactions float64 `json:"interactions"`
+	Price        float64 `json:"price"`
+	Uptime       float64 `json:"uptime"`
+}
+
 // RenterPriceEstimation contains a bunch of files estimating the costs of
 // various operations on the network.
 type RenterPriceEstimation struct {
@@ -156,6 +330,59 @@ type RenterPriceEstimation struct {
 // RenterSettings control the behavior of the Renter.
 type RenterSettings struct {
 	Allowance Allowance `json:"allowance"`
+
+	// MaxDownloadSpeed and MaxUploadSpeed limit the rate in bytes per second
+	// at which the renter transfers data from and to hosts, across all
+	// transfers. 0 means unlimited.
+	MaxDownloadSpeed int64 `json:"maxdownloadspeed"`
+	MaxUploadSpeed   int64 `json:"maxuploadspeed"`
+
+	// CacheSize is the maximum size in bytes of the cache of recently
+	// downloaded chunks on disk. 0 disables the cache.
+	CacheSize uint64 `json:"cachesize"`
+
+	// MaxUploadWorkers and MaxDownloadWorkers limit the number of pieces that
+	// the renter uploads and downloads at the same time, each from a
+	// different host. Every piece in transit is held in memory, so devices
+	// with little memory need lower limits. 0 selects the defaults.
+	MaxUploadWorkers   int `json:"maxuploadworkers"`
+	MaxDownloadWorkers int `json:"maxdownloadworkers"`
+
+	// Redundancy is the redundancy policy of the files that do not have
+	// their own.
+	Redundancy RedundancyPolicy `json:"redundancy"`
+
+	// RepairSchedule restricts when files are uploaded and repaired.
+	RepairSchedule RepairSchedule `json:"repairschedule"`
+}
+
+// A RepairSchedule restricts when the renter uploads and repairs files, for
+// connections that are metered or shared. Uploads and repairs only run from
+// StartHour until EndHour, in the renter's local time, and the window wraps
+// around midnight if EndHour is less than StartHour. They always run if the
+// hours are equal. In LowPriority mode, uploads and repairs also pause while
+// downloads are in progress. Downloads are never delayed by the schedule, and
+// pieces that are being uploaded when the renter pauses are finished.
+type RepairSchedule struct {
+	StartHour   int  `json:"starthour"`
+	EndHour     int  `json:"endhour"`
+	LowPriority bool `json:"lowpriority"`
+}
+
+// A RedundancyPolicy sets how far the renter repairs a file. A chunk is
+// repaired once its redundancy falls below MinRedundancy, and its missing
+// pieces are uploaded until its redundancy reaches TargetRedundancy. Both are
+// capped at the redundancy of the file's erasure code, and a value of 0 means
+// that cap, so the zero policy keeps every chunk at full redundancy. Nonzero
+// values must be at least 1.
+//
+// In Archival mode, pieces are only uploaded to the cheaper half of the
+// renter's hosts, ranked by storage price, so repairs are slower but cost
+// less.
+type RedundancyPolicy struct {
+	MinRedundancy    float64 `json:"minredundancy"`
+	TargetRedundancy float64 `json:"targetredundancy"`
+	Archival         bool    `json:"archival"`
 }
 
 // HostDBScans represents a sortable slice of scans.
@@ -258,19 +485,36 @@ type Renter interface {
 	// AllHosts returns the full list of hosts known to the renter.
 	AllHosts() []HostDBEntry
 
+	// AuthenticateBucket checks that key is the key of the named bucket.
+	AuthenticateBucket(name, key string) error
+
+	// Buckets returns the names of the renter's buckets.
+	Buckets() []string
+
 	// Close closes the Renter.
 	Close() error
 
 	// Contracts returns the contracts formed by the renter.
 	Contracts() []RenterContract
 
+	// CreateBucket creates a bucket, whose files are in the namespace with
+	// the bucket's name, and returns the key that the bucket is accessed
+	// with.
+	CreateBucket(name string) (string, error)
+
 	// CurrentPeriod returns the height at which the current allowance period
 	// began.
 	CurrentPeriod() types.BlockHeight
 
+	// DeleteBucket deletes an empty bucket.
+	DeleteBucket(name string) error
+
 	// DeleteFile deletes a file entry from the renter.
 	DeleteFile(path string) error
 
+	// DeleteNS deletes a file entry in a namespace from the renter.
+	DeleteNS(ns, path string) error
+
 	// Download performs a download according to the parameters passed, including
 	// downloads of `offset` and `length` type.
 	Download(params RenterDownloadParameters) error
@@ -278,9 +522,16 @@ type Renter interface {
 	// DownloadQueue lists all the files that have been scheduled for download.
 	DownloadQueue() []DownloadInfo
 
+	// FileInfoNS returns information on the file at path in a namespace.
+	FileInfoNS(ns, path string) (FileInfo, error)
+
 	// FileList returns information on all of the files stored by the renter.
 	FileList() []FileInfo
 
+	// FileListPage returns the files selected and ordered by opts, and the
+	// number of files that match opts.Prefix.
+	FileListPage(opts FileListOptions) ([]FileInfo, int, error)
+
 	// Host provides the DB entry and score breakdown for the requested host.
 	Host(pk types.SiaPublicKey) (HostDBEntry, bool)
 
@@ -299,6 +550,21 @@ type Renter interface {
 	// RenameFile changes the path of a file.
 	RenameFile(path, newPath string) error
 
+	// RenameNS changes the path of a file in a namespace.
+	RenameNS(ns, path, newPath string) error
+
+	// SetMetadata updates the user metadata of the file at path. Keys with
+	// empty values are removed.
+	SetMetadata(path string, metadata map[string]string) error
+
+	// RenameFiles changes the paths of many files at once. Either every
+	// file is renamed, or none are.
+	RenameFiles(renames map[string]string) error
+
+	// RenamePrefix replaces prefix in the paths of every file whose path
+	// starts with prefix, and returns the number of renamed files.
+	RenamePrefix(prefix, newPrefix string) (int, error)
+
 	// EstimateHostScore will return the score for a host with the provided
 	// settings, assuming perfect age and uptime adjustments
 	EstimateHostScore(entry HostDBEntry) HostScoreBreakdown
@@ -307,9 +573,24 @@ type Renter interface {
 	// hostdb's weighting algorithm.
 	ScoreBreakdown(entry HostDBEntry) HostScoreBreakdown
 
+	// HostScoreWeights returns the weights of the components of the hostdb's
+	// host scores.
+	HostScoreWeights() HostScoreWeights
+
+	// SetHostScoreWeights changes the weights of the components of the
+	// hostdb's host scores, and rescores every host.
+	SetHostScoreWeights(weights HostScoreWeights) error
+
 	// Settings returns the Renter's current settings.
 	Settings() RenterSettings
 
+	// SetDownloadPriority changes the priority of the download with the
+	// given ID. Downloads with a higher priority are fetched first.
+	SetDownloadPriority(id uint64, priority int) error
+
+	// CancelDownload cancels the download with the given ID.
+	CancelDownload(id uint64) error
+
 	// SetSettings sets the Renter's settings.
 	SetSettings(RenterSettings) error
 
@@ -319,8 +600,44 @@ type Renter interface {
 	// ShareFilesAscii creates an ASCII-encoded '.sia' file.
 	ShareFilesAscii(paths []string) (asciiSia string, err error)
 
+	// Streamer returns a reader for the file at path, which downloads the
+	// file's data from the hosts as it is read.
+	Streamer(path string) (io.ReadSeeker, error)
+
+	// StreamerNS returns a reader for the file at path in a namespace.
+	StreamerNS(ns, path string) (io.ReadSeeker, error)
+
 	// Upload uploads a file using the input parameters.
 	Upload(FileUploadParams) error
+
+	// UploadProgress reports how much of the file at path has been
+	// uploaded.
+	UploadProgress(path string) (UploadProgress, error)
+
+	// FileVersions returns the previous versions of the file at path, from
+	// oldest to newest.
+	FileVersions(path string) []FileVersion
+
+	// PruneVersions deletes the oldest previous versions of the file at path,
+	// so that at most keep versions remain.
+	PruneVersions(path string, keep int) error
+
+	// RepairFromDisk sets the local copy of the file at path, which must
+	// have the same contents as the uploaded file. The file's missing pieces
+	// are repaired from the copy.
+	RepairFromDisk(path, source string) error
+
+	// Migrations returns the most recent migrations of pieces away from
+	// failing hosts.
+	Migrations() []HostMigration
+
+	// SetRedundancyPolicy sets the redundancy policy of the file at path.
+	// The zero policy makes the file use the renter's policy.
+	SetRedundancyPolicy(path string, policy RedundancyPolicy) error
+
+	// VerifyFile challenges the hosts storing the pieces of the file at path
+	// to prove that they still have them, without downloading the file.
+	VerifyFile(path string) ([]PieceVerification, error)
 }
 
 // RenterDownloadParameters defines the parameters passed to the Renter's
@@ -330,6 +647,16 @@ type RenterDownloadParameters struct {
 	Httpwriter  io.Writer
 	Length      uint64
 	Offset      uint64
+	Priority    int
 	Siapath     string
 	Destination string
+
+	// Version is the previous version of the file to download. 0 downloads
+	// the current file.
+	Version uint64
+
+	// Namespace is the namespace of the file. The empty string is the
+	// default namespace. Previous versions can only be downloaded from the
+	// default namespace.
+	Namespace string
 }
@@ -0,0 +1,126 @@
+package renter
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/NebulousLabs/Sia/types"
+)
+
+const (
+	// AuditUnknownContract indicates that a piece is stored in a contract
+	// that the contractor does not know about.
+	AuditUnknownContract FileAuditIssueKind = "unknown contract"
+
+	// AuditPieceOutOfRange indicates that a piece refers to a chunk or piece
+	// index that does not exist for the file's size and erasure code.
+	AuditPieceOutOfRange FileAuditIssueKind = "piece out of range"
+
+	// AuditDuplicatePiece indicates that the same piece of the same chunk is
+	// referenced more than once by the file.
+	AuditDuplicatePiece FileAuditIssueKind = "duplicate piece"
+)
+
+type (
+	// FileAuditIssueKind describes the type of inconsistency found during a
+	// file audit.
+	FileAuditIssueKind string
+
+	// A FileAuditIssue describes a single inconsistency in the metadata of a
+	// file.
+	FileAuditIssue struct {
+		SiaPath    string               `json:"siapath"`
+		ContractID types.FileContractID `json:"contractid"`
+		Chunk      uint64               `json:"chunk"`
+		Piece      uint64               `json:"piece"`
+		Kind       FileAuditIssueKind   `json:"kind"`
+	}
+)
+
+// audit checks the file's pieces for inconsistencies. knownContract reports
+// whether a contract id is known to the contractor. The contracts are checked
+// in order of their ids, so that the same piece of a duplicate is always
+// reported, and the issues are sorted by chunk, piece, kind, then contract id.
+func (f *file) audit(knownContract func(types.FileContractID) bool) []FileAuditIssue {
+	contracts := make([]fileContract, 0, len(f.contracts))
+	for _, fc := range f.contracts {
+		contracts = append(contracts, fc)
+	}
+	sort.Slice(contracts, func(i, j int) bool {
+		return bytes.Compare(contracts[i].ID[:], contracts[j].ID[:]) < 0
+	})
+
+	var issues []FileAuditIssue
+	numChunks := f.numChunks()
+	numPieces := uint64(f.erasureCode.NumPieces())
+	seen := make(map[[2]uint64]struct{})
+	for _, fc := range contracts {
+		known := knownContract(fc.ID)
+		for _, p := range fc.Pieces {
+			issue := FileAuditIssue{
+				SiaPath:    f.name,
+				ContractID: fc.ID,
+				Chunk:      p.Chunk,
+				Piece:      p.Piece,
+			}
+			if !known {
+				issue.Kind = AuditUnknownContract
+				issues = append(issues, issue)
+			}
+			if p.Chunk >= numChunks || p.Piece >= numPieces {
+				issue.Kind = AuditPieceOutOfRange
+				issues = append(issues, issue)
+				continue
+			}
+			key := [2]uint64{p.Chunk, p.Piece}
+			if _, exists := seen[key]; exists {
+				issue.Kind = AuditDuplicatePiece
+				issues = append(issues, issue)
+				continue
+			}
+			seen[key] = struct{}{}
+		}
+	}
+	sort.Slice(issues, func(i, j int) bool {
+		if issues[i].Chunk != issues[j].Chunk {
+			return issues[i].Chunk < issues[j].Chunk
+		}
+		if issues[i].Piece != issues[j].Piece {
+			return issues[i].Piece < issues[j].Piece
+		}
+		if issues[i].Kind != issues[j].Kind {
+			return issues[i].Kind < issues[j].Kind
+		}
+		return bytes.Compare(issues[i].ContractID[:], issues[j].ContractID[:]) < 0
+	})
+	return issues
+}
+
+// AuditFiles checks the metadata of every file known to the renter for
+// inconsistencies, such as pieces stored in contracts that the contractor does
+// not know about, pieces that are out of range, and duplicate pieces. The
+// files are not modified.
+func (r *Renter) AuditFiles() []FileAuditIssue {
+	var files []*file
+	lockID := r.mu.RLock()
+	for _, f := range r.files {
+		files = append(files, f)
+	}
+	r.mu.RUnlock(lockID)
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].name < files[j].name
+	})
+
+	knownContract := func(id types.FileContractID) bool {
+		_, exists := r.hostContractor.ContractByID(r.hostContractor.ResolveID(id))
+		return exists
+	}
+
+	var issues []FileAuditIssue
+	for _, f := range files {
+		f.mu.RLock()
+		issues = append(issues, f.audit(knownContract)...)
+		f.mu.RUnlock()
+	}
+	return issues
+}
@@ -0,0 +1,126 @@
+package renter
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestFileAudit checks that the audit method of the file type reports each
+// kind of defect.
+func TestFileAudit(t *testing.T) {
+	rsc, _ := NewRSCode(1, 2)
+	f := &file{
+		name:        "audit",
+		size:        1000,
+		pieceSize:   100,
+		erasureCode: rsc,
+		contracts:   make(map[types.FileContractID]fileContract),
+	}
+	known := types.FileContractID{1}
+	unknown := types.FileContractID{2}
+	knownContract := func(id types.FileContractID) bool {
+		return id == known
+	}
+
+	// A consistent file should have no issues.
+	f.contracts[known] = fileContract{
+		ID:     known,
+		Pieces: []pieceData{{Chunk: 0, Piece: 0}, {Chunk: 1, Piece: 0}},
+	}
+	if issues := f.audit(knownContract); len(issues) != 0 {
+		t.Fatal("expected no issues, got", issues)
+	}
+
+	// Add a piece from an unknown contract.
+	f.contracts[unknown] = fileContract{
+		ID:     unknown,
+		Pieces: []pieceData{{Chunk: 2, Piece: 1}},
+	}
+	issues := f.audit(knownContract)
+	if len(issues) != 1 || issues[0].Kind != AuditUnknownContract || issues[0].ContractID != unknown || issues[0].SiaPath != "audit" {
+		t.Fatal("expected an unknown contract issue, got", issues)
+	}
+	delete(f.contracts, unknown)
+
+	// Add out of range pieces.
+	fc := f.contracts[known]
+	fc.Pieces = append(fc.Pieces, pieceData{Chunk: f.numChunks(), Piece: 0}, pieceData{Chunk: 3, Piece: 3})
+	f.contracts[known] = fc
+	issues = f.audit(knownContract)
+	if len(issues) != 2 || issues[0].Kind != AuditPieceOutOfRange || issues[1].Kind != AuditPieceOutOfRange {
+		t.Fatal("expected two out of range issues, got", issues)
+	}
+	if issues[0].Chunk != 3 || issues[0].Piece != 3 || issues[1].Chunk != f.numChunks() {
+		t.Error("issues were not sorted by chunk:", issues)
+	}
+	fc.Pieces = fc.Pieces[:2]
+	f.contracts[known] = fc
+
+	// Add a duplicate piece.
+	fc.Pieces = append(fc.Pieces, pieceData{Chunk: 1, Piece: 0})
+	f.contracts[known] = fc
+	issues = f.audit(knownContract)
+	if len(issues) != 1 || issues[0].Kind != AuditDuplicatePiece || issues[0].Chunk != 1 || issues[0].Piece != 0 {
+		t.Fatal("expected a duplicate piece issue, got", issues)
+	}
+	fc.Pieces = fc.Pieces[:2]
+	f.contracts[known] = fc
+
+	// The same piece stored in several contracts is always reported as a
+	// duplicate in the contracts after the first, sorted by contract id.
+	for i := byte(3); i < 10; i++ {
+		id := types.FileContractID{i}
+		f.contracts[id] = fileContract{ID: id, Pieces: []pieceData{{Chunk: 0, Piece: 0}}}
+	}
+	for i := 0; i < 10; i++ {
+		issues = f.audit(func(types.FileContractID) bool { return true })
+		if len(issues) != 7 {
+			t.Fatal("expected 7 duplicate piece issues, got", issues)
+		}
+		for j, issue := range issues {
+			if issue.Kind != AuditDuplicatePiece || issue.ContractID != (types.FileContractID{byte(j + 3)}) {
+				t.Fatal("issues were not sorted by contract id:", issues)
+			}
+		}
+	}
+}
+
+// TestRenterAuditFiles probes the AuditFiles method of the renter type.
+func TestRenterAuditFiles(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// An empty renter has no issues.
+	if issues := rt.renter.AuditFiles(); len(issues) != 0 {
+		t.Fatal("expected no issues, got", issues)
+	}
+
+	// The renter has no contracts, so every piece is in an unknown contract.
+	rsc, _ := NewRSCode(1, 1)
+	f := &file{
+		name:        "one",
+		size:        10,
+		pieceSize:   10,
+		erasureCode: rsc,
+		contracts: map[types.FileContractID]fileContract{
+			{1}: {ID: types.FileContractID{1}, Pieces: []pieceData{{Chunk: 0, Piece: 0}}},
+		},
+	}
+	id := rt.renter.mu.Lock()
+	rt.renter.files[f.name] = f
+	rt.renter.mu.Unlock(id)
+	issues := rt.renter.AuditFiles()
+	if len(issues) != 1 || issues[0].Kind != AuditUnknownContract || issues[0].SiaPath != "one" {
+		t.Fatal("expected an unknown contract issue, got", issues)
+	}
+	if len(f.contracts[types.FileContractID{1}].Pieces) != 1 {
+		t.Error("AuditFiles should not modify the file")
+	}
+}
@@ -0,0 +1,110 @@
+package renter
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+var errBadBackup = errors.New("backup could not be decrypted; it may have been made with a different seed")
+
+// backupKey derives the key that backups are encrypted with from the wallet
+// seed, so that a backup can be restored on any machine that has the seed.
+func backupKey(seed modules.Seed) crypto.TwofishKey {
+	return crypto.TwofishKey(crypto.HashAll(seed, "renter backup"))
+}
+
+// Backup writes the metadata of every file in the renter's default namespace
+// to w, encrypted with a key derived from the wallet seed. Together with the
+// seed, the backup is enough to recover the files using RestoreBackup, even if
+// the renter's directory is lost.
+func (r *Renter) Backup(w io.Writer, seed modules.Seed) error {
+	buf := new(bytes.Buffer)
+	if err := r.ExportRegistry(buf); err != nil {
+		return err
+	}
+	_, err := w.Write(backupKey(seed).EncryptBytes(buf.Bytes()))
+	return err
+}
+
+// RestoreBackup decrypts a backup written by Backup using the wallet seed,
+// and registers the files it contains in the renter. It returns the nicknames
+// of the restored files. If any of the nicknames are already in use,
+// ErrPathOverload is returned and no files are restored.
+//
+// The pieces of the restored files keep their original contracts, which are
+// found through the contractor even if they have since been renewed. Files
+// with pieces in contracts that the renter does not know are tracked for
+// repair, so that the repair loop moves them to the renter's current
+// contracts once enough of the file can be recovered.
+func (r *Renter) RestoreBackup(reader io.Reader, seed modules.Seed) ([]string, error) {
+	if err := r.addThread(); err != nil {
+		return nil, err
+	}
+	defer r.tg.Done()
+	ciphertext, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := backupKey(seed).DecryptBytes(ciphertext)
+	if err != nil {
+		return nil, errBadBackup
+	}
+	files, err := readSharedFiles(bytes.NewReader(plaintext))
+	if err != nil {
+		return nil, err
+	}
+
+	lockID := r.mu.Lock()
+	restored := make(map[string]struct{})
+	for _, f := range files {
+		if err := r.validateNickname(f.name); err != nil {
+			r.mu.Unlock(lockID)
+			return nil, err
+		}
+		if _, exists := restored[f.name]; exists {
+			r.mu.Unlock(lockID)
+			return nil, ErrPathOverload
+		} else if _, exists := r.files[f.name]; exists {
+			r.mu.Unlock(lockID)
+			return nil, ErrPathOverload
+		}
+		restored[f.name] = struct{}{}
+	}
+
+	names := make([]string, len(files))
+	var repairs []*file
+	for i, f := range files {
+		if err := r.saveFile(f); err != nil {
+			r.mu.Unlock(lockID)
+			return nil, err
+		}
+		r.files[f.name] = f
+		names[i] = f.name
+		for id := range f.contracts {
+			if _, exists := r.hostContractor.ContractByID(r.hostContractor.ResolveID(id)); !exists {
+				r.tracking[f.name] = trackedFile{}
+				repairs = append(repairs, f)
+				break
+			}
+		}
+	}
+	err = r.save()
+	r.mu.Unlock(lockID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range repairs {
+		select {
+		case r.newRepairs <- f:
+		case <-r.tg.StopChan():
+			return names, nil
+		}
+	}
+	return names, nil
+}
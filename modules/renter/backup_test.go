@@ -0,0 +1,128 @@
+package renter
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// listContractor is an onlineContractor that also lists its contracts.
+type listContractor struct {
+	onlineContractor
+}
+
+func (lc listContractor) Contracts() (cs []modules.RenterContract) {
+	for _, c := range lc.contracts {
+		cs = append(cs, c)
+	}
+	return cs
+}
+
+// renewContractor is a listContractor that resolves the IDs of renewed
+// contracts.
+type renewContractor struct {
+	listContractor
+	renewed map[types.FileContractID]types.FileContractID
+}
+
+func (rc renewContractor) ResolveID(id types.FileContractID) types.FileContractID {
+	if newID, ok := rc.renewed[id]; ok {
+		return newID
+	}
+	return id
+}
+
+// TestRenterBackup checks that files backed up by one renter can be restored
+// into another renter using the same seed, that their pieces keep their
+// original contracts, and that files with pieces in unknown contracts are
+// tracked for repair.
+func TestRenterBackup(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	f := newTestingFile()
+	f.name = "one"
+	f.contracts = map[types.FileContractID]fileContract{
+		{1}: {ID: types.FileContractID{1}, IP: "foo:1", Pieces: []pieceData{{0, 0, crypto.Hash{1}}}},
+		{3}: {ID: types.FileContractID{3}, IP: "bar:1", Pieces: []pieceData{{0, 1, crypto.Hash{3}}}},
+	}
+	id := rt.renter.mu.Lock()
+	rt.renter.files[f.name] = f
+	rt.renter.mu.Unlock(id)
+	g := newTestingFile()
+	g.name = "two"
+	g.contracts = map[types.FileContractID]fileContract{
+		{1}: {ID: types.FileContractID{1}, IP: "foo:1", Pieces: []pieceData{{0, 0, crypto.Hash{2}}}},
+	}
+	id = rt.renter.mu.Lock()
+	rt.renter.files[g.name] = g
+	rt.renter.mu.Unlock(id)
+
+	var seed modules.Seed
+	seed[0] = 1
+	buf := new(bytes.Buffer)
+	if err := rt.renter.Backup(buf, seed); err != nil {
+		t.Fatal(err)
+	}
+	backup := buf.Bytes()
+
+	// Restore the backup into a renter that has renewed the contract with one
+	// of the hosts.
+	hc := renewContractor{
+		listContractor: listContractor{onlineContractor{
+			contracts: map[types.FileContractID]modules.RenterContract{
+				{2}: {ID: types.FileContractID{2}, NetAddress: "foo:1", GoodForRenew: true},
+			},
+		}},
+		renewed: map[types.FileContractID]types.FileContractID{{1}: {2}},
+	}
+	rt2, err := newContractorTester(t.Name()+"2", closeHostDB{}, hc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt2.Close()
+
+	// The backup cannot be restored with a different seed.
+	if _, err := rt2.renter.RestoreBackup(bytes.NewReader(backup), modules.Seed{}); err != errBadBackup {
+		t.Fatal("expected errBadBackup, got", err)
+	}
+
+	names, err := rt2.renter.RestoreBackup(bytes.NewReader(backup), seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(names)
+	if !reflect.DeepEqual(names, []string{"one", "two"}) {
+		t.Fatal("wrong files restored:", names)
+	}
+	id = rt2.renter.mu.RLock()
+	restored := rt2.renter.files["one"]
+	_, oneTracked := rt2.renter.tracking["one"]
+	_, twoTracked := rt2.renter.tracking["two"]
+	rt2.renter.mu.RUnlock(id)
+	if restored.masterKey != f.masterKey || restored.checksum != f.checksum {
+		t.Fatal("restored file does not match the original")
+	}
+	if !reflect.DeepEqual(restored.contracts, f.contracts) {
+		t.Fatalf("expected contracts %v, got %v", f.contracts, restored.contracts)
+	}
+	if !oneTracked || twoTracked {
+		t.Fatal("only the file with pieces in an unknown contract should be tracked for repair")
+	}
+
+	// Restoring the backup again fails, because the file already exists.
+	if _, err := rt2.renter.RestoreBackup(bytes.NewReader(backup), seed); err != ErrPathOverload {
+		t.Fatal("expected ErrPathOverload, got", err)
+	}
+}
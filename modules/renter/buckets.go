@@ -0,0 +1,102 @@
+package renter
+
+import (
+	"encoding/hex"
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/fastrand"
+)
+
+var (
+	// ErrUnknownBucket is returned by AuthenticateBucket when no bucket has
+	// the given name.
+	ErrUnknownBucket = errors.New("no bucket with that name")
+
+	errBadBucketKey      = errors.New("wrong bucket key")
+	errBucketExists      = errors.New("a bucket with that name already exists")
+	errBucketNotEmpty    = errors.New("bucket still contains files")
+	errInvalidBucketName = errors.New("bucket names cannot be empty or contain colons")
+)
+
+// validateBucketName checks that name can be used as the name of a bucket.
+// Bucket names are sent as the username of HTTP basic auth, so they cannot
+// contain colons.
+func validateBucketName(name string) error {
+	if name == "" || strings.Contains(name, ":") {
+		return errInvalidBucketName
+	}
+	return validateNamespace(name)
+}
+
+// CreateBucket creates a bucket, which is a namespace that is accessed with
+// its own key, so that applications sharing the renter cannot see or modify
+// each other's files. The key is returned, and only its hash is saved.
+func (r *Renter) CreateBucket(name string) (string, error) {
+	if err := r.addThread(); err != nil {
+		return "", err
+	}
+	defer r.tg.Done()
+	if err := validateBucketName(name); err != nil {
+		return "", err
+	}
+	lockID := r.mu.Lock()
+	defer r.mu.Unlock(lockID)
+
+	if _, exists := r.buckets[name]; exists {
+		return "", errBucketExists
+	}
+	key := hex.EncodeToString(fastrand.Bytes(32))
+	r.buckets[name] = crypto.HashBytes([]byte(key))
+	return key, r.save()
+}
+
+// DeleteBucket deletes a bucket. Buckets can only be deleted once their files
+// have been deleted.
+func (r *Renter) DeleteBucket(name string) error {
+	if err := r.addThread(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	lockID := r.mu.Lock()
+	defer r.mu.Unlock(lockID)
+
+	if _, exists := r.buckets[name]; !exists {
+		return ErrUnknownBucket
+	}
+	for _, f := range r.files {
+		if f.namespace == name {
+			return errBucketNotEmpty
+		}
+	}
+	delete(r.buckets, name)
+	return r.save()
+}
+
+// Buckets returns the names of the renter's buckets, in sorted order.
+func (r *Renter) Buckets() []string {
+	lockID := r.mu.RLock()
+	defer r.mu.RUnlock(lockID)
+	names := make([]string, 0, len(r.buckets))
+	for name := range r.buckets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// AuthenticateBucket checks that key is the key of the bucket with the given
+// name. ErrUnknownBucket is returned if there is no such bucket.
+func (r *Renter) AuthenticateBucket(name, key string) error {
+	lockID := r.mu.RLock()
+	defer r.mu.RUnlock(lockID)
+	hash, exists := r.buckets[name]
+	if !exists {
+		return ErrUnknownBucket
+	} else if crypto.HashBytes([]byte(key)) != hash {
+		return errBadBucketKey
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package renter
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// TestRenterBuckets checks that buckets are authenticated with their keys,
+// that their files are listed separately, that only empty buckets can be
+// deleted, and that buckets are persisted.
+func TestRenterBuckets(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	for _, name := range []string{"", "a:b", "a/b", versionNamespace} {
+		if _, err := rt.renter.CreateBucket(name); err == nil {
+			t.Fatalf("bucket %q was created", name)
+		}
+	}
+	key, err := rt.renter.CreateBucket("app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rt.renter.CreateBucket("app"); err != errBucketExists {
+		t.Fatal("expected errBucketExists, got", err)
+	}
+	if err := rt.renter.AuthenticateBucket("app", key); err != nil {
+		t.Fatal(err)
+	} else if err := rt.renter.AuthenticateBucket("app", "wrong"); err != errBadBucketKey {
+		t.Fatal("expected errBadBucketKey, got", err)
+	} else if err := rt.renter.AuthenticateBucket("other", key); err != ErrUnknownBucket {
+		t.Fatal("expected ErrUnknownBucket, got", err)
+	}
+
+	// The bucket's files are only listed in the bucket.
+	f := newTestingFile()
+	f.namespace = "app"
+	id := rt.renter.mu.Lock()
+	rt.renter.files[f.key()] = f
+	rt.renter.mu.Unlock(id)
+	if files, _, err := rt.renter.FileListPage(modules.FileListOptions{Namespace: "app"}); err != nil {
+		t.Fatal(err)
+	} else if len(files) != 1 || files[0].SiaPath != f.name {
+		t.Fatal("expected the bucket's file, got", files)
+	}
+	if files, _, _ := rt.renter.FileListPage(modules.FileListOptions{}); len(files) != 0 {
+		t.Fatal("bucket's file was listed in the default namespace:", files)
+	}
+
+	// Buckets are persisted.
+	id = rt.renter.mu.Lock()
+	rt.renter.buckets = make(map[string]crypto.Hash)
+	err = rt.renter.load()
+	rt.renter.mu.Unlock(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buckets := rt.renter.Buckets(); len(buckets) != 1 || buckets[0] != "app" {
+		t.Fatal("buckets were not persisted:", buckets)
+	} else if err := rt.renter.AuthenticateBucket("app", key); err != nil {
+		t.Fatal(err)
+	}
+
+	// Buckets can only be deleted once they are empty.
+	if err := rt.renter.DeleteBucket("app"); err != errBucketNotEmpty {
+		t.Fatal("expected errBucketNotEmpty, got", err)
+	}
+	if err := rt.renter.DeleteNS("app", f.name); err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.renter.DeleteBucket("app"); err != nil {
+		t.Fatal(err)
+	} else if err := rt.renter.DeleteBucket("app"); err != ErrUnknownBucket {
+		t.Fatal("expected ErrUnknownBucket, got", err)
+	}
+}
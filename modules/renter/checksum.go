@@ -0,0 +1,53 @@
+package renter
+
+import (
+	"hash"
+
+	"github.com/NebulousLabs/Sia/crypto"
+)
+
+// A ChecksumVerifier incrementally computes the checksum of a file's contents
+// and compares it to the checksum recorded when the file was uploaded. It
+// allows a file to be verified while it is being downloaded, without holding
+// the whole file in memory.
+type ChecksumVerifier struct {
+	expected crypto.Hash
+	h        hash.Hash
+}
+
+// newChecksumVerifier returns a ChecksumVerifier for the contents of f.
+func (f *file) newChecksumVerifier() *ChecksumVerifier {
+	return &ChecksumVerifier{
+		expected: f.checksum,
+		h:        crypto.NewHash(),
+	}
+}
+
+// Write adds data to the running checksum. It never returns an error.
+func (cv *ChecksumVerifier) Write(data []byte) (int, error) {
+	return cv.h.Write(data)
+}
+
+// Verify reports whether the data written so far matches the file's
+// checksum. Files without a recorded checksum cannot be verified, and Verify
+// always returns false for them.
+func (cv *ChecksumVerifier) Verify() bool {
+	if cv.expected == (crypto.Hash{}) {
+		return false
+	}
+	var checksum crypto.Hash
+	copy(checksum[:], cv.h.Sum(nil))
+	return checksum == cv.expected
+}
+
+// NewChecksumVerifier returns a ChecksumVerifier for the file with the given
+// nickname.
+func (r *Renter) NewChecksumVerifier(nickname string) (*ChecksumVerifier, error) {
+	lockID := r.mu.RLock()
+	f, exists := r.files[nickname]
+	r.mu.RUnlock(lockID)
+	if !exists {
+		return nil, ErrUnknownPath
+	}
+	return f.newChecksumVerifier(), nil
+}
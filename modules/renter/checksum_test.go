@@ -0,0 +1,47 @@
+package renter
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/fastrand"
+)
+
+// TestChecksumVerifier checks that feeding data to a ChecksumVerifier in
+// multiple writes matches a single-shot checksum.
+func TestChecksumVerifier(t *testing.T) {
+	data := fastrand.Bytes(4096)
+	f := &file{checksum: crypto.HashBytes(data)}
+
+	// Feed the data in pieces of varying sizes.
+	cv := f.newChecksumVerifier()
+	for i, n := 0, 1; i < len(data); i, n = i+n, n*2 {
+		end := i + n
+		if end > len(data) {
+			end = len(data)
+		}
+		cv.Write(data[i:end])
+	}
+	if !cv.Verify() {
+		t.Fatal("verifier did not match the single-shot checksum")
+	}
+
+	// Additional data should cause verification to fail.
+	cv.Write([]byte{0})
+	if cv.Verify() {
+		t.Fatal("verifier matched after extra data was written")
+	}
+
+	// Different data should not match.
+	cv = f.newChecksumVerifier()
+	cv.Write(fastrand.Bytes(4096))
+	if cv.Verify() {
+		t.Fatal("verifier matched different data")
+	}
+
+	// A file without a checksum cannot be verified.
+	cv = (&file{}).newChecksumVerifier()
+	if cv.Verify() {
+		t.Fatal("verifier matched a file without a checksum")
+	}
+}
@@ -0,0 +1,177 @@
+package renter
+
+import (
+	"container/list"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/NebulousLabs/Sia/crypto"
+)
+
+// chunkCacheDir is the directory within the renter's persist directory that
+// holds the chunk cache.
+const chunkCacheDir = ".chunkcache"
+
+// A chunkCache is a least-recently-used cache of decoded chunks on disk, so
+// that chunks which are read repeatedly are only downloaded from hosts once.
+// Each chunk is stored in its own file, which is named by a hash of the file's
+// master key and the chunk's index, and encrypted with a key derived from
+// them, so the cache reveals nothing to someone who does not have the renter's
+// metadata.
+type chunkCache struct {
+	dir     string
+	maxSize uint64
+	size    uint64
+
+	// lru holds the cached chunks, most recently used first. entries maps
+	// the name of each cached chunk to its element in lru.
+	lru     *list.List
+	entries map[string]*list.Element
+
+	mu sync.Mutex
+}
+
+// A chunkCacheEntry is a chunk in the chunk cache. size is the size of its
+// encrypted file.
+type chunkCacheEntry struct {
+	name string
+	size uint64
+}
+
+// newChunkCache returns the chunk cache in dir. The cache is disabled until
+// its size is set using setMaxSize.
+func newChunkCache(dir string) *chunkCache {
+	return &chunkCache{
+		dir:     dir,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// chunkCacheName returns the name of the cached chunk with the given index of
+// the file with the given master key.
+func chunkCacheName(masterKey crypto.TwofishKey, chunkIndex uint64) string {
+	h := crypto.HashAll(masterKey, chunkIndex)
+	return hex.EncodeToString(h[:])
+}
+
+// chunkCacheKey returns the key that the cached chunk with the given index of
+// the file with the given master key is encrypted with.
+func chunkCacheKey(masterKey crypto.TwofishKey, chunkIndex uint64) crypto.TwofishKey {
+	return crypto.TwofishKey(crypto.HashAll(masterKey, chunkIndex, "chunk cache"))
+}
+
+// setMaxSize sets the maximum size in bytes of the cache, evicting the least
+// recently used chunks if the cache is larger. When the cache is first
+// enabled, the chunks left on disk by a previous run are added to the cache.
+// A size of 0 disables the cache and deletes its contents.
+func (c *chunkCache) setMaxSize(maxSize uint64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if maxSize == 0 {
+		c.maxSize, c.size = 0, 0
+		c.lru.Init()
+		c.entries = make(map[string]*list.Element)
+		return os.RemoveAll(c.dir)
+	}
+	if c.maxSize == 0 {
+		if err := os.MkdirAll(c.dir, 0700); err != nil {
+			return err
+		}
+		if err := c.loadEntries(); err != nil {
+			return err
+		}
+	}
+	c.maxSize = maxSize
+	c.evict()
+	return nil
+}
+
+// loadEntries adds the chunks on disk to the cache, using their modification
+// times to order them. The cache's lock must be held.
+func (c *chunkCache) loadEntries() error {
+	infos, err := ioutil.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ModTime().After(infos[j].ModTime())
+	})
+	for _, info := range infos {
+		if _, exists := c.entries[info.Name()]; exists || info.IsDir() || len(info.Name()) != 2*crypto.HashSize {
+			continue
+		}
+		c.entries[info.Name()] = c.lru.PushBack(chunkCacheEntry{info.Name(), uint64(info.Size())})
+		c.size += uint64(info.Size())
+	}
+	return nil
+}
+
+// evict deletes the least recently used chunks until the cache fits within
+// its maximum size. The cache's lock must be held.
+func (c *chunkCache) evict() {
+	for c.size > c.maxSize {
+		entry := c.lru.Remove(c.lru.Back()).(chunkCacheEntry)
+		delete(c.entries, entry.name)
+		c.size -= entry.size
+		os.Remove(filepath.Join(c.dir, entry.name))
+	}
+}
+
+// get returns the cached chunk with the given index of the file with the
+// given master key, if the chunk is in the cache.
+func (c *chunkCache) get(masterKey crypto.TwofishKey, chunkIndex uint64) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	name := chunkCacheName(masterKey, chunkIndex)
+	elem, exists := c.entries[name]
+	if !exists {
+		return nil, false
+	}
+
+	path := filepath.Join(c.dir, name)
+	ciphertext, err := ioutil.ReadFile(path)
+	if err == nil {
+		var chunk []byte
+		chunk, err = chunkCacheKey(masterKey, chunkIndex).DecryptBytes(ciphertext)
+		if err == nil {
+			c.lru.MoveToFront(elem)
+			now := time.Now()
+			os.Chtimes(path, now, now)
+			return chunk, true
+		}
+	}
+
+	// The chunk is missing or has been corrupted, so remove it from the
+	// cache.
+	c.lru.Remove(elem)
+	delete(c.entries, name)
+	c.size -= elem.Value.(chunkCacheEntry).size
+	os.Remove(path)
+	return nil, false
+}
+
+// add adds a decoded chunk with the given index of the file with the given
+// master key to the cache, evicting the least recently used chunks to make
+// room. Chunks that are larger than the cache are not added.
+func (c *chunkCache) add(masterKey crypto.TwofishKey, chunkIndex uint64, chunk []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	name := chunkCacheName(masterKey, chunkIndex)
+	ciphertext := chunkCacheKey(masterKey, chunkIndex).EncryptBytes(chunk)
+	if _, exists := c.entries[name]; exists || uint64(len(ciphertext)) > c.maxSize {
+		return nil
+	}
+	if err := ioutil.WriteFile(filepath.Join(c.dir, name), ciphertext, 0600); err != nil {
+		return err
+	}
+	c.entries[name] = c.lru.PushFront(chunkCacheEntry{name, uint64(len(ciphertext))})
+	c.size += uint64(len(ciphertext))
+	c.evict()
+	return nil
+}
@@ -0,0 +1,147 @@
+package renter
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/sync"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestChunkCache checks that the chunk cache returns the chunks added to it,
+// stores them encrypted, evicts the least recently used chunks, and reloads
+// its chunks from disk.
+func TestChunkCache(t *testing.T) {
+	dir := build.TempDir("renter", t.Name())
+	os.RemoveAll(dir)
+	defer os.RemoveAll(dir)
+	key := crypto.GenerateTwofishKey()
+	chunk := bytes.Repeat([]byte("chunk"), 20)
+	entrySize := uint64(len(chunkCacheKey(key, 0).EncryptBytes(chunk)))
+
+	// A disabled cache does not store chunks.
+	cc := newChunkCache(dir)
+	if err := cc.add(key, 0, chunk); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cc.get(key, 0); ok {
+		t.Fatal("disabled cache returned a chunk")
+	}
+
+	// Enable the cache with room for two chunks.
+	if err := cc.setMaxSize(2 * entrySize); err != nil {
+		t.Fatal(err)
+	}
+	for i := uint64(0); i < 2; i++ {
+		if err := cc.add(key, i, chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if cached, ok := cc.get(key, 0); !ok || !bytes.Equal(cached, chunk) {
+		t.Fatal("cache did not return chunk 0")
+	}
+	if _, ok := cc.get(crypto.GenerateTwofishKey(), 0); ok {
+		t.Fatal("cache returned a chunk of another file")
+	}
+	ciphertext, err := ioutil.ReadFile(filepath.Join(dir, chunkCacheName(key, 0)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(ciphertext, []byte("chunk")) {
+		t.Fatal("chunk is not encrypted on disk")
+	}
+
+	// Chunk 1 is now the least recently used, so it is evicted when chunk 2
+	// is added.
+	if err := cc.add(key, 2, chunk); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cc.get(key, 1); ok {
+		t.Fatal("least recently used chunk was not evicted")
+	}
+	if _, err := os.Stat(filepath.Join(dir, chunkCacheName(key, 1))); !os.IsNotExist(err) {
+		t.Fatal("evicted chunk was not deleted:", err)
+	}
+
+	// A new cache in the same directory finds the remaining chunks.
+	cc = newChunkCache(dir)
+	if err := cc.setMaxSize(2 * entrySize); err != nil {
+		t.Fatal(err)
+	}
+	for _, i := range []uint64{0, 2} {
+		if cached, ok := cc.get(key, i); !ok || !bytes.Equal(cached, chunk) {
+			t.Fatal("cache did not reload chunk", i)
+		}
+	}
+
+	// Corrupted chunks are dropped from the cache.
+	if err := ioutil.WriteFile(filepath.Join(dir, chunkCacheName(key, 0)), []byte("foo"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cc.get(key, 0); ok || cc.size != entrySize {
+		t.Fatal("corrupted chunk was not dropped")
+	}
+
+	// Disabling the cache deletes it.
+	if err := cc.setMaxSize(0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Fatal("cache directory was not deleted:", err)
+	}
+}
+
+// TestDownloadChunkCache checks that the download loop serves cached chunks
+// without fetching any pieces.
+func TestDownloadChunkCache(t *testing.T) {
+	dir := build.TempDir("renter", t.Name())
+	os.RemoveAll(dir)
+	defer os.RemoveAll(dir)
+
+	rsc, _ := NewRSCode(1, 1)
+	f := &file{
+		size:        5,
+		pieceSize:   5,
+		erasureCode: rsc,
+		masterKey:   crypto.GenerateTwofishKey(),
+	}
+	buf := new(bytes.Buffer)
+	d := newDownload(f, NewDownloadHttpWriter(buf, 0, 5))
+	d.length = 5
+	d.finishedChunks[0] = false
+	d.pieceSet = map[uint64]map[types.FileContractID]pieceData{0: {{1}: {}}}
+
+	r := &Renter{
+		mu:         sync.New(modules.SafeMutexDelay, 1),
+		tg:         new(sync.ThreadGroup),
+		workerPool: make(map[types.FileContractID]*worker),
+		chunkCache: newChunkCache(dir),
+	}
+	if err := r.chunkCache.setMaxSize(1 << 20); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.chunkCache.add(f.masterKey, 0, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	r.addDownloadToChunkQueue(d)
+
+	ds := &downloadState{activeWorkers: make(map[types.FileContractID]struct{})}
+	r.managedScheduleNewChunks(ds)
+	if len(ds.incompleteChunks) != 0 || ds.activePieces != 0 {
+		t.Fatal("pieces of a cached chunk were scheduled")
+	}
+	select {
+	case <-d.downloadFinished:
+	default:
+		t.Fatal("download did not complete")
+	}
+	if buf.String() != "hello" {
+		t.Fatalf("expected %q, got %q", "hello", buf.String())
+	}
+}
@@ -0,0 +1,146 @@
+package renter
+
+import (
+	"compress/flate"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// compressedDir is the directory within the renter's persist directory that
+// holds the compressed copies of compressed uploads. The repair loop reads
+// the chunks of compressed files from these copies.
+const compressedDir = ".compressed"
+
+var (
+	errCompressedRepair = errors.New("compressed files can only be repaired from their compressed copy")
+	errCompressedStream = errors.New("compressed files cannot be streamed")
+)
+
+// contentSize returns the size of the file's contents. Compressed files are
+// split into chunks at their compressed size, which is f.size.
+func (f *file) contentSize() uint64 {
+	if f.compressed {
+		return f.rawSize
+	}
+	return f.size
+}
+
+// compressedPath returns the path of the compressed copy of f.
+func (r *Renter) compressedPath(f *file) string {
+	return filepath.Join(r.persistDir, compressedDir, crypto.HashObject(f.masterKey).String())
+}
+
+// compressSource writes the compressed contents of the file at source to the
+// compressed copy of f, and sets the size of f to the compressed size. The
+// file is compressed as a single stream before it is split into chunks, so
+// that each chunk holds as much compressed data as possible.
+func (r *Renter) compressSource(f *file, source string) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	path := r.compressedPath(f)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	out, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	zw, _ := flate.NewWriter(out, flate.BestSpeed)
+	rawSize, err := io.Copy(zw, in)
+	if err == nil {
+		err = zw.Close()
+	}
+	var info os.FileInfo
+	if err == nil {
+		info, err = out.Stat()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return err
+	}
+	f.compressed = true
+	f.rawSize = uint64(rawSize)
+	f.size = uint64(info.Size())
+	return nil
+}
+
+// untrack stops tracking the file with the given key, and removes the
+// compressed copy or the copy of the reader that it was uploaded from, if
+// any. The renter's lock must be held.
+func (r *Renter) untrack(key string) {
+	if tf, tracked := r.tracking[key]; tracked {
+		dir := filepath.Dir(tf.RepairPath)
+		if dir == filepath.Join(r.persistDir, compressedDir) || dir == filepath.Join(r.persistDir, uploadsDir) {
+			os.Remove(tf.RepairPath)
+		}
+	}
+	delete(r.tracking, key)
+}
+
+// A decompressor is the DownloadWriter of a download of a compressed file. The
+// compressed stream is written to it in order, and it writes the requested
+// section of the decompressed contents to the download's destination. The
+// stream can only be decompressed in order, so the whole file is downloaded
+// even if only part of it is requested.
+type decompressor struct {
+	*DownloadHttpWriter
+	dest modules.DownloadWriter
+	pw   *io.PipeWriter
+	done chan error
+}
+
+// newDecompressor returns a decompressor for f that writes length bytes of its
+// contents, starting at offset, to dest.
+func newDecompressor(f *file, dest modules.DownloadWriter, offset, length uint64) *decompressor {
+	pr, pw := io.Pipe()
+	dc := &decompressor{
+		DownloadHttpWriter: NewDownloadHttpWriter(pw, 0, f.size),
+		dest:               dest,
+		pw:                 pw,
+		done:               make(chan error, 1),
+	}
+	go func() {
+		zr := flate.NewReader(pr)
+		_, err := io.CopyN(ioutil.Discard, zr, int64(offset))
+		buf := make([]byte, 1<<16)
+		for pos := offset; err == nil && pos < offset+length; {
+			n := uint64(len(buf))
+			if n > offset+length-pos {
+				n = offset + length - pos
+			}
+			if _, err = io.ReadFull(zr, buf[:n]); err == nil {
+				_, err = dest.WriteAt(buf[:n], int64(pos))
+			}
+			pos += n
+		}
+		// Drain the rest of the stream, so that the download is never
+		// blocked.
+		io.Copy(ioutil.Discard, pr)
+		dc.done <- err
+	}()
+	return dc
+}
+
+// Destination implements the DownloadWriter interface.
+func (dc *decompressor) Destination() string {
+	return dc.dest.Destination()
+}
+
+// close ends the compressed stream with the error of the download, and waits
+// for the decompression to finish. It returns the error of the decompression.
+func (dc *decompressor) close(err error) error {
+	dc.pw.CloseWithError(err)
+	return <-dc.done
+}
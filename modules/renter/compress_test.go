@@ -0,0 +1,93 @@
+package renter
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestRenterCompressSource checks that compressed copies can be decompressed
+// in sections, that compressed files are persisted, and that the compressed
+// copy is removed when the file is no longer tracked.
+func TestRenterCompressSource(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newContractorTester(t.Name(), closeHostDB{}, onlineContractor{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	contents := bytes.Repeat([]byte("compressible "), 1000)
+	source := filepath.Join(rt.renter.persistDir, "source")
+	if err := ioutil.WriteFile(source, contents, 0600); err != nil {
+		t.Fatal(err)
+	}
+	rsc, _ := NewRSCode(1, 1)
+	f := newFile("foo", rsc, pieceSize, uint64(len(contents)))
+	if err := rt.renter.compressSource(f, source); err != nil {
+		t.Fatal(err)
+	}
+	if !f.compressed || f.contentSize() != uint64(len(contents)) || f.size >= f.rawSize {
+		t.Fatalf("expected a compressed file of size %v, got %v compressed to %v", len(contents), f.rawSize, f.size)
+	}
+	compressed, err := ioutil.ReadFile(rt.renter.compressedPath(f))
+	if err != nil {
+		t.Fatal(err)
+	} else if uint64(len(compressed)) != f.size {
+		t.Fatal("compressed copy does not have the file's size")
+	}
+
+	// A section of the contents is written to the destination.
+	buf := new(bytes.Buffer)
+	dc := newDecompressor(f, NewDownloadHttpWriter(buf, 100, 50), 100, 50)
+	if _, err := dc.WriteAt(compressed, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := dc.close(nil); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(buf.Bytes(), contents[100:150]) {
+		t.Fatal("decompressed section does not match the contents")
+	}
+
+	// A truncated stream cannot be decompressed.
+	dc = newDecompressor(f, NewDownloadHttpWriter(new(bytes.Buffer), 0, f.rawSize), 0, f.rawSize)
+	dc.WriteAt(compressed[:len(compressed)/2], 0)
+	if err := dc.close(nil); err == nil {
+		t.Fatal("truncated stream was decompressed")
+	}
+
+	// Compressed files are written with the compressed version of the .sia
+	// format, and cannot be streamed.
+	shared := new(bytes.Buffer)
+	if err := shareFiles([]*file{f}, shared); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Contains(shared.Bytes(), []byte(shareVersionCompressed)) {
+		t.Fatal("compressed file was not written with", shareVersionCompressed)
+	}
+	files, err := readSharedFiles(shared)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := compareFiles(f, files[0]); err != nil {
+		t.Fatal(err)
+	}
+	id := rt.renter.mu.Lock()
+	rt.renter.files[f.name] = f
+	rt.renter.tracking[f.name] = trackedFile{RepairPath: rt.renter.compressedPath(f)}
+	rt.renter.mu.Unlock(id)
+	if _, err := rt.renter.Streamer(f.name); err != errCompressedStream {
+		t.Fatal("expected errCompressedStream, got", err)
+	}
+
+	// Deleting the file removes its compressed copy.
+	if err := rt.renter.DeleteFile(f.name); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(rt.renter.compressedPath(f)); !os.IsNotExist(err) {
+		t.Fatal("compressed copy was not removed:", err)
+	}
+}
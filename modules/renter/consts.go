@@ -6,6 +6,15 @@ import (
 	"github.com/NebulousLabs/Sia/build"
 )
 
+const (
+	// migrationFailureRatio is the fraction of a host's interactions that
+	// must have failed for the host to be considered failing.
+	migrationFailureRatio = 0.5
+
+	// maxMigrations is the number of migrations that the renter remembers.
+	maxMigrations = 100
+)
+
 var (
 	// Prime to avoid intersecting with regular events.
 	uploadFailureCooldown = build.Select(build.Var{
@@ -35,6 +44,54 @@ var (
 		Testing:  10 * time.Second,
 	}).(time.Duration)
 
+	// repairScheduleInterval is how often the repair loop checks whether it
+	// may upload again while it is paused by the repair schedule.
+	repairScheduleInterval = build.Select(build.Var{
+		Dev:      10 * time.Second,
+		Standard: time.Minute,
+		Testing:  100 * time.Millisecond,
+	}).(time.Duration)
+
+	// migrationInterval is how often the renter checks for failing hosts,
+	// whose pieces are migrated to other hosts.
+	migrationInterval = build.Select(build.Var{
+		Dev:      time.Minute,
+		Standard: time.Minute * 15,
+		Testing:  10 * time.Second,
+	}).(time.Duration)
+
+	// auditInterval is how often the renter audits the hosts that store its
+	// files, and auditPiecesPerHost is the number of pieces that each host is
+	// challenged to prove that it stores.
+	auditInterval = build.Select(build.Var{
+		Dev:      5 * time.Minute,
+		Standard: time.Hour,
+		Testing:  10 * time.Second,
+	}).(time.Duration)
+	auditPiecesPerHost = build.Select(build.Var{
+		Dev:      4,
+		Standard: 8,
+		Testing:  2,
+	}).(int)
+
+	// migrationMinInteractions is the number of interactions with a host
+	// that are needed before the host can be considered failing.
+	migrationMinInteractions = build.Select(build.Var{
+		Dev:      uint64(10),
+		Standard: uint64(50),
+		Testing:  uint64(5),
+	}).(uint64)
+
+	// maxPiecesPerHost is the maximum number of pieces of a single chunk that
+	// the renter will place on the same host. Storing multiple pieces of a
+	// chunk on one host means that a single host failure can remove multiple
+	// pieces at once.
+	maxPiecesPerHost = build.Select(build.Var{
+		Dev:      1,
+		Standard: 1,
+		Testing:  1,
+	}).(int)
+
 	// maxChunkCacheSize determines the maximum number of chunks that will be
 	// cached in memory.
 	maxChunkCacheSize = build.Select(build.Var{
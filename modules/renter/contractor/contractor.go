@@ -8,6 +8,7 @@ import (
 	"sync"
 
 	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/modules/renter/proto"
 	"github.com/NebulousLabs/Sia/persist"
 	siasync "github.com/NebulousLabs/Sia/sync"
 	"github.com/NebulousLabs/Sia/types"
@@ -46,6 +47,10 @@ type Contractor struct {
 	tpool   transactionPool
 	wallet  wallet
 
+	// rateLimit limits the bandwidth of the editors and downloaders of the
+	// contractor. It is shared with the renter that owns the contractor.
+	rateLimit *proto.RateLimit
+
 	// Only one thread should be performing contract maintenance at a time.
 	maintenanceLock siasync.TryMutex
 
@@ -156,8 +161,9 @@ func (c *Contractor) GoodForRenew(id types.FileContractID) bool {
 	return contract.GoodForRenew
 }
 
-// New returns a new Contractor.
-func New(cs consensusSet, wallet walletShim, tpool transactionPool, hdb hostDB, persistDir string) (*Contractor, error) {
+// New returns a new Contractor. The editors and downloaders of the Contractor
+// are limited by rl.
+func New(cs consensusSet, wallet walletShim, tpool transactionPool, hdb hostDB, rl *proto.RateLimit, persistDir string) (*Contractor, error) {
 	// Check for nil inputs.
 	if cs == nil {
 		return nil, errNilCS
@@ -181,11 +187,11 @@ func New(cs consensusSet, wallet walletShim, tpool transactionPool, hdb hostDB,
 	}
 
 	// Create Contractor using production dependencies.
-	return newContractor(cs, &walletBridge{w: wallet}, tpool, hdb, newPersist(persistDir), logger)
+	return newContractor(cs, &walletBridge{w: wallet}, tpool, hdb, rl, newPersist(persistDir), logger)
 }
 
 // newContractor creates a Contractor using the provided dependencies.
-func newContractor(cs consensusSet, w wallet, tp transactionPool, hdb hostDB, p persister, l *persist.Logger) (*Contractor, error) {
+func newContractor(cs consensusSet, w wallet, tp transactionPool, hdb hostDB, rl *proto.RateLimit, p persister, l *persist.Logger) (*Contractor, error) {
 	// Create the Contractor object.
 	c := &Contractor{
 		cs:      cs,
@@ -195,6 +201,8 @@ func newContractor(cs consensusSet, w wallet, tp transactionPool, hdb hostDB, p
 		tpool:   tp,
 		wallet:  w,
 
+		rateLimit: rl,
+
 		cachedRevisions: make(map[types.FileContractID]cachedRevision),
 		contracts:       make(map[types.FileContractID]modules.RenterContract),
 		downloaders:     make(map[types.FileContractID]*hostDownloader),
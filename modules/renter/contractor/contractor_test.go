@@ -49,31 +49,31 @@ func TestNew(t *testing.T) {
 	dir := build.TempDir("contractor", t.Name())
 
 	// Sane values.
-	_, err := New(stub, stub, stub, stub, dir)
+	_, err := New(stub, stub, stub, stub, nil, dir)
 	if err != nil {
 		t.Fatalf("expected nil, got %v", err)
 	}
 
 	// Nil consensus set.
-	_, err = New(nil, stub, stub, stub, dir)
+	_, err = New(nil, stub, stub, stub, nil, dir)
 	if err != errNilCS {
 		t.Fatalf("expected %v, got %v", errNilCS, err)
 	}
 
 	// Nil wallet.
-	_, err = New(stub, nil, stub, stub, dir)
+	_, err = New(stub, nil, stub, stub, nil, dir)
 	if err != errNilWallet {
 		t.Fatalf("expected %v, got %v", errNilWallet, err)
 	}
 
 	// Nil transaction pool.
-	_, err = New(stub, stub, nil, stub, dir)
+	_, err = New(stub, stub, nil, stub, nil, dir)
 	if err != errNilTpool {
 		t.Fatalf("expected %v, got %v", errNilTpool, err)
 	}
 
 	// Bad persistDir.
-	_, err = New(stub, stub, stub, stub, "")
+	_, err = New(stub, stub, stub, stub, nil, "")
 	if !os.IsNotExist(err) {
 		t.Fatalf("expected invalid directory, got %v", err)
 	}
@@ -122,7 +122,7 @@ func TestContract(t *testing.T) {
 func TestContracts(t *testing.T) {
 	var stub newStub
 	dir := build.TempDir("contractor", t.Name())
-	c, err := New(stub, stub, stub, stub, dir)
+	c, err := New(stub, stub, stub, stub, nil, dir)
 	if err != nil {
 		t.Fatalf("expected nil, got %v", err)
 	}
@@ -143,7 +143,10 @@ func (he *hostEditor) Delete(root crypto.Hash) (err error) {
 
 	he.contractor.mu.Lock()
 	he.contractor.contracts[contract.ID] = contract
-	he.contractor.saveSync()
+	he.contractor.persist.update(updateDeleteRevision{
+		NewRevisionTxn: contract.LastRevisionTxn,
+		NewMerkleRoots: contract.MerkleRoots,
+	})
 	he.contractor.mu.Unlock()
 	he.contract = contract
 
@@ -243,7 +246,7 @@ func (c *Contractor) Editor(id types.FileContractID, cancel <-chan struct{}) (_
 	}
 
 	// create editor
-	e, err := proto.NewEditor(host, contract, height, c.hdb, cancel)
+	e, err := proto.NewEditor(host, contract, height, c.hdb, c.rateLimit, cancel)
 	if proto.IsRevisionMismatch(err) {
 		// try again with the cached revision
 		c.mu.RLock()
@@ -257,7 +260,7 @@ func (c *Contractor) Editor(id types.FileContractID, cancel <-chan struct{}) (_
 		c.log.Printf("host %v has different revision for %v; retrying with cached revision", contract.NetAddress, contract.ID)
 		contract.LastRevision = cached.Revision
 		contract.MerkleRoots = cached.MerkleRoots
-		e, err = proto.NewEditor(host, contract, height, c.hdb, cancel)
+		e, err = proto.NewEditor(host, contract, height, c.hdb, c.rateLimit, cancel)
 		// needs to be handled separately since a revision mismatch is not automatically a failed interaction
 		if proto.IsRevisionMismatch(err) {
 			c.hdb.IncrementFailedInteractions(host.PublicKey)
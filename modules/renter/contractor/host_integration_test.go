@@ -99,7 +99,7 @@ func newTestingContractor(testdir string, g modules.Gateway, cs modules.Consensu
 	if err != nil {
 		return nil, err
 	}
-	return New(cs, w, tp, hdb, filepath.Join(testdir, "contractor"))
+	return New(cs, w, tp, hdb, nil, filepath.Join(testdir, "contractor"))
 }
 
 // newTestingTrio creates a Host, Contractor, and TestMiner that can be used
@@ -232,6 +232,10 @@ func (set updateSet) MarshalJSON() ([]byte, error) {
 			marshaledSet[i].Type = "cachedUploadRevision"
 		case updateCachedDownloadRevision:
 			marshaledSet[i].Type = "cachedDownloadRevision"
+		case updateDeleteRevision:
+			marshaledSet[i].Type = "deleteRevision"
+		case updateCachedDeleteRevision:
+			marshaledSet[i].Type = "cachedDeleteRevision"
 		}
 	}
 	return json.Marshal(marshaledSet)
@@ -266,6 +270,14 @@ func (set *updateSet) UnmarshalJSON(b []byte) error {
 			var cdr updateCachedDownloadRevision
 			err = json.Unmarshal(u.Data, &cdr)
 			*set = append(*set, cdr)
+		case "deleteRevision":
+			var dr updateDeleteRevision
+			err = json.Unmarshal(u.Data, &dr)
+			*set = append(*set, dr)
+		case "cachedDeleteRevision":
+			var cdr updateCachedDeleteRevision
+			err = json.Unmarshal(u.Data, &cdr)
+			*set = append(*set, cdr)
 		}
 		if err != nil {
 			return err
@@ -370,3 +382,42 @@ func (u updateCachedDownloadRevision) apply(data *contractorPersist) {
 	c.Revision = u.Revision
 	data.CachedRevisions[u.Revision.ParentID.String()] = c
 }
+
+// updateDeleteRevision is a journalUpdate that records the new data
+// associated with deleting sectors from a host.
+type updateDeleteRevision struct {
+	NewRevisionTxn types.Transaction `json:"newrevisiontxn"`
+	NewMerkleRoots []crypto.Hash     `json:"newmerkleroots"`
+}
+
+// apply sets the LastRevision, LastRevisionTxn, and MerkleRoots fields of the
+// contract being revised.
+func (u updateDeleteRevision) apply(data *contractorPersist) {
+	if len(u.NewRevisionTxn.FileContractRevisions) == 0 {
+		build.Critical("updateDeleteRevision is missing its FileContractRevision")
+		return
+	}
+	rev := u.NewRevisionTxn.FileContractRevisions[0]
+	c := data.Contracts[rev.ParentID.String()]
+	c.LastRevisionTxn = u.NewRevisionTxn
+	c.LastRevision = rev
+	c.MerkleRoots = u.NewMerkleRoots
+	data.Contracts[rev.ParentID.String()] = c
+}
+
+// updateCachedDeleteRevision is a journalUpdate that records the unsigned
+// revision sent to the host during a sector deletion, along with the Merkle
+// roots of the remaining sectors.
+type updateCachedDeleteRevision struct {
+	Revision    types.FileContractRevision `json:"revision"`
+	MerkleRoots []crypto.Hash              `json:"merkleroots"`
+}
+
+// apply sets the Revision and MerkleRoots fields of the cachedRevision
+// associated with the contract being revised.
+func (u updateCachedDeleteRevision) apply(data *contractorPersist) {
+	data.CachedRevisions[u.Revision.ParentID.String()] = cachedRevision{
+		Revision:    u.Revision,
+		MerkleRoots: u.MerkleRoots,
+	}
+}
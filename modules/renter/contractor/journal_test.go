@@ -91,6 +91,44 @@ func TestJournalCheckpoint(t *testing.T) {
 	}
 }
 
+// TestJournalDeleteRevision tests that the updates recorded when deleting
+// sectors are applied when the journal is reopened.
+func TestJournalDeleteRevision(t *testing.T) {
+	j, cleanup := tempJournal(t)
+	defer cleanup()
+
+	id := types.FileContractID{1}
+	rev := types.FileContractRevision{ParentID: id, NewRevisionNumber: 2}
+	us := updateSet{
+		updateCachedDeleteRevision{Revision: rev, MerkleRoots: []crypto.Hash{{2}}},
+		updateDeleteRevision{
+			NewRevisionTxn: types.Transaction{FileContractRevisions: []types.FileContractRevision{rev}},
+			NewMerkleRoots: []crypto.Hash{{2}},
+		},
+	}
+	if err := j.update(us); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var data contractorPersist
+	j2, err := openJournal(j.filename, &data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j2.Close()
+	cached := data.CachedRevisions[id.String()]
+	if cached.Revision.NewRevisionNumber != 2 || len(cached.MerkleRoots) != 1 || cached.MerkleRoots[0] != (crypto.Hash{2}) {
+		t.Fatal("cached delete revision was not applied:", cached)
+	}
+	c := data.Contracts[id.String()]
+	if c.LastRevision.NewRevisionNumber != 2 || len(c.MerkleRoots) != 1 || c.MerkleRoots[0] != (crypto.Hash{2}) {
+		t.Fatal("delete revision was not applied:", c)
+	}
+}
+
 func TestJournalMalformedJSON(t *testing.T) {
 	j, cleanup := tempJournal(t)
 	defer cleanup()
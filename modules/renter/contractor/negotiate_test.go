@@ -75,7 +75,7 @@ func newContractorTester(name string) (*contractorTester, error) {
 	if err != nil {
 		return nil, err
 	}
-	c, err := New(cs, w, tp, hdb, filepath.Join(testdir, modules.RenterDir))
+	c, err := New(cs, w, tp, hdb, nil, filepath.Join(testdir, modules.RenterDir))
 	if err != nil {
 		return nil, err
 	}
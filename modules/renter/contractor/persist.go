@@ -129,13 +129,95 @@ func (c *Contractor) saveSync() error {
 	return c.persist.save(c.persistData())
 }
 
+// A ContractExport contains a contractor's contracts, their cached revisions
+// and the renewal history that links them, so that they can be imported into
+// the contractor of another renter after the original is lost.
+type ContractExport struct {
+	Contracts       []modules.RenterContract  `json:"contracts"`
+	OldContracts    []modules.RenterContract  `json:"oldcontracts"`
+	CachedRevisions map[string]cachedRevision `json:"cachedrevisions"`
+	RenewedIDs      map[string]string         `json:"renewedids"`
+}
+
+// ExportContracts returns the contractor's current and expired contracts,
+// including their secret keys and latest revision transactions.
+func (c *Contractor) ExportContracts() ContractExport {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	data := c.persistData()
+	export := ContractExport{
+		CachedRevisions: data.CachedRevisions,
+		RenewedIDs:      data.RenewedIDs,
+	}
+	for _, contract := range c.contracts {
+		export.Contracts = append(export.Contracts, contract)
+	}
+	for id, contract := range c.oldContracts {
+		// COMPATv1.0.4-lts
+		// the special metrics contract is not a real contract
+		if id != metricsContractID {
+			export.OldContracts = append(export.OldContracts, contract)
+		}
+	}
+	return export
+}
+
+// ImportContracts adds the contracts of an export created by ExportContracts
+// to the contractor. Contracts that the contractor already knows about are
+// left unchanged, and contracts that have expired at the contractor's block
+// height are archived. It returns the number of contracts that were added.
+func (c *Contractor) ImportContracts(export ContractExport) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var added int
+	for _, contracts := range [][]modules.RenterContract{export.Contracts, export.OldContracts} {
+		for _, contract := range contracts {
+			if _, exists := c.contracts[contract.ID]; exists {
+				continue
+			} else if _, exists := c.oldContracts[contract.ID]; exists || contract.ID == metricsContractID {
+				continue
+			}
+			if c.blockHeight > contract.EndHeight() {
+				c.oldContracts[contract.ID] = contract
+			} else {
+				c.contracts[contract.ID] = contract
+				// The editor expects every revised contract to have a cached
+				// revision.
+				cached, ok := export.CachedRevisions[contract.ID.String()]
+				if !ok {
+					cached = cachedRevision{contract.LastRevision, contract.MerkleRoots}
+				}
+				c.cachedRevisions[contract.ID] = cached
+			}
+			added++
+		}
+	}
+	for oldString, newString := range export.RenewedIDs {
+		var oldHash, newHash crypto.Hash
+		if oldHash.LoadString(oldString) != nil || newHash.LoadString(newString) != nil {
+			continue
+		}
+		if _, exists := c.renewedIDs[types.FileContractID(oldHash)]; !exists {
+			c.renewedIDs[types.FileContractID(oldHash)] = types.FileContractID(newHash)
+		}
+	}
+	return added, c.saveSync()
+}
+
 // saveUploadRevision returns a function that saves an upload revision. It is
-// used by the Editor type to prevent desynchronizing with the host.
+// used by the Editor type to prevent desynchronizing with the host. Revisions
+// that delete sectors are saved along with all of the remaining roots.
 func (c *Contractor) saveUploadRevision(id types.FileContractID) func(types.FileContractRevision, []crypto.Hash) error {
 	return func(rev types.FileContractRevision, newRoots []crypto.Hash) error {
 		c.mu.Lock()
 		defer c.mu.Unlock()
 		c.cachedRevisions[id] = cachedRevision{rev, newRoots}
+		if len(newRoots) < len(c.contracts[id].MerkleRoots) {
+			return c.persist.update(updateCachedDeleteRevision{
+				Revision:    rev,
+				MerkleRoots: newRoots,
+			})
+		}
 		return c.persist.update(updateCachedUploadRevision{
 			Revision: rev,
 			// only the last root is new
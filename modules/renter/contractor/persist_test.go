@@ -228,3 +228,71 @@ func TestPubKeyScanner(t *testing.T) {
 		}
 	}
 }
+
+// TestExportImportContracts checks that contracts exported from one
+// contractor can be imported into another, and that expired and known
+// contracts are handled correctly.
+func TestExportImportContracts(t *testing.T) {
+	c := &Contractor{
+		persist: new(memPersist),
+		contracts: map[types.FileContractID]modules.RenterContract{
+			{1}: {ID: types.FileContractID{1}, LastRevision: types.FileContractRevision{NewWindowStart: 10}},
+			{2}: {ID: types.FileContractID{2}, LastRevision: types.FileContractRevision{NewWindowStart: 20}},
+		},
+		cachedRevisions: map[types.FileContractID]cachedRevision{
+			{1}: {Revision: types.FileContractRevision{ParentID: types.FileContractID{1}, NewRevisionNumber: 2}},
+		},
+		oldContracts: map[types.FileContractID]modules.RenterContract{
+			{0}:               {ID: types.FileContractID{0}},
+			metricsContractID: {ID: metricsContractID},
+		},
+		renewedIDs: map[types.FileContractID]types.FileContractID{
+			{0}: {1},
+		},
+	}
+	export := c.ExportContracts()
+	if len(export.Contracts) != 2 || len(export.OldContracts) != 1 {
+		t.Fatalf("expected 2 contracts and 1 old contract, got %v and %v", len(export.Contracts), len(export.OldContracts))
+	}
+
+	// Import the contracts into a contractor that already knows one of them,
+	// and whose block height is past the end of another.
+	c2 := &Contractor{
+		persist:     new(memPersist),
+		blockHeight: 15,
+		contracts: map[types.FileContractID]modules.RenterContract{
+			{2}: {ID: types.FileContractID{2}, NetAddress: "foo:1"},
+		},
+		cachedRevisions: make(map[types.FileContractID]cachedRevision),
+		oldContracts:    make(map[types.FileContractID]modules.RenterContract),
+		renewedIDs:      make(map[types.FileContractID]types.FileContractID),
+	}
+	added, err := c2.ImportContracts(export)
+	if err != nil {
+		t.Fatal(err)
+	} else if added != 2 {
+		t.Fatal("expected 2 contracts to be added, got", added)
+	}
+	if c2.contracts[types.FileContractID{2}].NetAddress != "foo:1" {
+		t.Fatal("known contract was replaced")
+	}
+	if _, ok := c2.oldContracts[types.FileContractID{1}]; !ok {
+		t.Fatal("expired contract was not archived")
+	}
+	if _, ok := c2.oldContracts[types.FileContractID{0}]; !ok {
+		t.Fatal("old contract was not imported")
+	}
+	if c2.ResolveID(types.FileContractID{0}) != (types.FileContractID{1}) {
+		t.Fatal("renewed IDs were not imported")
+	}
+
+	// Current contracts are given a cached revision.
+	c2.blockHeight = 0
+	delete(c2.oldContracts, types.FileContractID{1})
+	if _, err := c2.ImportContracts(export); err != nil {
+		t.Fatal(err)
+	}
+	if c2.cachedRevisions[types.FileContractID{1}].Revision.NewRevisionNumber != 2 {
+		t.Fatal("cached revision was not imported:", c2.cachedRevisions)
+	}
+}
@@ -0,0 +1,127 @@
+package renter
+
+import (
+	"github.com/NebulousLabs/Sia/crypto"
+)
+
+// A chunkIndexEntry locates an uploaded chunk in the chunk index. KeyHash is
+// the hash of the master key of the file that the chunk belongs to, so that
+// the entry is ignored once the file has been deleted or replaced.
+type chunkIndexEntry struct {
+	File    string // the key of the file in the renter's maps
+	Chunk   uint64
+	KeyHash crypto.Hash
+}
+
+// dedupHash returns the key in the chunk index of the chunk of f with the
+// given contents. Chunks can only share pieces if their contents, piece sizes
+// and erasure schemes all match, so all of them are hashed.
+func dedupHash(f *file, chunkData []byte) string {
+	return crypto.HashAll(chunkData, f.pieceSize, uint64(f.erasureCode.MinPieces()), uint64(f.erasureCode.NumPieces())).String()
+}
+
+// chunkIndexSource returns the file that the chunk index entry refers to, or
+// nil if the file no longer exists with the same master key. The renter's
+// lock must be held.
+func (r *Renter) chunkIndexSource(entry chunkIndexEntry) *file {
+	f, exists := r.files[entry.File]
+	if !exists || crypto.HashObject(f.masterKey) != entry.KeyHash {
+		return nil
+	}
+	return f
+}
+
+// liveChunkIndex returns the entries of the chunk index whose files still
+// exist. The renter's lock must be held.
+func (r *Renter) liveChunkIndex() map[string]chunkIndexEntry {
+	live := make(map[string]chunkIndexEntry, len(r.chunkIndex))
+	for hash, entry := range r.chunkIndex {
+		if r.chunkIndexSource(entry) != nil {
+			live[hash] = entry
+		}
+	}
+	return live
+}
+
+// managedDedupChunk adds the pieces of an uploaded chunk with the same
+// contents to the chunk cid of f, which must not have any pieces, and records
+// them in the chunk's repair status. The chunk's pieces are then encrypted
+// with the keys of the uploaded chunk. If no chunk with the same contents has
+// been uploaded, the chunk is added to the chunk index, so that later uploads
+// can reuse its pieces.
+func (r *Renter) managedDedupChunk(f *file, cid chunkID, cs *chunkStatus, chunkData []byte) error {
+	hash := dedupHash(f, chunkData)
+	lockID := r.mu.Lock()
+	defer r.mu.Unlock(lockID)
+	entry, exists := r.chunkIndex[hash]
+	src := r.chunkIndexSource(entry)
+	if !exists || src == nil {
+		r.chunkIndex[hash] = chunkIndexEntry{
+			File:    f.key(),
+			Chunk:   cid.index,
+			KeyHash: crypto.HashObject(f.masterKey),
+		}
+		return r.save()
+	} else if src == f && entry.Chunk == cid.index {
+		return nil
+	}
+
+	// Copy the pieces of the uploaded chunk, and the keys they are encrypted
+	// with.
+	src.mu.RLock()
+	keys := make([]crypto.TwofishKey, src.erasureCode.NumPieces())
+	for i := range keys {
+		keys[i] = pieceKey(src.masterKey, src.dedupKeys[entry.Chunk], entry.Chunk, uint64(i))
+	}
+	var shared []fileContract
+	for _, fc := range src.contracts {
+		var pieces []pieceData
+		for _, p := range fc.Pieces {
+			if p.Chunk == entry.Chunk {
+				pieces = append(pieces, pieceData{cid.index, p.Piece, p.MerkleRoot})
+			}
+		}
+		if len(pieces) > 0 {
+			shared = append(shared, fileContract{ID: fc.ID, IP: fc.IP, Pieces: pieces, WindowStart: fc.WindowStart})
+		}
+	}
+	src.mu.RUnlock()
+	if len(shared) == 0 {
+		// The uploaded chunk has no pieces yet, so this chunk is uploaded
+		// separately.
+		return nil
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, fc := range f.contracts {
+		for _, p := range fc.Pieces {
+			if p.Chunk == cid.index {
+				return nil
+			}
+		}
+	}
+	if f.dedupKeys == nil {
+		f.dedupKeys = make(map[uint64][]crypto.TwofishKey)
+	}
+	f.dedupKeys[cid.index] = keys
+	for _, sfc := range shared {
+		fc, exists := f.contracts[sfc.ID]
+		if !exists {
+			fc = fileContract{ID: sfc.ID, IP: sfc.IP, WindowStart: sfc.WindowStart}
+		}
+		fc.Pieces = append(fc.Pieces, sfc.Pieces...)
+		f.contracts[sfc.ID] = fc
+
+		// Only pieces that can be recovered count towards the chunk's
+		// redundancy, as in addFileToRepairState.
+		id := r.hostContractor.ResolveID(sfc.ID)
+		cs.contracts[id] = struct{}{}
+		if !r.hostContractor.IsOffline(id) && r.hostContractor.GoodForRenew(id) && !r.failingHosts.contains(sfc.IP) {
+			for _, p := range sfc.Pieces {
+				cs.pieces[p.Piece] = struct{}{}
+			}
+		}
+	}
+	return r.saveFile(f)
+}
@@ -0,0 +1,127 @@
+package renter
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/persist"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestRenterDedupChunk checks that chunks are added to the chunk index, that
+// identical chunks reuse the pieces and keys of indexed chunks, and that the
+// index and the dedup keys are persisted.
+func TestRenterDedupChunk(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newContractorTester(t.Name(), closeHostDB{}, onlineContractor{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	rsc, _ := NewRSCode(1, 1)
+	newStatus := func() *chunkStatus {
+		return &chunkStatus{
+			contracts: make(map[types.FileContractID]struct{}),
+			pieces:    make(map[uint64]struct{}),
+		}
+	}
+	chunk := []byte("chunk")
+	src := newFile("src", rsc, 5, 5)
+	dup := newFile("dup", rsc, 5, 5)
+	id := rt.renter.mu.Lock()
+	rt.renter.files[src.name] = src
+	rt.renter.files[dup.name] = dup
+	rt.renter.mu.Unlock(id)
+
+	// The first chunk is added to the index. A duplicate is not reused until
+	// the indexed chunk has pieces.
+	if err := rt.renter.managedDedupChunk(src, chunkID{0, src.key()}, newStatus(), chunk); err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.renter.managedDedupChunk(dup, chunkID{0, dup.key()}, newStatus(), chunk); err != nil {
+		t.Fatal(err)
+	}
+	if len(dup.contracts) != 0 {
+		t.Fatal("pieces were reused before being uploaded")
+	}
+	src.contracts[types.FileContractID{1}] = fileContract{
+		ID:     types.FileContractID{1},
+		IP:     "foo:1",
+		Pieces: []pieceData{{0, 0, crypto.Hash{1}}, {0, 1, crypto.Hash{2}}},
+	}
+
+	// A chunk with other contents is not deduplicated, but is added to the
+	// index.
+	cs := newStatus()
+	if err := rt.renter.managedDedupChunk(dup, chunkID{0, dup.key()}, cs, []byte("other")); err != nil {
+		t.Fatal(err)
+	}
+	if len(dup.contracts) != 0 || len(cs.pieces) != 0 {
+		t.Fatal("chunk with different contents was deduplicated")
+	}
+
+	// The duplicate chunk reuses the pieces and keys of the indexed chunk.
+	if err := rt.renter.managedDedupChunk(dup, chunkID{0, dup.key()}, cs, chunk); err != nil {
+		t.Fatal(err)
+	}
+	if len(cs.pieces) != 2 || len(cs.contracts) != 1 {
+		t.Fatalf("expected 2 pieces in 1 contract, got %v and %v", cs.pieces, cs.contracts)
+	}
+	if fc := dup.contracts[types.FileContractID{1}]; len(fc.Pieces) != 2 || fc.Pieces[1].MerkleRoot != (crypto.Hash{2}) {
+		t.Fatal("pieces were not reused:", dup.contracts)
+	}
+	for i := uint64(0); i < 2; i++ {
+		if pieceKey(dup.masterKey, dup.dedupKeys[0], 0, i) != deriveKey(src.masterKey, 0, i) {
+			t.Fatal("reused piece has the wrong key:", i)
+		}
+	}
+
+	// The dedup keys are persisted in the file's metadata, and are written
+	// with the dedup version of the .sia format.
+	buf := new(bytes.Buffer)
+	if err := shareFiles([]*file{dup}, buf); err != nil {
+		t.Fatal(err)
+	}
+	files, err := readSharedFiles(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := compareFiles(dup, files[0]); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	if err := shareFiles([]*file{src}, buf); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Contains(buf.Bytes(), []byte(shareVersion)) {
+		t.Fatal("file without dedup keys was not written with", shareVersion)
+	}
+
+	// The chunk index is persisted, but entries of deleted files are not.
+	indexSize := func() int {
+		id := rt.renter.mu.Lock()
+		err := rt.renter.saveSync()
+		rt.renter.mu.Unlock(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var data renterPersist
+		if err := persist.LoadJSON(saveMetadata, &data, filepath.Join(rt.renter.persistDir, PersistFilename)); err != nil {
+			t.Fatal(err)
+		}
+		return len(data.ChunkIndex)
+	}
+	if n := indexSize(); n != 2 {
+		t.Fatal("expected 2 persisted chunk index entries, got", n)
+	}
+	id = rt.renter.mu.Lock()
+	delete(rt.renter.files, src.name)
+	rt.renter.mu.Unlock(id)
+	if n := indexSize(); n != 1 {
+		t.Fatal("entry of a deleted file was persisted")
+	}
+}
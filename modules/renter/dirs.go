@@ -0,0 +1,255 @@
+package renter
+
+import (
+	"errors"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+var (
+	errDirExists  = errors.New("a directory already exists at that location")
+	errDirPinned  = errors.New("directory contains pinned files")
+	errInvalidDir = errors.New("directory must be a clean, relative path")
+	errRenameDir  = errors.New("cannot move a directory into itself")
+	errUnknownDir = errors.New("no directory known with that path")
+)
+
+// validateDir checks that dir can be used as a directory. The empty string is
+// the root directory, and is not valid here.
+func (r *Renter) validateDir(dir string) error {
+	if dir == "" || path.Clean(dir) != dir || path.IsAbs(dir) || dir == ".." || strings.HasPrefix(dir, "../") {
+		return errInvalidDir
+	}
+	return r.validateNickname(dir)
+}
+
+// inDir reports whether the nickname or directory name is within dir. Every
+// name is within the root directory.
+func inDir(name, dir string) bool {
+	return dir == "" || strings.HasPrefix(name, dir+"/")
+}
+
+// dirExists reports whether dir exists. Directories group the files of the
+// default namespace by the slash-separated components of their nicknames, and
+// a directory exists while it contains a file, or if it was created using
+// CreateDir and has not been deleted since. The renter's lock must be held.
+func (r *Renter) dirExists(dir string) bool {
+	if _, exists := r.dirs[dir]; exists || dir == "" {
+		return true
+	}
+	for d := range r.dirs {
+		if inDir(d, dir) {
+			return true
+		}
+	}
+	for _, f := range r.files {
+		if f.namespace == "" && inDir(f.name, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateDir creates an empty directory. Its parent directories are created
+// implicitly.
+func (r *Renter) CreateDir(dir string) error {
+	if err := r.addThread(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	if err := r.validateDir(dir); err != nil {
+		return err
+	}
+	lockID := r.mu.Lock()
+	defer r.mu.Unlock(lockID)
+
+	if r.dirExists(dir) {
+		return errDirExists
+	}
+	if _, exists := r.files[dir]; exists {
+		return ErrPathOverload
+	}
+	r.dirs[dir] = struct{}{}
+	return r.save()
+}
+
+// DirList returns the paths of the directories and files directly within dir,
+// in sorted order. The empty string lists the root directory.
+func (r *Renter) DirList(dir string) (dirs, files []string, err error) {
+	if dir != "" {
+		if err := r.validateDir(dir); err != nil {
+			return nil, nil, err
+		}
+	}
+	lockID := r.mu.RLock()
+	defer r.mu.RUnlock(lockID)
+	if !r.dirExists(dir) {
+		return nil, nil, errUnknownDir
+	}
+
+	prefix := dir
+	if prefix != "" {
+		prefix += "/"
+	}
+	subdirs := make(map[string]struct{})
+	addName := func(name string, isDir bool) {
+		rest := strings.TrimPrefix(name, prefix)
+		if i := strings.Index(rest, "/"); i >= 0 {
+			subdirs[prefix+rest[:i]] = struct{}{}
+		} else if isDir {
+			subdirs[name] = struct{}{}
+		} else {
+			files = append(files, name)
+		}
+	}
+	for d := range r.dirs {
+		if inDir(d, dir) {
+			addName(d, true)
+		}
+	}
+	for _, f := range r.files {
+		if f.namespace == "" && inDir(f.name, dir) {
+			addName(f.name, false)
+		}
+	}
+	for d := range subdirs {
+		dirs = append(dirs, d)
+	}
+	sort.Strings(dirs)
+	sort.Strings(files)
+	return dirs, files, nil
+}
+
+// FileListDir returns the files in dir and all of its subdirectories. The
+// empty string lists every file in the default namespace, like FileList.
+func (r *Renter) FileListDir(dir string) []modules.FileInfo {
+	var files []*file
+	lockID := r.mu.RLock()
+	for _, f := range r.files {
+		if f.namespace == "" && inDir(f.name, dir) {
+			files = append(files, f)
+		}
+	}
+	r.mu.RUnlock(lockID)
+
+	var fileList []modules.FileInfo
+	for _, f := range files {
+		f.mu.RLock()
+		fileList = append(fileList, r.fileInfo(f))
+		f.mu.RUnlock()
+	}
+	return fileList
+}
+
+// DeleteDir deletes dir, its subdirectories, and all of the files within
+// them, including their data on the hosts, like DeleteFile. Nothing is deleted
+// if any of the files are pinned or sealed.
+func (r *Renter) DeleteDir(dir string) error {
+	if err := r.addThread(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	if err := r.validateDir(dir); err != nil {
+		return err
+	}
+	lockID := r.mu.Lock()
+	if !r.dirExists(dir) {
+		r.mu.Unlock(lockID)
+		return errUnknownDir
+	}
+
+	var deleted []*file
+	for _, f := range r.files {
+		if f.namespace != "" || !inDir(f.name, dir) {
+			continue
+		}
+		f.mu.RLock()
+		pinned, sealed := f.pinned, f.sealed
+		f.mu.RUnlock()
+		if sealed {
+			r.mu.Unlock(lockID)
+			return ErrFileSealed
+		} else if pinned {
+			r.mu.Unlock(lockID)
+			return errDirPinned
+		}
+		deleted = append(deleted, f)
+	}
+
+	for _, f := range deleted {
+		delete(r.files, f.name)
+		r.untrack(f.name)
+		os.RemoveAll(r.sharePath("", f.name))
+	}
+	for d := range r.dirs {
+		if d == dir || inDir(d, dir) {
+			delete(r.dirs, d)
+		}
+	}
+	r.noteUnusedHosts(deleted)
+	err := r.save()
+	sectors := r.unusedSectors(deleted)
+	r.mu.Unlock(lockID)
+
+	go r.threadedDeleteSectors(sectors)
+	return err
+}
+
+// RenameDir moves dir, its subdirectories, and all of the files within them to
+// newDir, which must not exist. Nothing is moved if any of the files cannot be
+// renamed.
+func (r *Renter) RenameDir(dir, newDir string) error {
+	if err := r.addThread(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	if err := r.validateDir(dir); err != nil {
+		return err
+	}
+	if err := r.validateDir(newDir); err != nil {
+		return err
+	}
+	if newDir == dir || inDir(newDir, dir) {
+		return errRenameDir
+	}
+	lockID := r.mu.Lock()
+	defer r.mu.Unlock(lockID)
+	if !r.dirExists(dir) {
+		return errUnknownDir
+	}
+	if r.dirExists(newDir) {
+		return errDirExists
+	}
+	if _, exists := r.files[newDir]; exists {
+		return ErrPathOverload
+	}
+
+	// Check every file before renaming any of them.
+	renames := make(map[string]string)
+	for _, f := range r.files {
+		if f.namespace == "" && inDir(f.name, dir) {
+			renames[f.name] = newDir + strings.TrimPrefix(f.name, dir)
+		}
+	}
+	if err := r.checkRenames("", renames); err != nil {
+		return err
+	}
+	if err := r.moveFiles("", renames); err != nil {
+		return err
+	}
+	var moved []string
+	for d := range r.dirs {
+		if d == dir || inDir(d, dir) {
+			moved = append(moved, d)
+		}
+	}
+	for _, d := range moved {
+		delete(r.dirs, d)
+		r.dirs[newDir+strings.TrimPrefix(d, dir)] = struct{}{}
+	}
+	return r.save()
+}
@@ -0,0 +1,125 @@
+package renter
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestRenterDirs probes the CreateDir, DirList, FileListDir, RenameDir and
+// DeleteDir methods of the renter type.
+func TestRenterDirs(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	for _, name := range []string{"a/one", "a/b/two", "a/b/three", "four"} {
+		f := newTestingFile()
+		f.name = name
+		id := rt.renter.mu.Lock()
+		rt.renter.files[name] = f
+		err := rt.renter.saveFile(f)
+		rt.renter.mu.Unlock(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, dir := range []string{"", "/a", "a/", "a//b", "../a"} {
+		if err := rt.renter.CreateDir(dir); err != errInvalidDir {
+			t.Fatalf("expected errInvalidDir for %q, got %v", dir, err)
+		}
+	}
+	if err := rt.renter.CreateDir("a/b"); err != errDirExists {
+		t.Fatal("expected errDirExists, got", err)
+	}
+	if err := rt.renter.CreateDir("four"); err != ErrPathOverload {
+		t.Fatal("expected ErrPathOverload, got", err)
+	}
+	if err := rt.renter.CreateDir("a/empty"); err != nil {
+		t.Fatal(err)
+	}
+
+	dirs, files, err := rt.renter.DirList("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(dirs, []string{"a"}) || !reflect.DeepEqual(files, []string{"four"}) {
+		t.Fatal("wrong root listing:", dirs, files)
+	}
+	dirs, files, err = rt.renter.DirList("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(dirs, []string{"a/b", "a/empty"}) || !reflect.DeepEqual(files, []string{"a/one"}) {
+		t.Fatal("wrong listing of a:", dirs, files)
+	}
+	if _, _, err := rt.renter.DirList("c"); err != errUnknownDir {
+		t.Fatal("expected errUnknownDir, got", err)
+	}
+	if infos := rt.renter.FileListDir("a/b"); len(infos) != 2 {
+		t.Fatal("expected 2 files in a/b, got", infos)
+	}
+	if infos := rt.renter.FileListDir(""); len(infos) != 4 {
+		t.Fatal("expected 4 files in total, got", infos)
+	}
+
+	// Rename a directory, which moves its files and subdirectories.
+	if err := rt.renter.RenameDir("a", "a/c"); err != errRenameDir {
+		t.Fatal("expected errRenameDir, got", err)
+	}
+	if err := rt.renter.RenameDir("a", "four"); err != ErrPathOverload {
+		t.Fatal("expected ErrPathOverload, got", err)
+	}
+	if err := rt.renter.RenameDir("a", "z"); err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := rt.renter.files["z/b/two"]; !exists {
+		t.Fatal("file was not moved")
+	}
+	dirs, files, err = rt.renter.DirList("z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(dirs, []string{"z/b", "z/empty"}) || !reflect.DeepEqual(files, []string{"z/one"}) {
+		t.Fatal("wrong listing of z:", dirs, files)
+	}
+	if _, _, err := rt.renter.DirList("a"); err != errUnknownDir {
+		t.Fatal("expected errUnknownDir, got", err)
+	}
+
+	// Pinned files prevent a directory from being deleted.
+	if err := rt.renter.SetPinned("z/b/two", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.renter.DeleteDir("z/b"); err != errDirPinned {
+		t.Fatal("expected errDirPinned, got", err)
+	}
+	if err := rt.renter.SetPinned("z/b/two", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.renter.DeleteDir("z/b"); err != nil {
+		t.Fatal(err)
+	}
+	if infos := rt.renter.FileListDir("z"); len(infos) != 1 || infos[0].SiaPath != "z/one" {
+		t.Fatal("wrong files after deletion:", infos)
+	}
+
+	// Created directories are persisted.
+	if err := rt.renter.saveSync(); err != nil {
+		t.Fatal(err)
+	}
+	rt.renter.dirs = make(map[string]struct{})
+	id := rt.renter.mu.Lock()
+	err = rt.renter.load()
+	rt.renter.mu.Unlock(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := rt.renter.dirs["z/empty"]; !exists {
+		t.Fatal("created directory was not persisted:", rt.renter.dirs)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"errors"
 	"io"
 	"os"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -30,15 +31,24 @@ var (
 	errInsufficientPieces = errors.New("couldn't fetch enough pieces to recover data")
 
 	// maxActiveDownloadPieces determines the maximum number of pieces that are
-	// allowed to be concurrently downloading. More pieces means more
+	// allowed to be concurrently downloading, unless another limit is set
+	// using the MaxDownloadWorkers setting. More pieces means more
 	// parallelism, but also more RAM usage.
-	//
-	// TODO: Allow this number to be established in the renter settings.
 	maxActiveDownloadPieces = build.Select(build.Var{
 		Standard: int(60),
 		Dev:      int(10),
 		Testing:  int(5),
 	}).(int)
+
+	// downloadOverdrive is the number of pieces of a chunk that are fetched in
+	// addition to the pieces needed to recover it, if enough hosts store
+	// pieces of the chunk. The chunk is recovered from the pieces that arrive
+	// first, so that a slow host does not hold up the download.
+	downloadOverdrive = build.Select(build.Var{
+		Standard: int(2),
+		Dev:      int(1),
+		Testing:  int(1),
+	}).(int)
 )
 
 type (
@@ -56,18 +66,32 @@ type (
 		// have tried to fetch a piece of the chunk.
 		completedPieces map[uint64][]byte
 		workerAttempts  map[types.FileContractID]bool
+
+		// overdrive is the number of pieces of the chunk that are being
+		// fetched in addition to the pieces needed to recover it. Once the
+		// chunk is recovered, the pieces that are still being fetched are
+		// discarded.
+		overdrive int
+		recovered bool
 	}
 
 	// A download is a file download that has been queued by the renter.
 	download struct {
-		// Progress variables.
+		// Progress variables. A download is active once the first of its
+		// chunks has been scheduled.
 		atomicDataReceived uint64
+		active             bool
 		downloadComplete   bool
 		downloadErr        error
 		finishedChunks     map[uint64]bool
 		offset             uint64
 		length             uint64
 
+		// Downloads in the download queue are identified by their id. Chunks
+		// of downloads with a higher priority are scheduled first.
+		id       uint64
+		priority int
+
 		// Timestamp information.
 		completeTime time.Time
 		startTime    time.Time
@@ -80,12 +104,19 @@ type (
 		masterKey   crypto.TwofishKey
 		numChunks   uint64
 
+		// dedupKeys holds the dedup keys of the chunks to be downloaded that
+		// share their pieces with another file.
+		dedupKeys map[uint64][]crypto.TwofishKey
+
 		// pieceSet contains a sparse map of the chunk indices to be downloaded to
 		// their piece data.
 		pieceSet          map[uint64]map[types.FileContractID]pieceData
 		reportedPieceSize uint64
 		siapath           string
 
+		// namespace is the namespace that the download was requested in.
+		namespace string
+
 		// Syncrhonization tools.
 		downloadFinished chan struct{}
 		mu               sync.Mutex
@@ -153,6 +184,7 @@ func newDownload(f *file, destination modules.DownloadWriter) *download {
 		fileSize:         f.size,
 		masterKey:        f.masterKey,
 		numChunks:        f.numChunks(),
+		dedupKeys:        make(map[uint64][]crypto.TwofishKey),
 		siapath:          f.name,
 		downloadFinished: make(chan struct{}),
 		finishedChunks:   make(map[uint64]bool),
@@ -191,6 +223,11 @@ func (d *download) initPieceSet(f *file,
 			}
 		}
 	}
+	for i := range d.pieceSet {
+		if keys, ok := f.dedupKeys[i]; ok {
+			d.dedupKeys[i] = keys
+		}
+	}
 	f.mu.RUnlock()
 }
 
@@ -215,8 +252,9 @@ func (d *download) fail(err error) {
 }
 
 // recoverChunk takes a chunk that has had a sufficient number of pieces
-// downloaded and verifies, decrypts and decodes them into the file.
-func (cd *chunkDownload) recoverChunk() error {
+// downloaded and verifies, decrypts and decodes them into the file. The
+// decoded chunk is returned, so that it can be cached.
+func (cd *chunkDownload) recoverChunk() ([]byte, error) {
 	// Assemble the chunk from the download.
 	cd.download.mu.Lock()
 	chunk := make([][]byte, cd.download.erasureCode.NumPieces())
@@ -229,7 +267,7 @@ func (cd *chunkDownload) recoverChunk() error {
 
 	// Return early if the download has previously suffered an error.
 	if complete {
-		return build.ComposeErrors(errPrevErr, prevErr)
+		return nil, build.ComposeErrors(errPrevErr, prevErr)
 	}
 
 	// Decrypt the chunk pieces.
@@ -240,10 +278,10 @@ func (cd *chunkDownload) recoverChunk() error {
 		}
 
 		// Decrypt the piece.
-		key := deriveKey(cd.download.masterKey, cd.index, uint64(i))
+		key := pieceKey(cd.download.masterKey, cd.download.dedupKeys[cd.index], cd.index, uint64(i))
 		decryptedPiece, err := key.DecryptBytes(chunk[i])
 		if err != nil {
-			return build.ExtendErr("unable to decrypt piece", err)
+			return nil, build.ExtendErr("unable to decrypt piece", err)
 		}
 		chunk[i] = decryptedPiece
 	}
@@ -256,11 +294,15 @@ func (cd *chunkDownload) recoverChunk() error {
 	}
 	err := cd.download.erasureCode.Recover(chunk, recoverSize, recoverWriter)
 	if err != nil {
-		return build.ExtendErr("unable to recover chunk", err)
+		return nil, build.ExtendErr("unable to recover chunk", err)
 	}
-
 	result := recoverWriter.Bytes()
+	return result, cd.writeChunk(result)
+}
 
+// writeChunk writes the requested part of a decoded chunk to the download's
+// destination, and marks the chunk as finished.
+func (cd *chunkDownload) writeChunk(result []byte) error {
 	// Calculate the offset. If the offset is within the chunk, the
 	// requested offset is passed, otherwise the offset of the chunk
 	// within the overall file is passed.
@@ -285,7 +327,7 @@ func (cd *chunkDownload) recoverChunk() error {
 	result = result[lowerBound:upperBound]
 
 	// Write the bytes to the requested output.
-	_, err = cd.download.destination.WriteAt(result, int64(off))
+	_, err := cd.download.destination.WriteAt(result, int64(off))
 	if err != nil {
 		return build.ExtendErr("unable to write to download destination", err)
 	}
@@ -396,6 +438,13 @@ func (r *Renter) managedDownloadIteration(ds *downloadState) {
 	}
 	r.mu.Unlock(id)
 
+	// Prefer the workers that have downloaded pieces the fastest. Workers
+	// that have not downloaded anything yet are tried first, so that their
+	// latency is measured.
+	sort.SliceStable(ds.availableWorkers, func(i, j int) bool {
+		return ds.availableWorkers[i].downloadLatency < ds.availableWorkers[j].downloadLatency
+	})
+
 	// Add new chunks to the extent that resources allow.
 	r.managedScheduleNewChunks(ds)
 
@@ -418,6 +467,11 @@ loop:
 		incompleteChunk.download.mu.Lock()
 		downloadComplete := incompleteChunk.download.downloadComplete
 		incompleteChunk.download.mu.Unlock()
+		if incompleteChunk.recovered {
+			// The chunk was recovered without this piece.
+			ds.activePieces--
+			continue
+		}
 		if downloadComplete {
 			// The download has most likely failed. No need to complete this
 			// chunk.
@@ -483,6 +537,14 @@ loop:
 		// or the active set is able to pick up the slack. Verify that they are
 		// safe to be scheduled, and then schedule them if so.
 
+		// If this piece was only fetched in addition to the pieces needed to
+		// recover the chunk, the chunk can be completed without it.
+		if incompleteChunk.overdrive > 0 {
+			incompleteChunk.overdrive--
+			ds.activePieces--
+			continue
+		}
+
 		// Cannot find workers to complete this download, fail the download
 		// connected to this chunk.
 		r.log.Println("Not enough workers to finish download:", errInsufficientHosts)
@@ -501,6 +563,13 @@ loop:
 // managedScheduleNewChunks uses the set of available workers to schedule new
 // chunks if there are resources available to begin downloading them.
 func (r *Renter) managedScheduleNewChunks(ds *downloadState) {
+	id := r.mu.RLock()
+	maxPieces := r.maxDownloadWorkers
+	r.mu.RUnlock(id)
+	if maxPieces == 0 {
+		maxPieces = maxActiveDownloadPieces
+	}
+
 	// Keep adding chunks until a break condition is hit.
 	for {
 		chunkQueueLen := len(r.chunkQueue)
@@ -510,36 +579,80 @@ func (r *Renter) managedScheduleNewChunks(ds *downloadState) {
 		}
 
 		// View the next chunk.
-		nextChunk := r.chunkQueue[0]
+		next := r.nextChunkIndex()
+		nextChunk := r.chunkQueue[next]
 
 		// Check whether there are enough resources to perform the download.
-		if ds.activePieces+nextChunk.download.erasureCode.MinPieces() > maxActiveDownloadPieces {
+		// A chunk that needs more pieces than the limit is still downloaded
+		// once nothing else is, so that it does not stall the queue.
+		if ds.activePieces > 0 && ds.activePieces+nextChunk.download.erasureCode.MinPieces() > maxPieces {
 			// There is a limited amount of RAM available, and scheduling the
 			// next piece would consume too much RAM.
 			return
 		}
 
 		// Chunk is set to be downloaded. Clear it from the queue.
-		r.chunkQueue = r.chunkQueue[1:]
+		r.chunkQueue = append(r.chunkQueue[:next], r.chunkQueue[next+1:]...)
 
 		// Check if the download has already completed. If it has, it's because
 		// the download failed.
 		nextChunk.download.mu.Lock()
 		downloadComplete := nextChunk.download.downloadComplete
+		nextChunk.download.active = true
 		nextChunk.download.mu.Unlock()
 		if downloadComplete {
 			// Download has already failed.
 			continue
 		}
 
-		// Add an incomplete chunk entry for every piece of the download.
-		for i := 0; i < nextChunk.download.erasureCode.MinPieces(); i++ {
+		// Chunks in the chunk cache do not need to be downloaded.
+		if chunk, ok := r.chunkCache.get(nextChunk.download.masterKey, nextChunk.index); ok {
+			atomic.AddUint64(&nextChunk.download.atomicDataReceived, nextChunk.download.reportedPieceSize*uint64(nextChunk.download.erasureCode.MinPieces()))
+			if err := nextChunk.writeChunk(chunk); err != nil {
+				r.log.Println("Download failed - could not write a cached chunk:", err)
+				nextChunk.download.mu.Lock()
+				nextChunk.download.fail(err)
+				nextChunk.download.mu.Unlock()
+			}
+			continue
+		}
+
+		// Add an incomplete chunk entry for every piece of the download,
+		// including the overdrive pieces.
+		minPieces := nextChunk.download.erasureCode.MinPieces()
+		nextChunk.overdrive = len(nextChunk.download.pieceSet[nextChunk.index]) - minPieces
+		if nextChunk.overdrive > downloadOverdrive {
+			nextChunk.overdrive = downloadOverdrive
+		}
+		if spare := maxPieces - ds.activePieces - minPieces; nextChunk.overdrive > spare {
+			nextChunk.overdrive = spare
+		}
+		if nextChunk.overdrive < 0 {
+			nextChunk.overdrive = 0
+		}
+		for i := 0; i < minPieces+nextChunk.overdrive; i++ {
 			ds.incompleteChunks = append(ds.incompleteChunks, nextChunk)
 		}
-		ds.activePieces += nextChunk.download.erasureCode.MinPieces()
+		ds.activePieces += minPieces + nextChunk.overdrive
 	}
 }
 
+// nextChunkIndex returns the index in the chunk queue of the next chunk to
+// schedule, which is the earliest queued chunk of the downloads with the
+// highest priority. The chunk queue must not be empty.
+func (r *Renter) nextChunkIndex() int {
+	next, priority := 0, 0
+	for i, cd := range r.chunkQueue {
+		cd.download.mu.Lock()
+		p := cd.download.priority
+		cd.download.mu.Unlock()
+		if i == 0 || p > priority {
+			next, priority = i, p
+		}
+	}
+	return next
+}
+
 // managedWaitOnDownloadWork will wait for workers to return after attempting to
 // download a piece.
 func (r *Renter) managedWaitOnDownloadWork(ds *downloadState) {
@@ -577,6 +690,27 @@ func (r *Renter) managedWaitOnDownloadWork(ds *downloadState) {
 	if finishedDownload.err != nil {
 		r.log.Debugln("Error when downloading a piece:", finishedDownload.err)
 		worker.recentDownloadFailure = time.Now()
+		if cd.recovered {
+			ds.activePieces--
+			return
+		}
+		ds.incompleteChunks = append(ds.incompleteChunks, cd)
+		return
+	}
+	worker.noteDownloadTime(finishedDownload.downloadTime)
+
+	// Discard the piece if the chunk was recovered from faster hosts.
+	if cd.recovered {
+		ds.activePieces--
+		return
+	}
+
+	// Pieces of downloads that have failed or been cancelled are dropped along
+	// with their chunk the next time the incomplete chunks are scheduled.
+	cd.download.mu.Lock()
+	downloadComplete := cd.download.downloadComplete
+	cd.download.mu.Unlock()
+	if downloadComplete {
 		ds.incompleteChunks = append(ds.incompleteChunks, cd)
 		return
 	}
@@ -587,14 +721,17 @@ func (r *Renter) managedWaitOnDownloadWork(ds *downloadState) {
 
 	// If the chunk has completed, perform chunk recovery.
 	if len(cd.completedPieces) == cd.download.erasureCode.MinPieces() {
-		err := cd.recoverChunk()
+		chunk, err := cd.recoverChunk()
 		ds.activePieces -= len(cd.completedPieces)
 		cd.completedPieces = make(map[uint64][]byte)
+		cd.recovered = true
 		if err != nil {
 			r.log.Println("Download failed - could not recover a chunk:", err)
 			cd.download.mu.Lock()
 			cd.download.fail(err)
 			cd.download.mu.Unlock()
+		} else if err := r.chunkCache.add(cd.download.masterKey, cd.index, chunk); err != nil {
+			r.log.Debugln("Could not add a chunk to the chunk cache:", err)
 		}
 	}
 }
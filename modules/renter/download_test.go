@@ -0,0 +1,122 @@
+package renter
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/sync"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestDownloadOverdrive checks that the download loop fetches more pieces of a
+// chunk than are needed to recover it, if enough hosts store pieces of the
+// chunk, and that pieces arriving after the chunk was recovered are discarded.
+func TestDownloadOverdrive(t *testing.T) {
+	rsc, _ := NewRSCode(1, 3)
+	f := &file{
+		size:        1,
+		pieceSize:   1,
+		erasureCode: rsc,
+	}
+	d := newDownload(f, NewDownloadHttpWriter(new(bytes.Buffer), 0, 1))
+	d.finishedChunks[0] = false
+	d.pieceSet = map[uint64]map[types.FileContractID]pieceData{0: {}}
+
+	r := &Renter{
+		mu:         sync.New(modules.SafeMutexDelay, 1),
+		tg:         new(sync.ThreadGroup),
+		workerPool: make(map[types.FileContractID]*worker),
+		chunkCache: newChunkCache(""),
+	}
+	ds := &downloadState{
+		activeWorkers: make(map[types.FileContractID]struct{}),
+		resultChan:    make(chan finishedDownload),
+	}
+	cd := &chunkDownload{
+		download:        d,
+		completedPieces: make(map[uint64][]byte),
+		workerAttempts:  make(map[types.FileContractID]bool),
+	}
+	for i := byte(0); i < 4; i++ {
+		id := types.FileContractID{i}
+		d.pieceSet[0][id] = pieceData{Piece: uint64(i)}
+		cd.workerAttempts[id] = false
+		w := &worker{contractID: id, priorityDownloadChan: make(chan downloadWork, 1)}
+		r.workerPool[id] = w
+		ds.availableWorkers = append(ds.availableWorkers, w)
+	}
+	r.chunkQueue = []*chunkDownload{cd}
+
+	// One piece is needed to recover the chunk, so 1+downloadOverdrive pieces
+	// should be fetched.
+	r.managedScheduleNewChunks(ds)
+	r.managedScheduleIncompleteChunks(ds)
+	if len(ds.activeWorkers) != 1+downloadOverdrive || ds.activePieces != 1+downloadOverdrive {
+		t.Fatalf("expected %v pieces to be fetched, got %v (%v active)", 1+downloadOverdrive, len(ds.activeWorkers), ds.activePieces)
+	}
+
+	// Return a piece from the first worker after the chunk was recovered. The
+	// piece should be discarded, and the worker's latency recorded.
+	cd.recovered = true
+	ds.activePieces--
+	go func() {
+		ds.resultChan <- finishedDownload{cd, []byte{0}, nil, 0, types.FileContractID{0}, time.Second}
+	}()
+	r.managedWaitOnDownloadWork(ds)
+	if ds.activePieces != downloadOverdrive-1 {
+		t.Fatal("late piece was not discarded:", ds.activePieces)
+	}
+	if len(cd.completedPieces) != 0 {
+		t.Fatal("late piece was added to the chunk")
+	}
+	if r.workerPool[types.FileContractID{0}].downloadLatency != time.Second {
+		t.Fatal("download latency was not recorded")
+	}
+}
+
+// TestDownloadWorkerLimit checks that the download loop does not fetch more
+// pieces at once than the MaxDownloadWorkers setting allows, counting the
+// overdrive pieces, but that a chunk needing more pieces than the limit is
+// still fetched when nothing else is.
+func TestDownloadWorkerLimit(t *testing.T) {
+	rsc, _ := NewRSCode(2, 2)
+	f := &file{
+		size:        4,
+		pieceSize:   1,
+		erasureCode: rsc,
+	}
+	d := newDownload(f, NewDownloadHttpWriter(new(bytes.Buffer), 0, 4))
+	d.pieceSet = map[uint64]map[types.FileContractID]pieceData{0: {}, 1: {}}
+	for i := byte(0); i < 4; i++ {
+		d.pieceSet[0][types.FileContractID{i}] = pieceData{Piece: uint64(i)}
+		d.pieceSet[1][types.FileContractID{i}] = pieceData{Chunk: 1, Piece: uint64(i)}
+	}
+
+	r := &Renter{
+		mu:         sync.New(modules.SafeMutexDelay, 1),
+		chunkCache: newChunkCache(""),
+	}
+	ds := &downloadState{}
+	for i := uint64(0); i < 2; i++ {
+		r.chunkQueue = append(r.chunkQueue, &chunkDownload{download: d, index: i})
+	}
+
+	// The first chunk needs 2 pieces, which is more than the limit, but
+	// nothing else is being downloaded. No overdrive pieces are fetched, and
+	// the second chunk waits.
+	r.maxDownloadWorkers = 1
+	r.managedScheduleNewChunks(ds)
+	if ds.activePieces != 2 || len(r.chunkQueue) != 1 {
+		t.Fatalf("expected 2 active pieces and 1 queued chunk, got %v and %v", ds.activePieces, len(r.chunkQueue))
+	}
+
+	// With a higher limit, the second chunk is scheduled with the overdrive
+	// pieces that fit.
+	r.maxDownloadWorkers = 5
+	r.managedScheduleNewChunks(ds)
+	if ds.activePieces != 5 || len(r.chunkQueue) != 0 {
+		t.Fatalf("expected 5 active pieces and no queued chunks, got %v and %v", ds.activePieces, len(r.chunkQueue))
+	}
+}
@@ -3,6 +3,7 @@ package renter
 import (
 	"errors"
 	"fmt"
+	"io"
 	"path/filepath"
 	"sync/atomic"
 
@@ -10,15 +11,32 @@ import (
 	"github.com/NebulousLabs/Sia/types"
 )
 
+var (
+	errUnknownDownload   = errors.New("no download with that id")
+	errDownloadCancelled = errors.New("download was cancelled")
+	errDownloadFinished  = errors.New("download has already finished")
+	errKeylessFile       = errors.New("file was imported without its encryption key")
+)
+
 // Download performs a file download using the passed parameters.
 func (r *Renter) Download(p modules.RenterDownloadParameters) error {
 	// lookup the file associated with the nickname.
+	key := nsKey(p.Namespace, p.Siapath)
+	if p.Version != 0 {
+		if p.Namespace != "" {
+			return errUnversionedNS
+		}
+		key = nsKey(versionNamespace, versionName(p.Siapath, p.Version))
+	}
 	lockID := r.mu.RLock()
-	file, exists := r.files[p.Siapath]
+	file, exists := r.files[key]
 	r.mu.RUnlock(lockID)
 	if !exists {
 		return errors.New(fmt.Sprintf("no file with that path: %s", p.Siapath))
 	}
+	if file.keyless() {
+		return errKeylessFile
+	}
 
 	isHttpResp := p.Httpwriter != nil
 
@@ -35,7 +53,8 @@ func (r *Renter) Download(p modules.RenterDownloadParameters) error {
 	if p.Destination != "" && !filepath.IsAbs(p.Destination) {
 		return errors.New("destination must be an absolute path")
 	}
-	if p.Offset == file.size {
+	size := file.contentSize()
+	if p.Offset == size {
 		return errors.New("offset equals filesize")
 	}
 
@@ -56,17 +75,29 @@ func (r *Renter) Download(p modules.RenterDownloadParameters) error {
 
 	// sentinel: if length == 0, download the entire file
 	if p.Length == 0 {
-		p.Length = file.size - p.Offset
+		p.Length = size - p.Offset
 	}
 	// Check whether offset and length is valid.
-	if p.Offset < 0 || p.Offset+p.Length > file.size {
-		return fmt.Errorf("offset and length combination invalid, max byte is at index %d", file.size-1)
+	if p.Offset < 0 || p.Offset+p.Length > size {
+		return fmt.Errorf("offset and length combination invalid, max byte is at index %d", size-1)
 	}
 
-	// Create the download object and add it to the queue.
-	d := r.newSectionDownload(file, dw, currentContracts, p.Offset, p.Length)
+	// Create the download object and add it to the queue. Compressed files
+	// are downloaded in full and decompressed as they arrive.
+	var d *download
+	var dc *decompressor
+	if file.compressed {
+		dc = newDecompressor(file, dw, p.Offset, p.Length)
+		d = r.newSectionDownload(file, dc, currentContracts, 0, file.size)
+	} else {
+		d = r.newSectionDownload(file, dw, currentContracts, p.Offset, p.Length)
+	}
+	d.priority = p.Priority
+	d.namespace = p.Namespace
 
 	lockID = r.mu.Lock()
+	r.lastDownloadID++
+	d.id = r.lastDownloadID
 	r.downloadQueue = append(r.downloadQueue, d)
 	r.mu.Unlock(lockID)
 	r.newDownloads <- d
@@ -77,12 +108,32 @@ func (r *Renter) Download(p modules.RenterDownloadParameters) error {
 	// error itself.
 	select {
 	case <-d.downloadFinished:
-		return d.Err()
+		err := d.Err()
+		if dc != nil {
+			if decompressErr := dc.close(err); err == nil {
+				err = decompressErr
+			}
+		}
+		return err
 	case <-r.tg.StopChan():
-		return errors.New("download interrupted by shutdown")
+		err := errors.New("download interrupted by shutdown")
+		if dc != nil {
+			dc.close(err)
+		}
+		return err
 	}
 }
 
+// DownloadToWriter downloads the file with the given nickname and writes its
+// contents to w in order, without writing them to disk. It blocks until the
+// download has completed.
+func (r *Renter) DownloadToWriter(nickname string, w io.Writer) error {
+	return r.Download(modules.RenterDownloadParameters{
+		Httpwriter: w,
+		Siapath:    nickname,
+	})
+}
+
 // DownloadQueue returns the list of downloads in the queue.
 func (r *Renter) DownloadQueue() []modules.DownloadInfo {
 	lockID := r.mu.RLock()
@@ -94,16 +145,70 @@ func (r *Renter) DownloadQueue() []modules.DownloadInfo {
 		d := r.downloadQueue[len(r.downloadQueue)-i-1]
 
 		downloads[i] = modules.DownloadInfo{
+			ID:          d.id,
 			SiaPath:     d.siapath,
 			Destination: d.destination,
 			Filesize:    d.length,
 			StartTime:   d.startTime,
+			Namespace:   d.namespace,
 		}
 		downloads[i].Received = atomic.LoadUint64(&d.atomicDataReceived)
 
-		if err := d.Err(); err != nil {
-			downloads[i].Error = err.Error()
+		d.mu.Lock()
+		downloads[i].Priority = d.priority
+		switch {
+		case d.downloadErr != nil:
+			downloads[i].Error = d.downloadErr.Error()
+			downloads[i].State = modules.DownloadFailed
+		case d.downloadComplete:
+			downloads[i].State = modules.DownloadComplete
+		case d.active:
+			downloads[i].State = modules.DownloadActive
+		default:
+			downloads[i].State = modules.DownloadQueued
 		}
+		d.mu.Unlock()
 	}
 	return downloads
 }
+
+// SetDownloadPriority changes the priority of the download with the given ID.
+// The chunks of downloads with a higher priority are fetched before those of
+// downloads with a lower priority, regardless of the order in which the
+// downloads were queued. Downloads have priority 0 unless another priority is
+// given when they are queued.
+func (r *Renter) SetDownloadPriority(id uint64, priority int) error {
+	lockID := r.mu.RLock()
+	defer r.mu.RUnlock(lockID)
+	for _, d := range r.downloadQueue {
+		if d.id == id {
+			d.mu.Lock()
+			d.priority = priority
+			d.mu.Unlock()
+			return nil
+		}
+	}
+	return errUnknownDownload
+}
+
+// CancelDownload cancels the download with the given ID. Its remaining chunks
+// are no longer scheduled, and the pieces that are already being fetched for
+// it are dropped when they arrive, so that the connections to the hosts, which
+// are shared with other downloads, stay open. The download remains in the
+// download queue, where it is reported as failed.
+func (r *Renter) CancelDownload(id uint64) error {
+	lockID := r.mu.RLock()
+	defer r.mu.RUnlock(lockID)
+	for _, d := range r.downloadQueue {
+		if d.id == id {
+			d.mu.Lock()
+			defer d.mu.Unlock()
+			if d.downloadComplete {
+				return errDownloadFinished
+			}
+			d.fail(errDownloadCancelled)
+			return nil
+		}
+	}
+	return errUnknownDownload
+}
@@ -0,0 +1,160 @@
+package renter
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestRenterDownloadToWriter checks that DownloadToWriter rejects unknown
+// files without writing anything.
+func TestRenterDownloadToWriter(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	var buf bytes.Buffer
+	if err := rt.renter.DownloadToWriter("foo", &buf); err == nil {
+		t.Fatal("expected an error when downloading an unknown file")
+	}
+	if buf.Len() != 0 {
+		t.Fatal("data was written for an unknown file")
+	}
+}
+
+// TestRenterDownloadPriority checks that the chunks of the downloads with the
+// highest priority are scheduled first, and that the download queue reports
+// the priority and state of every download.
+func TestRenterDownloadPriority(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Queue three downloads, the last of which has failed.
+	downloads := make([]*download, 3)
+	for i := range downloads {
+		downloads[i] = newDownload(newTestingFile(), NewDownloadHttpWriter(new(bytes.Buffer), 0, 0))
+		downloads[i].id = uint64(i + 1)
+	}
+	downloads[2].fail(errors.New("failed"))
+	rt.renter.downloadQueue = downloads
+
+	// Scheduling uses a separate renter, so that the chunk queue is not
+	// shared with the download loop.
+	r := &Renter{}
+	for _, d := range downloads[:2] {
+		for i := uint64(0); i < 2; i++ {
+			r.chunkQueue = append(r.chunkQueue, &chunkDownload{download: d, index: i})
+		}
+	}
+	if next := r.nextChunkIndex(); next != 0 {
+		t.Fatal("with equal priorities, expected the first chunk to be next, got", next)
+	}
+	if err := rt.renter.SetDownloadPriority(2, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.renter.SetDownloadPriority(4, 1); err != errUnknownDownload {
+		t.Fatal("expected errUnknownDownload, got", err)
+	}
+	next := r.nextChunkIndex()
+	if cd := r.chunkQueue[next]; cd.download != downloads[1] || cd.index != 0 {
+		t.Fatal("expected the first chunk of the second download to be next, got index", next)
+	}
+	downloads[0].active = true
+
+	// The queue is ordered from the most recent download.
+	exp := []struct {
+		id       uint64
+		priority int
+		state    string
+	}{
+		{3, 0, modules.DownloadFailed},
+		{2, 1, modules.DownloadQueued},
+		{1, 0, modules.DownloadActive},
+	}
+	queue := rt.renter.DownloadQueue()
+	if len(queue) != len(exp) {
+		t.Fatalf("expected %v downloads, got %v", len(exp), len(queue))
+	}
+	for i, d := range queue {
+		if d.ID != exp[i].id || d.Priority != exp[i].priority || d.State != exp[i].state {
+			t.Errorf("download %v: expected %v, got %v %v %v", i, exp[i], d.ID, d.Priority, d.State)
+		}
+	}
+	if queue[0].Error != "failed" {
+		t.Error("expected the error of the failed download to be reported, got", queue[0].Error)
+	}
+}
+
+// TestRenterCancelDownload checks that cancelling a download fails it and
+// drops the pieces that arrive for it, and that finished and unknown downloads
+// cannot be cancelled.
+func TestRenterCancelDownload(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	downloads := make([]*download, 2)
+	for i := range downloads {
+		downloads[i] = newDownload(newTestingFile(), NewDownloadHttpWriter(new(bytes.Buffer), 0, 0))
+		downloads[i].id = uint64(i + 1)
+	}
+	downloads[1].fail(errors.New("failed"))
+	rt.renter.downloadQueue = downloads
+
+	if err := rt.renter.CancelDownload(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := downloads[0].Err(); err != errDownloadCancelled {
+		t.Fatal("expected errDownloadCancelled, got", err)
+	}
+	if err := downloads[1].Err(); err == errDownloadCancelled {
+		t.Fatal("wrong download was cancelled")
+	}
+	if queue := rt.renter.DownloadQueue(); queue[1].State != modules.DownloadFailed || queue[1].Error != errDownloadCancelled.Error() {
+		t.Fatalf("cancelled download is not reported as failed: %+v", queue[1])
+	}
+
+	for id, exp := range map[uint64]error{1: errDownloadFinished, 2: errDownloadFinished, 3: errUnknownDownload} {
+		if err := rt.renter.CancelDownload(id); err != exp {
+			t.Errorf("download %v: expected %v, got %v", id, exp, err)
+		}
+	}
+
+	// A piece that arrives for the cancelled download is dropped along with
+	// its chunk instead of being recovered.
+	workerID := types.FileContractID{1}
+	id := rt.renter.mu.Lock()
+	rt.renter.workerPool[workerID] = &worker{contractID: workerID}
+	rt.renter.mu.Unlock(id)
+	cd := &chunkDownload{download: downloads[0], completedPieces: make(map[uint64][]byte)}
+	ds := &downloadState{
+		activePieces:  1,
+		activeWorkers: map[types.FileContractID]struct{}{workerID: {}},
+		resultChan:    make(chan finishedDownload, 1),
+	}
+	ds.resultChan <- finishedDownload{cd, []byte{1}, nil, 0, workerID, 0}
+	rt.renter.managedWaitOnDownloadWork(ds)
+	rt.renter.managedScheduleIncompleteChunks(ds)
+	if len(cd.completedPieces) != 0 || cd.recovered || ds.activePieces != 0 || len(ds.incompleteChunks) != 0 {
+		t.Fatalf("piece of the cancelled download was not dropped: %v active pieces, %v incomplete chunks", ds.activePieces, len(ds.incompleteChunks))
+	}
+}
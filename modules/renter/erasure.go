@@ -1,6 +1,7 @@
 package renter
 
 import (
+	"fmt"
 	"io"
 
 	"github.com/klauspost/reedsolomon"
@@ -65,3 +66,14 @@ func NewRSCode(nData, nParity int) (modules.ErasureCoder, error) {
 		dataPieces: nData,
 	}, nil
 }
+
+// erasureScheme returns a short description of an erasure code, such as
+// "Reed-Solomon 10+20" for a Reed-Solomon code with 10 data pieces and 20
+// parity pieces. Unknown codes are described by the empty string.
+func erasureScheme(code modules.ErasureCoder) string {
+	rs, ok := code.(*rsCode)
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("Reed-Solomon %d+%d", rs.dataPieces, rs.numPieces-rs.dataPieces)
+}
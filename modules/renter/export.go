@@ -0,0 +1,148 @@
+package renter
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"sort"
+
+	"github.com/NebulousLabs/Sia/modules/renter/contractor"
+)
+
+const (
+	coldExportHeader  = "Sia Renter Cold Export"
+	coldExportVersion = "1.0"
+)
+
+var (
+	errBadColdExport    = errors.New("not a renter cold export")
+	errNoContractExport = errors.New("the renter's contractor does not support exporting contracts")
+)
+
+// A coldExport contains everything needed to reconstruct a renter on another
+// machine: its contracts, including their secret keys and latest revision
+// transactions, and the metadata of its files, including their master keys.
+// The files of each namespace are stored in the .sia format.
+type coldExport struct {
+	Header    string                    `json:"header"`
+	Version   string                    `json:"version"`
+	Contracts contractor.ContractExport `json:"contracts"`
+	Files     map[string][]byte         `json:"files"`
+}
+
+// A contractExporter is a hostContractor whose contracts can be exported and
+// imported.
+type contractExporter interface {
+	ExportContracts() contractor.ContractExport
+	ImportContracts(contractor.ContractExport) (int, error)
+}
+
+// Enforce that the contractor supports cold exports.
+var _ contractExporter = (*contractor.Contractor)(nil)
+
+// ColdExport writes a cold export of the renter to w, which can be loaded
+// into a renter on another machine using ColdImport. Unlike a backup, the
+// export does not depend on the wallet seed, so it can be handed to a recovery
+// service, but anyone who holds it can spend the remaining funds of the
+// renter's contracts and decrypt its files, so it must be stored securely.
+func (r *Renter) ColdExport(w io.Writer) error {
+	ce, ok := r.hostContractor.(contractExporter)
+	if !ok {
+		return errNoContractExport
+	}
+	export := coldExport{
+		Header:    coldExportHeader,
+		Version:   coldExportVersion,
+		Contracts: ce.ExportContracts(),
+		Files:     make(map[string][]byte),
+	}
+
+	lockID := r.mu.RLock()
+	namespaces := make(map[string][]*file)
+	for _, f := range r.files {
+		namespaces[f.namespace] = append(namespaces[f.namespace], f)
+	}
+	for ns, files := range namespaces {
+		sort.Slice(files, func(i, j int) bool {
+			return files[i].name < files[j].name
+		})
+		buf := new(bytes.Buffer)
+		if err := shareFiles(files, buf); err != nil {
+			r.mu.RUnlock(lockID)
+			return err
+		}
+		export.Files[ns] = buf.Bytes()
+	}
+	r.mu.RUnlock(lockID)
+
+	return json.NewEncoder(w).Encode(export)
+}
+
+// ColdImport reads a cold export written by ColdExport from reader, adds its
+// contracts to the renter's contractor, and registers its files in the renter.
+// It returns the number of contracts that were added, which excludes those the
+// contractor already knew about. If any of the files are already in use,
+// ErrPathOverload is returned and nothing is imported. The imported files are
+// not tracked for repair.
+func (r *Renter) ColdImport(reader io.Reader) (int, error) {
+	if err := r.addThread(); err != nil {
+		return 0, err
+	}
+	defer r.tg.Done()
+	ce, ok := r.hostContractor.(contractExporter)
+	if !ok {
+		return 0, errNoContractExport
+	}
+	var export coldExport
+	if err := json.NewDecoder(reader).Decode(&export); err != nil {
+		return 0, err
+	} else if export.Header != coldExportHeader {
+		return 0, errBadColdExport
+	} else if export.Version != coldExportVersion {
+		return 0, ErrIncompatible
+	}
+	var files []*file
+	for ns, data := range export.Files {
+		nsFiles, err := readSharedFiles(bytes.NewReader(data))
+		if err != nil {
+			return 0, err
+		}
+		if ns != versionNamespace {
+			if err := validateNamespace(ns); err != nil {
+				return 0, err
+			}
+		}
+		for _, f := range nsFiles {
+			f.namespace = ns
+		}
+		files = append(files, nsFiles...)
+	}
+
+	lockID := r.mu.Lock()
+	defer r.mu.Unlock(lockID)
+	imported := make(map[string]struct{})
+	for _, f := range files {
+		if err := r.validateNickname(f.name); err != nil {
+			return 0, err
+		}
+		if _, exists := imported[f.key()]; exists {
+			return 0, ErrPathOverload
+		} else if _, exists := r.files[f.key()]; exists {
+			return 0, ErrPathOverload
+		}
+		imported[f.key()] = struct{}{}
+	}
+
+	added, err := ce.ImportContracts(export.Contracts)
+	if err != nil {
+		return 0, err
+	}
+	for _, f := range files {
+		if err := r.saveFile(f); err != nil {
+			return added, err
+		}
+		r.files[f.key()] = f
+	}
+	return added, nil
+}
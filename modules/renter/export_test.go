@@ -0,0 +1,108 @@
+package renter
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/modules/renter/contractor"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// exportContractor is an onlineContractor that exports a fixed set of
+// contracts, and records the contracts imported into it.
+type exportContractor struct {
+	onlineContractor
+	export   contractor.ContractExport
+	imported *contractor.ContractExport
+}
+
+func (ec exportContractor) ExportContracts() contractor.ContractExport { return ec.export }
+func (ec exportContractor) ImportContracts(export contractor.ContractExport) (int, error) {
+	*ec.imported = export
+	return len(export.Contracts), nil
+}
+
+// TestRenterColdExport checks that a cold export of one renter contains its
+// contracts and the files of every namespace, and that it can be imported
+// into another renter.
+func TestRenterColdExport(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	contract := modules.RenterContract{
+		ID:              types.FileContractID{1},
+		NetAddress:      "foo:1",
+		LastRevisionTxn: types.Transaction{TransactionSignatures: []types.TransactionSignature{{Signature: []byte("sig")}}},
+	}
+	contract.SecretKey[0] = 1
+	hc := exportContractor{
+		export:   contractor.ContractExport{Contracts: []modules.RenterContract{contract}},
+		imported: new(contractor.ContractExport),
+	}
+	rt, err := newContractorTester(t.Name(), closeHostDB{}, hc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	one := newTestingFile()
+	one.name = "one"
+	one.contracts = map[types.FileContractID]fileContract{
+		{1}: {ID: types.FileContractID{1}, IP: "foo:1", Pieces: []pieceData{{0, 0, crypto.Hash{1}}}},
+	}
+	two := newTestingFile()
+	two.contracts = make(map[types.FileContractID]fileContract)
+	two.name = "two"
+	two.namespace = "ns"
+	id := rt.renter.mu.Lock()
+	rt.renter.files[one.key()] = one
+	rt.renter.files[two.key()] = two
+	rt.renter.mu.Unlock(id)
+
+	buf := new(bytes.Buffer)
+	if err := rt.renter.ColdExport(buf); err != nil {
+		t.Fatal(err)
+	}
+	export := buf.Bytes()
+
+	hc2 := exportContractor{imported: new(contractor.ContractExport)}
+	rt2, err := newContractorTester(t.Name()+"2", closeHostDB{}, hc2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt2.Close()
+
+	if _, err := rt2.renter.ColdImport(strings.NewReader(`{"header":"foo"}`)); err != errBadColdExport {
+		t.Fatal("expected errBadColdExport, got", err)
+	}
+	added, err := rt2.renter.ColdImport(bytes.NewReader(export))
+	if err != nil {
+		t.Fatal(err)
+	} else if added != 1 {
+		t.Fatal("expected 1 contract to be added, got", added)
+	}
+	imported := hc2.imported.Contracts
+	if len(imported) != 1 || imported[0].ID != contract.ID || imported[0].SecretKey != contract.SecretKey || !reflect.DeepEqual(imported[0].LastRevisionTxn, contract.LastRevisionTxn) {
+		t.Fatalf("expected contract %v to be imported, got %v", contract, imported)
+	}
+	for _, f := range []*file{one, two} {
+		restored, exists := rt2.renter.files[f.key()]
+		if !exists {
+			t.Fatalf("file %q in namespace %q was not imported", f.name, f.namespace)
+		}
+		if err := equalFiles(restored, f); err != nil {
+			t.Fatal(err)
+		} else if !reflect.DeepEqual(restored.contracts, f.contracts) {
+			t.Fatalf("expected contracts %v, got %v", f.contracts, restored.contracts)
+		}
+	}
+
+	// Importing the export again fails, because the files already exist.
+	if _, err := rt2.renter.ColdImport(bytes.NewReader(export)); err != ErrPathOverload {
+		t.Fatal("expected ErrPathOverload, got", err)
+	}
+}
@@ -1,9 +1,12 @@
 package renter
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
 	"os"
-	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 
 	"github.com/NebulousLabs/Sia/build"
@@ -16,6 +19,18 @@ var (
 	ErrEmptyFilename = errors.New("filename must be a nonempty string")
 	ErrUnknownPath   = errors.New("no file known with that path")
 	ErrPathOverload  = errors.New("a file already exists at that location")
+	ErrFileSealed    = errors.New("file is sealed and cannot be modified")
+
+	errInsufficientAvailablePieces = errors.New("not enough available pieces to recover file")
+	errMergeChecksum               = errors.New("cannot merge files with different checksums")
+	errMergeKeys                   = errors.New("cannot merge files encrypted with different keys; their pieces are not interchangeable")
+	errMergeMismatch               = errors.New("cannot merge files with different contents or erasure schemes")
+	errMergeSelf                   = errors.New("cannot merge a file with itself")
+	errUnknownPiece                = errors.New("file has no piece with that index")
+	errRotateUntracked             = errors.New("cannot rotate the key of a file without a local copy")
+	errBadFileSort                 = errors.New("files can only be sorted by name, size, expiration or health")
+	errNegativePage                = errors.New("offset and limit cannot be negative")
+	errEmptyPrefix                 = errors.New("prefix must be a nonempty string")
 )
 
 // A file is a single file that has been uploaded to the network. Files are
@@ -23,14 +38,49 @@ var (
 // Each piece is separately encrypted, using a key derived from the file's
 // master key. The pieces are uploaded to hosts in groups, such that one file
 // contract covers many pieces.
+//
+// The master key of a file never changes. RotateKey changes the key of a
+// nickname by replacing its file in r.files, so code that holds a *file may
+// hold one that is no longer r.files[f.key()].
 type file struct {
 	name        string
+	namespace   string // Static - can be accessed without lock.
 	size        uint64 // Static - can be accessed without lock.
 	contracts   map[types.FileContractID]fileContract
 	masterKey   crypto.TwofishKey    // Static - can be accessed without lock.
 	erasureCode modules.ErasureCoder // Static - can be accessed without lock.
 	pieceSize   uint64               // Static - can be accessed without lock.
+	checksum    crypto.Hash          // Static - can be accessed without lock.
 	mode        uint32               // actually an os.FileMode
+	pinned      bool                 // pinned files are excluded from automatic deletion
+	sealed      bool                 // sealed files cannot be renamed, modified, or deleted
+	tags        []string             // distinct tags, in the order they were added
+	metadata    map[string]string    // user metadata; replaced rather than modified, so it can be shared
+
+	// policy is the file's own redundancy policy. The renter's policy applies
+	// if it is the zero policy.
+	policy modules.RedundancyPolicy
+
+	// verified holds the height at which each piece index was last confirmed
+	// to be present on its hosts.
+	verified map[uint64]types.BlockHeight
+
+	// dedupKeys holds the piece keys of the chunks whose pieces are shared
+	// with an identical chunk of another file, and which are therefore
+	// encrypted with that file's keys.
+	dedupKeys map[uint64][]crypto.TwofishKey
+
+	// compressed files were compressed before they were split into chunks.
+	// Their size is the compressed size, and rawSize is the size of their
+	// contents.
+	compressed bool   // Static - can be accessed without lock.
+	rawSize    uint64 // Static - can be accessed without lock.
+
+	// uploads is the number of pieces of the file that workers are uploading.
+	// A file whose key was rotated no longer receives new uploads, and its
+	// sectors are deleted once its last upload finishes.
+	uploads int
+	rotated bool
 
 	mu sync.RWMutex
 }
@@ -56,11 +106,68 @@ type pieceData struct {
 	MerkleRoot crypto.Hash // the Merkle root of the piece
 }
 
+// A filePiece identifies a single piece of a file together with the contract
+// that stores it.
+type filePiece struct {
+	ContractID types.FileContractID
+	HostIP     modules.NetAddress
+	pieceData
+}
+
+// A FileSnapshot is a point-in-time view of a file. It contains only plain
+// values, so it can be held and passed around without any locking.
+type FileSnapshot struct {
+	Name          string            `json:"name"`
+	Available     bool              `json:"available"`
+	Redundancy    float64           `json:"redundancy"`
+	TimeRemaining types.BlockHeight `json:"timeremaining"`
+}
+
+// A RenewalHint names a contract that is nearing the start of its proof
+// window, together with the host it is formed with and the files that store
+// pieces in it.
+type RenewalHint struct {
+	ContractID      types.FileContractID `json:"contractid"`
+	HostIP          modules.NetAddress   `json:"hostip"`
+	BlocksRemaining types.BlockHeight    `json:"blocksremaining"`
+	Nicknames       []string             `json:"nicknames"`
+}
+
 // deriveKey derives the key used to encrypt and decrypt a specific file piece.
 func deriveKey(masterKey crypto.TwofishKey, chunkIndex, pieceIndex uint64) crypto.TwofishKey {
 	return crypto.TwofishKey(crypto.HashAll(masterKey, chunkIndex, pieceIndex))
 }
 
+// pieceKey returns the key used to encrypt and decrypt the piece with the
+// given index of the chunk with the given index, given the master key of its
+// file and the chunk's dedup keys, which are nil unless the chunk shares its
+// pieces with another file.
+func pieceKey(masterKey crypto.TwofishKey, chunkKeys []crypto.TwofishKey, chunkIndex, pieceIndex uint64) crypto.TwofishKey {
+	if pieceIndex < uint64(len(chunkKeys)) {
+		return chunkKeys[pieceIndex]
+	}
+	return deriveKey(masterKey, chunkIndex, pieceIndex)
+}
+
+// sameDedupKeys reports whether a and b hold the same dedup keys.
+func sameDedupKeys(a, b map[uint64][]crypto.TwofishKey) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for chunk, keys := range a {
+		other, ok := b[chunk]
+		if !ok || len(other) != len(keys) {
+			return false
+		}
+		for i := range keys {
+			if keys[i] != other[i] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
 // chunkSize returns the size of one chunk.
 func (f *file) chunkSize() uint64 {
 	return f.pieceSize * uint64(f.erasureCode.MinPieces())
@@ -80,6 +187,12 @@ func (f *file) numChunks() uint64 {
 	return n
 }
 
+// keyless indicates whether the file was imported without its encryption key,
+// in which case its contents cannot be decrypted.
+func (f *file) keyless() bool {
+	return f.masterKey == crypto.TwofishKey{}
+}
+
 // available indicates whether the file is ready to be downloaded.
 func (f *file) available(isOffline func(types.FileContractID) bool) bool {
 	chunkPieces := make([]int, f.numChunks())
@@ -88,6 +201,10 @@ func (f *file) available(isOffline func(types.FileContractID) bool) bool {
 			continue
 		}
 		for _, p := range fc.Pieces {
+			// skip pieces that refer to a nonexistent chunk
+			if p.Chunk >= uint64(len(chunkPieces)) {
+				continue
+			}
 			chunkPieces[p.Chunk]++
 		}
 	}
@@ -134,6 +251,10 @@ func (f *file) redundancy(isOffline func(types.FileContractID) bool) float64 {
 			continue
 		}
 		for _, p := range fc.Pieces {
+			// skip pieces that refer to a nonexistent chunk
+			if p.Chunk >= uint64(len(piecesPerChunk)) {
+				continue
+			}
 			piecesPerChunk[p.Chunk]++
 		}
 	}
@@ -146,6 +267,85 @@ func (f *file) redundancy(isOffline func(types.FileContractID) bool) float64 {
 	return float64(minPieces) / float64(f.erasureCode.MinPieces())
 }
 
+// effectiveRedundancy is like redundancy, but counts the distinct hosts that
+// store the pieces of each chunk instead of the pieces themselves. Pieces
+// stored on the same host are lost together, so they only add durability once.
+func (f *file) effectiveRedundancy(isOffline func(types.FileContractID) bool) float64 {
+	if f.size == 0 {
+		return -1
+	}
+	if f.numChunks() == 0 {
+		build.Critical("cannot get redundancy of a file with 0 chunks")
+		return -1
+	}
+	return float64(f.minChunkHosts(isOffline)) / float64(f.erasureCode.MinPieces())
+}
+
+// recoverableFromHosts returns the number of distinct hosts needed to recover
+// the file, and the lowest number of distinct hosts that store available
+// pieces of any chunk. Pieces on the same host are lost together, so they are
+// counted once. If hosts is lower than needed, the file depends on too few
+// hosts to be durable, even if enough pieces are available.
+func (f *file) recoverableFromHosts(isOffline func(types.FileContractID) bool) (needed, hosts int) {
+	return f.erasureCode.MinPieces(), f.minChunkHosts(isOffline)
+}
+
+// minChunkHosts returns the lowest number of distinct hosts that store
+// available pieces of any one chunk of the file.
+func (f *file) minChunkHosts(isOffline func(types.FileContractID) bool) int {
+	hostsPerChunk := make([]map[modules.NetAddress]struct{}, f.numChunks())
+	if len(hostsPerChunk) == 0 {
+		return 0
+	}
+	for _, fc := range f.contracts {
+		if isOffline(fc.ID) {
+			continue
+		}
+		for _, p := range fc.Pieces {
+			if p.Chunk >= uint64(len(hostsPerChunk)) {
+				continue
+			}
+			if hostsPerChunk[p.Chunk] == nil {
+				hostsPerChunk[p.Chunk] = make(map[modules.NetAddress]struct{})
+			}
+			hostsPerChunk[p.Chunk][fc.IP] = struct{}{}
+		}
+	}
+	minHosts := len(hostsPerChunk[0])
+	for _, hosts := range hostsPerChunk {
+		if len(hosts) < minHosts {
+			minHosts = len(hosts)
+		}
+	}
+	return minHosts
+}
+
+// missingPieces returns the number of pieces that would need to be uploaded
+// for every chunk of the file to have all of its pieces available. Pieces in
+// offline contracts are counted as missing.
+func (f *file) missingPieces(isOffline func(types.FileContractID) bool) int {
+	availablePieces := make([]map[uint64]struct{}, f.numChunks())
+	for _, fc := range f.contracts {
+		if isOffline(fc.ID) {
+			continue
+		}
+		for _, p := range fc.Pieces {
+			if p.Chunk >= uint64(len(availablePieces)) || p.Piece >= uint64(f.erasureCode.NumPieces()) {
+				continue
+			}
+			if availablePieces[p.Chunk] == nil {
+				availablePieces[p.Chunk] = make(map[uint64]struct{})
+			}
+			availablePieces[p.Chunk][p.Piece] = struct{}{}
+		}
+	}
+	var missing int
+	for _, pieces := range availablePieces {
+		missing += f.erasureCode.NumPieces() - len(pieces)
+	}
+	return missing
+}
+
 // expiration returns the lowest height at which any of the file's contracts
 // will expire.
 func (f *file) expiration() types.BlockHeight {
@@ -161,6 +361,242 @@ func (f *file) expiration() types.BlockHeight {
 	return lowest
 }
 
+// contractWindowSpread returns the earliest and latest WindowStart of the
+// contracts that store available pieces of the file. A small spread means
+// that the contracts expire at around the same time. 0 is returned for both if
+// the file has no available pieces.
+func (f *file) contractWindowSpread(isOffline func(types.FileContractID) bool) (earliest, latest types.BlockHeight) {
+	first := true
+	for _, fc := range f.contracts {
+		if len(fc.Pieces) == 0 || isOffline(fc.ID) {
+			continue
+		}
+		if first || fc.WindowStart < earliest {
+			earliest = fc.WindowStart
+		}
+		if first || fc.WindowStart > latest {
+			latest = fc.WindowStart
+		}
+		first = false
+	}
+	return earliest, latest
+}
+
+// timeRemaining returns the number of blocks between the provided height and
+// the expiration of the file's soonest expiring contract. 0 is returned if the
+// file has no contracts or a contract has already expired.
+func (f *file) timeRemaining(height types.BlockHeight) types.BlockHeight {
+	expiration := f.expiration()
+	if expiration <= height {
+		return 0
+	}
+	return expiration - height
+}
+
+// downloadPlan returns a minimal set of pieces that is sufficient to recover
+// every chunk of the file: MinPieces pieces with distinct piece indices per
+// chunk, taken from contracts that are not offline. Where possible, the pieces
+// of a chunk are spread across distinct hosts. The plan is ordered by chunk.
+// An error is returned if any chunk does not have enough available pieces.
+func (f *file) downloadPlan(isOffline func(types.FileContractID) bool) ([]filePiece, error) {
+	candidates := make([][]filePiece, f.numChunks())
+	for _, fc := range f.contracts {
+		if isOffline(fc.ID) {
+			continue
+		}
+		for _, p := range fc.Pieces {
+			if p.Chunk >= uint64(len(candidates)) {
+				continue
+			}
+			candidates[p.Chunk] = append(candidates[p.Chunk], filePiece{
+				ContractID: fc.ID,
+				HostIP:     fc.IP,
+				pieceData:  p,
+			})
+		}
+	}
+
+	minPieces := f.erasureCode.MinPieces()
+	var plan []filePiece
+	for _, pieces := range candidates {
+		// Sort the candidates so that the plan is deterministic.
+		sort.Slice(pieces, func(i, j int) bool {
+			if pieces[i].Piece != pieces[j].Piece {
+				return pieces[i].Piece < pieces[j].Piece
+			}
+			return bytes.Compare(pieces[i].ContractID[:], pieces[j].ContractID[:]) < 0
+		})
+
+		// Select pieces on unused hosts first, then fall back to pieces on
+		// hosts that have already been selected for this chunk.
+		usedPieces := make(map[uint64]struct{})
+		usedHosts := make(map[modules.NetAddress]struct{})
+		var selected []filePiece
+		for _, distinctHosts := range []bool{true, false} {
+			for _, p := range pieces {
+				if len(selected) == minPieces {
+					break
+				}
+				if _, exists := usedPieces[p.Piece]; exists {
+					continue
+				}
+				if _, exists := usedHosts[p.HostIP]; exists && distinctHosts {
+					continue
+				}
+				usedPieces[p.Piece] = struct{}{}
+				usedHosts[p.HostIP] = struct{}{}
+				selected = append(selected, p)
+			}
+		}
+		if len(selected) < minPieces {
+			return nil, errInsufficientAvailablePieces
+		}
+		plan = append(plan, selected...)
+	}
+	return plan, nil
+}
+
+// hostPieceCount returns the number of pieces of the given chunk that are
+// stored on the host at the given address.
+func (f *file) hostPieceCount(chunk uint64, host modules.NetAddress) int {
+	n := 0
+	for _, fc := range f.contracts {
+		if fc.IP != host {
+			continue
+		}
+		for _, p := range fc.Pieces {
+			if p.Chunk == chunk {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// validateHostDistribution returns an error naming the offending host if any
+// host stores more than maxPerHost pieces of a single chunk. Hosts are
+// identified by their address, so that renewed contracts with the same host
+// count towards the same total.
+func (f *file) validateHostDistribution(maxPerHost int) error {
+	counts := make(map[uint64]map[modules.NetAddress]int)
+	for _, fc := range f.contracts {
+		for _, p := range fc.Pieces {
+			if counts[p.Chunk] == nil {
+				counts[p.Chunk] = make(map[modules.NetAddress]int)
+			}
+			counts[p.Chunk][fc.IP]++
+			if counts[p.Chunk][fc.IP] > maxPerHost {
+				return fmt.Errorf("host %v holds more than %v pieces of chunk %v", fc.IP, maxPerHost, p.Chunk)
+			}
+		}
+	}
+	return nil
+}
+
+// A byteRange is a range of bytes of a file. End is exclusive.
+type byteRange struct {
+	Start, End uint64
+}
+
+// verifyPieceCoverage checks that every chunk of f has enough distinct pieces
+// in contracts that are not offline to be recovered, and returns the ranges of
+// the file that cannot be recovered. Unlike available, multiple copies of the
+// same piece are only counted once, since they do not help recover the chunk.
+// Adjacent unrecoverable chunks are reported as a single range.
+func (f *file) verifyPieceCoverage(isOffline func(types.FileContractID) bool) (covered bool, gaps []byteRange) {
+	chunkPieces := make([]map[uint64]struct{}, f.numChunks())
+	for _, fc := range f.contracts {
+		if isOffline(fc.ID) {
+			continue
+		}
+		for _, p := range fc.Pieces {
+			if p.Chunk >= uint64(len(chunkPieces)) || p.Piece >= uint64(f.erasureCode.NumPieces()) {
+				continue
+			}
+			if chunkPieces[p.Chunk] == nil {
+				chunkPieces[p.Chunk] = make(map[uint64]struct{})
+			}
+			chunkPieces[p.Chunk][p.Piece] = struct{}{}
+		}
+	}
+
+	chunkSize := f.chunkSize()
+	for i, pieces := range chunkPieces {
+		if len(pieces) >= f.erasureCode.MinPieces() {
+			continue
+		}
+		start := uint64(i) * chunkSize
+		end := start + chunkSize
+		if end > f.size {
+			end = f.size
+		}
+		if n := len(gaps); n > 0 && gaps[n-1].End == start {
+			gaps[n-1].End = end
+		} else {
+			gaps = append(gaps, byteRange{start, end})
+		}
+	}
+	return len(gaps) == 0, gaps
+}
+
+// merge adds the pieces of other that are stored in contracts that are not
+// offline to f, skipping pieces that f already stores on the same host. An
+// error is returned if the files do not share the same checksum, keys, and
+// erasure scheme, since their pieces would not be interchangeable.
+func (f *file) merge(other *file, isOffline func(types.FileContractID) bool) error {
+	if f.checksum != other.checksum {
+		return errMergeChecksum
+	}
+	if f.size != other.size || f.pieceSize != other.pieceSize ||
+		f.erasureCode.MinPieces() != other.erasureCode.MinPieces() || f.erasureCode.NumPieces() != other.erasureCode.NumPieces() {
+		return errMergeMismatch
+	}
+	// Every upload is encrypted with a new master key, so two uploads of the
+	// same content only share their pieces' keys if one was copied from the
+	// other. The pieces cannot be re-keyed without uploading them again.
+	if f.masterKey != other.masterKey || !sameDedupKeys(f.dedupKeys, other.dedupKeys) {
+		return errMergeKeys
+	}
+
+	// Determine which pieces f already stores on each host.
+	type hostPiece struct {
+		host         modules.NetAddress
+		chunk, piece uint64
+	}
+	existing := make(map[hostPiece]struct{})
+	for _, fc := range f.contracts {
+		for _, p := range fc.Pieces {
+			existing[hostPiece{fc.IP, p.Chunk, p.Piece}] = struct{}{}
+		}
+	}
+
+	// Add the new pieces.
+	if f.contracts == nil {
+		f.contracts = make(map[types.FileContractID]fileContract)
+	}
+	for _, ofc := range other.contracts {
+		if isOffline(ofc.ID) {
+			continue
+		}
+		fc, exists := f.contracts[ofc.ID]
+		if !exists {
+			fc = fileContract{ID: ofc.ID, IP: ofc.IP, WindowStart: ofc.WindowStart}
+		}
+		for _, p := range ofc.Pieces {
+			hp := hostPiece{ofc.IP, p.Chunk, p.Piece}
+			if _, exists := existing[hp]; exists {
+				continue
+			}
+			existing[hp] = struct{}{}
+			fc.Pieces = append(fc.Pieces, p)
+		}
+		if len(fc.Pieces) > 0 {
+			f.contracts[ofc.ID] = fc
+		}
+	}
+	return nil
+}
+
 // newFile creates a new file object.
 func newFile(name string, code modules.ErasureCoder, pieceSize, fileSize uint64) *file {
 	return &file{
@@ -179,107 +615,1201 @@ func newFile(name string, code modules.ErasureCoder, pieceSize, fileSize uint64)
 // TODO: The data is not cleared from any contracts where the host is not
 // immediately online.
 func (r *Renter) DeleteFile(nickname string) error {
+	return r.DeleteNS("", nickname)
+}
+
+// DeleteNS removes the file with the given nickname in namespace ns from the
+// renter, like DeleteFile.
+func (r *Renter) DeleteNS(ns, nickname string) error {
+	if err := r.addThread(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	if err := validateNamespace(ns); err != nil {
+		return err
+	}
 	lockID := r.mu.Lock()
-	f, exists := r.files[nickname]
+	key := nsKey(ns, nickname)
+	f, exists := r.files[key]
 	if !exists {
 		r.mu.Unlock(lockID)
 		return ErrUnknownPath
 	}
-	delete(r.files, nickname)
-	os.RemoveAll(filepath.Join(r.persistDir, f.name+ShareExtension))
-	r.saveSync()
+	if f.isSealed() {
+		r.mu.Unlock(lockID)
+		return ErrFileSealed
+	}
+	delete(r.files, key)
+	r.untrack(key)
+	os.RemoveAll(r.sharePath(ns, f.name))
+	r.save()
+	r.noteUnusedHosts([]*file{f})
+	sectors := r.unusedSectors([]*file{f})
 	r.mu.Unlock(lockID)
 
 	// delete the file's associated contract data.
-	f.mu.Lock()
-	defer f.mu.Unlock()
+	go r.threadedDeleteSectors(sectors)
+	return nil
+}
 
-	// TODO: delete the sectors of the file as well.
+// unusedSectors returns the Merkle roots of the sectors that store pieces of
+// the deleted files, grouped by contract. Sectors that also store pieces of a
+// remaining file are left out. The renter's lock must be held.
+func (r *Renter) unusedSectors(deleted []*file) map[types.FileContractID][]crypto.Hash {
+	used := make(map[types.FileContractID]map[crypto.Hash]struct{})
+	for _, f := range r.files {
+		f.mu.RLock()
+		for _, fc := range f.contracts {
+			id := r.hostContractor.ResolveID(fc.ID)
+			if used[id] == nil {
+				used[id] = make(map[crypto.Hash]struct{})
+			}
+			for _, p := range fc.Pieces {
+				used[id][p.MerkleRoot] = struct{}{}
+			}
+		}
+		f.mu.RUnlock()
+	}
 
-	return nil
+	sectors := make(map[types.FileContractID][]crypto.Hash)
+	for _, f := range deleted {
+		f.mu.RLock()
+		for _, fc := range f.contracts {
+			id := r.hostContractor.ResolveID(fc.ID)
+			for _, p := range fc.Pieces {
+				if _, exists := used[id][p.MerkleRoot]; exists {
+					continue
+				}
+				if used[id] == nil {
+					used[id] = make(map[crypto.Hash]struct{})
+				}
+				used[id][p.MerkleRoot] = struct{}{}
+				sectors[id] = append(sectors[id], p.MerkleRoot)
+			}
+		}
+		f.mu.RUnlock()
+	}
+	return sectors
+}
+
+// threadedDeleteSectors deletes sectors from the contracts that store them,
+// freeing up the storage in the contracts. The hosts are contacted in
+// parallel, so that slow hosts do not hold up the others. Hosts that cannot be
+// reached keep the sectors until their contracts expire.
+func (r *Renter) threadedDeleteSectors(sectors map[types.FileContractID][]crypto.Hash) {
+	if len(sectors) == 0 || r.tg.Add() != nil {
+		return
+	}
+	defer r.tg.Done()
+
+	var wg sync.WaitGroup
+	for id, roots := range sectors {
+		wg.Add(1)
+		go func(id types.FileContractID, roots []crypto.Hash) {
+			defer wg.Done()
+			e, err := r.hostContractor.Editor(id, r.tg.StopChan())
+			if err != nil {
+				r.log.Debugln("Could not delete sectors from contract", id, "-", err)
+				return
+			}
+			defer e.Close()
+			for _, root := range roots {
+				if err := e.Delete(root); err != nil {
+					r.log.Debugln("Could not delete sector from contract", id, "-", err)
+					return
+				}
+			}
+		}(id, roots)
+	}
+	wg.Wait()
 }
 
-// FileList returns all of the files that the renter has.
+// contractOffline reports whether the pieces stored in a contract should be
+// considered unavailable, either because the host is offline or has been
+// marked offline, or because the contract is unknown or will not be renewed.
+func (r *Renter) contractOffline(id types.FileContractID) bool {
+	id = r.hostContractor.ResolveID(id)
+	offline := r.hostContractor.IsOffline(id)
+	contract, exists := r.hostContractor.ContractByID(id)
+	if !exists {
+		return true
+	}
+	return offline || !contract.GoodForRenew || r.offlineHosts.contains(contract.NetAddress)
+}
+
+// FileList returns all of the files that the renter has in the default
+// namespace.
 func (r *Renter) FileList() []modules.FileInfo {
+	return r.FileListNS("")
+}
+
+// FileListNS returns all of the files that the renter has in namespace ns.
+func (r *Renter) FileListNS(ns string) []modules.FileInfo {
 	var files []*file
 	lockID := r.mu.RLock()
 	for _, f := range r.files {
-		files = append(files, f)
-	}
-	r.mu.RUnlock(lockID)
-
-	isOffline := func(id types.FileContractID) bool {
-		id = r.hostContractor.ResolveID(id)
-		offline := r.hostContractor.IsOffline(id)
-		contract, exists := r.hostContractor.ContractByID(id)
-		if !exists {
-			return true
+		if f.namespace == ns {
+			files = append(files, f)
 		}
-		return offline || !contract.GoodForRenew
 	}
+	r.mu.RUnlock(lockID)
 
 	var fileList []modules.FileInfo
 	for _, f := range files {
 		f.mu.RLock()
-		renewing := true
-		fileList = append(fileList, modules.FileInfo{
-			SiaPath:        f.name,
-			Filesize:       f.size,
-			Renewing:       renewing,
-			Available:      f.available(isOffline),
-			Redundancy:     f.redundancy(isOffline),
-			UploadProgress: f.uploadProgress(),
-			Expiration:     f.expiration(),
-		})
+		fileList = append(fileList, r.fileInfo(f))
 		f.mu.RUnlock()
 	}
 	return fileList
 }
 
-// RenameFile takes an existing file and changes the nickname. The original
-// file must exist, and there must not be any file that already has the
-// replacement nickname.
-func (r *Renter) RenameFile(currentName, newName string) error {
-	lockID := r.mu.Lock()
-	defer r.mu.Unlock(lockID)
+// FileInfoNS returns information on the file with the given nickname in
+// namespace ns.
+func (r *Renter) FileInfoNS(ns, nickname string) (modules.FileInfo, error) {
+	lockID := r.mu.RLock()
+	f, exists := r.files[nsKey(ns, nickname)]
+	r.mu.RUnlock(lockID)
+	if !exists {
+		return modules.FileInfo{}, ErrUnknownPath
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return r.fileInfo(f), nil
+}
 
-	// Check that newName is nonempty.
-	if newName == "" {
-		return ErrEmptyFilename
+// FileListPage returns the files in namespace opts.Namespace selected and
+// ordered by opts, and the number of files whose nicknames start with
+// opts.Prefix. Only the files on the requested page are copied, so listing a
+// page remains fast when the renter has many files. Files with equal sort keys
+// are ordered by nickname.
+func (r *Renter) FileListPage(opts modules.FileListOptions) ([]modules.FileInfo, int, error) {
+	if opts.Offset < 0 || opts.Limit < 0 {
+		return nil, 0, errNegativePage
+	}
+	switch opts.SortBy {
+	case "", modules.FileSortName, modules.FileSortSize, modules.FileSortExpiration, modules.FileSortHealth:
+	default:
+		return nil, 0, errBadFileSort
 	}
 
-	// Check that currentName exists and newName doesn't.
-	file, exists := r.files[currentName]
-	if !exists {
-		return ErrUnknownPath
+	type sortedFile struct {
+		f          *file
+		name       string
+		expiration types.BlockHeight
+		health     float64
 	}
-	_, exists = r.files[newName]
-	if exists {
-		return ErrPathOverload
+	var files []sortedFile
+	lockID := r.mu.RLock()
+	for _, f := range r.files {
+		if f.namespace == opts.Namespace && strings.HasPrefix(f.name, opts.Prefix) {
+			files = append(files, sortedFile{f: f, name: f.name})
+		}
 	}
+	r.mu.RUnlock(lockID)
 
-	// Modify the file and save it to disk.
-	file.mu.Lock()
-	file.name = newName
-	err := r.saveFile(file)
-	file.mu.Unlock()
-	if err != nil {
-		return err
+	// The expiration and health of a file depend on its contracts, so they
+	// are only computed when sorting by them.
+	for i := range files {
+		f := files[i].f
+		f.mu.RLock()
+		switch opts.SortBy {
+		case modules.FileSortExpiration:
+			files[i].expiration = f.expiration()
+		case modules.FileSortHealth:
+			files[i].health = f.redundancy(r.contractOffline)
+		}
+		f.mu.RUnlock()
+	}
+	less := func(a, b sortedFile) bool {
+		switch {
+		case opts.SortBy == modules.FileSortSize && a.f.contentSize() != b.f.contentSize():
+			return a.f.contentSize() < b.f.contentSize()
+		case opts.SortBy == modules.FileSortExpiration && a.expiration != b.expiration:
+			return a.expiration < b.expiration
+		case opts.SortBy == modules.FileSortHealth && a.health != b.health:
+			return a.health < b.health
+		}
+		return a.name < b.name
 	}
+	sort.Slice(files, func(i, j int) bool {
+		if opts.Reverse {
+			return less(files[j], files[i])
+		}
+		return less(files[i], files[j])
+	})
 
-	// Update the entries in the renter.
-	delete(r.files, currentName)
-	r.files[newName] = file
-	if t, ok := r.tracking[currentName]; ok {
-		delete(r.tracking, currentName)
-		r.tracking[newName] = t
+	total := len(files)
+	if opts.Offset > total {
+		opts.Offset = total
 	}
-	err = r.saveSync()
-	if err != nil {
-		return err
+	files = files[opts.Offset:]
+	if opts.Limit != 0 && opts.Limit < len(files) {
+		files = files[:opts.Limit]
+	}
+	fileList := make([]modules.FileInfo, 0, len(files))
+	for _, sf := range files {
+		sf.f.mu.RLock()
+		fileList = append(fileList, r.fileInfo(sf.f))
+		sf.f.mu.RUnlock()
+	}
+	return fileList, total, nil
+}
+
+// fileInfo returns the FileInfo of a file. The file's lock must be held.
+func (r *Renter) fileInfo(f *file) modules.FileInfo {
+	var activePieces int
+	hosts := make(map[modules.NetAddress]struct{})
+	for _, fc := range f.contracts {
+		if len(fc.Pieces) > 0 && !r.contractOffline(fc.ID) {
+			activePieces += len(fc.Pieces)
+			hosts[fc.IP] = struct{}{}
+		}
+	}
+	hostList := make([]modules.NetAddress, 0, len(hosts))
+	for host := range hosts {
+		hostList = append(hostList, host)
+	}
+	sort.Slice(hostList, func(i, j int) bool {
+		return hostList[i] < hostList[j]
+	})
+
+	renewing := true
+	return modules.FileInfo{
+		SiaPath:        f.name,
+		Filesize:       f.contentSize(),
+		Renewing:       renewing,
+		Available:      !f.keyless() && f.available(r.contractOffline),
+		Redundancy:     f.redundancy(r.contractOffline),
+		UploadProgress: f.uploadProgress(),
+		Expiration:     f.expiration(),
+		Pinned:         f.pinned,
+		Sealed:         f.sealed,
+		Compressed:     f.compressed,
+		Metadata:       f.metadata,
+		ActivePieces:   activePieces,
+		Hosts:          hostList,
+		LastRepair:     r.repairStarts.lastCompleted(f.key()),
+
+		RedundancyPolicy: f.policy,
+		Spending:         r.fileSpending(f),
+	}
+}
+
+// fileSpending returns an estimate of how much has been spent on f. The file's
+// lock must be held.
+func (r *Renter) fileSpending(f *file) modules.FileSpending {
+	var spending modules.FileSpending
+	for _, fc := range f.contracts {
+		contract, exists := r.hostContractor.ContractByID(r.hostContractor.ResolveID(fc.ID))
+		sectors := contract.LastRevision.NewFileSize / modules.SectorSize
+		if !exists || len(fc.Pieces) == 0 || sectors == 0 {
+			continue
+		}
+		// The contract's last revision may not yet cover every piece of f,
+		// so the share is capped at the whole contract.
+		pieces := uint64(len(fc.Pieces))
+		if pieces > sectors {
+			pieces = sectors
+		}
+		share := func(c types.Currency) types.Currency {
+			return c.Mul64(pieces).Div64(sectors)
+		}
+		fees := contract.TxnFee.Add(contract.SiafundFee).Add(contract.ContractFee)
+		spending.StorageSpending = spending.StorageSpending.Add(share(contract.StorageSpending))
+		spending.UploadSpending = spending.UploadSpending.Add(share(contract.UploadSpending))
+		spending.ContractFees = spending.ContractFees.Add(share(fees))
+	}
+	return spending
+}
+
+// HealthyFiles returns the files in the default namespace that are available
+// and whose soonest expiring contract ends more than minRemaining blocks from
+// now. These files are safe to serve.
+func (r *Renter) HealthyFiles(minRemaining types.BlockHeight) []modules.FileInfo {
+	height := r.cs.Height()
+	lockID := r.mu.RLock()
+	defer r.mu.RUnlock(lockID)
+
+	var healthy []modules.FileInfo
+	for _, f := range r.files {
+		if f.namespace != "" {
+			continue
+		}
+		f.mu.RLock()
+		if f.timeRemaining(height) > minRemaining && f.available(r.contractOffline) {
+			healthy = append(healthy, r.fileInfo(f))
+		}
+		f.mu.RUnlock()
 	}
+	return healthy
+}
+
+// TimeToFirstLoss returns the number of blocks until the first file in the
+// default namespace becomes unavailable if no repairs or renewals happen,
+// together with its nickname. Files that are already unavailable count as 0
+// blocks. Ties are broken by nickname, and if the renter has no files, 0 and
+// the empty string are returned.
+func (r *Renter) TimeToFirstLoss() (types.BlockHeight, string) {
+	height := r.cs.Height()
+	lockID := r.mu.RLock()
+	defer r.mu.RUnlock(lockID)
+
+	var minRemaining types.BlockHeight
+	var nickname string
+	for name, f := range r.files {
+		if f.namespace != "" {
+			continue
+		}
+		f.mu.RLock()
+		var remaining types.BlockHeight
+		if f.available(r.contractOffline) {
+			remaining = f.timeRemaining(height)
+		}
+		f.mu.RUnlock()
+		if nickname == "" || remaining < minRemaining || (remaining == minRemaining && name < nickname) {
+			minRemaining, nickname = remaining, name
+		}
+	}
+	return minRemaining, nickname
+}
 
-	// Delete the old .sia file.
-	oldPath := filepath.Join(r.persistDir, currentName+ShareExtension)
-	return os.RemoveAll(oldPath)
+// DeleteWhere deletes every file for which pred returns true, and returns the
+// nicknames of the deleted files in sorted order. Pinned files are never
+// deleted, and neither are sealed files. pred is called with a copy of each
+// file's FileInfo while the renter is locked, so it must not call any methods
+// of the renter. Only files in the default namespace are considered.
+func (r *Renter) DeleteWhere(pred func(modules.FileInfo) bool) (deleted []string) {
+	if r.addThread() != nil {
+		return nil
+	}
+	defer r.tg.Done()
+	lockID := r.mu.Lock()
+	var deletedFiles []*file
+	for name, f := range r.files {
+		if f.namespace != "" {
+			continue
+		}
+		f.mu.RLock()
+		info := r.fileInfo(f)
+		f.mu.RUnlock()
+		if info.Pinned || info.Sealed || !pred(info) {
+			continue
+		}
+		delete(r.files, name)
+		r.untrack(name)
+		os.RemoveAll(r.sharePath(f.namespace, f.name))
+		deleted = append(deleted, name)
+		deletedFiles = append(deletedFiles, f)
+	}
+	if len(deleted) > 0 {
+		r.save()
+		r.noteUnusedHosts(deletedFiles)
+	}
+	sectors := r.unusedSectors(deletedFiles)
+	r.mu.Unlock(lockID)
+
+	go r.threadedDeleteSectors(sectors)
+	sort.Strings(deleted)
+	return deleted
+}
+
+// SnapshotFiles returns a snapshot of every file that the renter has in the
+// default namespace, sorted by name. All values are computed when the snapshot
+// is taken; the snapshot holds no references to the renter or its files.
+func (r *Renter) SnapshotFiles() []FileSnapshot {
+	var files []*file
+	lockID := r.mu.RLock()
+	for _, f := range r.files {
+		if f.namespace == "" {
+			files = append(files, f)
+		}
+	}
+	r.mu.RUnlock(lockID)
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].name < files[j].name
+	})
+
+	height := r.cs.Height()
+	snapshots := make([]FileSnapshot, 0, len(files))
+	for _, f := range files {
+		f.mu.RLock()
+		snapshot := FileSnapshot{
+			Name:          f.name,
+			Available:     !f.keyless() && f.available(r.contractOffline),
+			Redundancy:    f.redundancy(r.contractOffline),
+			TimeRemaining: f.timeRemaining(height),
+		}
+		f.mu.RUnlock()
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots
+}
+
+// DiffSince compares a previous result of FileList against the current files
+// of the renter, and returns the nicknames of the files that have been added,
+// the files that have been removed, and the files whose availability or
+// redundancy has changed, each in sorted order. A renamed file is reported as
+// removed under its old nickname and added under its new one.
+func (r *Renter) DiffSince(previous []modules.FileInfo) (added, removed, changed []string) {
+	current := make(map[string]modules.FileInfo)
+	for _, fi := range r.FileList() {
+		current[fi.SiaPath] = fi
+	}
+	seen := make(map[string]struct{})
+	for _, old := range previous {
+		seen[old.SiaPath] = struct{}{}
+		fi, exists := current[old.SiaPath]
+		if !exists {
+			removed = append(removed, old.SiaPath)
+		} else if fi.Available != old.Available || fi.Redundancy != old.Redundancy {
+			changed = append(changed, old.SiaPath)
+		}
+	}
+	for name := range current {
+		if _, exists := seen[name]; !exists {
+			added = append(added, name)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	sort.Strings(changed)
+	return added, removed, changed
+}
+
+// RepairEstimate returns the number of pieces that a full repair would need to
+// upload, and the number of files that need repair. Like the repair loop, it
+// only considers tracked files, and counts every piece that is not available
+// in an online contract.
+func (r *Renter) RepairEstimate() (piecesToRepair int, filesAffected int) {
+	var files []*file
+	lockID := r.mu.RLock()
+	for name, f := range r.files {
+		if _, tracked := r.tracking[name]; tracked {
+			files = append(files, f)
+		}
+	}
+	r.mu.RUnlock(lockID)
+
+	for _, f := range files {
+		f.mu.RLock()
+		missing := f.missingPieces(r.contractOffline)
+		f.mu.RUnlock()
+		if missing > 0 {
+			piecesToRepair += missing
+			filesAffected++
+		}
+	}
+	return piecesToRepair, filesAffected
+}
+
+// FindByChecksum returns the nickname of a file whose contents have the
+// provided checksum. If multiple files have the checksum, the first nickname
+// in sorted order is returned. Files whose checksum is unknown, such as files
+// loaded from older .sia files, and files outside the default namespace are
+// never matched.
+func (r *Renter) FindByChecksum(h crypto.Hash) (nickname string, found bool) {
+	if h == (crypto.Hash{}) {
+		return "", false
+	}
+	lockID := r.mu.RLock()
+	defer r.mu.RUnlock(lockID)
+	for name, f := range r.files {
+		if f.namespace == "" && f.checksum == h && (!found || name < nickname) {
+			nickname, found = name, true
+		}
+	}
+	return nickname, found
+}
+
+// RenewalCandidates returns a hint for every contract used by the renter's
+// files whose proof window starts within the given number of blocks. Each
+// contract appears once, listing every file that stores pieces in it. Hints
+// are sorted by the number of blocks remaining. Contracts whose proof window
+// has already started are not included.
+func (r *Renter) RenewalCandidates(within types.BlockHeight) []RenewalHint {
+	var files []*file
+	lockID := r.mu.RLock()
+	for _, f := range r.files {
+		files = append(files, f)
+	}
+	r.mu.RUnlock(lockID)
+
+	height := r.cs.Height()
+	hints := make(map[types.FileContractID]*RenewalHint)
+	for _, f := range files {
+		f.mu.RLock()
+		for _, fc := range f.contracts {
+			if fc.WindowStart <= height || fc.WindowStart-height > within {
+				continue
+			}
+			hint, exists := hints[fc.ID]
+			if !exists {
+				hint = &RenewalHint{
+					ContractID:      fc.ID,
+					HostIP:          fc.IP,
+					BlocksRemaining: fc.WindowStart - height,
+				}
+				hints[fc.ID] = hint
+			}
+			hint.Nicknames = append(hint.Nicknames, f.name)
+		}
+		f.mu.RUnlock()
+	}
+
+	candidates := make([]RenewalHint, 0, len(hints))
+	for _, hint := range hints {
+		sort.Strings(hint.Nicknames)
+		candidates = append(candidates, *hint)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].BlocksRemaining != candidates[j].BlocksRemaining {
+			return candidates[i].BlocksRemaining < candidates[j].BlocksRemaining
+		}
+		return bytes.Compare(candidates[i].ContractID[:], candidates[j].ContractID[:]) < 0
+	})
+	return candidates
+}
+
+// OrphanContracts returns the contracts in known, in the order given, that do
+// not store any pieces of the renter's files. Contracts whose pieces are
+// currently unavailable, for example because their host is offline, are not
+// orphans. Contract IDs recorded by files are resolved to their latest renewal
+// before they are compared, so known should contain the current IDs of the
+// contracts.
+func (r *Renter) OrphanContracts(known []types.FileContractID) []types.FileContractID {
+	lockID := r.mu.RLock()
+	defer r.mu.RUnlock(lockID)
+	referenced := make(map[types.FileContractID]struct{})
+	for _, f := range r.files {
+		f.mu.RLock()
+		for _, fc := range f.contracts {
+			if len(fc.Pieces) > 0 {
+				referenced[r.hostContractor.ResolveID(fc.ID)] = struct{}{}
+			}
+		}
+		f.mu.RUnlock()
+	}
+
+	var orphans []types.FileContractID
+	for _, id := range known {
+		if _, exists := referenced[id]; !exists {
+			orphans = append(orphans, id)
+		}
+	}
+	return orphans
+}
+
+// ExpirationHistogram groups the renter's files by the time remaining until
+// their soonest expiring contract, rounded down to a multiple of bucketSize,
+// and returns the number of files in each bucket. Files without contracts or
+// with expired contracts are counted in bucket 0. A bucketSize of 0 is treated
+// as 1.
+func (r *Renter) ExpirationHistogram(bucketSize types.BlockHeight) map[types.BlockHeight]int {
+	if bucketSize == 0 {
+		bucketSize = 1
+	}
+	var files []*file
+	lockID := r.mu.RLock()
+	for _, f := range r.files {
+		files = append(files, f)
+	}
+	r.mu.RUnlock(lockID)
+
+	height := r.cs.Height()
+	histogram := make(map[types.BlockHeight]int)
+	for _, f := range files {
+		f.mu.RLock()
+		remaining := f.timeRemaining(height)
+		f.mu.RUnlock()
+		histogram[remaining/bucketSize*bucketSize]++
+	}
+	return histogram
+}
+
+// FilesByScheme groups the nicknames of the files in the default namespace by
+// the erasure scheme they were uploaded with, as described by erasureScheme.
+// The nicknames in each group are sorted.
+func (r *Renter) FilesByScheme() map[string][]string {
+	lockID := r.mu.RLock()
+	defer r.mu.RUnlock(lockID)
+	schemes := make(map[string][]string)
+	for name, f := range r.files {
+		if f.namespace != "" {
+			continue
+		}
+		scheme := erasureScheme(f.erasureCode)
+		schemes[scheme] = append(schemes[scheme], name)
+	}
+	for _, names := range schemes {
+		sort.Strings(names)
+	}
+	return schemes
+}
+
+// SetPinned pins or unpins the file with the given nickname. Pinned files are
+// excluded from automatic deletion, such as by DeleteWhere.
+func (r *Renter) SetPinned(nickname string, pinned bool) error {
+	if err := r.addThread(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	lockID := r.mu.Lock()
+	defer r.mu.Unlock(lockID)
+
+	f, exists := r.files[nickname]
+	if !exists {
+		return ErrUnknownPath
+	}
+	f.mu.Lock()
+	if f.sealed {
+		f.mu.Unlock()
+		return ErrFileSealed
+	}
+	f.pinned = pinned
+	f.mu.Unlock()
+	return r.save()
+}
+
+// isSealed reports whether f has been sealed.
+func (f *file) isSealed() bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.sealed
+}
+
+// Seal seals the file with the given nickname. A sealed file cannot be
+// renamed, deleted, merged, pinned or unpinned, or have its pieces replaced,
+// and it is never deleted automatically. Sealing cannot be undone.
+func (r *Renter) Seal(nickname string) error {
+	if err := r.addThread(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	lockID := r.mu.Lock()
+	defer r.mu.Unlock(lockID)
+
+	f, exists := r.files[nickname]
+	if !exists {
+		return ErrUnknownPath
+	}
+	f.mu.Lock()
+	f.sealed = true
+	f.mu.Unlock()
+	return r.save()
+}
+
+// RenameFile takes an existing file and changes the nickname. The original
+// file must exist, and there must not be any file that already has the
+// replacement nickname.
+func (r *Renter) RenameFile(currentName, newName string) error {
+	return r.RenameNS("", currentName, newName)
+}
+
+// CanRename reports whether RenameFile would succeed, returning the error it
+// would return otherwise. The renter is not modified.
+func (r *Renter) CanRename(currentName, newName string) error {
+	lockID := r.mu.RLock()
+	defer r.mu.RUnlock(lockID)
+	_, err := r.checkRename("", currentName, newName)
+	return err
+}
+
+// checkRename checks that the file currentName in namespace ns can be renamed
+// to newName, and returns the file. The renter's lock must be held.
+func (r *Renter) checkRename(ns, currentName, newName string) (*file, error) {
+	// Check that newName is nonempty and accepted by the validator.
+	if newName == "" {
+		return nil, ErrEmptyFilename
+	}
+	if err := r.validateNickname(newName); err != nil {
+		return nil, err
+	}
+
+	// Check that currentName exists and newName doesn't.
+	file, exists := r.files[nsKey(ns, currentName)]
+	if !exists {
+		return nil, ErrUnknownPath
+	}
+	if file.isSealed() {
+		return nil, ErrFileSealed
+	}
+	if _, exists := r.files[nsKey(ns, newName)]; exists {
+		return nil, ErrPathOverload
+	}
+	return file, nil
+}
+
+// RenameNS renames a file in namespace ns, like RenameFile. Only files in the
+// same namespace conflict with the replacement nickname.
+func (r *Renter) RenameNS(ns, currentName, newName string) error {
+	if err := r.addThread(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	if err := validateNamespace(ns); err != nil {
+		return err
+	}
+	lockID := r.mu.Lock()
+	defer r.mu.Unlock(lockID)
+
+	renames := map[string]string{currentName: newName}
+	if err := r.checkRenames(ns, renames); err != nil {
+		return err
+	}
+	if err := r.moveFiles(ns, renames); err != nil {
+		return err
+	}
+	return r.save()
+}
+
+// RenameFiles renames every file in renames, which maps the current nicknames
+// of files to their replacement nicknames. Either every file is renamed, or
+// none are, and the renter's metadata is only saved once.
+func (r *Renter) RenameFiles(renames map[string]string) error {
+	if err := r.addThread(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	lockID := r.mu.Lock()
+	defer r.mu.Unlock(lockID)
+
+	if err := r.checkRenames("", renames); err != nil {
+		return err
+	}
+	if err := r.moveFiles("", renames); err != nil {
+		return err
+	}
+	return r.save()
+}
+
+// RenamePrefix replaces prefix with newPrefix in the nicknames of every file
+// whose nickname starts with prefix, and in the paths of the created
+// directories that start with prefix. A prefix ending in a slash moves a whole
+// directory. It returns the number of renamed files. Either every file is
+// renamed, or none are.
+func (r *Renter) RenamePrefix(prefix, newPrefix string) (int, error) {
+	if err := r.addThread(); err != nil {
+		return 0, err
+	}
+	defer r.tg.Done()
+	if prefix == "" {
+		return 0, errEmptyPrefix
+	}
+	lockID := r.mu.Lock()
+	defer r.mu.Unlock(lockID)
+
+	renames := make(map[string]string)
+	for _, f := range r.files {
+		if f.namespace == "" && strings.HasPrefix(f.name, prefix) {
+			renames[f.name] = newPrefix + strings.TrimPrefix(f.name, prefix)
+		}
+	}
+	dirs := make(map[string]string)
+	for d := range r.dirs {
+		if strings.HasPrefix(d, prefix) {
+			dirs[d] = newPrefix + strings.TrimPrefix(d, prefix)
+		}
+	}
+	if len(renames) == 0 && len(dirs) == 0 {
+		return 0, ErrUnknownPath
+	}
+	for _, newDir := range dirs {
+		if err := r.validateDir(newDir); err != nil {
+			return 0, err
+		} else if _, exists := r.files[newDir]; exists {
+			return 0, ErrPathOverload
+		}
+	}
+	if err := r.checkRenames("", renames); err != nil {
+		return 0, err
+	}
+
+	if err := r.moveFiles("", renames); err != nil {
+		return 0, err
+	}
+	for d := range dirs {
+		delete(r.dirs, d)
+	}
+	for _, newDir := range dirs {
+		r.dirs[newDir] = struct{}{}
+	}
+	return len(renames), r.save()
+}
+
+// checkRenames checks that every file in renames can be renamed in namespace
+// ns, and that no two files are renamed to the same nickname. The renter's
+// lock must be held.
+func (r *Renter) checkRenames(ns string, renames map[string]string) error {
+	targets := make(map[string]struct{}, len(renames))
+	for currentName, newName := range renames {
+		if _, err := r.checkRename(ns, currentName, newName); err != nil {
+			return err
+		}
+		if _, exists := targets[newName]; exists {
+			return ErrPathOverload
+		}
+		targets[newName] = struct{}{}
+	}
+	return nil
+}
+
+// moveFiles renames the files in namespace ns that are in renames, which must
+// have been checked with checkRenames. The .sia file of each file is moved,
+// but the renter's metadata is not saved. If any of the .sia files cannot be
+// written or deleted, no file is renamed. The renter's lock must be held.
+func (r *Renter) moveFiles(ns string, renames map[string]string) error {
+	// Write every new .sia file first, so that nothing needs to be undone if
+	// one of them cannot be written.
+	var written []string
+	for currentName, newName := range renames {
+		if err := r.saveFileAs(r.files[nsKey(ns, currentName)], newName); err != nil {
+			for _, name := range written {
+				os.Remove(r.sharePath(ns, name))
+			}
+			return err
+		}
+		written = append(written, newName)
+	}
+	r.swapFiles(ns, renames)
+
+	// Delete the old .sia files. If one cannot be deleted, the files are
+	// renamed back, and the deleted .sia files are written again.
+	var removed []string
+	for currentName := range renames {
+		if err := os.RemoveAll(r.sharePath(ns, currentName)); err != nil {
+			undo := make(map[string]string, len(renames))
+			for currentName, newName := range renames {
+				undo[newName] = currentName
+			}
+			r.swapFiles(ns, undo)
+			for _, name := range removed {
+				r.saveFileAs(r.files[nsKey(ns, name)], name)
+			}
+			for _, name := range written {
+				os.Remove(r.sharePath(ns, name))
+			}
+			return err
+		}
+		removed = append(removed, currentName)
+	}
+	return nil
+}
+
+// saveFileAs writes the .sia file of f as if its nickname were name. The
+// renter's lock must be held.
+func (r *Renter) saveFileAs(f *file, name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	currentName := f.name
+	f.name = name
+	err := r.saveFile(f)
+	f.name = currentName
+	return err
+}
+
+// swapFiles changes the nicknames of the files in namespace ns that are in
+// renames, along with the renter's entries for them. The .sia files are not
+// touched. The renter's lock must be held.
+func (r *Renter) swapFiles(ns string, renames map[string]string) {
+	moved := make(map[string]string, len(renames))
+	for currentName, newName := range renames {
+		currentKey, newKey := nsKey(ns, currentName), nsKey(ns, newName)
+		file := r.files[currentKey]
+		file.mu.Lock()
+		file.name = newName
+		file.mu.Unlock()
+		delete(r.files, currentKey)
+		r.files[newKey] = file
+		if t, ok := r.tracking[currentKey]; ok {
+			delete(r.tracking, currentKey)
+			r.tracking[newKey] = t
+		}
+		moved[currentKey] = newKey
+	}
+
+	// Keep the chunk index entries of the moved files.
+	for hash, entry := range r.chunkIndex {
+		if newKey, ok := moved[entry.File]; ok {
+			entry.File = newKey
+			r.chunkIndex[hash] = entry
+		}
+	}
+}
+
+// MergeFiles adds the pieces of the file mergeName that are stored in online
+// contracts to the file keepName, and then deletes mergeName. Both files must
+// have the same checksum, master key and erasure scheme; errMergeChecksum is
+// returned if the checksums differ, and errMergeKeys if the same content was
+// encrypted with different keys, as it is when uploaded twice. Pieces that
+// keepName already stores on the same host are skipped.
+func (r *Renter) MergeFiles(keepName, mergeName string) error {
+	if err := r.addThread(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	if keepName == mergeName {
+		return errMergeSelf
+	}
+	lockID := r.mu.Lock()
+	defer r.mu.Unlock(lockID)
+
+	keep, exists := r.files[keepName]
+	if !exists {
+		return ErrUnknownPath
+	}
+	merge, exists := r.files[mergeName]
+	if !exists {
+		return ErrUnknownPath
+	}
+	if keep.isSealed() || merge.isSealed() {
+		return ErrFileSealed
+	}
+
+	keep.mu.Lock()
+	merge.mu.RLock()
+	err := keep.merge(merge, r.contractOffline)
+	merge.mu.RUnlock()
+	if err != nil {
+		keep.mu.Unlock()
+		return err
+	}
+	err = r.saveFile(keep)
+	keep.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// Delete the merged file.
+	delete(r.files, mergeName)
+	r.untrack(mergeName)
+	err = r.save()
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(r.sharePath("", mergeName))
+}
+
+// replacePiece moves every copy of the piece with the given index, in every
+// chunk, into the contract with the given id and host. The contract is
+// created if f does not already use it, and contracts that are left without
+// pieces are removed.
+func (f *file) replacePiece(pieceIndex uint64, id types.FileContractID, host modules.NetAddress, windowStart types.BlockHeight) error {
+	var moved []pieceData
+	for fcid, fc := range f.contracts {
+		var kept []pieceData
+		for _, p := range fc.Pieces {
+			if p.Piece == pieceIndex {
+				moved = append(moved, p)
+			} else {
+				kept = append(kept, p)
+			}
+		}
+		if len(kept) == len(fc.Pieces) {
+			continue
+		}
+		if len(kept) == 0 && fcid != id {
+			delete(f.contracts, fcid)
+			continue
+		}
+		fc.Pieces = kept
+		f.contracts[fcid] = fc
+	}
+	if len(moved) == 0 {
+		return errUnknownPiece
+	}
+
+	delete(f.verified, pieceIndex)
+
+	fc, exists := f.contracts[id]
+	if !exists {
+		fc = fileContract{ID: id}
+	}
+	fc.IP = host
+	fc.WindowStart = windowStart
+	fc.Pieces = append(fc.Pieces, moved...)
+	f.contracts[id] = fc
+	return nil
+}
+
+// ReplacePiece records that the piece with the given index of the file with
+// the given nickname has been uploaded to the host at newHost, under the
+// contract newContract with id newContractID. The piece's previous locations
+// are forgotten. This allows a piece that was lost with its host to be
+// restored without uploading the file again.
+func (r *Renter) ReplacePiece(nickname string, pieceIndex int, newContract types.FileContract, newContractID types.FileContractID, newHost modules.NetAddress) error {
+	if err := r.addThread(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	if pieceIndex < 0 {
+		return errUnknownPiece
+	}
+	lockID := r.mu.RLock()
+	defer r.mu.RUnlock(lockID)
+
+	f, exists := r.files[nickname]
+	if !exists {
+		return ErrUnknownPath
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.sealed {
+		return ErrFileSealed
+	}
+	if err := f.replacePiece(uint64(pieceIndex), newContractID, newHost, newContract.WindowStart); err != nil {
+		return err
+	}
+	return r.saveFile(f)
+}
+
+// RecordPieceVerified records that the piece with the given index of the file
+// with the given nickname was confirmed to be present on its hosts at height.
+// The height applies to the piece in every chunk. Pieces that are moved by
+// ReplacePiece lose their verification.
+func (r *Renter) RecordPieceVerified(nickname string, pieceIndex int, height types.BlockHeight) error {
+	if err := r.addThread(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	if pieceIndex < 0 {
+		return errUnknownPiece
+	}
+	lockID := r.mu.Lock()
+	defer r.mu.Unlock(lockID)
+
+	f, exists := r.files[nickname]
+	if !exists {
+		return ErrUnknownPath
+	}
+	f.mu.Lock()
+	var found bool
+	for _, fc := range f.contracts {
+		for _, p := range fc.Pieces {
+			found = found || p.Piece == uint64(pieceIndex)
+		}
+	}
+	if found {
+		if f.verified == nil {
+			f.verified = make(map[uint64]types.BlockHeight)
+		}
+		f.verified[uint64(pieceIndex)] = height
+	}
+	f.mu.Unlock()
+	if !found {
+		return errUnknownPiece
+	}
+	return r.save()
+}
+
+// StalePieces returns the nicknames of the files in the default namespace, in
+// sorted order, that store an available piece that has not been verified
+// within olderThan blocks of currentHeight. Pieces that were never verified are
+// treated as verified at height 0.
+func (r *Renter) StalePieces(olderThan, currentHeight types.BlockHeight) []string {
+	lockID := r.mu.RLock()
+	defer r.mu.RUnlock(lockID)
+
+	var nicknames []string
+	for name, f := range r.files {
+		if f.namespace != "" {
+			continue
+		}
+		f.mu.RLock()
+		var stale bool
+		for _, fc := range f.contracts {
+			if stale || r.contractOffline(fc.ID) {
+				continue
+			}
+			for _, p := range fc.Pieces {
+				if f.verified[p.Piece]+olderThan < currentHeight {
+					stale = true
+					break
+				}
+			}
+		}
+		f.mu.RUnlock()
+		if stale {
+			nicknames = append(nicknames, name)
+		}
+	}
+	sort.Strings(nicknames)
+	return nicknames
+}
+
+// RotateKey replaces the master key of the file with the given nickname with
+// newKey. The pieces encrypted with the old key are forgotten, and the repair
+// loop uploads the file again from its local copy, encrypted with the new key.
+// The file is unavailable until the repair has uploaded enough pieces, so
+// only files whose local copy still exists can have their key rotated.
+func (r *Renter) RotateKey(nickname string, newKey crypto.TwofishKey) error {
+	if err := r.addThread(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	lockID := r.mu.Lock()
+	old, exists := r.files[nickname]
+	if !exists {
+		r.mu.Unlock(lockID)
+		return ErrUnknownPath
+	}
+	if old.isSealed() {
+		r.mu.Unlock(lockID)
+		return ErrFileSealed
+	}
+	tf, tracked := r.tracking[nickname]
+	if !tracked {
+		r.mu.Unlock(lockID)
+		return errRotateUntracked
+	}
+	if _, err := os.Stat(tf.RepairPath); err != nil {
+		r.mu.Unlock(lockID)
+		return errRotateUntracked
+	}
+
+	// The master key of a file is static, so the file is replaced by a copy
+	// without pieces. Uploads already in progress hold the old file, so its
+	// sectors are only deleted once they finish.
+	old.mu.Lock()
+	old.rotated = true
+	pending := old.uploads > 0
+	f := &file{
+		name:        old.name,
+		namespace:   old.namespace,
+		size:        old.size,
+		contracts:   make(map[types.FileContractID]fileContract),
+		masterKey:   newKey,
+		erasureCode: old.erasureCode,
+		pieceSize:   old.pieceSize,
+		checksum:    old.checksum,
+		mode:        old.mode,
+		policy:      old.policy,
+		pinned:      old.pinned,
+		compressed:  old.compressed,
+		rawSize:     old.rawSize,
+		tags:        append([]string(nil), old.tags...),
+		metadata:    old.metadata,
+	}
+	old.mu.Unlock()
+	if err := r.saveFile(f); err != nil {
+		r.mu.Unlock(lockID)
+		return err
+	}
+	r.files[nickname] = f
+	err := r.save()
+	var sectors map[types.FileContractID][]crypto.Hash
+	if !pending {
+		sectors = r.unusedSectors([]*file{old})
+	}
+	r.mu.Unlock(lockID)
+	go r.threadedDeleteSectors(sectors)
+	if err != nil {
+		return err
+	}
+
+	// Send the file to the repair loop.
+	select {
+	case r.newRepairs <- f:
+	case <-r.tg.StopChan():
+	}
+	return nil
 }
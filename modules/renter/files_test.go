@@ -1,10 +1,22 @@
 package renter
 
 import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/modules/renter/contractor"
 	"github.com/NebulousLabs/Sia/types"
 )
 
@@ -179,6 +191,125 @@ func TestFileRedundancy(t *testing.T) {
 	}
 }
 
+// TestFileEffectiveRedundancy checks that pieces stored on the same host are
+// only counted once by effectiveRedundancy.
+func TestFileEffectiveRedundancy(t *testing.T) {
+	neverOffline := func(types.FileContractID) bool {
+		return false
+	}
+	rsc, _ := NewRSCode(1, 2)
+	f := &file{
+		size:        100,
+		pieceSize:   100,
+		erasureCode: rsc,
+		contracts: map[types.FileContractID]fileContract{
+			{1}: {ID: types.FileContractID{1}, IP: "foo", Pieces: []pieceData{{Chunk: 0, Piece: 0}}},
+			{2}: {ID: types.FileContractID{2}, IP: "bar", Pieces: []pieceData{{Chunk: 0, Piece: 1}}},
+			// a second contract with the same host
+			{3}: {ID: types.FileContractID{3}, IP: "bar", Pieces: []pieceData{{Chunk: 0, Piece: 2}}},
+		},
+	}
+	if r := f.redundancy(neverOffline); r != 3 {
+		t.Error("expected redundancy 3, got", r)
+	}
+	if r := f.effectiveRedundancy(neverOffline); r != 2 {
+		t.Error("expected effective redundancy 2, got", r)
+	}
+
+	// Offline hosts are not counted.
+	isOffline := func(id types.FileContractID) bool {
+		return id == types.FileContractID{1}
+	}
+	if r := f.effectiveRedundancy(isOffline); r != 1 {
+		t.Error("expected effective redundancy 1, got", r)
+	}
+
+	// An empty file has an effective redundancy of -1, like redundancy.
+	f.size = 0
+	if r := f.effectiveRedundancy(neverOffline); r != -1 {
+		t.Error("expected effective redundancy -1, got", r)
+	}
+}
+
+// TestFileRecoverableFromHosts checks that recoverableFromHosts counts the
+// distinct hosts storing the pieces of a file.
+func TestFileRecoverableFromHosts(t *testing.T) {
+	neverOffline := func(types.FileContractID) bool {
+		return false
+	}
+	// A file that needs 2 pieces per chunk, with all 4 pieces of its chunk
+	// clustered on a single host.
+	rsc, _ := NewRSCode(2, 2)
+	f := &file{
+		size:        200,
+		pieceSize:   100,
+		erasureCode: rsc,
+		contracts: map[types.FileContractID]fileContract{
+			{1}: {ID: types.FileContractID{1}, IP: "foo", Pieces: []pieceData{{Chunk: 0, Piece: 0}, {Chunk: 0, Piece: 1}}},
+			{2}: {ID: types.FileContractID{2}, IP: "foo", Pieces: []pieceData{{Chunk: 0, Piece: 2}, {Chunk: 0, Piece: 3}}},
+		},
+	}
+	if !f.available(neverOffline) {
+		t.Fatal("file should be available")
+	}
+	if needed, hosts := f.recoverableFromHosts(neverOffline); needed != 2 || hosts != 1 {
+		t.Fatalf("expected 2 needed and 1 host, got %v and %v", needed, hosts)
+	}
+
+	// Moving a piece to a second host makes the file recoverable from
+	// distinct hosts.
+	f.contracts[types.FileContractID{2}] = fileContract{ID: types.FileContractID{2}, IP: "bar", Pieces: []pieceData{{Chunk: 0, Piece: 2}, {Chunk: 0, Piece: 3}}}
+	if needed, hosts := f.recoverableFromHosts(neverOffline); needed != 2 || hosts != 2 {
+		t.Fatalf("expected 2 needed and 2 hosts, got %v and %v", needed, hosts)
+	}
+
+	// Offline hosts are not counted.
+	isOffline := func(id types.FileContractID) bool {
+		return id == types.FileContractID{2}
+	}
+	if _, hosts := f.recoverableFromHosts(isOffline); hosts != 1 {
+		t.Fatal("expected 1 host, got", hosts)
+	}
+}
+
+// TestFileMissingPieces probes the missingPieces method of the file type.
+func TestFileMissingPieces(t *testing.T) {
+	rsc, _ := NewRSCode(1, 2)
+	offline := types.FileContractID{2}
+	isOffline := func(id types.FileContractID) bool { return id == offline }
+	f := &file{
+		size:        200,
+		pieceSize:   100,
+		erasureCode: rsc,
+		contracts:   make(map[types.FileContractID]fileContract),
+	}
+	// 2 chunks of 3 pieces each.
+	if n := f.missingPieces(isOffline); n != 6 {
+		t.Fatal("expected 6 missing pieces, got", n)
+	}
+
+	f.contracts[types.FileContractID{1}] = fileContract{
+		ID: types.FileContractID{1},
+		Pieces: []pieceData{
+			{Chunk: 0, Piece: 0},
+			{Chunk: 0, Piece: 0}, // duplicate
+			{Chunk: 0, Piece: 1},
+			{Chunk: 1, Piece: 2},
+			{Chunk: 1, Piece: 3}, // out of range
+		},
+	}
+	f.contracts[offline] = fileContract{
+		ID:     offline,
+		Pieces: []pieceData{{Chunk: 0, Piece: 2}, {Chunk: 1, Piece: 0}},
+	}
+	if n := f.missingPieces(isOffline); n != 3 {
+		t.Fatal("expected 3 missing pieces, got", n)
+	}
+	if n := f.missingPieces(func(types.FileContractID) bool { return false }); n != 1 {
+		t.Fatal("expected 1 missing piece, got", n)
+	}
+}
+
 // TestFileExpiration probes the expiration method of the file type.
 func TestFileExpiration(t *testing.T) {
 	f := &file{
@@ -212,6 +343,44 @@ func TestFileExpiration(t *testing.T) {
 	}
 }
 
+// TestFileContractWindowSpread probes the contractWindowSpread method of the
+// file type.
+func TestFileContractWindowSpread(t *testing.T) {
+	isOffline := func(id types.FileContractID) bool {
+		return id == types.FileContractID{9}
+	}
+	f := &file{
+		contracts: make(map[types.FileContractID]fileContract),
+	}
+	if earliest, latest := f.contractWindowSpread(isOffline); earliest != 0 || latest != 0 {
+		t.Error("file with no pieces should have no spread, got", earliest, latest)
+	}
+
+	addContract := func(id byte, windowStart types.BlockHeight, pieces int) {
+		f.contracts[types.FileContractID{id}] = fileContract{
+			ID:          types.FileContractID{id},
+			WindowStart: windowStart,
+			Pieces:      make([]pieceData, pieces),
+		}
+	}
+	// Contracts with identical windows.
+	addContract(1, 100, 1)
+	addContract(2, 100, 2)
+	if earliest, latest := f.contractWindowSpread(isOffline); earliest != 100 || latest != 100 {
+		t.Error("expected a spread of 100 to 100, got", earliest, latest)
+	}
+
+	// Contracts with varied windows. Offline contracts and contracts
+	// without pieces are ignored.
+	addContract(3, 80, 1)
+	addContract(4, 150, 1)
+	addContract(5, 10, 0)
+	addContract(9, 500, 1)
+	if earliest, latest := f.contractWindowSpread(isOffline); earliest != 80 || latest != 150 {
+		t.Error("expected a spread of 80 to 150, got", earliest, latest)
+	}
+}
+
 // TestRenterDeleteFile probes the DeleteFile method of the renter type.
 func TestRenterDeleteFile(t *testing.T) {
 	if testing.Short() {
@@ -230,9 +399,11 @@ func TestRenterDeleteFile(t *testing.T) {
 	}
 
 	// Put a file in the renter.
+	id := rt.renter.mu.Lock()
 	rt.renter.files["1"] = &file{
 		name: "one",
 	}
+	rt.renter.mu.Unlock(id)
 	// Delete a different file.
 	err = rt.renter.DeleteFile("one")
 	if err != ErrUnknownPath {
@@ -250,7 +421,9 @@ func TestRenterDeleteFile(t *testing.T) {
 	// Put a file in the renter, then rename it.
 	f := newTestingFile()
 	f.name = "1"
+	id = rt.renter.mu.Lock()
 	rt.renter.files[f.name] = f
+	rt.renter.mu.Unlock(id)
 	rt.renter.RenameFile(f.name, "one")
 	// Call delete on the previous name.
 	err = rt.renter.DeleteFile("1")
@@ -279,6 +452,229 @@ func TestRenterDeleteFile(t *testing.T) {
 	}
 }
 
+// deleteEditor is a contractor.Editor that records the sectors deleted from
+// its contract. Methods that are not overridden panic.
+type deleteEditor struct {
+	contractor.Editor
+	id types.FileContractID
+	ec *editorContractor
+}
+
+func (deleteEditor) Close() error { return nil }
+func (e deleteEditor) Delete(root crypto.Hash) error {
+	e.ec.mu.Lock()
+	e.ec.deleted[e.id] = append(e.ec.deleted[e.id], root)
+	e.ec.mu.Unlock()
+	return nil
+}
+
+// editorContractor is an onlineContractor whose editors record deleted
+// sectors.
+type editorContractor struct {
+	onlineContractor
+	mu      sync.Mutex
+	deleted map[types.FileContractID][]crypto.Hash
+}
+
+func (ec *editorContractor) Editor(id types.FileContractID, _ <-chan struct{}) (contractor.Editor, error) {
+	return deleteEditor{id: id, ec: ec}, nil
+}
+
+// waitDeleted waits for the sectors in exp to be deleted, since sectors are
+// deleted in the background.
+func (ec *editorContractor) waitDeleted(exp map[types.FileContractID][]crypto.Hash) error {
+	for i := 0; i < 100; i++ {
+		ec.mu.Lock()
+		deleted := reflect.DeepEqual(ec.deleted, exp)
+		ec.mu.Unlock()
+		if deleted {
+			return nil
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+	return fmt.Errorf("expected deleted sectors %v, got %v", exp, ec.deleted)
+}
+
+// TestRenterDeleteFileSectors checks that deleting a file, with DeleteFile or
+// DeleteWhere, deletes the sectors storing its pieces from the hosts, except
+// for sectors that also store pieces of another file.
+func TestRenterDeleteFileSectors(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	hc := &editorContractor{
+		onlineContractor: onlineContractor{
+			contracts: map[types.FileContractID]modules.RenterContract{
+				{1}: {ID: types.FileContractID{1}, NetAddress: "foo:1", GoodForRenew: true},
+				{2}: {ID: types.FileContractID{2}, NetAddress: "bar:1", GoodForRenew: true},
+			},
+		},
+		deleted: make(map[types.FileContractID][]crypto.Hash),
+	}
+	rt, err := newContractorTester(t.Name(), closeHostDB{}, hc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Add two files. The second file shares a sector with the first.
+	one := newTestingFile()
+	one.name = "one"
+	one.contracts = map[types.FileContractID]fileContract{
+		{1}: {ID: types.FileContractID{1}, IP: "foo:1", Pieces: []pieceData{{0, 0, crypto.Hash{1}}, {1, 0, crypto.Hash{2}}}},
+		{2}: {ID: types.FileContractID{2}, IP: "bar:1", Pieces: []pieceData{{0, 1, crypto.Hash{3}}}},
+	}
+	two := newTestingFile()
+	two.name = "two"
+	two.contracts = map[types.FileContractID]fileContract{
+		{1}: {ID: types.FileContractID{1}, IP: "foo:1", Pieces: []pieceData{{0, 0, crypto.Hash{2}}}},
+	}
+	id := rt.renter.mu.Lock()
+	rt.renter.files[one.name] = one
+	rt.renter.files[two.name] = two
+	rt.renter.mu.Unlock(id)
+
+	if err := rt.renter.DeleteFile("one"); err != nil {
+		t.Fatal(err)
+	}
+	exp := map[types.FileContractID][]crypto.Hash{
+		{1}: {{1}},
+		{2}: {{3}},
+	}
+	if err := hc.waitDeleted(exp); err != nil {
+		t.Fatal(err)
+	}
+
+	// Deleting the second file with DeleteWhere deletes the shared sector.
+	if deleted := rt.renter.DeleteWhere(func(modules.FileInfo) bool { return true }); len(deleted) != 1 {
+		t.Fatal("expected the second file to be deleted, got", deleted)
+	}
+	exp[types.FileContractID{1}] = []crypto.Hash{{1}, {2}}
+	if err := hc.waitDeleted(exp); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestRenterDeleteWhere probes the DeleteWhere method of the renter type.
+func TestRenterDeleteWhere(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Put some files in the renter.
+	rsc, _ := NewRSCode(1, 1)
+	for _, name := range []string{"tmp/one", "tmp/two", "keep/one", "keep/two"} {
+		f := newFile(name, rsc, 1, 1)
+		id := rt.renter.mu.Lock()
+		rt.renter.files[name] = f
+		rt.renter.mu.Unlock(id)
+		if err := rt.renter.saveFile(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Delete the files with a prefix.
+	deleted := rt.renter.DeleteWhere(func(fi modules.FileInfo) bool {
+		return strings.HasPrefix(fi.SiaPath, "tmp/")
+	})
+	if len(deleted) != 2 || deleted[0] != "tmp/one" || deleted[1] != "tmp/two" {
+		t.Fatal("wrong files deleted:", deleted)
+	}
+	files := rt.renter.FileList()
+	if len(files) != 2 {
+		t.Fatal("expected 2 files to remain, got", len(files))
+	}
+	for _, fi := range files {
+		if !strings.HasPrefix(fi.SiaPath, "keep/") {
+			t.Error("unexpected file remains:", fi.SiaPath)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(rt.renter.persistDir, "tmp/one"+ShareExtension)); !os.IsNotExist(err) {
+		t.Error("deleted file still exists on disk:", err)
+	}
+
+	// A predicate that matches nothing should not delete anything.
+	if deleted := rt.renter.DeleteWhere(func(modules.FileInfo) bool { return false }); len(deleted) != 0 {
+		t.Error("files deleted by a predicate that matches nothing:", deleted)
+	}
+	if len(rt.renter.FileList()) != 2 {
+		t.Error("files were deleted by a predicate that matches nothing")
+	}
+}
+
+// TestRenterSetPinned checks that pinned files are excluded from DeleteWhere,
+// and that pins are persisted.
+func TestRenterSetPinned(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	if err := rt.renter.SetPinned("one", true); err != ErrUnknownPath {
+		t.Fatal("expected ErrUnknownPath, got", err)
+	}
+
+	// Put some files in the renter, and pin one of them.
+	rsc, _ := NewRSCode(1, 1)
+	for _, name := range []string{"one", "two"} {
+		f := newFile(name, rsc, 1, 1)
+		id := rt.renter.mu.Lock()
+		rt.renter.files[name] = f
+		rt.renter.mu.Unlock(id)
+		if err := rt.renter.saveFile(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rt.renter.SetPinned("one", true); err != nil {
+		t.Fatal(err)
+	}
+	for _, fi := range rt.renter.FileList() {
+		if fi.Pinned != (fi.SiaPath == "one") {
+			t.Error("wrong pinned flag in FileInfo:", fi)
+		}
+	}
+
+	// The pinned file should survive a DeleteWhere that matches every file.
+	deleted := rt.renter.DeleteWhere(func(modules.FileInfo) bool { return true })
+	if len(deleted) != 1 || deleted[0] != "two" {
+		t.Fatal("wrong files deleted:", deleted)
+	}
+	if _, exists := rt.renter.files["one"]; !exists {
+		t.Fatal("pinned file was deleted")
+	}
+
+	// The pin should be persisted.
+	id := rt.renter.mu.Lock()
+	delete(rt.renter.files, "one")
+	err = rt.renter.load()
+	rt.renter.mu.Unlock(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f, exists := rt.renter.files["one"]; !exists || !f.pinned {
+		t.Fatal("pin was not persisted")
+	}
+
+	// Once unpinned, the file can be deleted.
+	if err := rt.renter.SetPinned("one", false); err != nil {
+		t.Fatal(err)
+	}
+	if deleted := rt.renter.DeleteWhere(func(modules.FileInfo) bool { return true }); len(deleted) != 1 {
+		t.Fatal("unpinned file was not deleted:", deleted)
+	}
+}
+
 // TestRenterFileList probes the FileList method of the renter type.
 func TestRenterFileList(t *testing.T) {
 	if testing.Short() {
@@ -297,11 +693,13 @@ func TestRenterFileList(t *testing.T) {
 
 	// Put a file in the renter.
 	rsc, _ := NewRSCode(1, 1)
+	id := rt.renter.mu.Lock()
 	rt.renter.files["1"] = &file{
 		name:        "one",
 		erasureCode: rsc,
 		pieceSize:   1,
 	}
+	rt.renter.mu.Unlock(id)
 	if len(rt.renter.FileList()) != 1 {
 		t.Error("FileList is not returning the only file in the renter")
 	}
@@ -310,11 +708,13 @@ func TestRenterFileList(t *testing.T) {
 	}
 
 	// Put multiple files in the renter.
+	id = rt.renter.mu.Lock()
 	rt.renter.files["2"] = &file{
 		name:        "two",
 		erasureCode: rsc,
 		pieceSize:   1,
 	}
+	rt.renter.mu.Unlock(id)
 	if len(rt.renter.FileList()) != 2 {
 		t.Error("FileList is not returning both files in the renter")
 	}
@@ -326,63 +726,1592 @@ func TestRenterFileList(t *testing.T) {
 	}
 }
 
-// TestRenterRenameFile probes the rename method of the renter.
-func TestRenterRenameFile(t *testing.T) {
+// TestRenterFileSpending checks that the spending of a file's contracts is
+// split between the files that they store.
+func TestRenterFileSpending(t *testing.T) {
 	if testing.Short() {
 		t.SkipNow()
 	}
-	rt, err := newRenterTester(t.Name())
+	hc := onlineContractor{
+		contracts: map[types.FileContractID]modules.RenterContract{
+			{1}: {
+				ID:              types.FileContractID{1},
+				LastRevision:    types.FileContractRevision{NewFileSize: 4 * modules.SectorSize},
+				StorageSpending: types.NewCurrency64(400),
+				UploadSpending:  types.NewCurrency64(40),
+				ContractFee:     types.NewCurrency64(20),
+				TxnFee:          types.NewCurrency64(12),
+				SiafundFee:      types.NewCurrency64(8),
+			},
+			{2}: {
+				ID:              types.FileContractID{2},
+				LastRevision:    types.FileContractRevision{NewFileSize: 2 * modules.SectorSize},
+				StorageSpending: types.NewCurrency64(100),
+				UploadSpending:  types.NewCurrency64(10),
+				ContractFee:     types.NewCurrency64(2),
+			},
+			// a contract without any sectors
+			{3}: {ID: types.FileContractID{3}, StorageSpending: types.NewCurrency64(1000)},
+		},
+	}
+	rt, err := newContractorTester(t.Name(), closeHostDB{}, hc)
 	if err != nil {
 		t.Fatal(err)
 	}
 	defer rt.Close()
 
-	// Rename a file that doesn't exist.
-	err = rt.renter.RenameFile("1", "1a")
-	if err != ErrUnknownPath {
-		t.Error("Expecting ErrUnknownPath:", err)
+	rsc, _ := NewRSCode(1, 2)
+	id := rt.renter.mu.Lock()
+	rt.renter.files["foo"] = &file{
+		name:        "foo",
+		size:        1,
+		pieceSize:   1,
+		erasureCode: rsc,
+		contracts: map[types.FileContractID]fileContract{
+			{1}: {ID: types.FileContractID{1}, Pieces: []pieceData{{Chunk: 0, Piece: 0}}},
+			{2}: {ID: types.FileContractID{2}, Pieces: []pieceData{{Chunk: 0, Piece: 1}, {Chunk: 0, Piece: 2}}},
+			{3}: {ID: types.FileContractID{3}, Pieces: []pieceData{{Chunk: 0, Piece: 0}}},
+			// a contract that is unknown to the contractor
+			{4}: {ID: types.FileContractID{4}, Pieces: []pieceData{{Chunk: 0, Piece: 1}}},
+		},
 	}
+	rt.renter.mu.Unlock(id)
 
-	// Rename a file that does exist.
-	f := newTestingFile()
-	f.name = "1"
-	rt.renter.files["1"] = f
-	err = rt.renter.RenameFile("1", "1a")
+	// The file holds a quarter of the first contract and all of the second.
+	exp := modules.FileSpending{
+		StorageSpending: types.NewCurrency64(200),
+		UploadSpending:  types.NewCurrency64(20),
+		ContractFees:    types.NewCurrency64(12),
+	}
+	spending := rt.renter.FileList()[0].Spending
+	if spending.StorageSpending.Cmp(exp.StorageSpending) != 0 || spending.UploadSpending.Cmp(exp.UploadSpending) != 0 || spending.ContractFees.Cmp(exp.ContractFees) != 0 {
+		t.Fatalf("expected spending %v, got %v", exp, spending)
+	}
+}
+
+// TestRenterFileListPage checks that FileListPage filters, sorts and pages the
+// renter's files.
+func TestRenterFileListPage(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	hc := onlineContractor{
+		contracts: map[types.FileContractID]modules.RenterContract{
+			{1}: {ID: types.FileContractID{1}, NetAddress: "foo:1", GoodForRenew: true},
+			{2}: {ID: types.FileContractID{2}, NetAddress: "bar:1", GoodForRenew: true},
+		},
+	}
+	rt, err := newContractorTester(t.Name(), closeHostDB{}, hc)
 	if err != nil {
 		t.Fatal(err)
 	}
-	files := rt.renter.FileList()
-	if len(files) != 1 {
-		t.Fatal("FileList has unexpected number of files:", len(files))
+	defer rt.Close()
+
+	// Each file has a single chunk, so its redundancy is the number of its
+	// pieces.
+	rsc, _ := NewRSCode(1, 1)
+	for _, f := range []*file{
+		{name: "a/1", size: 3, contracts: map[types.FileContractID]fileContract{
+			{1}: {ID: types.FileContractID{1}, WindowStart: 20, Pieces: []pieceData{{Chunk: 0, Piece: 0}}},
+			{2}: {ID: types.FileContractID{2}, WindowStart: 30, Pieces: []pieceData{{Chunk: 0, Piece: 1}}},
+		}},
+		{name: "a/2", size: 1, contracts: map[types.FileContractID]fileContract{
+			{1}: {ID: types.FileContractID{1}, WindowStart: 10, Pieces: []pieceData{{Chunk: 0, Piece: 0}}},
+		}},
+		{name: "b", size: 2},
+		{name: "a/3", namespace: "ns", size: 4},
+	} {
+		f.erasureCode = rsc
+		f.pieceSize = 4
+		id := rt.renter.mu.Lock()
+		rt.renter.files[f.key()] = f
+		rt.renter.mu.Unlock(id)
 	}
-	if files[0].SiaPath != "1a" {
-		t.Errorf("RenameFile failed: expected 1a, got %v", files[0].SiaPath)
+
+	names := func(opts modules.FileListOptions, expTotal int) []string {
+		files, total, err := rt.renter.FileListPage(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total != expTotal {
+			t.Fatalf("%+v: expected %v files in total, got %v", opts, expTotal, total)
+		}
+		names := []string{}
+		for _, f := range files {
+			names = append(names, f.SiaPath)
+		}
+		return names
+	}
+	tests := []struct {
+		opts  modules.FileListOptions
+		names []string
+		total int
+	}{
+		{modules.FileListOptions{}, []string{"a/1", "a/2", "b"}, 3},
+		{modules.FileListOptions{SortBy: modules.FileSortSize}, []string{"a/2", "b", "a/1"}, 3},
+		{modules.FileListOptions{SortBy: modules.FileSortExpiration}, []string{"b", "a/2", "a/1"}, 3},
+		{modules.FileListOptions{SortBy: modules.FileSortHealth}, []string{"b", "a/2", "a/1"}, 3},
+		{modules.FileListOptions{SortBy: modules.FileSortHealth, Reverse: true}, []string{"a/1", "a/2", "b"}, 3},
+		{modules.FileListOptions{Prefix: "a/", Reverse: true}, []string{"a/2", "a/1"}, 2},
+		{modules.FileListOptions{SortBy: modules.FileSortSize, Offset: 1, Limit: 1}, []string{"b"}, 3},
+		{modules.FileListOptions{Offset: 5}, []string{}, 3},
+	}
+	for _, test := range tests {
+		if got := names(test.opts, test.total); !reflect.DeepEqual(got, test.names) {
+			t.Errorf("%+v: expected %v, got %v", test.opts, test.names, got)
+		}
 	}
 
-	// Rename a file to an existing name.
-	f2 := newTestingFile()
-	f2.name = "1"
-	rt.renter.files["1"] = f2
-	err = rt.renter.RenameFile("1", "1a")
-	if err != ErrPathOverload {
-		t.Error("Expecting ErrPathOverload, got", err)
+	if _, _, err := rt.renter.FileListPage(modules.FileListOptions{SortBy: "age"}); err != errBadFileSort {
+		t.Error("expected errBadFileSort, got", err)
+	}
+	if _, _, err := rt.renter.FileListPage(modules.FileListOptions{Limit: -1}); err != errNegativePage {
+		t.Error("expected errNegativePage, got", err)
 	}
+}
 
-	// Rename a file to the same name.
-	err = rt.renter.RenameFile("1", "1")
-	if err != ErrPathOverload {
-		t.Error("Expecting ErrPathOverload, got", err)
+// TestRenterSnapshotFiles probes the SnapshotFiles method of the renter type.
+func TestRenterSnapshotFiles(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Snapshot an empty renter.
+	if len(rt.renter.SnapshotFiles()) != 0 {
+		t.Error("SnapshotFiles has non-zero length for empty renter?")
 	}
 
-	// Renaming should also update the tracking set
-	rt.renter.tracking["1"] = trackedFile{"foo"}
-	err = rt.renter.RenameFile("1", "1b")
+	// Put a file in the renter.
+	rsc, _ := NewRSCode(1, 1)
+	height := rt.renter.cs.Height()
+	f := &file{
+		name:        "one",
+		size:        1,
+		erasureCode: rsc,
+		pieceSize:   1,
+		contracts: map[types.FileContractID]fileContract{
+			{1}: {ID: types.FileContractID{1}, WindowStart: height + 10, Pieces: []pieceData{{Chunk: 0, Piece: 0}}},
+		},
+	}
+	id := rt.renter.mu.Lock()
+	rt.renter.files[f.name] = f
+	rt.renter.mu.Unlock(id)
+	snapshots := rt.renter.SnapshotFiles()
+	if len(snapshots) != 1 {
+		t.Fatal("SnapshotFiles is not returning the only file in the renter")
+	}
+	expected := FileSnapshot{
+		Name:          "one",
+		Available:     false, // the renter has no contracts
+		Redundancy:    0,
+		TimeRemaining: 10,
+	}
+	if snapshots[0] != expected {
+		t.Fatalf("expected %v, got %v", expected, snapshots[0])
+	}
+
+	// Modify the renter and the file. The snapshot should not change.
+	if err := rt.renter.RenameFile("one", "two"); err != nil {
+		t.Fatal(err)
+	}
+	f.mu.Lock()
+	f.contracts[types.FileContractID{1}] = fileContract{ID: types.FileContractID{1}, WindowStart: height + 20}
+	f.mu.Unlock()
+	if snapshots[0] != expected {
+		t.Fatalf("snapshot changed after modifying the renter: expected %v, got %v", expected, snapshots[0])
+	}
+	if s := rt.renter.SnapshotFiles(); len(s) != 1 || s[0].Name != "two" || s[0].TimeRemaining != 20 {
+		t.Error("new snapshot does not reflect the modifications:", s)
+	}
+}
+
+// TestRenterExpirationHistogram probes the ExpirationHistogram method of the
+// renter type.
+func TestRenterExpirationHistogram(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester(t.Name())
 	if err != nil {
 		t.Fatal(err)
 	}
-	_, oldexists := rt.renter.tracking["1"]
-	_, newexists := rt.renter.tracking["1b"]
-	if oldexists || !newexists {
-		t.Error("renaming should have updated the entry in the tracking set")
+	defer rt.Close()
+
+	if len(rt.renter.ExpirationHistogram(10)) != 0 {
+		t.Error("ExpirationHistogram has non-zero length for empty renter?")
+	}
+
+	// Add files expiring at various heights, relative to the current height.
+	rsc, _ := NewRSCode(1, 1)
+	height := rt.renter.cs.Height()
+	remaining := map[string][]types.BlockHeight{
+		"none":    nil,     // no contracts
+		"expired": {0},     // expires at the current height
+		"five":    {5, 50}, // the soonest contract counts
+		"nine":    {9},
+		"ten":     {10},
+		"25":      {25},
+		"29":      {29},
+	}
+	for name, rems := range remaining {
+		f := &file{name: name, erasureCode: rsc, pieceSize: 1, contracts: make(map[types.FileContractID]fileContract)}
+		for i, rem := range rems {
+			id := types.FileContractID{byte(i)}
+			f.contracts[id] = fileContract{ID: id, WindowStart: height + rem}
+		}
+		id := rt.renter.mu.Lock()
+		rt.renter.files[name] = f
+		rt.renter.mu.Unlock(id)
+	}
+
+	histogram := rt.renter.ExpirationHistogram(10)
+	expected := map[types.BlockHeight]int{0: 4, 10: 1, 20: 2}
+	if len(histogram) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, histogram)
+	}
+	for bucket, n := range expected {
+		if histogram[bucket] != n {
+			t.Errorf("expected %v files in bucket %v, got %v", n, bucket, histogram[bucket])
+		}
+	}
+}
+
+// TestRenterFindByChecksum probes the FindByChecksum method of the renter
+// type.
+func TestRenterFindByChecksum(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Upload a file, which should have its checksum computed.
+	source := filepath.Join(build.SiaTestingDir, "renter", t.Name(), "source")
+	data := []byte("some data")
+	if err := ioutil.WriteFile(source, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	err = rt.renter.Upload(modules.FileUploadParams{Source: source, SiaPath: "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checksum := crypto.HashBytes(data)
+	if name, found := rt.renter.FindByChecksum(checksum); !found || name != "b" {
+		t.Fatal("uploaded file was not found by checksum:", name, found)
+	}
+
+	// Add another file with the same checksum; the first in sorted order
+	// should be returned.
+	rsc, _ := NewRSCode(1, 1)
+	id := rt.renter.mu.Lock()
+	rt.renter.files["a"] = &file{name: "a", erasureCode: rsc, pieceSize: 1, checksum: checksum}
+	rt.renter.mu.Unlock(id)
+	if name, found := rt.renter.FindByChecksum(checksum); !found || name != "a" {
+		t.Fatal("expected to find a, got", name, found)
+	}
+
+	// Unknown checksums should not be found, and neither should the zero
+	// checksum of files without a known checksum.
+	id = rt.renter.mu.Lock()
+	rt.renter.files["c"] = &file{name: "c", erasureCode: rsc, pieceSize: 1}
+	rt.renter.mu.Unlock(id)
+	if _, found := rt.renter.FindByChecksum(crypto.HashBytes([]byte("other data"))); found {
+		t.Error("found a file with an unknown checksum")
+	}
+	if _, found := rt.renter.FindByChecksum(crypto.Hash{}); found {
+		t.Error("found a file with the zero checksum")
+	}
+}
+
+// TestRenterRenewalCandidates probes the RenewalCandidates method of the
+// renter type using contracts that are shared between files.
+func TestRenterRenewalCandidates(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	height := rt.renter.cs.Height()
+	shared := fileContract{ID: types.FileContractID{1}, IP: "foo:1", WindowStart: height + 5}
+	unique := fileContract{ID: types.FileContractID{2}, IP: "bar:1", WindowStart: height + 10}
+	later := fileContract{ID: types.FileContractID{3}, IP: "baz:1", WindowStart: height + 11}
+	expired := fileContract{ID: types.FileContractID{4}, IP: "qux:1", WindowStart: height}
+	rsc, _ := NewRSCode(1, 1)
+	for name, fcs := range map[string][]fileContract{
+		"one":   {shared, unique},
+		"two":   {shared, later},
+		"three": {expired},
+	} {
+		f := &file{name: name, erasureCode: rsc, pieceSize: 1, contracts: make(map[types.FileContractID]fileContract)}
+		for _, fc := range fcs {
+			f.contracts[fc.ID] = fc
+		}
+		id := rt.renter.mu.Lock()
+		rt.renter.files[name] = f
+		rt.renter.mu.Unlock(id)
+	}
+
+	hints := rt.renter.RenewalCandidates(10)
+	if len(hints) != 2 {
+		t.Fatal("expected 2 hints, got", hints)
+	}
+	if hints[0].ContractID != shared.ID || hints[0].HostIP != "foo:1" || hints[0].BlocksRemaining != 5 {
+		t.Error("wrong hint for shared contract:", hints[0])
+	}
+	if len(hints[0].Nicknames) != 2 || hints[0].Nicknames[0] != "one" || hints[0].Nicknames[1] != "two" {
+		t.Error("shared contract should list both files:", hints[0].Nicknames)
+	}
+	if hints[1].ContractID != unique.ID || hints[1].BlocksRemaining != 10 || len(hints[1].Nicknames) != 1 || hints[1].Nicknames[0] != "one" {
+		t.Error("wrong hint for unique contract:", hints[1])
+	}
+
+	// A smaller threshold should only include the shared contract.
+	if hints := rt.renter.RenewalCandidates(9); len(hints) != 1 || hints[0].ContractID != shared.ID {
+		t.Error("expected only the shared contract, got", hints)
+	}
+}
+
+// TestRenterHealthyFiles checks that HealthyFiles only returns files that are
+// available and do not expire soon.
+func TestRenterHealthyFiles(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	hc := onlineContractor{
+		contracts: map[types.FileContractID]modules.RenterContract{
+			{1}: {ID: types.FileContractID{1}, NetAddress: "foo:1", GoodForRenew: true},
+		},
+	}
+	rt, err := newContractorTester(t.Name(), closeHostDB{}, hc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	rsc, _ := NewRSCode(1, 1)
+	height := rt.renter.cs.Height()
+	addFile := func(name string, id types.FileContractID, remaining types.BlockHeight) {
+		lockID := rt.renter.mu.Lock()
+		rt.renter.files[name] = &file{
+			name:        name,
+			size:        1,
+			pieceSize:   1,
+			erasureCode: rsc,
+			masterKey:   crypto.GenerateTwofishKey(),
+			contracts: map[types.FileContractID]fileContract{
+				id: {ID: id, WindowStart: height + remaining, Pieces: []pieceData{{Chunk: 0, Piece: 0}}},
+			},
+		}
+		rt.renter.mu.Unlock(lockID)
+	}
+	addFile("healthy", types.FileContractID{1}, 20)
+	addFile("expiring", types.FileContractID{1}, 5)
+	// a file stored in an unknown contract
+	addFile("unavailable", types.FileContractID{2}, 20)
+
+	healthy := rt.renter.HealthyFiles(10)
+	if len(healthy) != 1 || healthy[0].SiaPath != "healthy" || !healthy[0].Available {
+		t.Fatal("expected only the healthy file, got", healthy)
+	}
+	healthy = rt.renter.HealthyFiles(4)
+	if len(healthy) != 2 || healthy[0].SiaPath == "unavailable" || healthy[1].SiaPath == "unavailable" {
+		t.Fatal("expected the healthy and expiring files, got", healthy)
+	}
+	if healthy := rt.renter.HealthyFiles(20); len(healthy) != 0 {
+		t.Fatal("expected no healthy files, got", healthy)
+	}
+}
+
+// TestRenterTimeToFirstLoss probes the TimeToFirstLoss method of the renter
+// type.
+func TestRenterTimeToFirstLoss(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	hc := onlineContractor{
+		contracts: map[types.FileContractID]modules.RenterContract{
+			{1}: {ID: types.FileContractID{1}, NetAddress: "foo:1", GoodForRenew: true},
+		},
+	}
+	rt, err := newContractorTester(t.Name(), closeHostDB{}, hc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	if remaining, name := rt.renter.TimeToFirstLoss(); remaining != 0 || name != "" {
+		t.Fatal("expected no file for an empty renter, got", remaining, name)
+	}
+
+	rsc, _ := NewRSCode(1, 1)
+	height := rt.renter.cs.Height()
+	addFile := func(name string, id types.FileContractID, remaining types.BlockHeight) {
+		lockID := rt.renter.mu.Lock()
+		rt.renter.files[name] = &file{
+			name:        name,
+			size:        1,
+			pieceSize:   1,
+			erasureCode: rsc,
+			contracts: map[types.FileContractID]fileContract{
+				id: {ID: id, WindowStart: height + remaining, Pieces: []pieceData{{Chunk: 0, Piece: 0}}},
+			},
+		}
+		rt.renter.mu.Unlock(lockID)
+	}
+	addFile("twenty", types.FileContractID{1}, 20)
+	addFile("five", types.FileContractID{1}, 5)
+	addFile("ten", types.FileContractID{1}, 10)
+	if remaining, name := rt.renter.TimeToFirstLoss(); remaining != 5 || name != "five" {
+		t.Fatal("expected five to be lost in 5 blocks, got", remaining, name)
+	}
+
+	// A file stored in an unknown contract is already unavailable.
+	addFile("unavailable", types.FileContractID{2}, 50)
+	if remaining, name := rt.renter.TimeToFirstLoss(); remaining != 0 || name != "unavailable" {
+		t.Fatal("expected the unavailable file, got", remaining, name)
+	}
+}
+
+// TestRenterRenameFile probes the rename method of the renter.
+func TestRenterRenameFile(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Rename a file that doesn't exist.
+	err = rt.renter.RenameFile("1", "1a")
+	if err != ErrUnknownPath {
+		t.Error("Expecting ErrUnknownPath:", err)
+	}
+
+	// Rename a file that does exist.
+	f := newTestingFile()
+	f.name = "1"
+	id := rt.renter.mu.Lock()
+	rt.renter.files["1"] = f
+	rt.renter.mu.Unlock(id)
+	err = rt.renter.RenameFile("1", "1a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := rt.renter.FileList()
+	if len(files) != 1 {
+		t.Fatal("FileList has unexpected number of files:", len(files))
+	}
+	if files[0].SiaPath != "1a" {
+		t.Errorf("RenameFile failed: expected 1a, got %v", files[0].SiaPath)
+	}
+
+	// Rename a file to an existing name.
+	f2 := newTestingFile()
+	f2.name = "1"
+	id = rt.renter.mu.Lock()
+	rt.renter.files["1"] = f2
+	rt.renter.mu.Unlock(id)
+	err = rt.renter.RenameFile("1", "1a")
+	if err != ErrPathOverload {
+		t.Error("Expecting ErrPathOverload, got", err)
+	}
+
+	// Rename a file to the same name.
+	err = rt.renter.RenameFile("1", "1")
+	if err != ErrPathOverload {
+		t.Error("Expecting ErrPathOverload, got", err)
+	}
+
+	// Renaming should also update the tracking set
+	id = rt.renter.mu.Lock()
+	rt.renter.tracking["1"] = trackedFile{RepairPath: "foo"}
+	rt.renter.mu.Unlock(id)
+	err = rt.renter.RenameFile("1", "1b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, oldexists := rt.renter.tracking["1"]
+	_, newexists := rt.renter.tracking["1b"]
+	if oldexists || !newexists {
+		t.Error("renaming should have updated the entry in the tracking set")
+	}
+}
+
+// TestRenterRenameFiles checks that RenameFiles renames every file or none of
+// them, and that the chunk index follows the renamed files.
+func TestRenterRenameFiles(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	for _, name := range []string{"1", "2", "3"} {
+		f := newTestingFile()
+		f.name = name
+		id := rt.renter.mu.Lock()
+		rt.renter.files[name] = f
+		rt.renter.mu.Unlock(id)
+	}
+	rt.renter.chunkIndex["hash"] = chunkIndexEntry{File: "1", KeyHash: crypto.HashObject(rt.renter.files["1"].masterKey)}
+
+	// Batches with a missing file, an existing target or two files renamed
+	// to the same nickname are rejected without renaming anything.
+	for _, renames := range []map[string]string{
+		{"1": "1a", "4": "4a"},
+		{"1": "1a", "2": "3"},
+		{"1": "a", "2": "a"},
+	} {
+		if err := rt.renter.RenameFiles(renames); err != ErrUnknownPath && err != ErrPathOverload {
+			t.Fatalf("%v: expected ErrUnknownPath or ErrPathOverload, got %v", renames, err)
+		}
+		if _, exists := rt.renter.files["1"]; !exists || len(rt.renter.files) != 3 {
+			t.Fatal("files were renamed by a rejected batch:", renames)
+		}
+	}
+
+	if err := rt.renter.RenameFiles(map[string]string{"1": "1a", "2": "2a"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"1a", "2a", "3"} {
+		if f, exists := rt.renter.files[name]; !exists || f.name != name {
+			t.Fatal("file was not renamed:", name)
+		}
+	}
+	if entry := rt.renter.chunkIndex["hash"]; entry.File != "1a" || rt.renter.chunkIndexSource(entry) == nil {
+		t.Fatal("chunk index entry was not renamed:", entry)
+	}
+
+	// A batch in which one .sia file cannot be written renames nothing, and
+	// leaves no new .sia files behind.
+	for _, name := range []string{"1a", "2a"} {
+		if err := rt.renter.saveFile(rt.renter.files[name]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	blocked := rt.renter.sharePath("", "2b")
+	if err := os.MkdirAll(filepath.Join(blocked, "x"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.renter.RenameFiles(map[string]string{"1a": "1b", "2a": "2b"}); err == nil {
+		t.Fatal("expected an error writing a .sia file over a directory")
+	}
+	for _, name := range []string{"1a", "2a"} {
+		if f, exists := rt.renter.files[name]; !exists || f.name != name {
+			t.Fatal("file was renamed by a failed batch:", name)
+		} else if _, err := os.Stat(rt.renter.sharePath("", name)); err != nil {
+			t.Fatal("old .sia file was deleted by a failed batch:", err)
+		}
+	}
+	if _, err := os.Stat(rt.renter.sharePath("", "1b")); !os.IsNotExist(err) {
+		t.Fatal("new .sia file was left behind by a failed batch")
+	}
+	if entry := rt.renter.chunkIndex["hash"]; entry.File != "1a" {
+		t.Fatal("chunk index entry was renamed by a failed batch:", entry)
+	}
+}
+
+// TestRenterRenamePrefix checks that RenamePrefix renames the files and
+// created directories that start with the prefix.
+func TestRenterRenamePrefix(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	for _, name := range []string{"photos/a", "photos/2017/b", "photosets/c", "pics/d"} {
+		f := newTestingFile()
+		f.name = name
+		id := rt.renter.mu.Lock()
+		rt.renter.files[name] = f
+		rt.renter.mu.Unlock(id)
+	}
+	if err := rt.renter.CreateDir("photos/empty"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := rt.renter.RenamePrefix("", "foo"); err != errEmptyPrefix {
+		t.Fatal("expected errEmptyPrefix, got", err)
+	}
+	if _, err := rt.renter.RenamePrefix("videos/", "foo/"); err != ErrUnknownPath {
+		t.Fatal("expected ErrUnknownPath, got", err)
+	}
+	if _, err := rt.renter.RenamePrefix("photosets/c", "pics/d"); err != ErrPathOverload {
+		t.Fatal("expected ErrPathOverload, got", err)
+	}
+
+	n, err := rt.renter.RenamePrefix("photos/", "pics/")
+	if err != nil {
+		t.Fatal(err)
+	} else if n != 2 {
+		t.Fatal("expected 2 renamed files, got", n)
+	}
+	var names []string
+	for _, f := range rt.renter.FileList() {
+		names = append(names, f.SiaPath)
+	}
+	sort.Strings(names)
+	if strings.Join(names, " ") != "photosets/c pics/2017/b pics/a pics/d" {
+		t.Fatal("wrong files after renaming the prefix:", names)
+	}
+	if _, exists := rt.renter.dirs["pics/empty"]; !exists || len(rt.renter.dirs) != 1 {
+		t.Fatal("created directory was not moved:", rt.renter.dirs)
+	}
+}
+
+// TestRenterCanRename checks that CanRename reports the errors of RenameFile
+// without modifying the renter.
+func TestRenterCanRename(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	f1, f2 := newTestingFile(), newTestingFile()
+	f1.name, f2.name = "1", "2"
+	id := rt.renter.mu.Lock()
+	rt.renter.files["1"] = f1
+	rt.renter.files["2"] = f2
+	rt.renter.mu.Unlock(id)
+
+	tests := []struct {
+		currentName, newName string
+		err                  error
+	}{
+		{"3", "4", ErrUnknownPath},
+		{"1", "2", ErrPathOverload},
+		{"1", "", ErrEmptyFilename},
+		{"1", "3", nil},
+	}
+	for _, test := range tests {
+		if err := rt.renter.CanRename(test.currentName, test.newName); err != test.err {
+			t.Errorf("CanRename(%q, %q): expected %v, got %v", test.currentName, test.newName, test.err, err)
+		}
+	}
+	if len(rt.renter.files) != 2 || rt.renter.files["1"] != f1 || rt.renter.files["2"] != f2 || f1.name != "1" {
+		t.Error("CanRename modified the renter")
+	}
+	if _, err := os.Stat(filepath.Join(rt.renter.persistDir, "3"+ShareExtension)); !os.IsNotExist(err) {
+		t.Error("CanRename saved the file:", err)
+	}
+}
+
+// TestFileDownloadPlan probes the downloadPlan method of the file type.
+func TestFileDownloadPlan(t *testing.T) {
+	rsc, _ := NewRSCode(2, 2)
+	f := &file{
+		size:        1000,
+		pieceSize:   100,
+		erasureCode: rsc,
+		contracts:   make(map[types.FileContractID]fileContract),
+	}
+	neverOffline := func(types.FileContractID) bool {
+		return false
+	}
+
+	// An empty file cannot be recovered.
+	if _, err := f.downloadPlan(neverOffline); err != errInsufficientAvailablePieces {
+		t.Fatal("expected errInsufficientAvailablePieces, got", err)
+	}
+
+	// Two contracts on the same host hold piece 0 of every chunk, a third
+	// contract on another host holds piece 0 and piece 1 of every chunk.
+	for i, ip := range []modules.NetAddress{"foo:1", "foo:1", "bar:1"} {
+		fc := fileContract{ID: types.FileContractID{byte(i)}, IP: ip}
+		for c := uint64(0); c < f.numChunks(); c++ {
+			fc.Pieces = append(fc.Pieces, pieceData{Chunk: c, Piece: 0})
+			if ip == "bar:1" {
+				fc.Pieces = append(fc.Pieces, pieceData{Chunk: c, Piece: 1})
+			}
+		}
+		f.contracts[fc.ID] = fc
+	}
+	plan, err := f.downloadPlan(neverOffline)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uint64(len(plan)) != f.numChunks()*uint64(rsc.MinPieces()) {
+		t.Fatal("plan has the wrong number of pieces:", len(plan))
+	}
+	for c := uint64(0); c < f.numChunks(); c++ {
+		p1, p2 := plan[2*c], plan[2*c+1]
+		if p1.Chunk != c || p2.Chunk != c {
+			t.Fatal("plan is not ordered by chunk")
+		}
+		if p1.Piece == p2.Piece {
+			t.Fatal("plan contains duplicate piece indices for chunk", c)
+		}
+		if p1.HostIP == p2.HostIP {
+			t.Error("plan should prefer distinct hosts for chunk", c)
+		}
+	}
+
+	// If the contract holding piece 1 goes offline, the file cannot be
+	// recovered.
+	offline := func(fcid types.FileContractID) bool {
+		return fcid == types.FileContractID{2}
+	}
+	if _, err := f.downloadPlan(offline); err != errInsufficientAvailablePieces {
+		t.Fatal("expected errInsufficientAvailablePieces, got", err)
+	}
+}
+
+// TestFileValidateHostDistribution probes the validateHostDistribution method
+// of the file type.
+func TestFileValidateHostDistribution(t *testing.T) {
+	rsc, _ := NewRSCode(1, 2)
+	f := &file{
+		size:        1000,
+		pieceSize:   100,
+		erasureCode: rsc,
+		contracts: map[types.FileContractID]fileContract{
+			{0}: {ID: types.FileContractID{0}, IP: "foo:1", Pieces: []pieceData{{Chunk: 0, Piece: 0}, {Chunk: 1, Piece: 0}}},
+			{1}: {ID: types.FileContractID{1}, IP: "bar:1", Pieces: []pieceData{{Chunk: 0, Piece: 1}}},
+		},
+	}
+
+	// A host holding pieces of different chunks is fine.
+	if err := f.validateHostDistribution(1); err != nil {
+		t.Fatal(err)
+	}
+	if n := f.hostPieceCount(0, "foo:1"); n != 1 {
+		t.Fatal("expected foo to hold 1 piece of chunk 0, got", n)
+	}
+
+	// Add a renewed contract with the same host that holds another piece of
+	// chunk 0.
+	f.contracts[types.FileContractID{2}] = fileContract{ID: types.FileContractID{2}, IP: "foo:1", Pieces: []pieceData{{Chunk: 0, Piece: 2}}}
+	err := f.validateHostDistribution(1)
+	if err == nil || !strings.Contains(err.Error(), "foo:1") {
+		t.Fatal("expected an error naming foo:1, got", err)
+	}
+	if n := f.hostPieceCount(0, "foo:1"); n != 2 {
+		t.Fatal("expected foo to hold 2 pieces of chunk 0, got", n)
+	}
+
+	// A higher limit allows the duplicate.
+	if err := f.validateHostDistribution(2); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestFileZeroPieces checks that every method of the file type handles a file
+// that has no uploaded pieces, such as a file whose upload failed.
+func TestFileZeroPieces(t *testing.T) {
+	rsc, _ := NewRSCode(2, 2)
+	isOffline := func(types.FileContractID) bool { return false }
+	files := []*file{
+		// no contracts at all
+		{name: "nil", size: 1000, pieceSize: 100, erasureCode: rsc},
+		// contracts that hold no pieces
+		{name: "empty", size: 1000, pieceSize: 100, erasureCode: rsc, contracts: map[types.FileContractID]fileContract{
+			{1}: {ID: types.FileContractID{1}, IP: "foo:1"},
+		}},
+	}
+	tests := []struct {
+		method string
+		check  func(f *file) bool
+	}{
+		{"available", func(f *file) bool { return !f.available(isOffline) }},
+		{"uploadProgress", func(f *file) bool { return f.uploadProgress() == 0 }},
+		{"redundancy", func(f *file) bool { return f.redundancy(isOffline) == 0 }},
+		{"expiration", func(f *file) bool { return f.expiration() == 0 }},
+		{"downloadPlan", func(f *file) bool {
+			plan, err := f.downloadPlan(isOffline)
+			return err == errInsufficientAvailablePieces && len(plan) == 0
+		}},
+		{"hostPieceCount", func(f *file) bool { return f.hostPieceCount(0, "foo:1") == 0 }},
+		{"validateHostDistribution", func(f *file) bool { return f.validateHostDistribution(1) == nil }},
+		{"audit", func(f *file) bool { return len(f.audit(func(types.FileContractID) bool { return true })) == 0 }},
+	}
+	for _, f := range files {
+		for _, test := range tests {
+			if !test.check(f) {
+				t.Errorf("%v: unexpected result for file %q with no pieces", test.method, f.name)
+			}
+		}
+	}
+}
+
+// TestFileMerge probes the merge method of the file type.
+func TestFileMerge(t *testing.T) {
+	rsc, _ := NewRSCode(1, 2)
+	offline := types.FileContractID{3}
+	isOffline := func(id types.FileContractID) bool { return id == offline }
+	keep := &file{
+		size:        100,
+		pieceSize:   100,
+		erasureCode: rsc,
+		contracts: map[types.FileContractID]fileContract{
+			{1}: {ID: types.FileContractID{1}, IP: "foo:1", Pieces: []pieceData{{Chunk: 0, Piece: 0}}},
+		},
+	}
+	other := &file{
+		size:        100,
+		pieceSize:   100,
+		erasureCode: rsc,
+		contracts: map[types.FileContractID]fileContract{
+			// duplicate of a piece that keep already has on the same host
+			{2}: {ID: types.FileContractID{2}, IP: "foo:1", Pieces: []pieceData{{Chunk: 0, Piece: 0}}},
+			// a piece stored in an offline contract
+			offline: {ID: offline, IP: "bar:1", Pieces: []pieceData{{Chunk: 0, Piece: 1}}},
+			// a new piece
+			{4}: {ID: types.FileContractID{4}, IP: "baz:1", Pieces: []pieceData{{Chunk: 0, Piece: 2}}},
+		},
+	}
+	if err := keep.merge(other, isOffline); err != nil {
+		t.Fatal(err)
+	}
+	if len(keep.contracts) != 2 || len(keep.contracts[types.FileContractID{4}].Pieces) != 1 {
+		t.Fatal("merge did not add exactly the new piece:", keep.contracts)
+	}
+	if keep.redundancy(isOffline) != 2 {
+		t.Error("expected redundancy 2 after merging, got", keep.redundancy(isOffline))
+	}
+
+	// Merging again should not add anything.
+	if err := keep.merge(other, isOffline); err != nil {
+		t.Fatal(err)
+	}
+	if len(keep.contracts[types.FileContractID{4}].Pieces) != 1 {
+		t.Error("merging twice duplicated pieces")
+	}
+
+	// Files with different keys or checksums cannot be merged.
+	other.masterKey = crypto.GenerateTwofishKey()
+	if err := keep.merge(other, isOffline); err != errMergeKeys {
+		t.Error("expected errMergeKeys, got", err)
+	}
+	other.checksum = crypto.Hash{1}
+	if err := keep.merge(other, isOffline); err != errMergeChecksum {
+		t.Error("expected errMergeChecksum, got", err)
+	}
+}
+
+// TestRenterMergeFiles probes the MergeFiles method of the renter type.
+func TestRenterMergeFiles(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Unknown files cannot be merged.
+	if err := rt.renter.MergeFiles("one", "two"); err != ErrUnknownPath {
+		t.Error("expected ErrUnknownPath, got", err)
+	}
+
+	rsc, _ := NewRSCode(1, 1)
+	key := crypto.GenerateTwofishKey()
+	for _, name := range []string{"one", "two", "three"} {
+		f := newFile(name, rsc, 1, 1)
+		f.masterKey = key
+		id := rt.renter.mu.Lock()
+		rt.renter.files[name] = f
+		rt.renter.mu.Unlock(id)
+	}
+	rt.renter.files["three"].masterKey = crypto.GenerateTwofishKey()
+	id := rt.renter.mu.Lock()
+	rt.renter.files["four"] = newFile("four", rsc, 1, 1)
+	rt.renter.mu.Unlock(id)
+	rt.renter.files["four"].masterKey = key
+	rt.renter.files["four"].checksum = crypto.Hash{1}
+
+	// Files with different master keys or checksums should be rejected.
+	if err := rt.renter.MergeFiles("one", "three"); err != errMergeKeys {
+		t.Error("expected errMergeKeys, got", err)
+	}
+	if err := rt.renter.MergeFiles("one", "four"); err != errMergeChecksum {
+		t.Error("expected errMergeChecksum, got", err)
+	}
+	if _, exists := rt.renter.files["three"]; !exists {
+		t.Error("rejected merge deleted the file")
+	}
+
+	// Merging matching files should delete the merged file.
+	if err := rt.renter.MergeFiles("one", "two"); err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := rt.renter.files["two"]; exists {
+		t.Error("merged file was not deleted")
+	}
+	if _, exists := rt.renter.files["one"]; !exists {
+		t.Error("kept file was deleted")
+	}
+	if err := rt.renter.MergeFiles("one", "one"); err != errMergeSelf {
+		t.Error("expected errMergeSelf, got", err)
+	}
+}
+
+// TestRenterOrphanContracts checks that OrphanContracts reports the known
+// contracts that do not store pieces of any file, even if the pieces of a
+// contract are unavailable.
+func TestRenterOrphanContracts(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	hc := onlineContractor{
+		contracts: map[types.FileContractID]modules.RenterContract{
+			{1}: {ID: types.FileContractID{1}, NetAddress: "foo:1", GoodForRenew: true},
+			{2}: {ID: types.FileContractID{2}, NetAddress: "bar:1", GoodForRenew: true},
+			{3}: {ID: types.FileContractID{3}, NetAddress: "baz:1", GoodForRenew: true},
+			{4}: {ID: types.FileContractID{4}, NetAddress: "qux:1", GoodForRenew: false},
+		},
+	}
+	rt, err := newContractorTester(t.Name(), closeHostDB{}, hc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	rsc, _ := NewRSCode(1, 1)
+	id := rt.renter.mu.Lock()
+	rt.renter.files["one"] = &file{
+		name:        "one",
+		erasureCode: rsc,
+		contracts: map[types.FileContractID]fileContract{
+			{1}: {ID: types.FileContractID{1}, IP: "foo:1", Pieces: []pieceData{{Chunk: 0, Piece: 0}}},
+			// a contract without pieces
+			{3}: {ID: types.FileContractID{3}, IP: "baz:1"},
+		},
+	}
+	rt.renter.files["two"] = &file{
+		name:        "two",
+		erasureCode: rsc,
+		contracts: map[types.FileContractID]fileContract{
+			{1}: {ID: types.FileContractID{1}, IP: "foo:1", Pieces: []pieceData{{Chunk: 0, Piece: 1}}},
+			// a contract that will not be renewed, whose piece is unavailable
+			{4}: {ID: types.FileContractID{4}, IP: "qux:1", Pieces: []pieceData{{Chunk: 0, Piece: 0}}},
+		},
+	}
+	rt.renter.mu.Unlock(id)
+
+	known := []types.FileContractID{{5}, {4}, {3}, {2}, {1}}
+	orphans := rt.renter.OrphanContracts(known)
+	exp := []types.FileContractID{{5}, {3}, {2}}
+	if !reflect.DeepEqual(orphans, exp) {
+		t.Fatalf("expected %v, got %v", exp, orphans)
+	}
+	if orphans := rt.renter.OrphanContracts(nil); len(orphans) != 0 {
+		t.Fatal("expected no orphans, got", orphans)
+	}
+}
+
+// TestRenterStalePieces checks that StalePieces reports the files with
+// available pieces that have not been verified recently.
+func TestRenterStalePieces(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	hc := onlineContractor{
+		contracts: map[types.FileContractID]modules.RenterContract{
+			{1}: {ID: types.FileContractID{1}, NetAddress: "foo:1", GoodForRenew: true},
+		},
+	}
+	rt, err := newContractorTester(t.Name(), closeHostDB{}, hc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	rsc, _ := NewRSCode(1, 2)
+	f := &file{
+		name:        "foo",
+		size:        1,
+		pieceSize:   1,
+		erasureCode: rsc,
+		contracts: map[types.FileContractID]fileContract{
+			{1}: {ID: types.FileContractID{1}, IP: "foo:1", Pieces: []pieceData{{Chunk: 0, Piece: 0}, {Chunk: 0, Piece: 1}}},
+			// an unknown contract, whose pieces are not available
+			{2}: {ID: types.FileContractID{2}, IP: "bar:1", Pieces: []pieceData{{Chunk: 0, Piece: 2}}},
+		},
+	}
+	id := rt.renter.mu.Lock()
+	rt.renter.files[f.name] = f
+	rt.renter.mu.Unlock(id)
+
+	if err := rt.renter.RecordPieceVerified("bar", 0, 10); err != ErrUnknownPath {
+		t.Fatal("expected ErrUnknownPath, got", err)
+	}
+	if err := rt.renter.RecordPieceVerified("foo", 3, 10); err != errUnknownPiece {
+		t.Fatal("expected errUnknownPiece, got", err)
+	}
+
+	// None of the pieces have been verified.
+	if stale := rt.renter.StalePieces(5, 3); len(stale) != 0 {
+		t.Fatal("expected no stale files, got", stale)
+	}
+	if stale := rt.renter.StalePieces(5, 10); len(stale) != 1 || stale[0] != "foo" {
+		t.Fatal("expected foo to be stale, got", stale)
+	}
+
+	// Verify the available pieces.
+	for _, piece := range []int{0, 1} {
+		if err := rt.renter.RecordPieceVerified("foo", piece, 10); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if stale := rt.renter.StalePieces(5, 15); len(stale) != 0 {
+		t.Fatal("expected no stale files, got", stale)
+	}
+	if stale := rt.renter.StalePieces(5, 16); len(stale) != 1 {
+		t.Fatal("expected foo to be stale, got", stale)
+	}
+	if err := rt.renter.RecordPieceVerified("foo", 1, 12); err != nil {
+		t.Fatal(err)
+	}
+	if stale := rt.renter.StalePieces(4, 15); len(stale) != 1 {
+		t.Fatal("expected piece 0 to be stale, got", stale)
+	}
+
+	// Replacing a piece forgets its verification.
+	if err := rt.renter.RecordPieceVerified("foo", 0, 12); err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.renter.ReplacePiece("foo", 1, types.FileContract{}, types.FileContractID{1}, "foo:1"); err != nil {
+		t.Fatal(err)
+	}
+	if stale := rt.renter.StalePieces(4, 15); len(stale) != 1 {
+		t.Fatal("expected the replaced piece to be stale, got", stale)
+	}
+
+	// Verification heights should be persisted.
+	id = rt.renter.mu.Lock()
+	err = rt.renter.saveFile(f)
+	if err == nil {
+		err = rt.renter.saveSync()
+	}
+	if err == nil {
+		delete(rt.renter.files, "foo")
+		err = rt.renter.load()
+	}
+	rt.renter.mu.Unlock(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h := rt.renter.files["foo"].verified[0]; h != 12 {
+		t.Fatal("verification height was not persisted:", h)
+	}
+}
+
+// TestRenterReplacePiece checks that replacing a piece stored in a dead
+// contract makes the file available again.
+func TestRenterReplacePiece(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	hc := onlineContractor{
+		contracts: map[types.FileContractID]modules.RenterContract{
+			{1}: {ID: types.FileContractID{1}, NetAddress: "foo:1", GoodForRenew: true},
+			{2}: {ID: types.FileContractID{2}, NetAddress: "bar:1", GoodForRenew: true},
+		},
+	}
+	rt, err := newContractorTester(t.Name(), closeHostDB{}, hc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// A file that needs both of its pieces, one of which is stored in an
+	// unknown contract.
+	rsc, _ := NewRSCode(2, 1)
+	f := &file{
+		name:        "foo",
+		size:        2,
+		pieceSize:   1,
+		erasureCode: rsc,
+		masterKey:   crypto.GenerateTwofishKey(),
+		contracts: map[types.FileContractID]fileContract{
+			{1}: {ID: types.FileContractID{1}, IP: "foo:1", Pieces: []pieceData{{Chunk: 0, Piece: 0}}},
+			{3}: {ID: types.FileContractID{3}, IP: "dead:1", Pieces: []pieceData{{Chunk: 0, Piece: 1}}},
+		},
+	}
+	id := rt.renter.mu.Lock()
+	rt.renter.files[f.name] = f
+	rt.renter.mu.Unlock(id)
+	if rt.renter.FileList()[0].Available {
+		t.Fatal("file should not be available")
+	}
+
+	if err := rt.renter.ReplacePiece("bar", 1, types.FileContract{}, types.FileContractID{2}, "bar:1"); err != ErrUnknownPath {
+		t.Fatal("expected ErrUnknownPath, got", err)
+	}
+	if err := rt.renter.ReplacePiece("foo", 2, types.FileContract{}, types.FileContractID{2}, "bar:1"); err != errUnknownPiece {
+		t.Fatal("expected errUnknownPiece, got", err)
+	}
+
+	// Replace the dead piece.
+	if err := rt.renter.ReplacePiece("foo", 1, types.FileContract{WindowStart: 10}, types.FileContractID{2}, "bar:1"); err != nil {
+		t.Fatal(err)
+	}
+	if fc := f.contracts[types.FileContractID{2}]; fc.IP != "bar:1" || fc.WindowStart != 10 || len(fc.Pieces) != 1 || fc.Pieces[0].Piece != 1 {
+		t.Fatal("piece was not moved to the new contract:", fc)
+	}
+	if _, exists := f.contracts[types.FileContractID{3}]; exists {
+		t.Fatal("contract without pieces was not removed")
+	}
+	if !rt.renter.FileList()[0].Available {
+		t.Fatal("file should be available after replacing the dead piece")
+	}
+}
+
+// TestRenterSeal checks that every mutating operation is rejected on a sealed
+// file, while reads still work.
+func TestRenterSeal(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	if err := rt.renter.Seal("one"); err != ErrUnknownPath {
+		t.Fatal("expected ErrUnknownPath, got", err)
+	}
+
+	// Put some files in the renter, and seal one of them.
+	rsc, _ := NewRSCode(1, 1)
+	for _, name := range []string{"one", "two"} {
+		f := newFile(name, rsc, 1, 1)
+		f.contracts[types.FileContractID{1}] = fileContract{ID: types.FileContractID{1}, Pieces: []pieceData{{Chunk: 0, Piece: 0}}}
+		id := rt.renter.mu.Lock()
+		rt.renter.files[name] = f
+		rt.renter.mu.Unlock(id)
+		if err := rt.renter.saveFile(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rt.renter.Seal("one"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every mutating operation should be rejected.
+	if err := rt.renter.RenameFile("one", "three"); err != ErrFileSealed {
+		t.Error("expected ErrFileSealed from RenameFile, got", err)
+	}
+	if err := rt.renter.DeleteFile("one"); err != ErrFileSealed {
+		t.Error("expected ErrFileSealed from DeleteFile, got", err)
+	}
+	if err := rt.renter.SetPinned("one", true); err != ErrFileSealed {
+		t.Error("expected ErrFileSealed from SetPinned, got", err)
+	}
+	if err := rt.renter.MergeFiles("one", "two"); err != ErrFileSealed {
+		t.Error("expected ErrFileSealed from MergeFiles, got", err)
+	}
+	if err := rt.renter.MergeFiles("two", "one"); err != ErrFileSealed {
+		t.Error("expected ErrFileSealed from MergeFiles, got", err)
+	}
+	if err := rt.renter.ReplacePiece("one", 0, types.FileContract{}, types.FileContractID{2}, "foo:1"); err != ErrFileSealed {
+		t.Error("expected ErrFileSealed from ReplacePiece, got", err)
+	}
+	var buf bytes.Buffer
+	if err := shareFiles([]*file{newFile("one", rsc, 1, 1)}, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.renter.ImportRegistry(&buf, true); err != ErrFileSealed {
+		t.Error("expected ErrFileSealed from ImportRegistry, got", err)
+	}
+	if deleted := rt.renter.DeleteWhere(func(modules.FileInfo) bool { return true }); len(deleted) != 1 || deleted[0] != "two" {
+		t.Error("wrong files deleted:", deleted)
+	}
+
+	// Reads should still work, and the file should be unchanged.
+	files := rt.renter.FileList()
+	if len(files) != 1 || files[0].SiaPath != "one" || !files[0].Sealed || files[0].Pinned {
+		t.Fatal("wrong file list:", files)
+	}
+	if _, err := rt.renter.ShareFilesAscii([]string{"one"}); err != nil {
+		t.Error(err)
+	}
+	if fc := rt.renter.files["one"].contracts[types.FileContractID{1}]; len(fc.Pieces) != 1 {
+		t.Error("sealed file was modified:", rt.renter.files["one"].contracts)
+	}
+
+	// The seal should be persisted.
+	id := rt.renter.mu.Lock()
+	delete(rt.renter.files, "one")
+	rt.renter.mu.Unlock(id)
+	id = rt.renter.mu.Lock()
+	err = rt.renter.load()
+	rt.renter.mu.Unlock(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f, exists := rt.renter.files["one"]; !exists || !f.sealed {
+		t.Fatal("seal was not persisted")
+	}
+}
+
+// TestRenterDiffSince probes the DiffSince method of the renter type with
+// added, removed, and changed files.
+func TestRenterDiffSince(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	rsc, _ := NewRSCode(1, 1)
+	for _, name := range []string{"one", "two", "three"} {
+		id := rt.renter.mu.Lock()
+		rt.renter.files[name] = newFile(name, rsc, 1, 1)
+		rt.renter.mu.Unlock(id)
+	}
+	previous := rt.renter.FileList()
+	if added, removed, changed := rt.renter.DiffSince(previous); len(added)+len(removed)+len(changed) != 0 {
+		t.Fatal("expected no differences, got", added, removed, changed)
+	}
+
+	// Add a file, remove a file, rename a file, and change the availability
+	// of a file. The renter has no contracts, so none of its files are
+	// available; mark a file available in the previous snapshot instead.
+	id := rt.renter.mu.Lock()
+	rt.renter.files["four"] = newFile("four", rsc, 1, 1)
+	delete(rt.renter.files, "one")
+	rt.renter.mu.Unlock(id)
+	if err := rt.renter.RenameFile("two", "five"); err != nil {
+		t.Fatal(err)
+	}
+	for i := range previous {
+		if previous[i].SiaPath == "three" {
+			previous[i].Available = true
+		}
+	}
+
+	added, removed, changed := rt.renter.DiffSince(previous)
+	if len(added) != 2 || added[0] != "five" || added[1] != "four" {
+		t.Error("wrong added files:", added)
+	}
+	if len(removed) != 2 || removed[0] != "one" || removed[1] != "two" {
+		t.Error("wrong removed files:", removed)
+	}
+	if len(changed) != 1 || changed[0] != "three" {
+		t.Error("wrong changed files:", changed)
+	}
+}
+
+// TestFileVerifyPieceCoverage probes the verifyPieceCoverage method of the file
+// type with complete, gapped, and duplicated piece layouts.
+func TestFileVerifyPieceCoverage(t *testing.T) {
+	rsc, _ := NewRSCode(2, 1)
+	isOffline := func(id types.FileContractID) bool { return id == types.FileContractID{9} }
+
+	// newTestFile returns a 5-chunk file with 20-byte chunks, with the given
+	// pieces of each chunk stored in contract 1.
+	newTestFile := func(pieces map[uint64][]uint64) *file {
+		fc := fileContract{ID: types.FileContractID{1}}
+		for chunk, ps := range pieces {
+			for _, p := range ps {
+				fc.Pieces = append(fc.Pieces, pieceData{Chunk: chunk, Piece: p})
+			}
+		}
+		return &file{
+			size:        95,
+			pieceSize:   10,
+			erasureCode: rsc,
+			contracts:   map[types.FileContractID]fileContract{fc.ID: fc},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		pieces map[uint64][]uint64
+		gaps   []byteRange
+	}{
+		{"complete", map[uint64][]uint64{0: {0, 1}, 1: {1, 2}, 2: {0, 2}, 3: {0, 1, 2}, 4: {0, 1}}, nil},
+		{"gapped", map[uint64][]uint64{0: {0, 1}, 1: {1}, 3: {0, 1}, 4: {0}}, []byteRange{{20, 60}, {80, 95}}},
+		{"duplicated", map[uint64][]uint64{0: {0, 0}, 1: {1, 2}, 2: {2, 2, 2}, 3: {0, 1}, 4: {0, 1}}, []byteRange{{0, 20}, {40, 60}}},
+		{"empty", nil, []byteRange{{0, 95}}},
+	}
+	for _, test := range tests {
+		f := newTestFile(test.pieces)
+		covered, gaps := f.verifyPieceCoverage(isOffline)
+		if covered != (len(test.gaps) == 0) {
+			t.Errorf("%v: expected covered to be %v", test.name, len(test.gaps) == 0)
+		}
+		if len(gaps) != len(test.gaps) {
+			t.Errorf("%v: expected gaps %v, got %v", test.name, test.gaps, gaps)
+			continue
+		}
+		for i := range gaps {
+			if gaps[i] != test.gaps[i] {
+				t.Errorf("%v: expected gaps %v, got %v", test.name, test.gaps, gaps)
+			}
+		}
+	}
+
+	// Pieces in offline contracts do not count.
+	f := newTestFile(map[uint64][]uint64{0: {0, 1}, 1: {0, 1}, 2: {0, 1}, 3: {0, 1}})
+	f.contracts[types.FileContractID{9}] = fileContract{ID: types.FileContractID{9}, Pieces: []pieceData{{Chunk: 4, Piece: 0}, {Chunk: 4, Piece: 1}}}
+	if covered, gaps := f.verifyPieceCoverage(isOffline); covered || len(gaps) != 1 || gaps[0] != (byteRange{80, 95}) {
+		t.Error("pieces in offline contract were counted:", gaps)
+	}
+}
+
+// TestRenterFilesByScheme probes the FilesByScheme method of the renter type.
+func TestRenterFilesByScheme(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	if len(rt.renter.FilesByScheme()) != 0 {
+		t.Fatal("expected no schemes for an empty renter")
+	}
+
+	rsc1, _ := NewRSCode(1, 2)
+	rsc2, _ := NewRSCode(10, 20)
+	id := rt.renter.mu.Lock()
+	rt.renter.files["one"] = newFile("one", rsc1, 1, 1)
+	rt.renter.files["two"] = newFile("two", rsc2, 1, 1)
+	rt.renter.files["three"] = newFile("three", rsc1, 1, 1)
+	rt.renter.mu.Unlock(id)
+	// a file with an unknown erasure code
+	id = rt.renter.mu.Lock()
+	rt.renter.files["four"] = &file{name: "four"}
+	rt.renter.mu.Unlock(id)
+	// a file outside the default namespace
+	f := newFile("five", rsc1, 1, 1)
+	f.namespace = "ns"
+	id = rt.renter.mu.Lock()
+	rt.renter.files[f.key()] = f
+	rt.renter.mu.Unlock(id)
+
+	schemes := rt.renter.FilesByScheme()
+	exp := map[string][]string{
+		"Reed-Solomon 1+2":   {"one", "three"},
+		"Reed-Solomon 10+20": {"two"},
+		"":                   {"four"},
+	}
+	if !reflect.DeepEqual(schemes, exp) {
+		t.Errorf("expected %v, got %v", exp, schemes)
+	}
+}
+
+// TestRenterRotateKey checks that RotateKey replaces the key of a file and
+// forgets the pieces encrypted with the old key.
+func TestRenterRotateKey(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	newKey := crypto.GenerateTwofishKey()
+	if err := rt.renter.RotateKey("foo", newKey); err != ErrUnknownPath {
+		t.Fatal("expected ErrUnknownPath, got", err)
+	}
+
+	// A file without a local copy cannot have its key rotated.
+	f := newTestingFile()
+	f.name = "foo"
+	f.pinned = true
+	f.policy = modules.RedundancyPolicy{MinRedundancy: 1.5, TargetRedundancy: 2}
+	f.contracts = map[types.FileContractID]fileContract{
+		{1}: {ID: types.FileContractID{1}, Pieces: []pieceData{{Chunk: 0, Piece: 0}}},
+	}
+	id := rt.renter.mu.Lock()
+	rt.renter.files["foo"] = f
+	rt.renter.mu.Unlock(id)
+	if err := rt.renter.RotateKey("foo", newKey); err != errRotateUntracked {
+		t.Fatal("expected errRotateUntracked, got", err)
+	}
+	source := filepath.Join(rt.renter.persistDir, "source")
+	id = rt.renter.mu.Lock()
+	rt.renter.tracking["foo"] = trackedFile{RepairPath: source}
+	rt.renter.mu.Unlock(id)
+	if err := rt.renter.RotateKey("foo", newKey); err != errRotateUntracked {
+		t.Fatal("expected errRotateUntracked, got", err)
+	}
+
+	if err := ioutil.WriteFile(source, []byte("foo"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.renter.RotateKey("foo", newKey); err != nil {
+		t.Fatal(err)
+	}
+	id = rt.renter.mu.RLock()
+	rotated := rt.renter.files["foo"]
+	rt.renter.mu.RUnlock(id)
+	if rotated.masterKey != newKey {
+		t.Error("key was not rotated")
+	}
+	if f.masterKey == newKey || len(f.contracts) != 1 {
+		t.Error("the old file was modified")
+	}
+	rotated.mu.RLock()
+	if len(rotated.contracts) != 0 {
+		t.Error("pieces encrypted with the old key were not forgotten")
+	}
+	if rotated.size != f.size || rotated.checksum != f.checksum || !rotated.pinned || rotated.policy != f.policy {
+		t.Error("rotated file does not match the original")
+	}
+	rotated.mu.RUnlock()
+	if rt.renter.FileList()[0].Available {
+		t.Error("file should not be available until it is repaired")
+	}
+
+	// Sealed files cannot have their key rotated.
+	if err := rt.renter.Seal("foo"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.renter.RotateKey("foo", crypto.GenerateTwofishKey()); err != ErrFileSealed {
+		t.Fatal("expected ErrFileSealed, got", err)
+	}
+}
+
+// TestRenterRotateKeyUploads checks that the sectors of a file whose key is
+// rotated are only deleted once the uploads to the old file finish, including
+// the sectors uploaded after the rotation.
+func TestRenterRotateKeyUploads(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	hc := &editorContractor{
+		onlineContractor: onlineContractor{
+			contracts: map[types.FileContractID]modules.RenterContract{
+				{1}: {ID: types.FileContractID{1}, NetAddress: "foo:1"},
+			},
+		},
+		deleted: make(map[types.FileContractID][]crypto.Hash),
+	}
+	rt, err := newContractorTester(t.Name(), closeHostDB{}, hc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	source := filepath.Join(rt.renter.persistDir, "source")
+	if err := ioutil.WriteFile(source, []byte("foo"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	f := newTestingFile()
+	f.name = "foo"
+	f.contracts = map[types.FileContractID]fileContract{
+		{1}: {ID: types.FileContractID{1}, IP: "foo:1", Pieces: []pieceData{{0, 0, crypto.Hash{1}}}},
+	}
+	f.uploads = 1
+	id := rt.renter.mu.Lock()
+	rt.renter.files["foo"] = f
+	rt.renter.tracking["foo"] = trackedFile{RepairPath: source}
+	rt.renter.mu.Unlock(id)
+
+	if err := rt.renter.RotateKey("foo", crypto.GenerateTwofishKey()); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	hc.mu.Lock()
+	deleted := len(hc.deleted)
+	hc.mu.Unlock()
+	if deleted != 0 {
+		t.Fatal("sectors were deleted while an upload was in progress")
+	}
+
+	// The upload in progress finishes and adds a piece to the old file.
+	f.mu.Lock()
+	fc := f.contracts[types.FileContractID{1}]
+	fc.Pieces = append(fc.Pieces, pieceData{1, 0, crypto.Hash{2}})
+	f.contracts[types.FileContractID{1}] = fc
+	f.mu.Unlock()
+	rt.renter.managedFinishUpload(f)
+	exp := map[types.FileContractID][]crypto.Hash{
+		{1}: {{1}, {2}},
+	}
+	if err := hc.waitDeleted(exp); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestRenterFileListHealth checks the health fields reported by FileList.
+func TestRenterFileListHealth(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	hc := onlineContractor{
+		contracts: map[types.FileContractID]modules.RenterContract{
+			{1}: {ID: types.FileContractID{1}, NetAddress: "foo:1", GoodForRenew: true},
+			{2}: {ID: types.FileContractID{2}, NetAddress: "bar:1", GoodForRenew: true},
+		},
+	}
+	rt, err := newContractorTester(t.Name(), closeHostDB{}, hc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	rsc, _ := NewRSCode(1, 2)
+	id := rt.renter.mu.Lock()
+	rt.renter.files["foo"] = &file{
+		name:        "foo",
+		size:        2,
+		pieceSize:   1,
+		erasureCode: rsc,
+		contracts: map[types.FileContractID]fileContract{
+			{1}: {ID: types.FileContractID{1}, IP: "foo:1", Pieces: []pieceData{{Chunk: 0, Piece: 0}, {Chunk: 1, Piece: 0}}},
+			{2}: {ID: types.FileContractID{2}, IP: "bar:1", Pieces: []pieceData{{Chunk: 0, Piece: 1}}},
+			// a contract that is not available
+			{3}: {ID: types.FileContractID{3}, IP: "baz:1", Pieces: []pieceData{{Chunk: 1, Piece: 1}}},
+		},
+	}
+	rt.renter.mu.Unlock(id)
+
+	files := rt.renter.FileList()
+	if len(files) != 1 {
+		t.Fatal("expected 1 file, got", files)
+	}
+	if files[0].ActivePieces != 3 {
+		t.Error("expected 3 active pieces, got", files[0].ActivePieces)
+	}
+	if !reflect.DeepEqual(files[0].Hosts, []modules.NetAddress{"bar:1", "foo:1"}) {
+		t.Error("wrong hosts:", files[0].Hosts)
+	}
+	if !files[0].LastRepair.IsZero() {
+		t.Error("file has not been repaired, but LastRepair is", files[0].LastRepair)
+	}
+
+	repaired := time.Now()
+	rt.renter.repairStarts.complete(chunkID{1, "foo"}, repaired)
+	if files := rt.renter.FileList(); !files[0].LastRepair.Equal(repaired) {
+		t.Error("expected LastRepair", repaired, "got", files[0].LastRepair)
 	}
 }
@@ -0,0 +1,100 @@
+package renter
+
+import (
+	"sync"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+	"github.com/NebulousLabs/fastrand"
+)
+
+// managedAuditHosts challenges each host that stores pieces of the renter's
+// files to prove that it stores a few random pieces, and records the result as
+// a successful or failed interaction with the host in the hostdb. Scans only
+// show whether a host can be reached, so the audits are what make a host that
+// has lost data count as failing, which migrates its pieces to other hosts.
+// Offline hosts and hosts without a contract are not audited, and audits that
+// fail because the host could not be reached, does not support the RPC or is
+// busy are not recorded, since they say nothing about whether the host stores
+// the pieces. A host only proves the sectors of its current contract, so
+// pieces that are stored under an older contract with the host, such as
+// pieces of imported files, are not audited.
+func (r *Renter) managedAuditHosts() {
+	hosts := make(map[modules.NetAddress]map[types.FileContractID][]pieceData)
+	lockID := r.mu.RLock()
+	for _, f := range r.files {
+		f.mu.RLock()
+		for _, fc := range f.contracts {
+			if hosts[fc.IP] == nil {
+				hosts[fc.IP] = make(map[types.FileContractID][]pieceData)
+			}
+			hosts[fc.IP][fc.ID] = append(hosts[fc.IP][fc.ID], fc.Pieces...)
+		}
+		f.mu.RUnlock()
+	}
+	r.mu.RUnlock(lockID)
+
+	var wg sync.WaitGroup
+	for addr, contracts := range hosts {
+		contract, ok := r.hostContractor.Contract(addr)
+		if !ok || r.hostContractor.IsOffline(contract.ID) {
+			continue
+		}
+		var pieces []pieceData
+		for id, ps := range contracts {
+			if r.hostContractor.ResolveID(id) == contract.ID {
+				pieces = append(pieces, ps...)
+			}
+		}
+		if len(pieces) == 0 {
+			continue
+		}
+		// Only a random sample of the pieces is challenged, so that audits
+		// cost little bandwidth however much the host stores.
+		if len(pieces) > auditPiecesPerHost {
+			sample := make([]pieceData, auditPiecesPerHost)
+			for i, j := range fastrand.Perm(len(pieces))[:auditPiecesPerHost] {
+				sample[i] = pieces[j]
+			}
+			pieces = sample
+		}
+		wg.Add(1)
+		go func(contract modules.RenterContract, pieces []pieceData) {
+			defer wg.Done()
+			proven := true
+			for _, v := range r.managedVerifyPieces(contract.NetAddress, pieces) {
+				if v.Error == errInvalidSegmentProof.Error() {
+					r.log.Println("Host", contract.NetAddress, "failed an audit of piece", v.Piece, "of chunk", v.Chunk)
+					r.hostDB.IncrementFailedInteractions(contract.HostPublicKey)
+					return
+				} else if !v.Intact {
+					proven = false
+				}
+			}
+			if !proven {
+				r.log.Debugln("Could not audit host", contract.NetAddress)
+				return
+			}
+			r.hostDB.IncrementSuccessfulInteractions(contract.HostPublicKey)
+		}(contract, pieces)
+	}
+	wg.Wait()
+}
+
+// threadedAuditHosts periodically audits the hosts that store the renter's
+// files.
+func (r *Renter) threadedAuditHosts() {
+	for {
+		select {
+		case <-time.After(auditInterval):
+		case <-r.tg.StopChan():
+			return
+		}
+		if r.tg.Add() != nil {
+			return
+		}
+		r.managedAuditHosts()
+		r.tg.Done()
+	}
+}
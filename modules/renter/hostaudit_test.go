@@ -0,0 +1,102 @@
+package renter
+
+import (
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+	"github.com/NebulousLabs/fastrand"
+)
+
+// auditHostDB is a hostDB that counts the successful and failed interactions
+// with each host, keyed by public key.
+type auditHostDB struct {
+	closeHostDB
+	mu         sync.Mutex
+	successful map[string]int
+	failed     map[string]int
+}
+
+func (hdb *auditHostDB) IncrementSuccessfulInteractions(pk types.SiaPublicKey) {
+	hdb.mu.Lock()
+	hdb.successful[string(pk.Key)]++
+	hdb.mu.Unlock()
+}
+
+func (hdb *auditHostDB) IncrementFailedInteractions(pk types.SiaPublicKey) {
+	hdb.mu.Lock()
+	hdb.failed[string(pk.Key)]++
+	hdb.mu.Unlock()
+}
+
+// TestRenterAuditHosts checks that hosts that prove that they store the
+// audited pieces get a successful interaction, that hosts that have lost them
+// get a failed interaction, and that hosts without a contract or that cannot
+// be reached, and pieces stored under an older contract, are not audited.
+func TestRenterAuditHosts(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	sector := fastrand.Bytes(int(modules.SectorSize))
+	root := crypto.MerkleRoot(sector)
+	listen := func() (net.Listener, modules.NetAddress) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		go serveSegmentProofs(l, map[crypto.Hash][]byte{root: sector})
+		return l, modules.NetAddress(l.Addr().String())
+	}
+	good, goodAddr := listen()
+	defer good.Close()
+	bad, badAddr := listen()
+	defer bad.Close()
+	closed, closedAddr := listen()
+	closed.Close()
+
+	hc := addressContractor{onlineContractor{contracts: map[types.FileContractID]modules.RenterContract{
+		{1}: {ID: types.FileContractID{1}, NetAddress: goodAddr, HostPublicKey: types.SiaPublicKey{Key: []byte("good")}},
+		{2}: {ID: types.FileContractID{2}, NetAddress: badAddr, HostPublicKey: types.SiaPublicKey{Key: []byte("bad")}},
+		{4}: {ID: types.FileContractID{4}, NetAddress: closedAddr, HostPublicKey: types.SiaPublicKey{Key: []byte("closed")}},
+	}}}
+	hdb := &auditHostDB{successful: make(map[string]int), failed: make(map[string]int)}
+	rt, err := newContractorTester(t.Name(), hdb, hc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// The good host stores its piece, the bad host has lost one of its two
+	// pieces, the third host has no contract, and the fourth host cannot be
+	// reached. The good host also stores a piece under an older contract,
+	// which it cannot prove using its current contract.
+	rsc, _ := NewRSCode(1, 4)
+	f := &file{
+		name:        "foo",
+		erasureCode: rsc,
+		contracts: map[types.FileContractID]fileContract{
+			{1}: {ID: types.FileContractID{1}, IP: goodAddr, Pieces: []pieceData{{0, 0, root}}},
+			{2}: {ID: types.FileContractID{2}, IP: badAddr, Pieces: []pieceData{{0, 1, root}, {0, 2, crypto.Hash{1}}}},
+			{3}: {ID: types.FileContractID{3}, IP: "unknown:1", Pieces: []pieceData{{0, 3, root}}},
+			{4}: {ID: types.FileContractID{4}, IP: closedAddr, Pieces: []pieceData{{0, 4, root}}},
+			{5}: {ID: types.FileContractID{5}, IP: goodAddr, Pieces: []pieceData{{1, 0, crypto.Hash{2}}}},
+		},
+	}
+	id := rt.renter.mu.Lock()
+	rt.renter.files[f.name] = f
+	rt.renter.mu.Unlock(id)
+
+	rt.renter.managedAuditHosts()
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+	if hdb.successful["good"] != 1 || hdb.failed["good"] != 0 {
+		t.Fatalf("expected 1 successful interaction with the good host, got %v and %v failed", hdb.successful["good"], hdb.failed["good"])
+	} else if hdb.successful["bad"] != 0 || hdb.failed["bad"] != 1 {
+		t.Fatalf("expected 1 failed interaction with the bad host, got %v and %v successful", hdb.failed["bad"], hdb.successful["bad"])
+	} else if len(hdb.successful)+len(hdb.failed) != 2 {
+		t.Fatal("host without a contract or that cannot be reached was audited")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/types"
 )
 
 const (
@@ -33,6 +34,20 @@ const (
 	// historicInteractionDecay defines the decay of the HistoricSuccessfulInteractions
 	// and HistoricFailedInteractions after every block
 	historicInteractionDecay = 0.999
+
+	// unusedHostDecay defines the extra decay of the historic interactions of
+	// a host that is applied by NoteHostUnused, when the renter no longer
+	// stores any data on the host.
+	unusedHostDecay = 0.5
+
+	// minHostCooldown is the number of blocks that a host is put on cooldown
+	// after its first consecutive failed interaction. Each additional
+	// consecutive failure doubles the cooldown, up to maxHostCooldown.
+	minHostCooldown types.BlockHeight = 1
+
+	// maxHostCooldown is the maximum number of blocks that a host can be put
+	// on cooldown for.
+	maxHostCooldown types.BlockHeight = 144
 )
 
 var (
@@ -7,6 +7,7 @@ package hostdb
 import (
 	"errors"
 	"fmt"
+	"io"
 	"math"
 	"os"
 	"path/filepath"
@@ -53,10 +54,44 @@ type HostDB struct {
 	scanWait bool
 	online   bool
 
+	// onlineSet is set once the online status has been set using SetOnline,
+	// after which the online check no longer updates it.
+	onlineSet bool
+
+	// maxInteractionsPerBlock caps the recent interactions of a host between
+	// updates of its historic interactions. Zero means no cap.
+	maxInteractionsPerBlock uint64
+
+	// failurePenalty is the weight of a failed interaction relative to a
+	// successful one. Zero means the default weight of 1.
+	failurePenalty float64
+
+	// scoreWeights are the exponents applied to the components of the host
+	// weights.
+	scoreWeights modules.HostScoreWeights
+
+	// interactionLog receives a line for every recorded interaction. It is
+	// nil unless enabled using EnableInteractionLog.
+	interactionLog io.Writer
+
 	blockHeight types.BlockHeight
 	lastChange  modules.ConsensusChangeID
 }
 
+// A ScoredHost is a host in the hostdb together with its interaction counts,
+// decayed to the current block height, and its score.
+type ScoredHost struct {
+	PublicKey  types.SiaPublicKey `json:"publickey"`
+	NetAddress modules.NetAddress `json:"netaddress"`
+
+	HistoricSuccessfulInteractions uint64 `json:"historicsuccessfulinteractions"`
+	HistoricFailedInteractions     uint64 `json:"historicfailedinteractions"`
+	RecentSuccessfulInteractions   uint64 `json:"recentsuccessfulinteractions"`
+	RecentFailedInteractions       uint64 `json:"recentfailedinteractions"`
+
+	Score types.Currency `json:"score"`
+}
+
 // New returns a new HostDB.
 func New(g modules.Gateway, cs modules.ConsensusSet, persistDir string) (*HostDB, error) {
 	// Check for nil inputs.
@@ -81,8 +116,9 @@ func newHostDB(g modules.Gateway, cs modules.ConsensusSet, persistDir string, de
 		gateway:    g,
 		persistDir: persistDir,
 
-		scanMap:  make(map[string]struct{}),
-		scanPool: make(chan modules.HostDBEntry),
+		scanMap:      make(map[string]struct{}),
+		scanPool:     make(chan modules.HostDBEntry),
+		scoreWeights: defaultScoreWeights,
 	}
 
 	// Create the persist directory if it does not yet exist.
@@ -184,18 +220,43 @@ func newHostDB(g modules.Gateway, cs modules.ConsensusSet, persistDir string, de
 	return hdb, nil
 }
 
+// recentInteractionWeights returns the accumulated weights of the recent
+// interactions of a host. Entries that were loaded from disk only carry the
+// rounded integer counters, in which case the counters are used as weights.
+func recentInteractionWeights(host modules.HostDBEntry) (success, failed float64) {
+	if host.RecentSuccessfulWeight == 0 && host.RecentFailedWeight == 0 {
+		return float64(host.RecentSuccessfulInteractions), float64(host.RecentFailedInteractions)
+	}
+	return host.RecentSuccessfulWeight, host.RecentFailedWeight
+}
+
+// addRecentInteractions adds weighted successful and failed interactions to
+// the recent interactions of a host. The integer counters are updated to the
+// rounded value of the accumulated weights.
+func addRecentInteractions(host *modules.HostDBEntry, successWeight, failWeight float64) {
+	rsi, rfi := recentInteractionWeights(*host)
+	rsi += successWeight
+	rfi += failWeight
+	host.RecentSuccessfulWeight = rsi
+	host.RecentFailedWeight = rfi
+	host.RecentSuccessfulInteractions = uint64(math.Floor(rsi + 0.5))
+	host.RecentFailedInteractions = uint64(math.Floor(rfi + 0.5))
+}
+
 // updateHostDBEntry updates a HostDBEntries's historic interactions if more
 // than one block passed since the last update. This should be called every time
 // before the recent interactions are updated.  if passedTime is e.g. 10, this
 // means that the recent interactions were updated 10 blocks ago but never
 // since. So we need to apply the decay of 1 block before we append the recent
 // interactions from 10 blocks ago and then apply the decay of 9 more blocks in
-// which the recent interactions have been 0
-func updateHostHistoricInteractions(host *modules.HostDBEntry, bh types.BlockHeight) {
+// which the recent interactions have been 0. If the decay produces historic
+// interactions that are negative, NaN or infinite, both historic counters are
+// reset to 0 and false is returned.
+func updateHostHistoricInteractions(host *modules.HostDBEntry, bh types.BlockHeight) bool {
 	passedTime := bh - host.LastHistoricUpdate
 	if passedTime == 0 {
 		// no time passed. nothing to do.
-		return
+		return true
 	}
 
 	// tmp float64 values for more accurate decay
@@ -207,9 +268,11 @@ func updateHostHistoricInteractions(host *modules.HostDBEntry, bh types.BlockHei
 	hsi *= decay
 	hfi *= decay
 
-	// Apply the recent interactions of that single block
-	hsi += float64(host.RecentSuccessfulInteractions)
-	hfi += float64(host.RecentFailedInteractions)
+	// Apply the recent interactions of that single block, using the
+	// fractional weights rather than the rounded counters.
+	rsi, rfi := recentInteractionWeights(*host)
+	hsi += rsi
+	hfi += rfi
 
 	// Apply the decay of the rest of the blocks
 	if passedTime > 1 {
@@ -218,14 +281,54 @@ func updateHostHistoricInteractions(host *modules.HostDBEntry, bh types.BlockHei
 		hfi *= decay
 	}
 
+	// Reset values that cannot be represented by the counters, rather than
+	// converting them to garbage.
+	valid := validInteractions(hsi) && validInteractions(hfi)
+	if !valid {
+		hsi, hfi = 0, 0
+	}
+
 	// Set new values
 	host.HistoricSuccessfulInteractions = uint64(hsi)
 	host.HistoricFailedInteractions = uint64(hfi)
 	host.RecentSuccessfulInteractions = 0
 	host.RecentFailedInteractions = 0
+	host.RecentSuccessfulWeight = 0
+	host.RecentFailedWeight = 0
 
 	// Update the time of the last update
 	host.LastHistoricUpdate = bh
+	return valid
+}
+
+// validInteractions reports whether x is a non-negative, finite number of
+// interactions.
+func validInteractions(x float64) bool {
+	return x >= 0 && !math.IsInf(x, 0)
+}
+
+// updateHistoricInteractions updates the historic interactions of host to the
+// hostdb's block height, logging any interactions that had to be reset.
+func (hdb *HostDB) updateHistoricInteractions(host *modules.HostDBEntry) {
+	if !updateHostHistoricInteractions(host, hdb.blockHeight) {
+		hdb.log.Println("WARN: reset invalid interactions of host", host.PublicKey.String())
+	}
+}
+
+// hostCooldown returns the number of blocks that a host should be put on
+// cooldown for after the given number of consecutive failures.
+func hostCooldown(failures uint64) types.BlockHeight {
+	if failures == 0 {
+		return 0
+	}
+	cooldown := minHostCooldown
+	for i := uint64(1); i < failures && cooldown < maxHostCooldown; i++ {
+		cooldown *= 2
+	}
+	if cooldown > maxHostCooldown {
+		cooldown = maxHostCooldown
+	}
+	return cooldown
 }
 
 // ActiveHosts returns a list of hosts that are currently online, sorted by
@@ -247,12 +350,89 @@ func (hdb *HostDB) ActiveHosts() (activeHosts []modules.HostDBEntry) {
 	return activeHosts
 }
 
+// TopHostsDiverse returns up to n active hosts, in order of decreasing weight,
+// such that no two of them share the same addrKey. Hosts that share a key
+// with a higher weighted host are skipped, which avoids picking hosts that
+// are likely to fail together, such as hosts on the same subnet. A nil
+// addrKey groups hosts by their full address.
+func (hdb *HostDB) TopHostsDiverse(n int, addrKey func(modules.NetAddress) string) []modules.HostDBEntry {
+	if addrKey == nil {
+		addrKey = func(addr modules.NetAddress) string { return string(addr) }
+	}
+	var top []modules.HostDBEntry
+	used := make(map[string]struct{})
+	hosts := hdb.ActiveHosts()
+	for i := len(hosts) - 1; i >= 0 && len(top) < n; i-- {
+		key := addrKey(hosts[i].NetAddress)
+		if _, exists := used[key]; exists {
+			continue
+		}
+		used[key] = struct{}{}
+		top = append(top, hosts[i])
+	}
+	return top
+}
+
 // AllHosts returns all of the hosts known to the hostdb, including the
 // inactive ones.
 func (hdb *HostDB) AllHosts() (allHosts []modules.HostDBEntry) {
 	return hdb.hostTree.All()
 }
 
+// Dump returns every host in the hostdb together with its score, sorted by
+// weight. The interactions of all hosts are decayed to the same block height,
+// so that the results are comparable. The hosts in the hostdb are not
+// modified.
+func (hdb *HostDB) Dump() []ScoredHost {
+	hdb.mu.RLock()
+	defer hdb.mu.RUnlock()
+
+	var hosts []ScoredHost
+	for _, entry := range hdb.hostTree.All() {
+		hdb.updateHistoricInteractions(&entry)
+		hosts = append(hosts, ScoredHost{
+			PublicKey:  entry.PublicKey,
+			NetAddress: entry.NetAddress,
+
+			HistoricSuccessfulInteractions: entry.HistoricSuccessfulInteractions,
+			HistoricFailedInteractions:     entry.HistoricFailedInteractions,
+			RecentSuccessfulInteractions:   entry.RecentSuccessfulInteractions,
+			RecentFailedInteractions:       entry.RecentFailedInteractions,
+
+			Score: hdb.calculateHostWeight(entry),
+		})
+	}
+	return hosts
+}
+
+// Verify checks that the hosts in the host tree are consistent: no host has
+// been updated at a height beyond the hostdb's block height, the interaction
+// weights of every host are finite, and every host can be selected by its
+// public key. The first inconsistency found is returned as an error.
+func (hdb *HostDB) Verify() error {
+	hdb.mu.RLock()
+	defer hdb.mu.RUnlock()
+
+	for _, host := range hdb.hostTree.All() {
+		if host.LastHistoricUpdate > hdb.blockHeight {
+			return fmt.Errorf("host %v was last updated at height %v, after the current height %v", host.PublicKey.String(), host.LastHistoricUpdate, hdb.blockHeight)
+		}
+		for _, w := range []float64{host.RecentSuccessfulWeight, host.RecentFailedWeight} {
+			if math.IsNaN(w) || math.IsInf(w, 0) {
+				return fmt.Errorf("host %v has an invalid interaction weight %v", host.PublicKey.String(), w)
+			}
+		}
+		selected, exists := hdb.hostTree.Select(host.PublicKey)
+		if !exists {
+			return fmt.Errorf("host %v cannot be selected by its public key", host.PublicKey.String())
+		}
+		if selected.PublicKey.String() != host.PublicKey.String() || selected.NetAddress != host.NetAddress {
+			return fmt.Errorf("selecting host %v returned host %v", host.PublicKey.String(), selected.PublicKey.String())
+		}
+	}
+	return nil
+}
+
 // AverageContractPrice returns the average price of a host.
 func (hdb *HostDB) AverageContractPrice() (totalPrice types.Currency) {
 	sampleSize := 32
@@ -281,12 +461,159 @@ func (hdb *HostDB) Host(spk types.SiaPublicKey) (modules.HostDBEntry, bool) {
 // a number of hosts to return, and a slice of netaddresses to ignore, and
 // returns a slice of entries.
 func (hdb *HostDB) RandomHosts(n int, excludeKeys []types.SiaPublicKey) []modules.HostDBEntry {
+	// Exclude any hosts that are still on cooldown.
+	hdb.mu.RLock()
+	bh := hdb.blockHeight
+	hdb.mu.RUnlock()
+	for _, host := range hdb.hostTree.All() {
+		if host.CooldownUntil > bh {
+			excludeKeys = append(excludeKeys, host.PublicKey)
+		}
+	}
 	return hdb.hostTree.SelectRandom(n, excludeKeys)
 }
 
+// Online returns whether the hostdb considers itself to be online. While the
+// hostdb is offline, failed interactions and failed scans are not held against
+// hosts.
+func (hdb *HostDB) Online() bool {
+	hdb.mu.RLock()
+	defer hdb.mu.RUnlock()
+	return hdb.online
+}
+
+// SetOnline sets whether the hostdb considers itself to be online. Once
+// SetOnline has been called, the hostdb no longer checks its connectivity
+// itself, so that the online status can be driven by an external
+// connectivity check.
+func (hdb *HostDB) SetOnline(online bool) {
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+	hdb.online = online
+	hdb.onlineSet = true
+}
+
+// OnCooldown returns true if the host with the given key has recently failed
+// and should not be selected at the provided height.
+func (hdb *HostDB) OnCooldown(key types.SiaPublicKey, currentHeight types.BlockHeight) bool {
+	host, exists := hdb.hostTree.Select(key)
+	if !exists {
+		return false
+	}
+	return host.CooldownUntil > currentHeight
+}
+
 // IncrementSuccessfulInteractions increments the number of successful
 // interactions with a host for a given key
 func (hdb *HostDB) IncrementSuccessfulInteractions(key types.SiaPublicKey) {
+	hdb.RecordSuccessWeighted(key, 1)
+}
+
+// IncrementFailedInteractions increments the number of failed interactions with
+// a host for a given key, and puts the host on cooldown. The cooldown grows
+// exponentially with the number of consecutive failures.
+func (hdb *HostDB) IncrementFailedInteractions(key types.SiaPublicKey) {
+	hdb.RecordFailureWeighted(key, 1)
+}
+
+// hostKeyByAddr returns the public key of the host with the provided
+// NetAddress. If no host has the address, false is returned.
+func (hdb *HostDB) hostKeyByAddr(addr modules.NetAddress) (types.SiaPublicKey, bool) {
+	for _, host := range hdb.hostTree.All() {
+		if host.NetAddress == addr {
+			return host.PublicKey, true
+		}
+	}
+	return types.SiaPublicKey{}, false
+}
+
+// IncrementSuccessfulInteractionsByAddr increments the number of successful
+// interactions with the host at the provided NetAddress. It returns false if
+// no host has the address, in which case nothing is recorded.
+func (hdb *HostDB) IncrementSuccessfulInteractionsByAddr(addr modules.NetAddress) bool {
+	key, exists := hdb.hostKeyByAddr(addr)
+	if exists {
+		hdb.IncrementSuccessfulInteractions(key)
+	}
+	return exists
+}
+
+// IncrementFailedInteractionsByAddr increments the number of failed
+// interactions with the host at the provided NetAddress. It returns false if
+// no host has the address, in which case nothing is recorded.
+func (hdb *HostDB) IncrementFailedInteractionsByAddr(addr modules.NetAddress) bool {
+	key, exists := hdb.hostKeyByAddr(addr)
+	if exists {
+		hdb.IncrementFailedInteractions(key)
+	}
+	return exists
+}
+
+// NoteHostUnused records that the renter no longer stores any data on the host
+// with the given key. The host's interactions become less relevant, so an
+// extra decay is applied to its historic interactions, after moving its recent
+// interactions into them.
+func (hdb *HostDB) NoteHostUnused(key types.SiaPublicKey) {
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+
+	host, haveHost := hdb.hostTree.Select(key)
+	if !haveHost {
+		return
+	}
+	hdb.updateHistoricInteractions(&host)
+	hsi, hfi := float64(host.HistoricSuccessfulInteractions), float64(host.HistoricFailedInteractions)
+	rsi, rfi := recentInteractionWeights(host)
+	host.HistoricSuccessfulInteractions = uint64((hsi + rsi) * unusedHostDecay)
+	host.HistoricFailedInteractions = uint64((hfi + rfi) * unusedHostDecay)
+	host.RecentSuccessfulInteractions = 0
+	host.RecentFailedInteractions = 0
+	host.RecentSuccessfulWeight = 0
+	host.RecentFailedWeight = 0
+	hdb.hostTree.Modify(host)
+}
+
+// SetMaxInteractionsPerBlock caps the weight of the interactions recorded for a
+// single host within a block. Interactions beyond the cap are dropped, which
+// protects the host scores against callers that record interactions in a
+// loop. A cap of zero removes the limit.
+func (hdb *HostDB) SetMaxInteractionsPerBlock(n uint64) {
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+	hdb.maxInteractionsPerBlock = n
+}
+
+// capInteractionWeight returns the portion of weight that can be added to the
+// recent interactions of host without exceeding maxInteractionsPerBlock. The
+// historic interactions of host must be up to date.
+func (hdb *HostDB) capInteractionWeight(host modules.HostDBEntry, weight float64) float64 {
+	if hdb.maxInteractionsPerBlock == 0 {
+		return weight
+	}
+	rsi, rfi := recentInteractionWeights(host)
+	return math.Min(weight, float64(hdb.maxInteractionsPerBlock)-rsi-rfi)
+}
+
+// SetFailurePenalty sets the multiplier applied to the weight of every failed
+// interaction recorded from now on, so that a failure can count more than a
+// success towards a host's interactions. Non-positive multipliers restore the
+// default of 1.
+func (hdb *HostDB) SetFailurePenalty(multiplier float64) {
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+	if multiplier <= 0 {
+		multiplier = 0
+	}
+	hdb.failurePenalty = multiplier
+}
+
+// RecordSuccessWeighted adds a successful interaction of the provided weight
+// to the recent interactions of a host. Weights that are not positive and
+// finite, including NaN, are ignored.
+func (hdb *HostDB) RecordSuccessWeighted(key types.SiaPublicKey, weight float64) {
+	if !(weight > 0) || math.IsInf(weight, 1) {
+		return
+	}
 	hdb.mu.Lock()
 	defer hdb.mu.Unlock()
 
@@ -297,16 +624,29 @@ func (hdb *HostDB) IncrementSuccessfulInteractions(key types.SiaPublicKey) {
 	}
 
 	// Update historic values if necessary
-	updateHostHistoricInteractions(&host, hdb.blockHeight)
+	hdb.updateHistoricInteractions(&host)
 
-	// Increment the successful interactions
-	host.RecentSuccessfulInteractions++
+	// Drop the weight beyond the per-block cap.
+	weight = hdb.capInteractionWeight(host, weight)
+	if weight <= 0 {
+		return
+	}
+
+	// Add the weight to the successful interactions, and clear the cooldown
+	hdb.logInteraction(key, interactionSuccess, weight)
+	addRecentInteractions(&host, weight, 0)
+	host.ConsecutiveFailures = 0
+	host.CooldownUntil = 0
 	hdb.hostTree.Modify(host)
 }
 
-// IncrementFailedInteractions increments the number of failed interactions with
-// a host for a given key
-func (hdb *HostDB) IncrementFailedInteractions(key types.SiaPublicKey) {
+// RecordFailureWeighted adds a failed interaction of the provided weight to
+// the recent interactions of a host. Weights that are not positive and
+// finite, including NaN, are ignored.
+func (hdb *HostDB) RecordFailureWeighted(key types.SiaPublicKey, weight float64) {
+	if !(weight > 0) || math.IsInf(weight, 1) {
+		return
+	}
 	hdb.mu.Lock()
 	defer hdb.mu.Unlock()
 
@@ -318,9 +658,22 @@ func (hdb *HostDB) IncrementFailedInteractions(key types.SiaPublicKey) {
 	}
 
 	// Update historic values if necessary
-	updateHostHistoricInteractions(&host, hdb.blockHeight)
+	hdb.updateHistoricInteractions(&host)
+
+	// Apply the failure penalty, and drop the weight beyond the per-block
+	// cap.
+	if hdb.failurePenalty != 0 {
+		weight *= hdb.failurePenalty
+	}
+	weight = hdb.capInteractionWeight(host, weight)
+	if weight <= 0 {
+		return
+	}
 
-	// Increment the failed interactions
-	host.RecentFailedInteractions++
+	// Add the weight to the failed interactions, and extend the cooldown
+	hdb.logInteraction(key, interactionFailure, weight)
+	addRecentInteractions(&host, 0, weight)
+	host.ConsecutiveFailures++
+	host.CooldownUntil = hdb.blockHeight + hostCooldown(host.ConsecutiveFailures)
 	hdb.hostTree.Modify(host)
 }
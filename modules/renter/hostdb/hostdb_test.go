@@ -5,6 +5,8 @@ import (
 	"math"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -41,7 +43,8 @@ func bareHostDB() *HostDB {
 	hdb := &HostDB{
 		log: persist.NewLogger(ioutil.Discard),
 
-		scanPool: make(chan modules.HostDBEntry),
+		scanPool:     make(chan modules.HostDBEntry),
+		scoreWeights: defaultScoreWeights,
 	}
 	hdb.hostTree = hosttree.New(hdb.calculateHostWeight)
 	return hdb
@@ -510,3 +513,464 @@ func TestUpdateHistoricInteractions(t *testing.T) {
 			host.HistoricFailedInteractions, host.HistoricSuccessfulInteractions)
 	}
 }
+
+// TestWeightedInteractions checks that fractional interaction weights are
+// accumulated, rounded into the integer counters, and used by the decay math.
+func TestWeightedInteractions(t *testing.T) {
+	hdb := bareHostDB()
+	hdb.online = true
+
+	host := makeHostDBEntry()
+	err := hdb.hostTree.Insert(host)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Record fractional weights.
+	for i := 0; i < 4; i++ {
+		hdb.RecordSuccessWeighted(host.PublicKey, 2.6)
+		hdb.RecordFailureWeighted(host.PublicKey, 0.25)
+	}
+	host, ok := hdb.Host(host.PublicKey)
+	if !ok {
+		t.Fatal("Modified host not found in hostdb")
+	}
+	if host.RecentSuccessfulWeight != 10.4 || host.RecentFailedWeight != 1 {
+		t.Errorf("Weights should be 10.4 and 1 but were %v and %v", host.RecentSuccessfulWeight, host.RecentFailedWeight)
+	}
+	if host.RecentSuccessfulInteractions != 10 || host.RecentFailedInteractions != 1 {
+		t.Errorf("Interactions should be 10 and 1 but were %v and %v", host.RecentSuccessfulInteractions, host.RecentFailedInteractions)
+	}
+
+	// Non-positive and non-finite weights should be ignored.
+	hdb.RecordSuccessWeighted(host.PublicKey, 0)
+	hdb.RecordFailureWeighted(host.PublicKey, -3)
+	hdb.RecordSuccessWeighted(host.PublicKey, math.NaN())
+	hdb.RecordFailureWeighted(host.PublicKey, math.NaN())
+	hdb.RecordSuccessWeighted(host.PublicKey, math.Inf(1))
+	hdb.RecordFailureWeighted(host.PublicKey, math.Inf(1))
+	host, _ = hdb.Host(host.PublicKey)
+	if host.RecentSuccessfulWeight != 10.4 || host.RecentFailedWeight != 1 {
+		t.Errorf("Weights should be unchanged but were %v and %v", host.RecentSuccessfulWeight, host.RecentFailedWeight)
+	}
+
+	// After a block, the fractional weight should be moved into the historic
+	// interactions rather than the rounded counter.
+	hdb.blockHeight++
+	hdb.IncrementSuccessfulInteractions(host.PublicKey)
+	host, _ = hdb.Host(host.PublicKey)
+	weight := 10.4
+	expected := uint64(weight * historicInteractionDecay)
+	if host.HistoricSuccessfulInteractions != expected {
+		t.Errorf("Historic interactions should be %v but were %v", expected, host.HistoricSuccessfulInteractions)
+	}
+	if host.RecentSuccessfulInteractions != 1 || host.RecentSuccessfulWeight != 1 {
+		t.Errorf("Recent interactions should be 1 but were %v (%v)", host.RecentSuccessfulInteractions, host.RecentSuccessfulWeight)
+	}
+
+	// An entry without weights, e.g. one loaded from disk, should fall back on
+	// the integer counters.
+	loaded := makeHostDBEntry()
+	loaded.RecentSuccessfulInteractions = 3
+	addRecentInteractions(&loaded, 0.5, 0)
+	if loaded.RecentSuccessfulWeight != 3.5 || loaded.RecentSuccessfulInteractions != 4 {
+		t.Errorf("Loaded entry should have weight 3.5 and 4 interactions, got %v and %v", loaded.RecentSuccessfulWeight, loaded.RecentSuccessfulInteractions)
+	}
+}
+
+// TestHostCooldown checks that consecutive failed interactions put a host on
+// an increasing cooldown, and that a successful interaction clears it.
+func TestHostCooldown(t *testing.T) {
+	hdb := bareHostDB()
+	hdb.online = true
+	hdb.blockHeight = 10
+
+	host := makeHostDBEntry()
+	err := hdb.hostTree.Insert(host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hdb.OnCooldown(host.PublicKey, hdb.blockHeight) {
+		t.Fatal("host should not start on cooldown")
+	}
+
+	// Each consecutive failure should extend the cooldown.
+	var prevCooldown types.BlockHeight
+	for i := 0; i < 4; i++ {
+		hdb.IncrementFailedInteractions(host.PublicKey)
+		host, _ = hdb.Host(host.PublicKey)
+		if host.CooldownUntil <= prevCooldown {
+			t.Fatalf("cooldown was not extended after %v failures: %v <= %v", i+1, host.CooldownUntil, prevCooldown)
+		}
+		prevCooldown = host.CooldownUntil
+	}
+	if host.ConsecutiveFailures != 4 || host.CooldownUntil != hdb.blockHeight+hostCooldown(4) {
+		t.Fatal("wrong cooldown after 4 failures:", host.ConsecutiveFailures, host.CooldownUntil)
+	}
+	if !hdb.OnCooldown(host.PublicKey, hdb.blockHeight) {
+		t.Fatal("host should be on cooldown")
+	}
+	if hdb.OnCooldown(host.PublicKey, host.CooldownUntil) {
+		t.Fatal("host should be off cooldown once the cooldown height is reached")
+	}
+	if len(hdb.RandomHosts(1, nil)) != 0 {
+		t.Fatal("RandomHosts returned a host that is on cooldown")
+	}
+
+	// The cooldown should never exceed the maximum.
+	if hostCooldown(1000) != maxHostCooldown {
+		t.Fatal("cooldown should be capped at", maxHostCooldown)
+	}
+
+	// A success should clear the cooldown.
+	hdb.IncrementSuccessfulInteractions(host.PublicKey)
+	host, _ = hdb.Host(host.PublicKey)
+	if host.ConsecutiveFailures != 0 || hdb.OnCooldown(host.PublicKey, hdb.blockHeight) {
+		t.Fatal("success did not clear the cooldown")
+	}
+	if len(hdb.RandomHosts(1, nil)) != 1 {
+		t.Fatal("RandomHosts did not return the host after its cooldown was cleared")
+	}
+}
+
+// TestDump checks that the Dump method reports decayed interactions and scores
+// without modifying the hosts.
+func TestDump(t *testing.T) {
+	hdb := bareHostDB()
+	hdb.blockHeight = 10
+
+	host1 := makeHostDBEntry()
+	host1.NetAddress = "foo:1"
+	host1.HistoricSuccessfulInteractions = 1000
+	host1.HistoricFailedInteractions = 100
+	host1.RecentFailedInteractions = 10
+	host2 := makeHostDBEntry()
+	host2.NetAddress = "bar:1"
+	host2.RecentSuccessfulInteractions = 5
+	host2.LastHistoricUpdate = hdb.blockHeight
+	for _, host := range []modules.HostDBEntry{host1, host2} {
+		if err := hdb.hostTree.Insert(host); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dump := hdb.Dump()
+	if len(dump) != 2 {
+		t.Fatal("expected 2 hosts in the dump, got", len(dump))
+	}
+	dumped := make(map[modules.NetAddress]ScoredHost)
+	for _, sh := range dump {
+		dumped[sh.NetAddress] = sh
+	}
+
+	// host1 was last updated at height 0 and should be decayed.
+	decayed := host1
+	updateHostHistoricInteractions(&decayed, hdb.blockHeight)
+	sh := dumped["foo:1"]
+	if sh.HistoricSuccessfulInteractions != decayed.HistoricSuccessfulInteractions || sh.HistoricFailedInteractions != decayed.HistoricFailedInteractions {
+		t.Errorf("wrong historic interactions: expected %v and %v, got %v and %v", decayed.HistoricSuccessfulInteractions, decayed.HistoricFailedInteractions, sh.HistoricSuccessfulInteractions, sh.HistoricFailedInteractions)
+	}
+	if sh.HistoricSuccessfulInteractions >= 1000 || sh.RecentFailedInteractions != 0 {
+		t.Error("host1 was not decayed:", sh)
+	}
+	if sh.Score.Cmp(hdb.calculateHostWeight(decayed)) != 0 || sh.PublicKey.String() != host1.PublicKey.String() {
+		t.Error("wrong score or key for host1:", sh)
+	}
+
+	// host2 was updated at the current height and should be unchanged.
+	sh = dumped["bar:1"]
+	if sh.HistoricSuccessfulInteractions != 0 || sh.RecentSuccessfulInteractions != 5 {
+		t.Error("wrong interactions for host2:", sh)
+	}
+
+	// The hosts in the hostdb should not have been modified.
+	host, _ := hdb.Host(host1.PublicKey)
+	if host.HistoricSuccessfulInteractions != 1000 || host.RecentFailedInteractions != 10 || host.LastHistoricUpdate != 0 {
+		t.Error("Dump modified a host:", host)
+	}
+}
+
+// TestIncrementInteractionsByAddr checks that interactions recorded by
+// NetAddress are attributed to the host with that address.
+func TestIncrementInteractionsByAddr(t *testing.T) {
+	hdb := bareHostDB()
+	hdb.online = true
+
+	host := makeHostDBEntry()
+	host.NetAddress = "foo:1234"
+	other := makeHostDBEntry()
+	other.NetAddress = "bar:1234"
+	for _, h := range []modules.HostDBEntry{host, other} {
+		if err := hdb.hostTree.Insert(h); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if !hdb.IncrementSuccessfulInteractionsByAddr("foo:1234") {
+		t.Fatal("known address was not resolved")
+	}
+	if !hdb.IncrementFailedInteractionsByAddr("foo:1234") {
+		t.Fatal("known address was not resolved")
+	}
+	if hdb.IncrementSuccessfulInteractionsByAddr("baz:1234") || hdb.IncrementFailedInteractionsByAddr("baz:1234") {
+		t.Fatal("unknown address was resolved")
+	}
+
+	host, _ = hdb.Host(host.PublicKey)
+	if host.RecentSuccessfulInteractions != 1 || host.RecentFailedInteractions != 1 {
+		t.Fatal("interactions were not recorded:", host.RecentSuccessfulInteractions, host.RecentFailedInteractions)
+	}
+	other, _ = hdb.Host(other.PublicKey)
+	if other.RecentSuccessfulInteractions != 0 || other.RecentFailedInteractions != 0 {
+		t.Fatal("interactions were recorded for the wrong host")
+	}
+}
+
+// TestSetOnline checks that failed interactions are not recorded while the
+// hostdb is set offline, while successful interactions still are.
+func TestSetOnline(t *testing.T) {
+	hdb := bareHostDB()
+	host := makeHostDBEntry()
+	if err := hdb.hostTree.Insert(host); err != nil {
+		t.Fatal(err)
+	}
+
+	hdb.SetOnline(false)
+	if hdb.Online() {
+		t.Fatal("hostdb should be offline")
+	}
+	hdb.IncrementSuccessfulInteractions(host.PublicKey)
+	hdb.IncrementFailedInteractions(host.PublicKey)
+	host, _ = hdb.Host(host.PublicKey)
+	if host.RecentSuccessfulInteractions != 1 || host.RecentFailedInteractions != 0 || host.ConsecutiveFailures != 0 {
+		t.Fatal("wrong interactions while offline:", host.RecentSuccessfulInteractions, host.RecentFailedInteractions, host.ConsecutiveFailures)
+	}
+
+	hdb.SetOnline(true)
+	if !hdb.Online() {
+		t.Fatal("hostdb should be online")
+	}
+	hdb.IncrementFailedInteractions(host.PublicKey)
+	host, _ = hdb.Host(host.PublicKey)
+	if host.RecentFailedInteractions != 1 || host.ConsecutiveFailures != 1 {
+		t.Fatal("failed interaction was not recorded while online:", host.RecentFailedInteractions, host.ConsecutiveFailures)
+	}
+}
+
+// TestMaxInteractionsPerBlock checks that interactions beyond the per-block
+// cap are dropped until the historic interactions are next updated.
+func TestMaxInteractionsPerBlock(t *testing.T) {
+	hdb := bareHostDB()
+	hdb.online = true
+	hdb.blockHeight = 10
+	host := makeHostDBEntry()
+	host.LastHistoricUpdate = hdb.blockHeight
+	if err := hdb.hostTree.Insert(host); err != nil {
+		t.Fatal(err)
+	}
+
+	hdb.SetMaxInteractionsPerBlock(3)
+	for i := 0; i < 5; i++ {
+		hdb.IncrementSuccessfulInteractions(host.PublicKey)
+	}
+	hdb.IncrementFailedInteractions(host.PublicKey)
+	host, _ = hdb.Host(host.PublicKey)
+	if host.RecentSuccessfulInteractions != 3 || host.RecentFailedInteractions != 0 || host.ConsecutiveFailures != 0 {
+		t.Fatal("cap was not enforced:", host.RecentSuccessfulInteractions, host.RecentFailedInteractions, host.ConsecutiveFailures)
+	}
+
+	// Weighted interactions are cut off at the cap.
+	hdb.blockHeight++
+	hdb.RecordFailureWeighted(host.PublicKey, 2)
+	hdb.RecordSuccessWeighted(host.PublicKey, 2)
+	host, _ = hdb.Host(host.PublicKey)
+	if host.RecentFailedWeight != 2 || host.RecentSuccessfulWeight != 1 {
+		t.Fatal("weighted interactions were not capped:", host.RecentFailedWeight, host.RecentSuccessfulWeight)
+	}
+	if host.HistoricSuccessfulInteractions == 0 {
+		t.Fatal("recent interactions were not moved to the historic interactions")
+	}
+
+	// Without a cap, all interactions are recorded.
+	hdb.SetMaxInteractionsPerBlock(0)
+	for i := 0; i < 5; i++ {
+		hdb.IncrementSuccessfulInteractions(host.PublicKey)
+	}
+	host, _ = hdb.Host(host.PublicKey)
+	if host.RecentSuccessfulInteractions != 6 {
+		t.Fatal("interactions were dropped without a cap:", host.RecentSuccessfulInteractions)
+	}
+}
+
+// TestSetFailurePenalty checks that SetFailurePenalty scales the weight of
+// failed interactions, but not of successful ones.
+func TestSetFailurePenalty(t *testing.T) {
+	hdb := bareHostDB()
+	hdb.online = true
+	hdb.blockHeight = 10
+	host := makeHostDBEntry()
+	host.LastHistoricUpdate = hdb.blockHeight
+	if err := hdb.hostTree.Insert(host); err != nil {
+		t.Fatal(err)
+	}
+
+	// By default, failures and successes have the same weight.
+	hdb.IncrementSuccessfulInteractions(host.PublicKey)
+	hdb.IncrementFailedInteractions(host.PublicKey)
+	host, _ = hdb.Host(host.PublicKey)
+	if host.RecentSuccessfulWeight != 1 || host.RecentFailedWeight != 1 {
+		t.Fatal("wrong default weights:", host.RecentSuccessfulWeight, host.RecentFailedWeight)
+	}
+
+	hdb.SetFailurePenalty(3)
+	hdb.IncrementSuccessfulInteractions(host.PublicKey)
+	hdb.IncrementFailedInteractions(host.PublicKey)
+	hdb.RecordFailureWeighted(host.PublicKey, 0.5)
+	host, _ = hdb.Host(host.PublicKey)
+	if host.RecentSuccessfulWeight != 2 || host.RecentFailedWeight != 5.5 {
+		t.Fatal("failure penalty was not applied:", host.RecentSuccessfulWeight, host.RecentFailedWeight)
+	}
+
+	// A non-positive penalty restores the default.
+	hdb.SetFailurePenalty(-1)
+	hdb.IncrementFailedInteractions(host.PublicKey)
+	host, _ = hdb.Host(host.PublicKey)
+	if host.RecentFailedWeight != 6.5 {
+		t.Fatal("default failure penalty was not restored:", host.RecentFailedWeight)
+	}
+}
+
+// TestNoteHostUnused checks that NoteHostUnused applies an extra decay to the
+// interactions of a host.
+func TestNoteHostUnused(t *testing.T) {
+	hdb := bareHostDB()
+	hdb.blockHeight = 10
+	host := makeHostDBEntry()
+	host.HistoricSuccessfulInteractions = 100
+	host.HistoricFailedInteractions = 20
+	host.RecentSuccessfulInteractions = 4
+	host.LastHistoricUpdate = hdb.blockHeight
+	if err := hdb.hostTree.Insert(host); err != nil {
+		t.Fatal(err)
+	}
+
+	hdb.NoteHostUnused(host.PublicKey)
+	host, _ = hdb.Host(host.PublicKey)
+	if host.HistoricSuccessfulInteractions != 52 || host.HistoricFailedInteractions != 10 || host.RecentSuccessfulInteractions != 0 {
+		t.Fatal("wrong interactions after extra decay:", host.HistoricSuccessfulInteractions, host.HistoricFailedInteractions, host.RecentSuccessfulInteractions)
+	}
+
+	// Unknown hosts are ignored.
+	hdb.NoteHostUnused(types.SiaPublicKey{})
+}
+
+// TestVerify checks that Verify detects inconsistent hosts.
+func TestVerify(t *testing.T) {
+	hdb := bareHostDB()
+	hdb.blockHeight = 10
+	host := makeHostDBEntry()
+	host.LastHistoricUpdate = hdb.blockHeight
+	if err := hdb.hostTree.Insert(host); err != nil {
+		t.Fatal(err)
+	}
+	if err := hdb.Verify(); err != nil {
+		t.Fatal(err)
+	}
+
+	host.RecentFailedWeight = math.NaN()
+	if err := hdb.hostTree.Modify(host); err != nil {
+		t.Fatal(err)
+	}
+	if err := hdb.Verify(); err == nil {
+		t.Fatal("Verify did not detect a NaN interaction weight")
+	}
+
+	host.RecentFailedWeight = 0
+	host.LastHistoricUpdate = hdb.blockHeight + 1
+	if err := hdb.hostTree.Modify(host); err != nil {
+		t.Fatal(err)
+	}
+	if err := hdb.Verify(); err == nil {
+		t.Fatal("Verify did not detect an update in the future")
+	}
+}
+
+// TestUpdateHistoricInteractionsInvalid checks that invalid interaction
+// weights do not produce garbage historic interactions.
+func TestUpdateHistoricInteractionsInvalid(t *testing.T) {
+	tests := []struct {
+		success, failed float64
+	}{
+		{math.NaN(), 0},
+		{0, math.Inf(1)},
+		{math.Inf(-1), 1},
+		{math.Inf(1), math.Inf(-1)},
+	}
+	for _, test := range tests {
+		host := modules.HostDBEntry{
+			HistoricSuccessfulInteractions: 10,
+			HistoricFailedInteractions:     10,
+			RecentSuccessfulWeight:         test.success,
+			RecentFailedWeight:             test.failed,
+		}
+		if updateHostHistoricInteractions(&host, 5) {
+			t.Errorf("invalid weights %v and %v were not detected", test.success, test.failed)
+		}
+		if host.HistoricSuccessfulInteractions != 0 || host.HistoricFailedInteractions != 0 || host.RecentSuccessfulWeight != 0 || host.RecentFailedWeight != 0 {
+			t.Errorf("interactions were not reset for weights %v and %v: %v", test.success, test.failed, host)
+		}
+		if host.LastHistoricUpdate != 5 {
+			t.Error("last update was not recorded")
+		}
+	}
+
+	// Recent interactions without any weight are valid.
+	host := modules.HostDBEntry{HistoricSuccessfulInteractions: 10}
+	if !updateHostHistoricInteractions(&host, 1) {
+		t.Error("valid interactions were reset")
+	}
+	if host.HistoricSuccessfulInteractions != 9 {
+		t.Error("wrong historic interactions:", host.HistoricSuccessfulInteractions)
+	}
+}
+
+// TestTopHostsDiverse checks that TopHostsDiverse picks the highest weighted
+// host of each group.
+func TestTopHostsDiverse(t *testing.T) {
+	hdb := bareHostDB()
+	// Cheaper hosts have a higher weight.
+	prices := map[modules.NetAddress]uint64{
+		"1.1.1.1:1": 3,
+		"1.1.2.2:1": 1, // same /16 as 1.1.1.1
+		"2.2.2.2:1": 2,
+		"3.3.3.3:1": 4,
+	}
+	for addr, price := range prices {
+		host := makeHostDBEntry()
+		host.NetAddress = addr
+		host.StoragePrice = minTotalPrice.Mul64(price)
+		if err := hdb.hostTree.Insert(host); err != nil {
+			t.Fatal(err)
+		}
+	}
+	subnet := func(addr modules.NetAddress) string {
+		parts := strings.Split(addr.Host(), ".")
+		return parts[0] + "." + parts[1]
+	}
+
+	var addrs []modules.NetAddress
+	for _, host := range hdb.TopHostsDiverse(10, subnet) {
+		addrs = append(addrs, host.NetAddress)
+	}
+	exp := []modules.NetAddress{"1.1.2.2:1", "2.2.2.2:1", "3.3.3.3:1"}
+	if !reflect.DeepEqual(addrs, exp) {
+		t.Fatalf("expected %v, got %v", exp, addrs)
+	}
+
+	if top := hdb.TopHostsDiverse(1, subnet); len(top) != 1 || top[0].NetAddress != "1.1.2.2:1" {
+		t.Fatal("wrong top host:", top)
+	}
+	if top := hdb.TopHostsDiverse(10, nil); len(top) != 4 {
+		t.Fatal("expected every host without a grouping function, got", top)
+	}
+}
@@ -1,6 +1,7 @@
 package hostdb
 
 import (
+	"errors"
 	"math"
 	"math/big"
 
@@ -9,7 +10,34 @@ import (
 	"github.com/NebulousLabs/Sia/types"
 )
 
+const (
+	// interactionExponentiation is the power that the ratio of successful
+	// interactions is raised to.
+	interactionExponentiation = 10
+
+	// interactionPriorSuccesses is the number of successful interactions that
+	// every host is assumed to have had, so that the first few failures of a
+	// new host do not ruin its score.
+	interactionPriorSuccesses = 30
+
+	// maxScoreWeight is the largest score weight that can be set. Larger
+	// weights would let the collateral adjustments overflow.
+	maxScoreWeight = 10
+)
+
 var (
+	// defaultScoreWeights are the score weights of a new hostdb. They give
+	// the same scores as the hostdb did before the weights could be changed,
+	// which ignores the interactions with a host.
+	defaultScoreWeights = modules.HostScoreWeights{
+		Age:        1,
+		Collateral: 1,
+		Price:      1,
+		Uptime:     1,
+	}
+
+	errInvalidScoreWeight = errors.New("score weights must be between 0 and 10")
+
 	// Because most weights would otherwise be fractional, we set the base
 	// weight to be very large.
 	baseWeight = types.NewCurrency(new(big.Int).Exp(big.NewInt(10), big.NewInt(80), nil))
@@ -341,18 +369,47 @@ func (hdb *HostDB) uptimeAdjustments(entry modules.HostDBEntry) float64 {
 	return math.Pow(uptimeRatio, exp)
 }
 
-// calculateHostWeight returns the weight of a host according to the settings of
-// the host database entry.
-func (hdb *HostDB) calculateHostWeight(entry modules.HostDBEntry) types.Currency {
-	collateralReward := hdb.collateralAdjustments(entry)
-	pricePenalty := hdb.priceAdjustments(entry)
-	storageRemainingPenalty := storageRemainingAdjustments(entry)
-	versionPenalty := versionAdjustments(entry)
-	lifetimePenalty := hdb.lifetimeAdjustments(entry)
-	uptimePenalty := hdb.uptimeAdjustments(entry)
+// interactionAdjustments penalizes the host for the share of its interactions
+// that failed.
+func interactionAdjustments(entry modules.HostDBEntry) float64 {
+	rsi, rfi := recentInteractionWeights(entry)
+	successes := float64(entry.HistoricSuccessfulInteractions) + rsi + interactionPriorSuccesses
+	failures := float64(entry.HistoricFailedInteractions) + rfi
+	return math.Pow(successes/(successes+failures), interactionExponentiation)
+}
 
+// validateScoreWeights checks that every score weight is between 0 and
+// maxScoreWeight.
+func validateScoreWeights(weights modules.HostScoreWeights) error {
+	for _, w := range []float64{weights.Age, weights.Collateral, weights.Interactions, weights.Price, weights.Uptime} {
+		if !(w >= 0 && w <= maxScoreWeight) {
+			return errInvalidScoreWeight
+		}
+	}
+	return nil
+}
+
+// weightedAdjustments returns the adjustments that make up the weight of a
+// host, each raised to its score weight.
+func (hdb *HostDB) weightedAdjustments(entry modules.HostDBEntry) modules.HostScoreBreakdown {
+	weights := hdb.scoreWeights
+	return modules.HostScoreBreakdown{
+		AgeAdjustment:              math.Pow(hdb.lifetimeAdjustments(entry), weights.Age),
+		BurnAdjustment:             1,
+		CollateralAdjustment:       math.Pow(hdb.collateralAdjustments(entry), weights.Collateral),
+		InteractionAdjustment:      math.Pow(interactionAdjustments(entry), weights.Interactions),
+		PriceAdjustment:            math.Pow(hdb.priceAdjustments(entry), weights.Price),
+		StorageRemainingAdjustment: storageRemainingAdjustments(entry),
+		UptimeAdjustment:           math.Pow(hdb.uptimeAdjustments(entry), weights.Uptime),
+		VersionAdjustment:          versionAdjustments(entry),
+	}
+}
+
+// combineAdjustments returns the weight of a host with the provided
+// adjustments.
+func combineAdjustments(sb modules.HostScoreBreakdown) types.Currency {
 	// Combine the adjustments.
-	fullPenalty := collateralReward * pricePenalty * storageRemainingPenalty * versionPenalty * lifetimePenalty * uptimePenalty
+	fullPenalty := sb.CollateralAdjustment * sb.PriceAdjustment * sb.StorageRemainingAdjustment * sb.VersionAdjustment * sb.AgeAdjustment * sb.UptimeAdjustment * sb.InteractionAdjustment
 
 	// Return a types.Currency.
 	weight := baseWeight.MulFloat(fullPenalty)
@@ -363,6 +420,12 @@ func (hdb *HostDB) calculateHostWeight(entry modules.HostDBEntry) types.Currency
 	return weight
 }
 
+// calculateHostWeight returns the weight of a host according to the settings of
+// the host database entry.
+func (hdb *HostDB) calculateHostWeight(entry modules.HostDBEntry) types.Currency {
+	return combineAdjustments(hdb.weightedAdjustments(entry))
+}
+
 // calculateConversionRate calculates the conversion rate of the provided
 // host score, comparing it to the hosts in the database and returning what
 // percentage of contracts it is likely to participate in.
@@ -382,31 +445,25 @@ func (hdb *HostDB) calculateConversionRate(score types.Currency) float64 {
 }
 
 // EstimateHostScore takes a HostExternalSettings and returns the estimated
-// score of that host in the hostdb, assuming no penalties for age or uptime.
+// score of that host in the hostdb, assuming no penalties for age, uptime, or
+// failed interactions.
 func (hdb *HostDB) EstimateHostScore(entry modules.HostDBEntry) modules.HostScoreBreakdown {
-	collateralReward := hdb.collateralAdjustments(entry)
-	pricePenalty := hdb.priceAdjustments(entry)
-	storageRemainingPenalty := storageRemainingAdjustments(entry)
-	versionPenalty := versionAdjustments(entry)
-	fullPenalty := collateralReward * pricePenalty * storageRemainingPenalty * versionPenalty
-
-	estimatedScore := baseWeight.MulFloat(fullPenalty)
-	if estimatedScore.IsZero() {
-		estimatedScore = types.NewCurrency64(1)
-	}
-
-	return modules.HostScoreBreakdown{
-		Score:          estimatedScore,
-		ConversionRate: hdb.calculateConversionRate(estimatedScore),
+	hdb.mu.RLock()
+	defer hdb.mu.RUnlock()
 
+	sb := modules.HostScoreBreakdown{
 		AgeAdjustment:              1,
 		BurnAdjustment:             1,
-		CollateralAdjustment:       collateralReward,
-		PriceAdjustment:            pricePenalty,
-		StorageRemainingAdjustment: storageRemainingPenalty,
+		CollateralAdjustment:       math.Pow(hdb.collateralAdjustments(entry), hdb.scoreWeights.Collateral),
+		InteractionAdjustment:      1,
+		PriceAdjustment:            math.Pow(hdb.priceAdjustments(entry), hdb.scoreWeights.Price),
+		StorageRemainingAdjustment: storageRemainingAdjustments(entry),
 		UptimeAdjustment:           1,
-		VersionAdjustment:          versionPenalty,
+		VersionAdjustment:          versionAdjustments(entry),
 	}
+	sb.Score = combineAdjustments(sb)
+	sb.ConversionRate = hdb.calculateConversionRate(sb.Score)
+	return sb
 }
 
 // ScoreBreakdown provdes a detailed set of scalars and bools indicating
@@ -415,17 +472,34 @@ func (hdb *HostDB) ScoreBreakdown(entry modules.HostDBEntry) modules.HostScoreBr
 	hdb.mu.Lock()
 	defer hdb.mu.Unlock()
 
-	score := hdb.calculateHostWeight(entry)
-	return modules.HostScoreBreakdown{
-		Score:          score,
-		ConversionRate: hdb.calculateConversionRate(score),
+	sb := hdb.weightedAdjustments(entry)
+	sb.Score = combineAdjustments(sb)
+	sb.ConversionRate = hdb.calculateConversionRate(sb.Score)
+	return sb
+}
 
-		AgeAdjustment:              hdb.lifetimeAdjustments(entry),
-		BurnAdjustment:             1,
-		CollateralAdjustment:       hdb.collateralAdjustments(entry),
-		PriceAdjustment:            hdb.priceAdjustments(entry),
-		StorageRemainingAdjustment: storageRemainingAdjustments(entry),
-		UptimeAdjustment:           hdb.uptimeAdjustments(entry),
-		VersionAdjustment:          versionAdjustments(entry),
+// ScoreWeights returns the weights of the components of the host scores.
+func (hdb *HostDB) ScoreWeights() modules.HostScoreWeights {
+	hdb.mu.RLock()
+	defer hdb.mu.RUnlock()
+	return hdb.scoreWeights
+}
+
+// SetScoreWeights changes the weights of the components of the host scores,
+// so that host selection can favor cheap hosts or reliable ones. Every host is
+// rescored, and the weights are saved.
+func (hdb *HostDB) SetScoreWeights(weights modules.HostScoreWeights) error {
+	if err := validateScoreWeights(weights); err != nil {
+		return err
+	}
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+
+	hdb.scoreWeights = weights
+	for _, host := range hdb.hostTree.All() {
+		if err := hdb.hostTree.Modify(host); err != nil {
+			return err
+		}
 	}
+	return hdb.saveSync()
 }
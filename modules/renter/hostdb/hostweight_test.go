@@ -1,6 +1,8 @@
 package hostdb
 
 import (
+	"math"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -284,3 +286,91 @@ func TestHostWeightUptimeDifferences4(t *testing.T) {
 		t.Error("Been around longer should have more weight")
 	}
 }
+
+func TestHostWeightInteractionDifferences(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	hdb := bareHostDB()
+	var entry modules.HostDBEntry
+	entry.RemainingStorage = 250e3
+	entry.StoragePrice = types.NewCurrency64(1000).Mul(types.SiacoinPrecision)
+	entry.HistoricSuccessfulInteractions = 100
+
+	entry2 := entry
+	entry2.HistoricFailedInteractions = 50
+	if hdb.calculateHostWeight(entry).Cmp(hdb.calculateHostWeight(entry2)) != 0 {
+		t.Error("Interactions should be ignored by default")
+	}
+	hdb.scoreWeights.Interactions = 1
+	if hdb.calculateHostWeight(entry).Cmp(hdb.calculateHostWeight(entry2)) <= 0 {
+		t.Error("Failed interactions should have less weight")
+	}
+}
+
+// TestSetScoreWeights checks that changing the score weights rescores the
+// hosts, that invalid weights are rejected, and that the weights are
+// persisted.
+func TestSetScoreWeights(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	hdbt, err := newHDBTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The cheap host is preferred by default, and the host that offers more
+	// collateral is preferred once prices are ignored. The preferred host has
+	// the most weight, so it is the last host in the tree.
+	tbMonthPrice := func(sc uint64) types.Currency {
+		return types.NewCurrency64(sc).Mul(types.SiacoinPrecision).Div64(tbMonth)
+	}
+	var cheap, collateral modules.HostDBEntry
+	cheap.PublicKey.Key = []byte("cheap")
+	cheap.RemainingStorage = 250e3
+	cheap.StoragePrice = tbMonthPrice(300)
+	collateral.PublicKey.Key = []byte("collateral")
+	collateral.RemainingStorage = 250e3
+	collateral.StoragePrice = tbMonthPrice(1000)
+	collateral.Collateral = tbMonthPrice(1000)
+	hdbt.hdb.mu.Lock()
+	hdbt.hdb.hostTree.Insert(cheap)
+	hdbt.hdb.hostTree.Insert(collateral)
+	hdbt.hdb.mu.Unlock()
+	if hosts := hdbt.hdb.AllHosts(); string(hosts[len(hosts)-1].PublicKey.Key) != "cheap" {
+		t.Fatal("expected the cheap host to be preferred by default")
+	}
+	weights := defaultScoreWeights
+	weights.Price = 0
+	if err := hdbt.hdb.SetScoreWeights(weights); err != nil {
+		t.Fatal(err)
+	}
+	if hosts := hdbt.hdb.AllHosts(); string(hosts[len(hosts)-1].PublicKey.Key) != "collateral" {
+		t.Fatal("expected the host with more collateral to be preferred when prices are ignored")
+	}
+
+	for _, w := range []float64{-1, maxScoreWeight + 1, math.NaN()} {
+		invalid := weights
+		invalid.Uptime = w
+		if err := hdbt.hdb.SetScoreWeights(invalid); err != errInvalidScoreWeight {
+			t.Fatalf("expected errInvalidScoreWeight for weight %v, got %v", w, err)
+		}
+	}
+	if hdbt.hdb.ScoreWeights() != weights {
+		t.Fatal("invalid weights were set:", hdbt.hdb.ScoreWeights())
+	}
+
+	// Close and reload.
+	err = hdbt.hdb.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hdbt.hdb, err = newHostDB(hdbt.gateway, hdbt.cs, filepath.Join(hdbt.persistDir, modules.RenterDir), quitAfterLoadDeps{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hdbt.hdb.ScoreWeights() != weights {
+		t.Fatal("score weights were not persisted:", hdbt.hdb.ScoreWeights())
+	}
+}
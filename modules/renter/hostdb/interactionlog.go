@@ -0,0 +1,81 @@
+package hostdb
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+const (
+	interactionSuccess = "success"
+	interactionFailure = "failure"
+)
+
+// EnableInteractionLog makes the hostdb write a line to w for every
+// interaction it records against a host, before the host's interactions are
+// modified. Each line holds the time in nanoseconds since the Unix epoch, the
+// block height, the host's public key, whether the interaction was a success
+// or a failure, and its weight after any penalty or cap has been applied.
+// Interactions that are dropped are not logged. A nil writer disables the log.
+func (hdb *HostDB) EnableInteractionLog(w io.Writer) {
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+	hdb.interactionLog = w
+}
+
+// logInteraction writes an interaction to the interaction log, if one is set.
+// The hostdb's lock must be held.
+func (hdb *HostDB) logInteraction(key types.SiaPublicKey, kind string, weight float64) {
+	if hdb.interactionLog == nil {
+		return
+	}
+	_, err := fmt.Fprintf(hdb.interactionLog, "%d %d %s %s %s\n", time.Now().UnixNano(), hdb.blockHeight, key.String(), kind, strconv.FormatFloat(weight, 'g', -1, 64))
+	if err != nil {
+		hdb.log.Println("Unable to write to the interaction log:", err)
+	}
+}
+
+// ReplayInteractionLog reads an interaction log written by the hostdb and
+// returns, for every host in the log, the interactions that the hostdb held
+// after recording the last of them, keyed by the host's public key. Hosts are
+// assumed to have had no interactions before the first line of the log.
+func ReplayInteractionLog(r io.Reader) (map[string]modules.HostDBEntry, error) {
+	hosts := make(map[string]modules.HostDBEntry)
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 5 {
+			return nil, fmt.Errorf("line %v: expected 5 fields, got %v", line, len(fields))
+		}
+		height, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %v: invalid block height: %v", line, err)
+		}
+		weight, err := strconv.ParseFloat(fields[4], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %v: invalid weight: %v", line, err)
+		}
+
+		host := hosts[fields[2]]
+		updateHostHistoricInteractions(&host, types.BlockHeight(height))
+		switch fields[3] {
+		case interactionSuccess:
+			addRecentInteractions(&host, weight, 0)
+		case interactionFailure:
+			addRecentInteractions(&host, 0, weight)
+		default:
+			return nil, fmt.Errorf("line %v: unknown interaction %q", line, fields[3])
+		}
+		hosts[fields[2]] = host
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return hosts, nil
+}
@@ -0,0 +1,73 @@
+package hostdb
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// TestReplayInteractionLog checks that replaying the interaction log
+// reproduces the interactions recorded by the hostdb.
+func TestReplayInteractionLog(t *testing.T) {
+	hdb := bareHostDB()
+	hdb.online = true
+	host1, host2 := makeHostDBEntry(), makeHostDBEntry()
+	for _, host := range []modules.HostDBEntry{host1, host2} {
+		if err := hdb.hostTree.Insert(host); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Record interactions across several blocks, with a penalty and a cap
+	// that drops some of them.
+	var buf bytes.Buffer
+	hdb.EnableInteractionLog(&buf)
+	hdb.SetFailurePenalty(2)
+	hdb.SetMaxInteractionsPerBlock(4)
+	for i := 0; i < 5; i++ {
+		hdb.blockHeight += 3
+		hdb.IncrementSuccessfulInteractions(host1.PublicKey)
+		hdb.IncrementFailedInteractions(host1.PublicKey)
+		hdb.RecordSuccessWeighted(host2.PublicKey, 1.5)
+		hdb.RecordSuccessWeighted(host2.PublicKey, 2)
+		hdb.IncrementFailedInteractions(host2.PublicKey)
+		hdb.IncrementFailedInteractions(host2.PublicKey)
+	}
+	if n := strings.Count(buf.String(), "\n"); n != 5*5 {
+		t.Fatal("wrong number of logged interactions:", n)
+	}
+
+	logged := buf.String()
+	replayed, err := ReplayInteractionLog(strings.NewReader(logged))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replayed) != 2 {
+		t.Fatal("expected 2 hosts in the replay, got", len(replayed))
+	}
+	for i, host := range []modules.HostDBEntry{host1, host2} {
+		live, _ := hdb.Host(host.PublicKey)
+		r := replayed[host.PublicKey.String()]
+		if r.HistoricSuccessfulInteractions != live.HistoricSuccessfulInteractions || r.HistoricFailedInteractions != live.HistoricFailedInteractions ||
+			r.RecentSuccessfulWeight != live.RecentSuccessfulWeight || r.RecentFailedWeight != live.RecentFailedWeight {
+			t.Errorf("replay of host %v does not match: expected %v, got %v", i, live, r)
+		}
+	}
+
+	// Interactions are not logged once the log is disabled.
+	hdb.EnableInteractionLog(nil)
+	hdb.IncrementSuccessfulInteractions(host1.PublicKey)
+	if buf.String() != logged {
+		t.Fatal("interaction was logged after the log was disabled")
+	}
+
+	// Invalid logs are rejected.
+	if _, err := ReplayInteractionLog(strings.NewReader("1 2 foo bar 1\n")); err == nil {
+		t.Error("expected an error for an unknown interaction")
+	}
+	if _, err := ReplayInteractionLog(strings.NewReader("1 2 foo\n")); err == nil {
+		t.Error("expected an error for a short line")
+	}
+}
@@ -18,14 +18,16 @@ func (hdb *HostDB) threadedOnlineCheck() {
 
 	for {
 		// Every 30 seconds, check the online status and update the online
-		// field.
+		// field, unless the online status is set using SetOnline.
 		peers := hdb.gateway.Peers()
 		hdb.mu.Lock()
-		hdb.online = false
-		for _, peer := range peers {
-			if !peer.Local {
-				hdb.online = true
-				break
+		if !hdb.onlineSet {
+			hdb.online = false
+			for _, peer := range peers {
+				if !peer.Local {
+					hdb.online = true
+					break
+				}
 			}
 		}
 		hdb.mu.Unlock()
@@ -27,6 +27,10 @@ type hdbPersist struct {
 	AllHosts    []modules.HostDBEntry
 	BlockHeight types.BlockHeight
 	LastChange  modules.ConsensusChangeID
+
+	// ScoreWeights is nil in hostdbs that were saved before the score
+	// weights could be changed.
+	ScoreWeights *modules.HostScoreWeights
 }
 
 // persistData returns the data in the hostdb that will be saved to disk.
@@ -34,6 +38,8 @@ func (hdb *HostDB) persistData() (data hdbPersist) {
 	data.AllHosts = hdb.hostTree.All()
 	data.BlockHeight = hdb.blockHeight
 	data.LastChange = hdb.lastChange
+	weights := hdb.scoreWeights
+	data.ScoreWeights = &weights
 	return data
 }
 
@@ -54,6 +60,9 @@ func (hdb *HostDB) load() error {
 	// Set the hostdb internal values.
 	hdb.blockHeight = data.BlockHeight
 	hdb.lastChange = data.LastChange
+	if data.ScoreWeights != nil && validateScoreWeights(*data.ScoreWeights) == nil {
+		hdb.scoreWeights = *data.ScoreWeights
+	}
 
 	// Load each of the hosts into the host tree.
 	for _, host := range data.AllHosts {
@@ -51,6 +51,8 @@ func TestSaveLoad(t *testing.T) {
 	host1.FirstSeen = 1
 	host2.FirstSeen = 2
 	host3.FirstSeen = 3
+	host1.ConsecutiveFailures = 3
+	host1.CooldownUntil = 7
 	host1.PublicKey.Key = []byte("foo")
 	host2.PublicKey.Key = []byte("bar")
 	host3.PublicKey.Key = []byte("baz")
@@ -94,6 +96,9 @@ func TestSaveLoad(t *testing.T) {
 	if h1.FirstSeen != 1 {
 		t.Error("h1 block height loaded incorrectly")
 	}
+	if h1.ConsecutiveFailures != 3 || h1.CooldownUntil != 7 {
+		t.Error("h1 cooldown loaded incorrectly")
+	}
 	if h2.FirstSeen != 2 {
 		t.Error("h1 block height loaded incorrectly")
 	}
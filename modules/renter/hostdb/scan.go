@@ -201,7 +201,7 @@ func (hdb *HostDB) managedScanHost(entry modules.HostDBEntry) {
 
 	// Update historic interactions of entry if necessary
 	hdb.mu.RLock()
-	updateHostHistoricInteractions(&entry, hdb.blockHeight)
+	hdb.updateHistoricInteractions(&entry)
 	hdb.mu.RUnlock()
 
 	var settings modules.HostExternalSettings
@@ -235,9 +235,9 @@ func (hdb *HostDB) managedScanHost(entry modules.HostDBEntry) {
 	}()
 	if err != nil {
 		hdb.log.Debugf("Scan of host at %v failed: %v", netAddr, err)
-		if hdb.online {
+		if hdb.Online() {
 			// Increment failed host interactions
-			entry.RecentFailedInteractions++
+			addRecentInteractions(&entry, 0, 1)
 		}
 
 	} else {
@@ -245,7 +245,7 @@ func (hdb *HostDB) managedScanHost(entry modules.HostDBEntry) {
 		entry.HostExternalSettings = settings
 
 		// Increment successful host interactions
-		entry.RecentSuccessfulInteractions++
+		addRecentInteractions(&entry, 1, 0)
 	}
 
 	// Update the host tree to have a new entry, including the new error. Then
@@ -0,0 +1,322 @@
+package renter
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// An offlineHostSet is a set of hosts, such as the hosts that have been
+// marked offline using MarkHostOffline, whose pieces are considered
+// unavailable. The set has its own lock, so that it can be checked regardless
+// of whether the renter's lock is held.
+type offlineHostSet struct {
+	hosts map[modules.NetAddress]struct{}
+	mu    sync.RWMutex
+}
+
+// contains reports whether the host at addr has been marked offline.
+func (s *offlineHostSet) contains(addr modules.NetAddress) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, exists := s.hosts[addr]
+	return exists
+}
+
+// set marks the host at addr as offline or online. It returns false if the
+// host was already in the requested state.
+func (s *offlineHostSet) set(addr modules.NetAddress, offline bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, exists := s.hosts[addr]
+	if exists == offline {
+		return false
+	}
+	if offline {
+		if s.hosts == nil {
+			s.hosts = make(map[modules.NetAddress]struct{})
+		}
+		s.hosts[addr] = struct{}{}
+	} else {
+		delete(s.hosts, addr)
+	}
+	return true
+}
+
+// list returns the addresses of the hosts in the set, sorted.
+func (s *offlineHostSet) list() []modules.NetAddress {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	addrs := make([]modules.NetAddress, 0, len(s.hosts))
+	for addr := range s.hosts {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool {
+		return addrs[i] < addrs[j]
+	})
+	return addrs
+}
+
+// markHost marks the host at addr as offline or online, saves the renter, and
+// returns the number of pieces whose availability changed as a result.
+func (r *Renter) markHost(addr modules.NetAddress, offline bool) int {
+	if r.addThread() != nil {
+		return 0
+	}
+	defer r.tg.Done()
+	lockID := r.mu.Lock()
+	defer r.mu.Unlock(lockID)
+
+	if !r.offlineHosts.set(addr, offline) {
+		return 0
+	}
+	r.save()
+
+	var affected int
+	for _, f := range r.files {
+		f.mu.RLock()
+		for _, fc := range f.contracts {
+			if fc.IP == addr {
+				affected += len(fc.Pieces)
+			}
+		}
+		f.mu.RUnlock()
+	}
+	return affected
+}
+
+// MarkHostOffline marks every piece stored on the host at addr as unavailable,
+// and returns the number of pieces affected. Pieces that were already marked
+// unavailable are not counted. The host remains offline until MarkHostOnline
+// is called, and the setting is persisted across restarts.
+func (r *Renter) MarkHostOffline(addr modules.NetAddress) int {
+	return r.markHost(addr, true)
+}
+
+// MarkHostOnline reverses MarkHostOffline, and returns the number of pieces
+// stored on the host that are no longer marked unavailable.
+func (r *Renter) MarkHostOnline(addr modules.NetAddress) int {
+	return r.markHost(addr, false)
+}
+
+// HostConcentration returns, for each host, the number of distinct files that
+// store at least one available piece on it. Hosts that store pieces of a large
+// fraction of the renter's files are a single point of failure.
+func (r *Renter) HostConcentration() map[modules.NetAddress]int {
+	lockID := r.mu.RLock()
+	defer r.mu.RUnlock(lockID)
+
+	concentration := make(map[modules.NetAddress]int)
+	for _, f := range r.files {
+		hosts := make(map[modules.NetAddress]struct{})
+		f.mu.RLock()
+		for _, fc := range f.contracts {
+			if len(fc.Pieces) > 0 && !r.contractOffline(fc.ID) {
+				hosts[fc.IP] = struct{}{}
+			}
+		}
+		f.mu.RUnlock()
+		for host := range hosts {
+			concentration[host]++
+		}
+	}
+	return concentration
+}
+
+// A RebalanceAction proposes moving the piece with index PieceIndex of the file
+// with the given nickname away from the host at HostIP.
+type RebalanceAction struct {
+	Nickname   string
+	PieceIndex int
+	HostIP     modules.NetAddress
+}
+
+// RebalancePlan proposes moves of pieces away from the hosts that store
+// available pieces of more than maxFilesPerHost files, as counted by
+// HostConcentration. Only files in the default namespace that remain available
+// without their pieces on the host are moved, so the plan may leave a host
+// above the limit if too few of its files have redundancy to spare. Hosts and
+// files are considered in sorted order. The renter is not modified.
+func (r *Renter) RebalancePlan(maxFilesPerHost int) []RebalanceAction {
+	lockID := r.mu.RLock()
+	defer r.mu.RUnlock(lockID)
+
+	filesOnHost := make(map[modules.NetAddress][]string)
+	for key, f := range r.files {
+		hosts := make(map[modules.NetAddress]struct{})
+		f.mu.RLock()
+		for _, fc := range f.contracts {
+			if len(fc.Pieces) > 0 && !r.contractOffline(fc.ID) {
+				hosts[fc.IP] = struct{}{}
+			}
+		}
+		f.mu.RUnlock()
+		for host := range hosts {
+			filesOnHost[host] = append(filesOnHost[host], key)
+		}
+	}
+	hosts := make([]modules.NetAddress, 0, len(filesOnHost))
+	for host := range filesOnHost {
+		hosts = append(hosts, host)
+	}
+	sort.Slice(hosts, func(i, j int) bool {
+		return hosts[i] < hosts[j]
+	})
+
+	// movedFrom holds, for every file, the hosts that the plan already moves
+	// its pieces away from.
+	movedFrom := make(map[string]map[modules.NetAddress]struct{})
+	var plan []RebalanceAction
+	for _, host := range hosts {
+		keys := filesOnHost[host]
+		excess := len(keys) - maxFilesPerHost
+		sort.Strings(keys)
+		for _, key := range keys {
+			if excess <= 0 {
+				break
+			}
+			f := r.files[key]
+			if f.namespace != "" {
+				continue
+			}
+			f.mu.RLock()
+			spare := f.available(func(id types.FileContractID) bool {
+				ip := f.contracts[id].IP
+				_, moved := movedFrom[key][ip]
+				return ip == host || moved || r.contractOffline(id)
+			})
+			var pieces []int
+			if spare {
+				indices := make(map[uint64]struct{})
+				for _, fc := range f.contracts {
+					if fc.IP != host || r.contractOffline(fc.ID) {
+						continue
+					}
+					for _, p := range fc.Pieces {
+						indices[p.Piece] = struct{}{}
+					}
+				}
+				for index := range indices {
+					pieces = append(pieces, int(index))
+				}
+			}
+			f.mu.RUnlock()
+			if !spare {
+				continue
+			}
+
+			sort.Ints(pieces)
+			for _, index := range pieces {
+				plan = append(plan, RebalanceAction{Nickname: f.name, PieceIndex: index, HostIP: host})
+			}
+			if movedFrom[key] == nil {
+				movedFrom[key] = make(map[modules.NetAddress]struct{})
+			}
+			movedFrom[key][host] = struct{}{}
+			excess--
+		}
+	}
+	return plan
+}
+
+// RecommendHosts returns the public keys of up to count active hosts, in order
+// of preference, that do not store any available pieces of the file with the
+// given nickname. Uploading to these hosts spreads the file over as many hosts
+// as possible.
+func (r *Renter) RecommendHosts(nickname string, count int) ([]types.SiaPublicKey, error) {
+	lockID := r.mu.RLock()
+	f, exists := r.files[nickname]
+	r.mu.RUnlock(lockID)
+	if !exists {
+		return nil, ErrUnknownPath
+	}
+
+	used := make(map[modules.NetAddress]struct{})
+	f.mu.RLock()
+	for _, fc := range f.contracts {
+		if len(fc.Pieces) > 0 && !r.contractOffline(fc.ID) {
+			used[fc.IP] = struct{}{}
+		}
+	}
+	f.mu.RUnlock()
+
+	// ActiveHosts is sorted by increasing weight, so the preferred hosts are
+	// at the end.
+	var keys []types.SiaPublicKey
+	hosts := r.hostDB.ActiveHosts()
+	for i := len(hosts) - 1; i >= 0 && len(keys) < count; i-- {
+		if _, exists := used[hosts[i].NetAddress]; !exists {
+			keys = append(keys, hosts[i].PublicKey)
+		}
+	}
+	return keys, nil
+}
+
+// noteUnusedHosts calls the renter's hostUnusedHook for every host that stored
+// pieces of the deleted files, but does not store pieces of any remaining file.
+// Hosts are identified by the keys of their contracts. The renter's lock must
+// be held.
+func (r *Renter) noteUnusedHosts(deleted []*file) {
+	if r.hostUnusedHook == nil {
+		return
+	}
+	candidates := make(map[modules.NetAddress]types.FileContractID)
+	for _, f := range deleted {
+		f.mu.RLock()
+		for _, fc := range f.contracts {
+			candidates[fc.IP] = fc.ID
+		}
+		f.mu.RUnlock()
+	}
+	for _, f := range r.files {
+		f.mu.RLock()
+		for _, fc := range f.contracts {
+			delete(candidates, fc.IP)
+		}
+		f.mu.RUnlock()
+	}
+	for _, id := range candidates {
+		contract, exists := r.hostContractor.ContractByID(r.hostContractor.ResolveID(id))
+		if exists {
+			r.hostUnusedHook(contract.HostPublicKey)
+		}
+	}
+}
+
+// A HostDBLike lists the hosts known to a hostdb. It is satisfied by the
+// renter's hostdb.
+type HostDBLike interface {
+	AllHosts() []modules.HostDBEntry
+}
+
+// ValidateHostsAgainst returns the nicknames of the files in the default
+// namespace, in sorted order, that store available pieces on hosts that are
+// not known to hdb. These files depend on hosts that may have left the
+// network.
+func (r *Renter) ValidateHostsAgainst(hdb HostDBLike) []string {
+	known := make(map[modules.NetAddress]struct{})
+	for _, host := range hdb.AllHosts() {
+		known[host.NetAddress] = struct{}{}
+	}
+
+	lockID := r.mu.RLock()
+	defer r.mu.RUnlock(lockID)
+	var nicknames []string
+	for name, f := range r.files {
+		if f.namespace != "" {
+			continue
+		}
+		f.mu.RLock()
+		for _, fc := range f.contracts {
+			if _, exists := known[fc.IP]; !exists && len(fc.Pieces) > 0 && !r.contractOffline(fc.ID) {
+				nicknames = append(nicknames, name)
+				break
+			}
+		}
+		f.mu.RUnlock()
+	}
+	sort.Strings(nicknames)
+	return nicknames
+}
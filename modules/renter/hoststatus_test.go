@@ -0,0 +1,500 @@
+package renter
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/modules/renter/contractor"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// onlineContractor is a hostContractor that reports a fixed set of contracts,
+// all of which are online. Editors cannot be created, and methods that are not
+// overridden panic.
+type onlineContractor struct {
+	hostContractor
+	contracts map[types.FileContractID]modules.RenterContract
+}
+
+func (onlineContractor) Close() error                                           { return nil }
+func (onlineContractor) Contracts() []modules.RenterContract                    { return nil }
+func (onlineContractor) GoodForRenew(types.FileContractID) bool                 { return true }
+func (onlineContractor) IsOffline(types.FileContractID) bool                    { return false }
+func (onlineContractor) ResolveID(id types.FileContractID) types.FileContractID { return id }
+func (onlineContractor) Editor(types.FileContractID, <-chan struct{}) (contractor.Editor, error) {
+	return nil, errors.New("no editor")
+}
+func (oc onlineContractor) ContractByID(id types.FileContractID) (modules.RenterContract, bool) {
+	c, ok := oc.contracts[id]
+	return c, ok
+}
+
+// closeHostDB is a hostDB that can only be closed, that knows no hosts, and
+// that ignores interactions.
+type closeHostDB struct {
+	hostDB
+}
+
+func (closeHostDB) Close() error                                       { return nil }
+func (closeHostDB) IncrementSuccessfulInteractions(types.SiaPublicKey) {}
+func (closeHostDB) IncrementFailedInteractions(types.SiaPublicKey)     {}
+func (closeHostDB) Host(types.SiaPublicKey) (modules.HostDBEntry, bool) {
+	return modules.HostDBEntry{}, false
+}
+
+// TestRenterMarkHostOffline checks that marking a host offline makes the
+// pieces it stores unavailable, and that marking it online again reverses
+// this.
+func TestRenterMarkHostOffline(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	hc := onlineContractor{
+		contracts: map[types.FileContractID]modules.RenterContract{
+			{1}: {ID: types.FileContractID{1}, NetAddress: "foo:1", GoodForRenew: true},
+			{2}: {ID: types.FileContractID{2}, NetAddress: "bar:1", GoodForRenew: true},
+		},
+	}
+	rt, err := newContractorTester(t.Name(), closeHostDB{}, hc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Add a file that needs one of its two pieces, one on each host.
+	rsc, _ := NewRSCode(1, 1)
+	f := &file{
+		name:        "one",
+		size:        1,
+		pieceSize:   1,
+		erasureCode: rsc,
+		masterKey:   crypto.GenerateTwofishKey(),
+		contracts: map[types.FileContractID]fileContract{
+			{1}: {ID: types.FileContractID{1}, IP: "foo:1", Pieces: []pieceData{{Chunk: 0, Piece: 0}}},
+			{2}: {ID: types.FileContractID{2}, IP: "bar:1", Pieces: []pieceData{{Chunk: 0, Piece: 1}}},
+		},
+	}
+	id := rt.renter.mu.Lock()
+	rt.renter.files[f.name] = f
+	rt.renter.mu.Unlock(id)
+	files := rt.renter.FileList()
+	if !files[0].Available || files[0].Redundancy != 2 {
+		t.Fatal("file should be available with redundancy 2:", files[0])
+	}
+
+	// Mark one host offline.
+	if n := rt.renter.MarkHostOffline("foo:1"); n != 1 {
+		t.Fatal("expected 1 piece to be affected, got", n)
+	}
+	if n := rt.renter.MarkHostOffline("foo:1"); n != 0 {
+		t.Fatal("marking a host offline twice should not affect any pieces, got", n)
+	}
+	files = rt.renter.FileList()
+	if !files[0].Available || files[0].Redundancy != 1 {
+		t.Fatal("file should be available with redundancy 1:", files[0])
+	}
+
+	// Mark the other host offline.
+	rt.renter.MarkHostOffline("bar:1")
+	if files = rt.renter.FileList(); files[0].Available || files[0].Redundancy != 0 {
+		t.Fatal("file should be unavailable:", files[0])
+	}
+
+	// The offline hosts should be persisted.
+	rt.renter.Close()
+	rt.renter, err = newRenter(rt.cs, rt.tpool, closeHostDB{}, hc, rt.renter.rateLimit, rt.renter.persistDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id = rt.renter.mu.Lock()
+	rt.renter.files[f.name] = f
+	rt.renter.mu.Unlock(id)
+	if files = rt.renter.FileList(); files[0].Available {
+		t.Fatal("offline hosts were not persisted:", files[0])
+	}
+
+	// Mark a host online again.
+	if n := rt.renter.MarkHostOnline("bar:1"); n != 1 {
+		t.Fatal("expected 1 piece to be affected, got", n)
+	}
+	if files = rt.renter.FileList(); !files[0].Available || files[0].Redundancy != 1 {
+		t.Fatal("file should be available with redundancy 1:", files[0])
+	}
+}
+
+// TestRenterRepairEstimate probes the RepairEstimate method of the renter
+// type using files at various redundancy levels.
+func TestRenterRepairEstimate(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	hc := onlineContractor{
+		contracts: map[types.FileContractID]modules.RenterContract{
+			{1}: {ID: types.FileContractID{1}, NetAddress: "foo:1", GoodForRenew: true},
+			{2}: {ID: types.FileContractID{2}, NetAddress: "bar:1", GoodForRenew: true},
+		},
+	}
+	rt, err := newContractorTester(t.Name(), closeHostDB{}, hc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	if pieces, files := rt.renter.RepairEstimate(); pieces != 0 || files != 0 {
+		t.Fatal("expected no repairs for an empty renter, got", pieces, files)
+	}
+
+	// Add files with 0, 1, and 2 of their 2 pieces uploaded.
+	rsc, _ := NewRSCode(1, 1)
+	newTestFile := func(name string, contracts ...types.FileContractID) *file {
+		f := &file{
+			name:        name,
+			size:        1,
+			pieceSize:   1,
+			erasureCode: rsc,
+			contracts:   make(map[types.FileContractID]fileContract),
+		}
+		for i, id := range contracts {
+			f.contracts[id] = fileContract{ID: id, Pieces: []pieceData{{Chunk: 0, Piece: uint64(i)}}}
+		}
+		id := rt.renter.mu.Lock()
+		rt.renter.files[name] = f
+		rt.renter.tracking[name] = trackedFile{}
+		rt.renter.mu.Unlock(id)
+		return f
+	}
+	newTestFile("none")
+	newTestFile("one", types.FileContractID{1})
+	newTestFile("full", types.FileContractID{1}, types.FileContractID{2})
+	// a piece in an unknown contract needs to be repaired
+	newTestFile("unknown", types.FileContractID{1}, types.FileContractID{3})
+
+	if pieces, files := rt.renter.RepairEstimate(); pieces != 4 || files != 3 {
+		t.Fatal("expected 4 pieces in 3 files, got", pieces, files)
+	}
+
+	// Untracked files are not repaired.
+	id := rt.renter.mu.Lock()
+	delete(rt.renter.tracking, "none")
+	rt.renter.mu.Unlock(id)
+	if pieces, files := rt.renter.RepairEstimate(); pieces != 2 || files != 2 {
+		t.Fatal("expected 2 pieces in 2 files, got", pieces, files)
+	}
+}
+
+// TestRenterHostConcentration checks that HostConcentration counts the
+// distinct files with available pieces on each host, rather than pieces.
+func TestRenterHostConcentration(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	hc := onlineContractor{
+		contracts: map[types.FileContractID]modules.RenterContract{
+			{1}: {ID: types.FileContractID{1}, NetAddress: "foo:1", GoodForRenew: true},
+			{2}: {ID: types.FileContractID{2}, NetAddress: "foo:1", GoodForRenew: true},
+			{3}: {ID: types.FileContractID{3}, NetAddress: "bar:1", GoodForRenew: true},
+			{4}: {ID: types.FileContractID{4}, NetAddress: "baz:1", GoodForRenew: false},
+		},
+	}
+	rt, err := newContractorTester(t.Name(), closeHostDB{}, hc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	if c := rt.renter.HostConcentration(); len(c) != 0 {
+		t.Fatal("expected no hosts for an empty renter, got", c)
+	}
+
+	rsc, _ := NewRSCode(1, 1)
+	newTestFile := func(name string, contracts map[types.FileContractID]fileContract) {
+		id := rt.renter.mu.Lock()
+		rt.renter.files[name] = &file{
+			name:        name,
+			size:        1,
+			pieceSize:   1,
+			erasureCode: rsc,
+			contracts:   contracts,
+		}
+		rt.renter.mu.Unlock(id)
+	}
+	// Two pieces in each of two contracts with the same host.
+	newTestFile("one", map[types.FileContractID]fileContract{
+		{1}: {ID: types.FileContractID{1}, IP: "foo:1", Pieces: []pieceData{{Chunk: 0, Piece: 0}, {Chunk: 1, Piece: 0}}},
+		{2}: {ID: types.FileContractID{2}, IP: "foo:1", Pieces: []pieceData{{Chunk: 0, Piece: 1}, {Chunk: 1, Piece: 1}}},
+	})
+	// Pieces on two hosts, one of them unavailable.
+	newTestFile("two", map[types.FileContractID]fileContract{
+		{1}: {ID: types.FileContractID{1}, IP: "foo:1", Pieces: []pieceData{{Chunk: 0, Piece: 0}}},
+		{3}: {ID: types.FileContractID{3}, IP: "bar:1", Pieces: []pieceData{{Chunk: 0, Piece: 1}}},
+		{4}: {ID: types.FileContractID{4}, IP: "baz:1", Pieces: []pieceData{{Chunk: 0, Piece: 1}}},
+	})
+	// A contract without pieces.
+	newTestFile("three", map[types.FileContractID]fileContract{
+		{3}: {ID: types.FileContractID{3}, IP: "bar:1"},
+	})
+
+	c := rt.renter.HostConcentration()
+	if len(c) != 2 || c["foo:1"] != 2 || c["bar:1"] != 1 {
+		t.Fatal("wrong host concentration:", c)
+	}
+}
+
+// activeHostDB is a hostDB with a fixed set of active hosts.
+type activeHostDB struct {
+	closeHostDB
+	hosts []modules.HostDBEntry
+}
+
+func (hdb activeHostDB) ActiveHosts() []modules.HostDBEntry { return hdb.hosts }
+
+// TestRenterRecommendHosts checks that RecommendHosts excludes the hosts that
+// already store available pieces of a file.
+func TestRenterRecommendHosts(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	hc := onlineContractor{
+		contracts: map[types.FileContractID]modules.RenterContract{
+			{1}: {ID: types.FileContractID{1}, NetAddress: "foo:1", GoodForRenew: true},
+		},
+	}
+	// The hosts are listed by increasing weight, like the hostdb's.
+	var hdb activeHostDB
+	for i, addr := range []modules.NetAddress{"foo:1", "bar:1", "baz:1", "qux:1"} {
+		hdb.hosts = append(hdb.hosts, modules.HostDBEntry{
+			HostExternalSettings: modules.HostExternalSettings{NetAddress: addr},
+			PublicKey:            types.SiaPublicKey{Key: []byte{byte(i)}},
+		})
+	}
+	rt, err := newContractorTester(t.Name(), hdb, hc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	if _, err := rt.renter.RecommendHosts("one", 1); err != ErrUnknownPath {
+		t.Fatal("expected ErrUnknownPath, got", err)
+	}
+
+	// A file with an available piece on foo, and a piece on bar in an unknown
+	// contract.
+	rsc, _ := NewRSCode(1, 1)
+	id := rt.renter.mu.Lock()
+	rt.renter.files["one"] = &file{
+		name:        "one",
+		size:        1,
+		pieceSize:   1,
+		erasureCode: rsc,
+		contracts: map[types.FileContractID]fileContract{
+			{1}: {ID: types.FileContractID{1}, IP: "foo:1", Pieces: []pieceData{{Chunk: 0, Piece: 0}}},
+			{2}: {ID: types.FileContractID{2}, IP: "bar:1", Pieces: []pieceData{{Chunk: 0, Piece: 1}}},
+		},
+	}
+	rt.renter.mu.Unlock(id)
+
+	keys, err := rt.renter.RecommendHosts("one", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys[0].Key[0] != 3 || keys[1].Key[0] != 2 {
+		t.Fatal("wrong recommendations:", keys)
+	}
+	if keys, _ = rt.renter.RecommendHosts("one", 10); len(keys) != 3 {
+		t.Fatal("expected 3 recommendations, got", keys)
+	}
+}
+
+// TestRenterHostUnusedHook checks that the unused-host hook is called for the
+// hosts that no longer store pieces of any file after files are deleted.
+func TestRenterHostUnusedHook(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	hc := onlineContractor{
+		contracts: map[types.FileContractID]modules.RenterContract{
+			{1}: {ID: types.FileContractID{1}, NetAddress: "foo:1", HostPublicKey: types.SiaPublicKey{Key: []byte("foo")}},
+			{2}: {ID: types.FileContractID{2}, NetAddress: "bar:1", HostPublicKey: types.SiaPublicKey{Key: []byte("bar")}},
+		},
+	}
+	rt, err := newContractorTester(t.Name(), closeHostDB{}, hc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Deleting without a hook should work.
+	rsc, _ := NewRSCode(1, 1)
+	newTestFile := func(name string, contracts ...types.FileContractID) {
+		f := newFile(name, rsc, 1, 1)
+		for _, id := range contracts {
+			f.contracts[id] = fileContract{ID: id, IP: hc.contracts[id].NetAddress, Pieces: []pieceData{{}}}
+		}
+		id := rt.renter.mu.Lock()
+		rt.renter.files[name] = f
+		rt.renter.mu.Unlock(id)
+	}
+	newTestFile("one", types.FileContractID{1})
+	if err := rt.renter.DeleteFile("one"); err != nil {
+		t.Fatal(err)
+	}
+
+	var unused []string
+	rt.renter.SetHostUnusedHook(func(key types.SiaPublicKey) {
+		unused = append(unused, string(key.Key))
+	})
+
+	// Only bar is unused after deleting the first file.
+	newTestFile("one", types.FileContractID{1}, types.FileContractID{2})
+	newTestFile("two", types.FileContractID{1})
+	if err := rt.renter.DeleteFile("one"); err != nil {
+		t.Fatal(err)
+	}
+	if len(unused) != 1 || unused[0] != "bar" {
+		t.Fatal("expected bar to be unused, got", unused)
+	}
+
+	// foo is unused once every file is deleted.
+	unused = nil
+	if deleted := rt.renter.DeleteWhere(func(modules.FileInfo) bool { return true }); len(deleted) != 1 {
+		t.Fatal("expected one file to be deleted, got", deleted)
+	}
+	if len(unused) != 1 || unused[0] != "foo" {
+		t.Fatal("expected foo to be unused, got", unused)
+	}
+}
+
+// fakeHostDB is a HostDBLike with a fixed set of hosts.
+type fakeHostDB []modules.HostDBEntry
+
+func (hdb fakeHostDB) AllHosts() []modules.HostDBEntry { return hdb }
+
+// TestRenterValidateHostsAgainst checks that ValidateHostsAgainst reports the
+// files with available pieces on hosts that the hostdb does not know.
+func TestRenterValidateHostsAgainst(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	hc := onlineContractor{
+		contracts: map[types.FileContractID]modules.RenterContract{
+			{1}: {ID: types.FileContractID{1}, NetAddress: "foo:1", GoodForRenew: true},
+			{2}: {ID: types.FileContractID{2}, NetAddress: "bar:1", GoodForRenew: true},
+			{3}: {ID: types.FileContractID{3}, NetAddress: "baz:1", GoodForRenew: true},
+		},
+	}
+	rt, err := newContractorTester(t.Name(), closeHostDB{}, hc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	rsc, _ := NewRSCode(1, 1)
+	newTestFile := func(name string, contracts ...types.FileContractID) {
+		f := newFile(name, rsc, 1, 1)
+		for _, id := range contracts {
+			f.contracts[id] = fileContract{ID: id, IP: hc.contracts[id].NetAddress, Pieces: []pieceData{{}}}
+		}
+		id := rt.renter.mu.Lock()
+		rt.renter.files[name] = f
+		rt.renter.mu.Unlock(id)
+	}
+	newTestFile("known", types.FileContractID{1})
+	newTestFile("unknown", types.FileContractID{1}, types.FileContractID{2})
+	newTestFile("also-unknown", types.FileContractID{3})
+	// a piece on an unknown host in a contract that is not available
+	newTestFile("offline", types.FileContractID{1})
+	id := rt.renter.mu.Lock()
+	rt.renter.files["offline"].contracts[types.FileContractID{4}] = fileContract{ID: types.FileContractID{4}, IP: "qux:1", Pieces: []pieceData{{}}}
+	rt.renter.mu.Unlock(id)
+
+	hdb := fakeHostDB{
+		{HostExternalSettings: modules.HostExternalSettings{NetAddress: "foo:1"}},
+	}
+	names := rt.renter.ValidateHostsAgainst(hdb)
+	if len(names) != 2 || names[0] != "also-unknown" || names[1] != "unknown" {
+		t.Fatal("wrong files reported:", names)
+	}
+
+	hdb = append(hdb, modules.HostDBEntry{HostExternalSettings: modules.HostExternalSettings{NetAddress: "bar:1"}})
+	hdb = append(hdb, modules.HostDBEntry{HostExternalSettings: modules.HostExternalSettings{NetAddress: "baz:1"}})
+	if names := rt.renter.ValidateHostsAgainst(hdb); len(names) != 0 {
+		t.Fatal("expected no files to be reported, got", names)
+	}
+}
+
+// TestRenterRebalancePlan checks that RebalancePlan moves files with spare
+// redundancy away from an over-concentrated host.
+func TestRenterRebalancePlan(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	hc := onlineContractor{
+		contracts: map[types.FileContractID]modules.RenterContract{
+			{1}: {ID: types.FileContractID{1}, NetAddress: "foo:1", GoodForRenew: true},
+			{2}: {ID: types.FileContractID{2}, NetAddress: "bar:1", GoodForRenew: true},
+		},
+	}
+	rt, err := newContractorTester(t.Name(), closeHostDB{}, hc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	rsc, _ := NewRSCode(1, 2)
+	newTestFile := func(name string, contracts map[types.FileContractID]fileContract) {
+		id := rt.renter.mu.Lock()
+		rt.renter.files[name] = &file{
+			name:        name,
+			size:        1,
+			pieceSize:   1,
+			erasureCode: rsc,
+			contracts:   contracts,
+		}
+		rt.renter.mu.Unlock(id)
+	}
+	// Two files that are also available from bar.
+	newTestFile("one", map[types.FileContractID]fileContract{
+		{1}: {ID: types.FileContractID{1}, IP: "foo:1", Pieces: []pieceData{{Chunk: 0, Piece: 0}, {Chunk: 0, Piece: 2}}},
+		{2}: {ID: types.FileContractID{2}, IP: "bar:1", Pieces: []pieceData{{Chunk: 0, Piece: 1}}},
+	})
+	newTestFile("two", map[types.FileContractID]fileContract{
+		{1}: {ID: types.FileContractID{1}, IP: "foo:1", Pieces: []pieceData{{Chunk: 0, Piece: 1}}},
+		{2}: {ID: types.FileContractID{2}, IP: "bar:1", Pieces: []pieceData{{Chunk: 0, Piece: 0}}},
+	})
+	// A file that is only stored on foo.
+	newTestFile("three", map[types.FileContractID]fileContract{
+		{1}: {ID: types.FileContractID{1}, IP: "foo:1", Pieces: []pieceData{{Chunk: 0, Piece: 0}, {Chunk: 0, Piece: 1}}},
+	})
+
+	if plan := rt.renter.RebalancePlan(3); len(plan) != 0 {
+		t.Fatal("expected an empty plan, got", plan)
+	}
+
+	// foo stores three files, one of which can be moved away.
+	plan := rt.renter.RebalancePlan(2)
+	exp := []RebalanceAction{
+		{"one", 0, "foo:1"},
+		{"one", 2, "foo:1"},
+	}
+	if !reflect.DeepEqual(plan, exp) {
+		t.Fatalf("expected %v, got %v", exp, plan)
+	}
+
+	// A limit of 1 cannot be reached: three cannot leave foo, and one and two
+	// cannot both leave foo and bar. After moving one off bar, only two can
+	// leave foo.
+	plan = rt.renter.RebalancePlan(1)
+	exp = []RebalanceAction{
+		{"one", 1, "bar:1"},
+		{"two", 1, "foo:1"},
+	}
+	if !reflect.DeepEqual(plan, exp) {
+		t.Fatalf("expected %v, got %v", exp, plan)
+	}
+	if len(rt.renter.files["one"].contracts) != 2 {
+		t.Fatal("RebalancePlan modified the renter")
+	}
+}
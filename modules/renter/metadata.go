@@ -0,0 +1,82 @@
+package renter
+
+import (
+	"errors"
+)
+
+// maxMetadataSize is the maximum total size in bytes of the keys and values
+// of a file's metadata. Metadata is saved in the renter's metadata file, which
+// is rewritten on every change, so it is kept small.
+const maxMetadataSize = 4096
+
+var (
+	errEmptyMetadataKey = errors.New("metadata keys must be nonempty strings")
+	errMetadataTooLarge = errors.New("file metadata cannot exceed 4096 bytes")
+)
+
+// metadataSize returns the total size of the keys and values of metadata.
+func metadataSize(metadata map[string]string) int {
+	var size int
+	for key, value := range metadata {
+		size += len(key) + len(value)
+	}
+	return size
+}
+
+// mergeMetadata returns the metadata of a file after update has been applied
+// to it. Keys with empty values in update are removed.
+func mergeMetadata(metadata, update map[string]string) (map[string]string, error) {
+	merged := make(map[string]string, len(metadata)+len(update))
+	for key, value := range metadata {
+		merged[key] = value
+	}
+	for key, value := range update {
+		if key == "" {
+			return nil, errEmptyMetadataKey
+		} else if value == "" {
+			delete(merged, key)
+		} else {
+			merged[key] = value
+		}
+	}
+	if metadataSize(merged) > maxMetadataSize {
+		return nil, errMetadataTooLarge
+	}
+	if len(merged) == 0 {
+		return nil, nil
+	}
+	return merged, nil
+}
+
+// SetMetadata updates the metadata of the file with the given nickname with
+// the keys and values of metadata, such as the file's MIME type or original
+// modification time. Keys with empty values are removed. The metadata is
+// returned in the file's FileInfo, but is not used by the renter. Sealed files
+// cannot be modified.
+func (r *Renter) SetMetadata(nickname string, metadata map[string]string) error {
+	if err := r.addThread(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	lockID := r.mu.Lock()
+	defer r.mu.Unlock(lockID)
+
+	f, exists := r.files[nickname]
+	if !exists {
+		return ErrUnknownPath
+	}
+	f.mu.Lock()
+	if f.sealed {
+		f.mu.Unlock()
+		return ErrFileSealed
+	}
+	merged, err := mergeMetadata(f.metadata, metadata)
+	if err == nil {
+		f.metadata = merged
+	}
+	f.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return r.save()
+}
@@ -0,0 +1,68 @@
+package renter
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestRenterSetMetadata checks that the metadata of files can be updated,
+// that invalid metadata is rejected, and that metadata is persisted.
+func TestRenterSetMetadata(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	f := newTestingFile()
+	f.name = "foo"
+	id := rt.renter.mu.Lock()
+	rt.renter.files[f.name] = f
+	rt.renter.mu.Unlock(id)
+	if err := rt.renter.SetMetadata("bar", map[string]string{"a": "b"}); err != ErrUnknownPath {
+		t.Fatal("expected ErrUnknownPath, got", err)
+	}
+
+	// Keys are added and updated, and keys with empty values are removed.
+	if err := rt.renter.SetMetadata("foo", map[string]string{"mimetype": "text/plain", "mtime": "1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.renter.SetMetadata("foo", map[string]string{"mtime": "", "source": "/tmp/foo"}); err != nil {
+		t.Fatal(err)
+	}
+	metadata := rt.renter.FileList()[0].Metadata
+	if len(metadata) != 2 || metadata["mimetype"] != "text/plain" || metadata["source"] != "/tmp/foo" {
+		t.Fatal("wrong metadata:", metadata)
+	}
+
+	// Invalid updates leave the metadata unchanged.
+	if err := rt.renter.SetMetadata("foo", map[string]string{"": "a"}); err != errEmptyMetadataKey {
+		t.Fatal("expected errEmptyMetadataKey, got", err)
+	}
+	if err := rt.renter.SetMetadata("foo", map[string]string{"big": strings.Repeat("a", maxMetadataSize)}); err != errMetadataTooLarge {
+		t.Fatal("expected errMetadataTooLarge, got", err)
+	}
+	if len(rt.renter.FileList()[0].Metadata) != 2 {
+		t.Fatal("metadata was changed by an invalid update")
+	}
+
+	// The metadata is persisted.
+	id = rt.renter.mu.Lock()
+	f.metadata = nil
+	err = rt.renter.load()
+	rt.renter.mu.Unlock(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata := rt.renter.FileList()[0].Metadata; metadata["source"] != "/tmp/foo" {
+		t.Fatal("metadata was not persisted:", metadata)
+	}
+
+	f.sealed = true
+	if err := rt.renter.SetMetadata("foo", map[string]string{"a": "b"}); err != ErrFileSealed {
+		t.Fatal("expected ErrFileSealed, got", err)
+	}
+}
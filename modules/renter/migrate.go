@@ -0,0 +1,109 @@
+package renter
+
+import (
+	"sort"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// hostFailing reports whether most of the renter's interactions with a host
+// have failed. Hosts with too few interactions to judge are not failing.
+func hostFailing(host modules.HostDBEntry) bool {
+	failed := host.HistoricFailedInteractions + host.RecentFailedInteractions
+	total := failed + host.HistoricSuccessfulInteractions + host.RecentSuccessfulInteractions
+	return total >= migrationMinInteractions && float64(failed) > migrationFailureRatio*float64(total)
+}
+
+// managedCheckFailingHosts updates the set of failing hosts from the hostdb's
+// interaction counters. The pieces stored on a newly failing host are
+// considered missing by the repair loop, so the files that store them are
+// queued for repair, and the pieces are uploaded to other hosts before the
+// files become unavailable. The pieces remain available for download until
+// the host goes offline.
+func (r *Renter) managedCheckFailingHosts() {
+	failing := make(map[modules.NetAddress]struct{})
+	for _, c := range r.hostContractor.Contracts() {
+		if host, ok := r.hostDB.Host(c.HostPublicKey); ok && hostFailing(host) {
+			failing[c.NetAddress] = struct{}{}
+		}
+	}
+	for _, addr := range r.failingHosts.list() {
+		if _, ok := failing[addr]; !ok {
+			r.failingHosts.set(addr, false)
+		}
+	}
+	var newlyFailing []modules.NetAddress
+	for addr := range failing {
+		if r.failingHosts.set(addr, true) {
+			newlyFailing = append(newlyFailing, addr)
+		}
+	}
+	if len(newlyFailing) == 0 {
+		return
+	}
+	sort.Slice(newlyFailing, func(i, j int) bool {
+		return newlyFailing[i] < newlyFailing[j]
+	})
+
+	// Record a migration for each newly failing host, and find the files
+	// that store pieces on them.
+	affected := make(map[*file]struct{})
+	lockID := r.mu.Lock()
+	for _, addr := range newlyFailing {
+		var pieces int
+		for _, f := range r.files {
+			f.mu.RLock()
+			for _, fc := range f.contracts {
+				if fc.IP == addr && len(fc.Pieces) > 0 {
+					pieces += len(fc.Pieces)
+					affected[f] = struct{}{}
+				}
+			}
+			f.mu.RUnlock()
+		}
+		r.log.Println("Migrating", pieces, "pieces away from failing host", addr)
+		r.migrations = append(r.migrations, modules.HostMigration{
+			NetAddress: addr,
+			Pieces:     pieces,
+			Time:       time.Now(),
+		})
+	}
+	if len(r.migrations) > maxMigrations {
+		r.migrations = r.migrations[len(r.migrations)-maxMigrations:]
+	}
+	r.mu.Unlock(lockID)
+
+	for f := range affected {
+		select {
+		case r.newRepairs <- f:
+		case <-r.tg.StopChan():
+			return
+		}
+	}
+}
+
+// Migrations returns the most recent migrations of pieces away from failing
+// hosts, oldest first.
+func (r *Renter) Migrations() []modules.HostMigration {
+	lockID := r.mu.RLock()
+	defer r.mu.RUnlock(lockID)
+	return append([]modules.HostMigration(nil), r.migrations...)
+}
+
+// threadedMigrateFailingHosts periodically checks for failing hosts, and
+// migrates the pieces stored on them to other hosts.
+func (r *Renter) threadedMigrateFailingHosts() {
+	for {
+		select {
+		case <-time.After(migrationInterval):
+		case <-r.tg.StopChan():
+			return
+		}
+		if r.tg.Add() != nil {
+			return
+		}
+		r.managedCheckFailingHosts()
+		r.tg.Done()
+	}
+}
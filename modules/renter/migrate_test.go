@@ -0,0 +1,118 @@
+package renter
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// interactionHostDB is a hostDB that reports the interaction counters of a
+// fixed set of hosts, keyed by public key.
+type interactionHostDB struct {
+	closeHostDB
+	hosts map[string]modules.HostDBEntry
+}
+
+func (hdb interactionHostDB) Host(pk types.SiaPublicKey) (modules.HostDBEntry, bool) {
+	host, ok := hdb.hosts[string(pk.Key)]
+	return host, ok
+}
+
+// TestHostFailing checks that hosts are failing once enough of their
+// interactions have failed.
+func TestHostFailing(t *testing.T) {
+	tests := []struct {
+		failed, succeeded uint64
+		failing           bool
+	}{
+		{0, 0, false},
+		{migrationMinInteractions - 1, 0, false},
+		{migrationMinInteractions, 0, true},
+		{migrationMinInteractions, migrationMinInteractions, false},
+		{migrationMinInteractions + 1, migrationMinInteractions, true},
+	}
+	for _, test := range tests {
+		host := modules.HostDBEntry{
+			HistoricFailedInteractions:     test.failed / 2,
+			RecentFailedInteractions:       test.failed - test.failed/2,
+			HistoricSuccessfulInteractions: test.succeeded / 2,
+			RecentSuccessfulInteractions:   test.succeeded - test.succeeded/2,
+		}
+		if hostFailing(host) != test.failing {
+			t.Errorf("host with %v failed and %v successful interactions: expected failing to be %v", test.failed, test.succeeded, test.failing)
+		}
+	}
+}
+
+// TestRenterMigrateFailingHosts checks that the pieces stored on failing hosts
+// are considered missing by the repair loop, and that each migration is
+// recorded once.
+func TestRenterMigrateFailingHosts(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	hdb := interactionHostDB{hosts: map[string]modules.HostDBEntry{
+		"foo": {HistoricFailedInteractions: migrationMinInteractions},
+		"bar": {HistoricSuccessfulInteractions: migrationMinInteractions},
+	}}
+	hc := listContractor{onlineContractor{
+		contracts: map[types.FileContractID]modules.RenterContract{
+			{1}: {ID: types.FileContractID{1}, NetAddress: "foo:1", HostPublicKey: types.SiaPublicKey{Key: []byte("foo")}, GoodForRenew: true},
+			{2}: {ID: types.FileContractID{2}, NetAddress: "bar:1", HostPublicKey: types.SiaPublicKey{Key: []byte("bar")}, GoodForRenew: true},
+		},
+	}}
+	rt, err := newContractorTester(t.Name(), hdb, hc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Add a tracked file with one piece on each host.
+	rsc, _ := NewRSCode(1, 1)
+	f := &file{
+		name:        "one",
+		size:        1,
+		pieceSize:   1,
+		erasureCode: rsc,
+		contracts: map[types.FileContractID]fileContract{
+			{1}: {ID: types.FileContractID{1}, IP: "foo:1", Pieces: []pieceData{{Chunk: 0, Piece: 0}}},
+			{2}: {ID: types.FileContractID{2}, IP: "bar:1", Pieces: []pieceData{{Chunk: 0, Piece: 1}}},
+		},
+	}
+	id := rt.renter.mu.Lock()
+	rt.renter.files[f.name] = f
+	rt.renter.tracking[f.name] = trackedFile{}
+	rt.renter.mu.Unlock(id)
+
+	rt.renter.managedCheckFailingHosts()
+	rt.renter.managedCheckFailingHosts()
+	migrations := rt.renter.Migrations()
+	if len(migrations) != 1 || migrations[0].NetAddress != "foo:1" || migrations[0].Pieces != 1 {
+		t.Fatalf("expected one migration of 1 piece from foo:1, got %v", migrations)
+	}
+
+	// The piece on the failing host needs to be repaired, but remains
+	// available for download.
+	rs := &repairState{
+		activeWorkers:    make(map[types.FileContractID]*worker),
+		availableWorkers: make(map[types.FileContractID]*worker),
+		gapCounts:        make(map[int]int),
+		incompleteChunks: make(map[chunkID]*chunkStatus),
+	}
+	rt.renter.addFileToRepairState(rs, f)
+	cs, exists := rs.incompleteChunks[chunkID{0, f.key()}]
+	if !exists || len(cs.pieces) != 1 {
+		t.Fatal("piece on the failing host is not being repaired")
+	}
+	if files := rt.renter.FileList(); files[0].Redundancy != 2 {
+		t.Fatal("piece on the failing host should remain available:", files[0].Redundancy)
+	}
+
+	// Once the host recovers, it is no longer failing.
+	hdb.hosts["foo"] = modules.HostDBEntry{HistoricSuccessfulInteractions: 2 * migrationMinInteractions}
+	rt.renter.managedCheckFailingHosts()
+	if rt.renter.failingHosts.contains("foo:1") {
+		t.Fatal("recovered host is still failing")
+	}
+}
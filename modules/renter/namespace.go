@@ -0,0 +1,78 @@
+package renter
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+)
+
+// namespaceDir is the directory within the renter's persist directory that
+// holds the .sia files of files outside the default namespace. Each namespace
+// has its own subdirectory.
+const namespaceDir = ".namespaces"
+
+var (
+	errInvalidNamespace = errors.New("namespaces cannot be . or .., or contain slashes or NUL bytes")
+	errNicknameReserved = errors.New("nicknames cannot begin with " + namespaceDir + "/")
+)
+
+// validateNamespace checks that ns can be used as a namespace. The empty
+// string is the default namespace.
+func validateNamespace(ns string) error {
+	if ns == "." || ns == ".." || strings.ContainsAny(ns, "/\x00") {
+		return errInvalidNamespace
+	} else if ns == versionNamespace {
+		return errNamespaceReserved
+	}
+	return nil
+}
+
+// nsKey returns the key of the file with the given nickname in namespace ns,
+// under which it is stored in the renter's files and tracking maps. Files in
+// the default namespace are keyed by their nickname alone. Namespaces cannot
+// contain NUL bytes, and the default nickname validator rejects them in
+// nicknames, so keys of files in different namespaces do not collide.
+func nsKey(ns, nickname string) string {
+	if ns == "" {
+		return nickname
+	}
+	return ns + "\x00" + nickname
+}
+
+// key returns the key of the file in the renter's maps.
+func (f *file) key() string {
+	return nsKey(f.namespace, f.name)
+}
+
+// sharePath returns the path of the .sia file of the file with the given
+// nickname in namespace ns.
+func (r *Renter) sharePath(ns, nickname string) string {
+	if ns == "" {
+		return filepath.Join(r.persistDir, nickname+ShareExtension)
+	}
+	return filepath.Join(r.persistDir, namespaceDir, ns, nickname+ShareExtension)
+}
+
+// pathNamespace returns the namespace of the .sia file at path, which must be
+// within the renter's persist directory.
+func (r *Renter) pathNamespace(path string) string {
+	rel, err := filepath.Rel(r.persistDir, path)
+	if err != nil {
+		return ""
+	}
+	parts := strings.SplitN(filepath.ToSlash(rel), "/", 3)
+	if len(parts) == 3 && parts[0] == namespaceDir {
+		return parts[1]
+	}
+	return ""
+}
+
+// validateNickname checks that nickname is accepted by the renter's nickname
+// validator, and that it does not begin with namespaceDir, which would cause
+// its .sia file to be confused with those of namespaced files.
+func (r *Renter) validateNickname(nickname string) error {
+	if strings.HasPrefix(nickname, namespaceDir+"/") {
+		return errNicknameReserved
+	}
+	return r.nicknameValidator(nickname)
+}
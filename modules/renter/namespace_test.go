@@ -0,0 +1,116 @@
+package renter
+
+import (
+	"testing"
+)
+
+// TestRenterNamespaces checks that files with identical nicknames in
+// different namespaces coexist, and that lookups, renames and deletions are
+// scoped to a namespace.
+func TestRenterNamespaces(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Add a file named "foo" to the default namespace and to namespaces "a"
+	// and "b", and a file named "baz" to namespace "a".
+	addFile := func(ns, name string) {
+		f := newTestingFile()
+		f.name = name
+		f.namespace = ns
+		id := rt.renter.mu.Lock()
+		rt.renter.files[f.key()] = f
+		rt.renter.mu.Unlock(id)
+		if err := rt.renter.saveFile(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	addFile("", "foo")
+	addFile("a", "foo")
+	addFile("a", "baz")
+	addFile("b", "foo")
+
+	checkNames := func(ns string, names ...string) {
+		files := rt.renter.FileListNS(ns)
+		found := make(map[string]bool)
+		for _, fi := range files {
+			found[fi.SiaPath] = true
+		}
+		if len(files) != len(names) {
+			t.Fatalf("expected %v files in namespace %q, got %v", len(names), ns, files)
+		}
+		for _, name := range names {
+			if !found[name] {
+				t.Fatalf("expected %v in namespace %q, got %v", name, ns, files)
+			}
+		}
+	}
+	checkNames("", "foo")
+	checkNames("a", "foo", "baz")
+	checkNames("b", "foo")
+	checkNames("c")
+	if files := rt.renter.FileList(); len(files) != 1 {
+		t.Fatal("FileList should only list the default namespace, got", files)
+	}
+	if fi, err := rt.renter.FileInfoNS("a", "baz"); err != nil || fi.SiaPath != "baz" {
+		t.Fatal("expected baz in namespace a, got", fi, err)
+	}
+	if _, err := rt.renter.FileInfoNS("b", "baz"); err != ErrUnknownPath {
+		t.Fatal("expected ErrUnknownPath, got", err)
+	}
+
+	// Renames only conflict within a namespace.
+	if err := rt.renter.RenameNS("a", "foo", "bar"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.renter.RenameNS("b", "foo", "bar"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.renter.RenameNS("a", "baz", "bar"); err != ErrPathOverload {
+		t.Fatal("expected ErrPathOverload, got", err)
+	}
+	if err := rt.renter.RenameNS("c", "bar", "qux"); err != ErrUnknownPath {
+		t.Fatal("expected ErrUnknownPath, got", err)
+	}
+	checkNames("", "foo")
+	checkNames("a", "bar", "baz")
+	checkNames("b", "bar")
+
+	// Deletions are scoped to a namespace.
+	if err := rt.renter.DeleteNS("b", "bar"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.renter.DeleteNS("b", "bar"); err != ErrUnknownPath {
+		t.Fatal("expected ErrUnknownPath, got", err)
+	}
+	checkNames("a", "bar", "baz")
+	checkNames("b")
+
+	// Invalid namespaces and reserved nicknames are rejected.
+	if err := rt.renter.DeleteNS("a/b", "bar"); err != errInvalidNamespace {
+		t.Fatal("expected errInvalidNamespace, got", err)
+	}
+	if err := rt.renter.RenameNS("..", "bar", "qux"); err != errInvalidNamespace {
+		t.Fatal("expected errInvalidNamespace, got", err)
+	}
+	if err := rt.renter.RenameFile("foo", namespaceDir+"/a/foo"); err != errNicknameReserved {
+		t.Fatal("expected errNicknameReserved, got", err)
+	}
+
+	// The namespaces should be restored when the renter is loaded.
+	id := rt.renter.mu.Lock()
+	rt.renter.files = make(map[string]*file)
+	err = rt.renter.load()
+	rt.renter.mu.Unlock(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkNames("", "foo")
+	checkNames("a", "bar", "baz")
+	checkNames("b")
+}
@@ -5,12 +5,17 @@ import (
 	"compress/gzip"
 	"encoding/base64"
 	"errors"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/encoding"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/persist"
@@ -21,6 +26,11 @@ const (
 	PersistFilename = "renter.json"
 	ShareExtension  = ".sia"
 	logFile         = modules.RenterDir + ".log"
+
+	// orphanedDir is the directory within the persist directory that Compact
+	// moves .sia files to if they do not belong to a known file. The renter
+	// does not load the files in it.
+	orphanedDir = ".orphaned"
 )
 
 var (
@@ -30,7 +40,21 @@ var (
 	ErrIncompatible   = errors.New("file is not compatible with current version")
 
 	shareHeader  = [15]byte{'S', 'i', 'a', ' ', 'S', 'h', 'a', 'r', 'e', 'd', ' ', 'F', 'i', 'l', 'e'}
-	shareVersion = "0.4"
+	shareVersion = "0.5"
+
+	// COMPATv1.3.0 - .sia files of version 0.4 do not contain checksums.
+	shareVersionNoChecksum = "0.4"
+
+	// shareVersionDedup is the version of .sia files containing files whose
+	// chunks share pieces with other files. Each file's checksum is followed
+	// by the keys of its shared chunks. Other files are written with
+	// shareVersion, so that older renters can still load them.
+	shareVersionDedup = "0.6"
+
+	// shareVersionCompressed is the version of .sia files containing
+	// compressed files. Each file's dedup keys are followed by whether it is
+	// compressed and the size of its contents.
+	shareVersionCompressed = "0.7"
 
 	saveMetadata = persist.Metadata{
 		Header:  "Renter Persistence",
@@ -38,6 +62,76 @@ var (
 	}
 )
 
+// persistVersion is the schema version of the renter's metadata. Version 1 is
+// the metadata saved before the schema was versioned, which only contains the
+// tracked files. Version 2 adds the offline hosts and the pinned, sealed, tags
+// and verified settings of the files. Version 3 adds the created directories,
+// version 4 adds the bandwidth limits, version 5 adds the chunk cache size and
+// the redundancy policies, version 6 adds the worker limits, version 7 adds
+// the chunk index and the dedup setting of tracked files, version 8 adds the
+// user metadata of the files, version 9 adds the repair schedule, and version
+// 10 adds the buckets.
+const persistVersion = 10
+
+// errNewerPersist is returned when loading metadata that was saved by a newer
+// version of the renter. Loading it would silently drop the fields that this
+// version does not know about.
+var errNewerPersist = errors.New("renter metadata was saved by a newer version of the renter")
+
+// renterPersist is the renter's metadata, as saved in renter.json.
+type renterPersist struct {
+	Version      int
+	Tracking     map[string]trackedFile
+	OfflineHosts []modules.NetAddress
+	Pinned       []string
+	Sealed       []string
+	Tags         map[string][]string
+	Verified     map[string]map[uint64]types.BlockHeight
+	Dirs         []string
+
+	MaxDownloadSpeed int64
+	MaxUploadSpeed   int64
+	CacheSize        uint64
+
+	MaxUploadWorkers   int
+	MaxDownloadWorkers int
+
+	Redundancy   modules.RedundancyPolicy
+	FilePolicies map[string]modules.RedundancyPolicy
+
+	ChunkIndex map[string]chunkIndexEntry
+
+	Metadata map[string]map[string]string
+
+	RepairSchedule modules.RepairSchedule
+
+	Buckets map[string]crypto.Hash
+
+	Repairing map[string]string `json:",omitempty"` // COMPATv0.4.8
+}
+
+// migratePersist upgrades metadata saved with an older schema version to
+// persistVersion, filling in defaults for the fields that the older version
+// lacks.
+func migratePersist(data *renterPersist) error {
+	// Metadata saved before the schema was versioned has no version.
+	if data.Version == 0 {
+		data.Version = 1
+	}
+	if data.Version > persistVersion {
+		return fmt.Errorf("%v: found schema version %v, but only versions up to %v are supported", errNewerPersist, data.Version, persistVersion)
+	}
+	if data.Version < 2 {
+		if data.Tracking == nil {
+			data.Tracking = make(map[string]trackedFile)
+		}
+		data.Tags = make(map[string][]string)
+		data.Verified = make(map[string]map[uint64]types.BlockHeight)
+	}
+	data.Version = persistVersion
+	return nil
+}
+
 // MarshalSia implements the encoding.SiaMarshaller interface, writing the
 // file data to w.
 func (f *file) MarshalSia(w io.Writer) error {
@@ -155,14 +249,14 @@ func (f *file) UnmarshalSia(r io.Reader) error {
 // saveFile saves a file to the renter directory.
 func (r *Renter) saveFile(f *file) error {
 	// Create directory structure specified in nickname.
-	fullPath := filepath.Join(r.persistDir, f.name+ShareExtension)
+	fullPath := r.sharePath(f.namespace, f.name)
 	err := os.MkdirAll(filepath.Dir(fullPath), 0700)
 	if err != nil {
 		return err
 	}
 
 	// Open SafeFile handle.
-	handle, err := persist.NewSafeFile(filepath.Join(r.persistDir, f.name+ShareExtension))
+	handle, err := persist.NewSafeFile(fullPath)
 	if err != nil {
 		return err
 	}
@@ -180,13 +274,140 @@ func (r *Renter) saveFile(f *file) error {
 
 // saveSync stores the current renter data to disk and then syncs to disk.
 func (r *Renter) saveSync() error {
-	data := struct {
-		Tracking map[string]trackedFile
-	}{r.tracking}
+	var pinned, sealed []string
+	tags := make(map[string][]string)
+	verified := make(map[string]map[uint64]types.BlockHeight)
+	policies := make(map[string]modules.RedundancyPolicy)
+	metadata := make(map[string]map[string]string)
+	for name, f := range r.files {
+		f.mu.RLock()
+		if f.pinned {
+			pinned = append(pinned, name)
+		}
+		if f.sealed {
+			sealed = append(sealed, name)
+		}
+		if len(f.tags) > 0 {
+			tags[name] = f.tags
+		}
+		if len(f.verified) > 0 {
+			verified[name] = f.verified
+		}
+		if f.policy != (modules.RedundancyPolicy{}) {
+			policies[name] = f.policy
+		}
+		if len(f.metadata) > 0 {
+			metadata[name] = f.metadata
+		}
+		f.mu.RUnlock()
+	}
+	sort.Strings(pinned)
+	sort.Strings(sealed)
+	dirs := make([]string, 0, len(r.dirs))
+	for dir := range r.dirs {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
 
+	data := renterPersist{
+		Version:      persistVersion,
+		Tracking:     r.tracking,
+		OfflineHosts: r.offlineHosts.list(),
+		Pinned:       pinned,
+		Sealed:       sealed,
+		Tags:         tags,
+		Verified:     verified,
+		Dirs:         dirs,
+
+		MaxDownloadSpeed: r.maxDownloadSpeed,
+		MaxUploadSpeed:   r.maxUploadSpeed,
+		CacheSize:        r.cacheSize,
+
+		MaxUploadWorkers:   r.maxUploadWorkers,
+		MaxDownloadWorkers: r.maxDownloadWorkers,
+
+		Redundancy:   r.policy,
+		FilePolicies: policies,
+
+		ChunkIndex: r.liveChunkIndex(),
+
+		Metadata: metadata,
+
+		RepairSchedule: r.schedule,
+
+		Buckets: r.buckets,
+	}
 	return persist.SaveJSON(saveMetadata, data, filepath.Join(r.persistDir, PersistFilename))
 }
 
+// save saves the renter's metadata, unless auto-flush has been enabled using
+// StartAutoFlush, in which case the renter is only marked dirty, to be saved by
+// the next flush. The renter's lock must be held.
+func (r *Renter) save() error {
+	if r.autoFlush {
+		r.dirty = true
+		return nil
+	}
+	return r.saveSync()
+}
+
+// Flush saves the renter's metadata if it has changed since it was last
+// saved. Flush is only needed when auto-flush has been enabled, since the
+// metadata is otherwise saved on every change.
+func (r *Renter) Flush() error {
+	lockID := r.mu.Lock()
+	defer r.mu.Unlock(lockID)
+	if !r.dirty {
+		return nil
+	}
+	if err := r.saveSync(); err != nil {
+		return err
+	}
+	r.dirty = false
+	return nil
+}
+
+// StartAutoFlush throttles the saving of the renter's metadata. Instead of
+// saving the metadata on every change, the renter saves it at most once per
+// interval, and when it is closed. Calling StartAutoFlush again replaces the
+// interval. The .sia files of individual files are still saved immediately.
+func (r *Renter) StartAutoFlush(interval time.Duration) error {
+	if err := r.addThread(); err != nil {
+		return err
+	}
+	lockID := r.mu.Lock()
+	if r.autoFlushStop != nil {
+		close(r.autoFlushStop)
+	}
+	stop := make(chan struct{})
+	r.autoFlushStop = stop
+	r.autoFlush = true
+	r.mu.Unlock(lockID)
+
+	go r.threadedAutoFlush(interval, stop)
+	return nil
+}
+
+// threadedAutoFlush flushes the renter's metadata every interval until stop is
+// closed or the renter is shut down. The caller must have called tg.Add.
+func (r *Renter) threadedAutoFlush(interval time.Duration, stop <-chan struct{}) {
+	defer r.tg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := r.Flush(); err != nil {
+				r.log.Println("ERROR: could not flush renter metadata:", err)
+			}
+		case <-stop:
+			return
+		case <-r.tg.StopChan():
+			return
+		}
+	}
+}
+
 // load fetches the saved renter data from disk.
 func (r *Renter) load() error {
 	// Recursively load all files found in renter directory. Errors
@@ -199,8 +420,11 @@ func (r *Renter) load() error {
 			return nil
 		}
 
-		// Skip folders and non-sia files.
-		if info.IsDir() || filepath.Ext(path) != ShareExtension {
+		// Skip folders, non-sia files, and .sia files moved aside by
+		// Compact.
+		if info.IsDir() && path == filepath.Join(r.persistDir, orphanedDir) {
+			return filepath.SkipDir
+		} else if info.IsDir() || filepath.Ext(path) != ShareExtension {
 			return nil
 		}
 
@@ -212,8 +436,9 @@ func (r *Renter) load() error {
 		}
 		defer file.Close()
 
-		// Load the file contents into the renter.
-		_, err = r.loadSharedFiles(file)
+		// Load the file contents into the renter, in the namespace given by
+		// the file's location.
+		_, err = r.loadSharedFiles(file, r.pathNamespace(path))
 		if err != nil {
 			r.log.Println("ERROR: could not load .sia file:", err)
 			return nil
@@ -225,28 +450,104 @@ func (r *Renter) load() error {
 	}
 
 	// Load contracts, repair set, and entropy.
-	data := struct {
-		Tracking  map[string]trackedFile
-		Repairing map[string]string // COMPATv0.4.8
-	}{}
+	var data renterPersist
 	err = persist.LoadJSON(saveMetadata, &data, filepath.Join(r.persistDir, PersistFilename))
 	if err != nil {
 		return err
 	}
+	if err := migratePersist(&data); err != nil {
+		return err
+	}
 	if data.Tracking != nil {
 		r.tracking = data.Tracking
 	}
+	if data.ChunkIndex != nil {
+		r.chunkIndex = data.ChunkIndex
+	}
+	if data.Buckets != nil {
+		r.buckets = data.Buckets
+	}
+	for _, addr := range data.OfflineHosts {
+		r.offlineHosts.set(addr, true)
+	}
+	for _, name := range data.Pinned {
+		if f, exists := r.files[name]; exists {
+			f.pinned = true
+		}
+	}
+	for _, name := range data.Sealed {
+		if f, exists := r.files[name]; exists {
+			f.sealed = true
+		}
+	}
+	for name, tags := range data.Tags {
+		if f, exists := r.files[name]; exists {
+			f.tags = tags
+		}
+	}
+	for name, verified := range data.Verified {
+		if f, exists := r.files[name]; exists {
+			f.verified = verified
+		}
+	}
+	for name, policy := range data.FilePolicies {
+		if f, exists := r.files[name]; exists {
+			f.policy = policy
+		}
+	}
+	for name, metadata := range data.Metadata {
+		if f, exists := r.files[name]; exists {
+			f.metadata = metadata
+		}
+	}
+	for _, dir := range data.Dirs {
+		r.dirs[dir] = struct{}{}
+	}
+	r.maxDownloadSpeed, r.maxUploadSpeed = data.MaxDownloadSpeed, data.MaxUploadSpeed
+	r.rateLimit.SetLimits(r.maxDownloadSpeed, r.maxUploadSpeed)
+	r.cacheSize = data.CacheSize
+	r.maxUploadWorkers, r.maxDownloadWorkers = data.MaxUploadWorkers, data.MaxDownloadWorkers
+	r.policy = data.Redundancy
+	r.schedule = data.RepairSchedule
+	return r.chunkCache.setMaxSize(r.cacheSize)
+}
 
-	return nil
+// A dedupChunk holds the piece keys of a chunk whose pieces are shared with
+// another file, as stored in .sia files.
+type dedupChunk struct {
+	Chunk uint64
+	Keys  []crypto.TwofishKey
+}
+
+// encodeDedupKeys returns the dedup keys of a file in order of their chunks.
+func encodeDedupKeys(dedupKeys map[uint64][]crypto.TwofishKey) []dedupChunk {
+	chunks := make([]dedupChunk, 0, len(dedupKeys))
+	for chunk, keys := range dedupKeys {
+		chunks = append(chunks, dedupChunk{chunk, keys})
+	}
+	sort.Slice(chunks, func(i, j int) bool {
+		return chunks[i].Chunk < chunks[j].Chunk
+	})
+	return chunks
 }
 
 // shareFiles writes the specified files to w. First a header is written,
 // followed by the gzipped concatenation of each file.
 func shareFiles(files []*file, w io.Writer) error {
+	version := shareVersion
+	for _, f := range files {
+		if f.compressed {
+			version = shareVersionCompressed
+			break
+		} else if len(f.dedupKeys) > 0 {
+			version = shareVersionDedup
+		}
+	}
+
 	// Write header.
 	err := encoding.NewEncoder(w).EncodeAll(
 		shareHeader,
-		shareVersion,
+		version,
 		uint64(len(files)),
 	)
 	if err != nil {
@@ -257,12 +558,24 @@ func shareFiles(files []*file, w io.Writer) error {
 	zip, _ := gzip.NewWriterLevel(w, gzip.BestSpeed)
 	enc := encoding.NewEncoder(zip)
 
-	// Encode each file.
+	// Encode each file, followed by its checksum, its dedup keys if any file
+	// has shared chunks or is compressed, and its compression if any file is
+	// compressed.
 	for _, f := range files {
-		err = enc.Encode(f)
+		err = enc.EncodeAll(f, f.checksum)
 		if err != nil {
 			return err
 		}
+		if version == shareVersionDedup || version == shareVersionCompressed {
+			if err := enc.Encode(encodeDedupKeys(f.dedupKeys)); err != nil {
+				return err
+			}
+		}
+		if version == shareVersionCompressed {
+			if err := enc.EncodeAll(f.compressed, f.rawSize); err != nil {
+				return err
+			}
+		}
 	}
 
 	return zip.Close()
@@ -327,9 +640,9 @@ func (r *Renter) ShareFilesAscii(nicknames []string) (string, error) {
 	return buf.String(), nil
 }
 
-// loadSharedFiles reads .sia data from reader and registers the contained
-// files in the renter. It returns the nicknames of the loaded files.
-func (r *Renter) loadSharedFiles(reader io.Reader) ([]string, error) {
+// readSharedFiles reads .sia data from reader and returns the contained files.
+// The files are not registered in the renter.
+func readSharedFiles(reader io.Reader) ([]*file, error) {
 	// read header
 	var header [15]byte
 	var version string
@@ -343,7 +656,7 @@ func (r *Renter) loadSharedFiles(reader io.Reader) ([]string, error) {
 		return nil, err
 	} else if header != shareHeader {
 		return nil, ErrBadFile
-	} else if version != shareVersion {
+	} else if version != shareVersion && version != shareVersionNoChecksum && version != shareVersionDedup && version != shareVersionCompressed {
 		return nil, ErrIncompatible
 	}
 
@@ -362,24 +675,61 @@ func (r *Renter) loadSharedFiles(reader io.Reader) ([]string, error) {
 		if err != nil {
 			return nil, err
 		}
+		if version != shareVersionNoChecksum {
+			err = dec.Decode(&files[i].checksum)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if version == shareVersionDedup || version == shareVersionCompressed {
+			var chunks []dedupChunk
+			if err := dec.Decode(&chunks); err != nil {
+				return nil, err
+			}
+			if len(chunks) > 0 {
+				files[i].dedupKeys = make(map[uint64][]crypto.TwofishKey, len(chunks))
+				for _, c := range chunks {
+					files[i].dedupKeys[c.Chunk] = c.Keys
+				}
+			}
+		}
+		if version == shareVersionCompressed {
+			if err := dec.DecodeAll(&files[i].compressed, &files[i].rawSize); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return files, nil
+}
 
-		// Make sure the file's name does not conflict with existing files.
+// loadSharedFiles reads .sia data from reader and registers the contained
+// files in namespace ns of the renter. It returns the nicknames of the loaded
+// files.
+func (r *Renter) loadSharedFiles(reader io.Reader, ns string) ([]string, error) {
+	files, err := readSharedFiles(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	// Make sure the file names do not conflict with existing files.
+	for _, f := range files {
+		f.namespace = ns
 		dupCount := 0
-		origName := files[i].name
+		origName := f.name
 		for {
-			_, exists := r.files[files[i].name]
+			_, exists := r.files[f.key()]
 			if !exists {
 				break
 			}
 			dupCount++
-			files[i].name = origName + "_" + strconv.Itoa(dupCount)
+			f.name = origName + "_" + strconv.Itoa(dupCount)
 		}
 	}
 
 	// Add files to renter.
-	names := make([]string, numFiles)
+	names := make([]string, len(files))
 	for i, f := range files {
-		r.files[f.name] = f
+		r.files[f.key()] = f
 		names[i] = f.name
 	}
 	// Save the files.
@@ -390,6 +740,343 @@ func (r *Renter) loadSharedFiles(reader io.Reader) ([]string, error) {
 	return names, nil
 }
 
+// ExportRegistry writes the metadata of every file in the renter's default
+// namespace to w, using the .sia format. The files are written in order of
+// their nicknames.
+func (r *Renter) ExportRegistry(w io.Writer) error {
+	lockID := r.mu.RLock()
+	defer r.mu.RUnlock(lockID)
+
+	files := make([]*file, 0, len(r.files))
+	for _, f := range r.files {
+		if f.namespace == "" {
+			files = append(files, f)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].name < files[j].name
+	})
+	return shareFiles(files, w)
+}
+
+// ImportRegistry reads file metadata written by ExportRegistry from reader
+// and registers the files in the renter. If any of the imported nicknames
+// are already in use, ErrPathOverload is returned and no files are imported,
+// unless overwrite is set, in which case the existing files are replaced and
+// are no longer tracked for repair. Sealed files are never replaced.
+func (r *Renter) ImportRegistry(reader io.Reader, overwrite bool) error {
+	if err := r.addThread(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	files, err := readSharedFiles(reader)
+	if err != nil {
+		return err
+	}
+
+	lockID := r.mu.Lock()
+	defer r.mu.Unlock(lockID)
+
+	// Check the nicknames, and check for collisions, both with existing files
+	// and within the import.
+	imported := make(map[string]struct{})
+	for _, f := range files {
+		if err := r.validateNickname(f.name); err != nil {
+			return err
+		}
+		if _, exists := imported[f.name]; exists {
+			return ErrPathOverload
+		}
+		imported[f.name] = struct{}{}
+		if existing, exists := r.files[f.name]; exists && !overwrite {
+			return ErrPathOverload
+		} else if exists && existing.isSealed() {
+			return ErrFileSealed
+		}
+	}
+
+	// Add the files to the renter and save them. Replaced files are no longer
+	// tracked for repair.
+	replaced := false
+	for _, f := range files {
+		if _, exists := r.files[f.name]; exists {
+			r.untrack(f.name)
+			replaced = true
+		}
+		r.files[f.name] = f
+		if err := r.saveFile(f); err != nil {
+			return err
+		}
+	}
+	if replaced {
+		return r.save()
+	}
+	return nil
+}
+
+// ExportFile returns a descriptor of the file with the given nickname, which
+// can be loaded into another renter using ImportFile. The descriptor contains
+// the file's erasure scheme, checksum, and the locations of its pieces, using
+// the .sia format. The file's encryption key is only included if includeKey is
+// set; without it, the imported file cannot be downloaded until its key is
+// supplied.
+func (r *Renter) ExportFile(nickname string, includeKey bool) ([]byte, error) {
+	lockID := r.mu.RLock()
+	f, exists := r.files[nickname]
+	r.mu.RUnlock(lockID)
+	if !exists {
+		return nil, ErrUnknownPath
+	}
+
+	f.mu.RLock()
+	descriptor := &file{
+		name:        f.name,
+		size:        f.size,
+		contracts:   f.contracts,
+		erasureCode: f.erasureCode,
+		pieceSize:   f.pieceSize,
+		checksum:    f.checksum,
+		mode:        f.mode,
+		compressed:  f.compressed,
+		rawSize:     f.rawSize,
+	}
+	if includeKey {
+		descriptor.masterKey = f.masterKey
+		descriptor.dedupKeys = f.dedupKeys
+	}
+	buf := new(bytes.Buffer)
+	err := shareFiles([]*file{descriptor}, buf)
+	f.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ImportFile loads a file descriptor created by ExportFile into the renter.
+// The file keeps its nickname, and ErrPathOverload is returned if the
+// nickname is already in use. The file is not tracked for repair.
+//
+// A file imported without its key is not available and cannot be downloaded.
+// Its key is supplied by importing a descriptor of the same file that
+// includes the key, which replaces the keyless file.
+//
+// The descriptor may come from another renter, whose contracts this renter
+// does not know. Hosts serve sectors to any contract formed with them, so
+// pieces in unknown contracts are moved to the renter's current contract with
+// the host that stores them, if it has one.
+func (r *Renter) ImportFile(data []byte) error {
+	if err := r.addThread(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	files, err := readSharedFiles(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if len(files) != 1 {
+		return errors.New("file descriptor must contain exactly one file")
+	}
+	f := files[0]
+
+	// Find the current contract with each host.
+	current := make(map[modules.NetAddress]modules.RenterContract)
+	for _, c := range r.hostContractor.Contracts() {
+		current[c.NetAddress] = c
+	}
+	contracts := make(map[types.FileContractID]fileContract)
+	for id, fc := range f.contracts {
+		if _, exists := r.hostContractor.ContractByID(r.hostContractor.ResolveID(id)); !exists {
+			if c, ok := current[fc.IP]; ok {
+				fc.ID = c.ID
+				fc.WindowStart = c.EndHeight()
+			}
+		}
+		if existing, exists := contracts[fc.ID]; exists {
+			fc.Pieces = append(existing.Pieces, fc.Pieces...)
+		}
+		contracts[fc.ID] = fc
+	}
+	f.contracts = contracts
+
+	lockID := r.mu.Lock()
+	defer r.mu.Unlock(lockID)
+	if err := r.validateNickname(f.name); err != nil {
+		return err
+	}
+	if existing, exists := r.files[f.name]; exists {
+		existing.mu.RLock()
+		supplied := existing.keyless() && !f.keyless() && existing.checksum == f.checksum
+		existing.mu.RUnlock()
+		if !supplied {
+			return ErrPathOverload
+		}
+	}
+	if err := r.saveFile(f); err != nil {
+		return err
+	}
+	r.files[f.name] = f
+	return nil
+}
+
+// persistSize returns the total size of the renter's persist file and of the
+// .sia files in the renter directory, leaving out those moved aside by
+// Compact.
+func (r *Renter) persistSize() (int64, error) {
+	var size int64
+	err := filepath.Walk(r.persistDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && path == filepath.Join(r.persistDir, orphanedDir) {
+			return filepath.SkipDir
+		}
+		if !info.IsDir() && (filepath.Ext(path) == ShareExtension || info.Name() == PersistFilename) {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// compareFiles returns an error describing the first difference between the
+// persisted metadata of f1 and f2, or nil if they are identical.
+func compareFiles(f1, f2 *file) error {
+	switch {
+	case f1.name != f2.name:
+		return fmt.Errorf("names do not match: %v %v", f1.name, f2.name)
+	case f1.size != f2.size || f1.pieceSize != f2.pieceSize || f1.mode != f2.mode || f1.compressed != f2.compressed || f1.rawSize != f2.rawSize:
+		return fmt.Errorf("%v: sizes or modes do not match", f1.name)
+	case f1.masterKey != f2.masterKey || f1.checksum != f2.checksum || !sameDedupKeys(f1.dedupKeys, f2.dedupKeys):
+		return fmt.Errorf("%v: keys or checksums do not match", f1.name)
+	case f1.erasureCode.MinPieces() != f2.erasureCode.MinPieces() || f1.erasureCode.NumPieces() != f2.erasureCode.NumPieces():
+		return fmt.Errorf("%v: erasure codes do not match", f1.name)
+	case len(f1.contracts) != len(f2.contracts):
+		return fmt.Errorf("%v: contract counts do not match: %v %v", f1.name, len(f1.contracts), len(f2.contracts))
+	}
+	for id, fc1 := range f1.contracts {
+		fc2, exists := f2.contracts[id]
+		if !exists || fc1.ID != fc2.ID || fc1.IP != fc2.IP || fc1.WindowStart != fc2.WindowStart || len(fc1.Pieces) != len(fc2.Pieces) {
+			return fmt.Errorf("%v: contract %v does not match", f1.name, id)
+		}
+		for i := range fc1.Pieces {
+			if fc1.Pieces[i] != fc2.Pieces[i] {
+				return fmt.Errorf("%v: contract %v does not match", f1.name, id)
+			}
+		}
+	}
+	return nil
+}
+
+// Compact rewrites the renter's persistence from the files currently known to
+// the renter. The .sia file of every file is rewritten, .sia files that do not
+// belong to a known file (such as those left behind by an interrupted rename,
+// or those that could not be loaded) are moved to the orphaned directory, and
+// tracking entries of deleted files are dropped. Each file is
+// checked to load back identically before anything on disk is changed.
+// Compact returns the number of bytes reclaimed.
+func (r *Renter) Compact() (int64, error) {
+	if err := r.addThread(); err != nil {
+		return 0, err
+	}
+	defer r.tg.Done()
+	lockID := r.mu.Lock()
+	defer r.mu.Unlock(lockID)
+
+	before, err := r.persistSize()
+	if err != nil {
+		return 0, err
+	}
+
+	// Check that every file survives a round trip through the .sia format.
+	for _, f := range r.files {
+		f.mu.RLock()
+		buf := new(bytes.Buffer)
+		err := shareFiles([]*file{f}, buf)
+		if err == nil {
+			var loaded []*file
+			loaded, err = readSharedFiles(buf)
+			if err == nil {
+				err = compareFiles(f, loaded[0])
+			}
+		}
+		f.mu.RUnlock()
+		if err != nil {
+			return 0, errors.New("compacted file does not match: " + err.Error())
+		}
+	}
+
+	// Rewrite the .sia files, then move aside those that do not belong to a
+	// known file. The renter cannot tell whether it wrote them, so they are
+	// kept in case they are the only copy of a file's metadata.
+	known := make(map[string]struct{})
+	for _, f := range r.files {
+		f.mu.RLock()
+		err := r.saveFile(f)
+		known[r.sharePath(f.namespace, f.name)] = struct{}{}
+		f.mu.RUnlock()
+		if err != nil {
+			return 0, err
+		}
+	}
+	err = filepath.Walk(r.persistDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && path == filepath.Join(r.persistDir, orphanedDir) {
+			return filepath.SkipDir
+		}
+		if _, exists := known[path]; !info.IsDir() && filepath.Ext(path) == ShareExtension && !exists {
+			return r.moveOrphaned(path)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	// Drop the tracking entries of deleted files and rewrite the persist
+	// file.
+	for name := range r.tracking {
+		if _, exists := r.files[name]; !exists {
+			r.untrack(name)
+		}
+	}
+	if err := r.saveSync(); err != nil {
+		return 0, err
+	}
+	r.dirty = false
+
+	after, err := r.persistSize()
+	if err != nil {
+		return 0, err
+	}
+	r.log.Printf("Compacted renter persistence, reclaiming %v bytes", before-after)
+	return before - after, nil
+}
+
+// moveOrphaned moves the .sia file at path, which must be within the renter's
+// persist directory, to the same location within the orphaned directory. A
+// number is added to its name if a file was already moved there.
+func (r *Renter) moveOrphaned(path string) error {
+	rel, err := filepath.Rel(r.persistDir, path)
+	if err != nil {
+		return err
+	}
+	dst := filepath.Join(r.persistDir, orphanedDir, rel)
+	if err := os.MkdirAll(filepath.Dir(dst), 0700); err != nil {
+		return err
+	}
+	base := strings.TrimSuffix(dst, ShareExtension)
+	for i := 1; ; i++ {
+		if _, err := os.Stat(dst); os.IsNotExist(err) {
+			break
+		}
+		dst = base + "." + strconv.Itoa(i) + ShareExtension
+	}
+	return os.Rename(path, dst)
+}
+
 // initPersist handles all of the persistence initialization, such as creating
 // the persistence directory and starting the logger.
 func (r *Renter) initPersist() error {
@@ -416,6 +1103,10 @@ func (r *Renter) initPersist() error {
 // LoadSharedFiles loads a .sia file into the renter. It returns the nicknames
 // of the loaded files.
 func (r *Renter) LoadSharedFiles(filename string) ([]string, error) {
+	if err := r.addThread(); err != nil {
+		return nil, err
+	}
+	defer r.tg.Done()
 	lockID := r.mu.Lock()
 	defer r.mu.Unlock(lockID)
 
@@ -424,15 +1115,19 @@ func (r *Renter) LoadSharedFiles(filename string) ([]string, error) {
 		return nil, err
 	}
 	defer file.Close()
-	return r.loadSharedFiles(file)
+	return r.loadSharedFiles(file, "")
 }
 
 // LoadSharedFilesAscii loads an ASCII-encoded .sia file into the renter. It
 // returns the nicknames of the loaded files.
 func (r *Renter) LoadSharedFilesAscii(asciiSia string) ([]string, error) {
+	if err := r.addThread(); err != nil {
+		return nil, err
+	}
+	defer r.tg.Done()
 	lockID := r.mu.Lock()
 	defer r.mu.Unlock(lockID)
 
 	dec := base64.NewDecoder(base64.URLEncoding, bytes.NewBufferString(asciiSia))
-	return r.loadSharedFiles(dec)
+	return r.loadSharedFiles(dec, "")
 }
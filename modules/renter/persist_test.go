@@ -5,12 +5,18 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/NebulousLabs/Sia/build"
 	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/persist"
+	"github.com/NebulousLabs/Sia/types"
 	"github.com/NebulousLabs/fastrand"
 )
 
@@ -27,6 +33,7 @@ func newTestingFile() *file {
 		masterKey:   crypto.GenerateTwofishKey(),
 		erasureCode: rsc,
 		pieceSize:   encoding.DecUint64(data[6:8]),
+		checksum:    crypto.HashBytes(data),
 	}
 }
 
@@ -94,7 +101,9 @@ func TestFileShareLoad(t *testing.T) {
 	}
 
 	// Remove the file from the renter.
+	id = rt.renter.mu.Lock()
 	delete(rt.renter.files, savedFile.name)
+	rt.renter.mu.Unlock(id)
 
 	// Load the .sia file back into the renter.
 	names, err := rt.renter.LoadSharedFiles(path)
@@ -108,10 +117,15 @@ func TestFileShareLoad(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
+	if rt.renter.files[savedFile.name].checksum != savedFile.checksum {
+		t.Fatal("checksum not loaded properly")
+	}
 
 	// Share and load multiple files.
 	savedFile2 := newTestingFile()
+	id = rt.renter.mu.Lock()
 	rt.renter.files[savedFile2.name] = savedFile2
+	rt.renter.mu.Unlock(id)
 	path = filepath.Join(build.SiaTestingDir, "renter", t.Name(), "test2.sia")
 	err = rt.renter.ShareFiles([]string{savedFile.name, savedFile2.name}, path)
 	if err != nil {
@@ -119,8 +133,10 @@ func TestFileShareLoad(t *testing.T) {
 	}
 
 	// Remove the files from the renter.
+	id = rt.renter.mu.Lock()
 	delete(rt.renter.files, savedFile.name)
 	delete(rt.renter.files, savedFile2.name)
+	rt.renter.mu.Unlock(id)
 
 	names, err = rt.renter.LoadSharedFiles(path)
 	if err != nil {
@@ -162,7 +178,9 @@ func TestFileShareLoadASCII(t *testing.T) {
 	}
 
 	// Remove the file from the renter.
+	id = rt.renter.mu.Lock()
 	delete(rt.renter.files, savedFile.name)
+	rt.renter.mu.Unlock(id)
 
 	names, err := rt.renter.LoadSharedFilesAscii(ascii)
 	if err != nil {
@@ -178,6 +196,100 @@ func TestFileShareLoadASCII(t *testing.T) {
 	}
 }
 
+// TestRenterExportImportRegistry probes the ExportRegistry and ImportRegistry
+// methods of the renter type.
+func TestRenterExportImportRegistry(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Add two files with a contract to the renter.
+	f1 := newTestingFile()
+	f2 := newTestingFile()
+	for f2.name == f1.name {
+		f2 = newTestingFile()
+	}
+	f1.contracts = map[types.FileContractID]fileContract{
+		{1}: {ID: types.FileContractID{1}, IP: "foo:1", Pieces: []pieceData{{Chunk: 0, Piece: 0}}, WindowStart: 10},
+	}
+	id := rt.renter.mu.Lock()
+	rt.renter.files[f1.name] = f1
+	rt.renter.files[f2.name] = f2
+	rt.renter.mu.Unlock(id)
+
+	// Export the registry, then clear the renter.
+	buf := new(bytes.Buffer)
+	err = rt.renter.ExportRegistry(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	export := buf.Bytes()
+	id = rt.renter.mu.Lock()
+	delete(rt.renter.files, f1.name)
+	delete(rt.renter.files, f2.name)
+	rt.renter.mu.Unlock(id)
+
+	// Import the registry and compare the files.
+	err = rt.renter.ImportRegistry(bytes.NewReader(export), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rt.renter.files) != 2 {
+		t.Fatal("expected 2 files after import, got", len(rt.renter.files))
+	}
+	for _, f := range []*file{f1, f2} {
+		if err := equalFiles(rt.renter.files[f.name], f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fc := rt.renter.files[f1.name].contracts[types.FileContractID{1}]
+	if fc.IP != "foo:1" || len(fc.Pieces) != 1 || fc.WindowStart != 10 {
+		t.Error("contract was not restored properly:", fc)
+	}
+
+	// Importing again should fail due to the collisions, without replacing
+	// the existing files.
+	existing := rt.renter.files[f1.name]
+	err = rt.renter.ImportRegistry(bytes.NewReader(export), false)
+	if err != ErrPathOverload {
+		t.Fatal("expected ErrPathOverload, got", err)
+	}
+	if rt.renter.files[f1.name] != existing {
+		t.Error("failed import should not replace existing files")
+	}
+
+	// Importing with overwrite should replace the files, and stop tracking
+	// the replaced files.
+	id = rt.renter.mu.Lock()
+	rt.renter.tracking[f1.name] = trackedFile{RepairPath: "/foo"}
+	rt.renter.mu.Unlock(id)
+	err = rt.renter.ImportRegistry(bytes.NewReader(export), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rt.renter.files[f1.name] == existing {
+		t.Error("import with overwrite should replace existing files")
+	}
+	if len(rt.renter.files) != 2 {
+		t.Fatal("expected 2 files after import, got", len(rt.renter.files))
+	}
+	if _, tracked := rt.renter.tracking[f1.name]; tracked {
+		t.Error("replaced file is still tracked")
+	}
+	var data renterPersist
+	if err := persist.LoadJSON(saveMetadata, &data, filepath.Join(rt.renter.persistDir, PersistFilename)); err != nil {
+		t.Fatal(err)
+	}
+	if _, tracked := data.Tracking[f1.name]; tracked {
+		t.Error("replaced file is still tracked on disk")
+	}
+}
+
 // TestRenterSaveLoad probes the save and load methods of the renter type.
 func TestRenterSaveLoad(t *testing.T) {
 	if testing.Short() {
@@ -315,3 +427,432 @@ func TestSiafileCompatibility(t *testing.T) {
 		t.Fatal("nickname not loaded properly:", names)
 	}
 }
+
+// TestRenterCompact checks that compacting the renter's persistence removes
+// stale data and moves aside unknown .sia files, while preserving every file
+// and its metadata.
+func TestRenterCompact(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Add some files with contracts.
+	var files []*file
+	for i := 0; i < 3; i++ {
+		f := newTestingFile()
+		f.name = "compact/file" + strconv.Itoa(i)
+		f.contracts = map[types.FileContractID]fileContract{
+			{byte(i)}: {
+				ID:          types.FileContractID{byte(i)},
+				IP:          "foo:1",
+				Pieces:      []pieceData{{Chunk: 0, Piece: 1, MerkleRoot: crypto.Hash{byte(i)}}},
+				WindowStart: types.BlockHeight(i),
+			},
+		}
+		id := rt.renter.mu.Lock()
+		rt.renter.files[f.name] = f
+		rt.renter.tracking[f.name] = trackedFile{RepairPath: "/tmp/" + f.name}
+		rt.renter.mu.Unlock(id)
+		if err := rt.renter.saveFile(f); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, f)
+	}
+	files[0].pinned = true
+
+	// Deleting a file leaves its tracking entry behind. Add a .sia file that
+	// does not belong to any file, as left behind by an interrupted rename.
+	if err := rt.renter.RenameFile(files[1].name, "compact/renamed"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.renter.DeleteFile(files[2].name); err != nil {
+		t.Fatal(err)
+	}
+	files = files[:2]
+	orphan := newTestingFile()
+	orphan.name = "compact/orphan"
+	if err := rt.renter.saveFile(orphan); err != nil {
+		t.Fatal(err)
+	}
+	stale := filepath.Join(rt.renter.persistDir, "compact", "orphan"+ShareExtension)
+
+	reclaimed, err := rt.renter.Compact()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reclaimed <= 0 {
+		t.Error("expected compaction to reclaim space, got", reclaimed)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Error("stale .sia file was not moved:", err)
+	}
+	moved := filepath.Join(rt.renter.persistDir, orphanedDir, "compact", "orphan"+ShareExtension)
+	if _, err := os.Stat(moved); err != nil {
+		t.Error("stale .sia file was not moved to the orphaned directory:", err)
+	}
+	if _, exists := rt.renter.tracking["compact/file2"]; exists {
+		t.Error("tracking entry of deleted file was not removed")
+	}
+
+	// The compacted persistence should load back into identical files.
+	id := rt.renter.mu.Lock()
+	rt.renter.files = make(map[string]*file)
+	rt.renter.tracking = make(map[string]trackedFile)
+	err = rt.renter.load()
+	rt.renter.mu.Unlock(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rt.renter.files) != len(files) {
+		t.Fatalf("expected %v files, got %v", len(files), len(rt.renter.files))
+	}
+	for _, f := range files {
+		loaded, exists := rt.renter.files[f.name]
+		if !exists {
+			t.Fatal("file was not preserved:", f.name)
+		}
+		if err := compareFiles(f, loaded); err != nil {
+			t.Fatal(err)
+		}
+		if loaded.pinned != f.pinned {
+			t.Error("pinned status was not preserved:", f.name)
+		}
+	}
+	if rt.renter.tracking["compact/file0"].RepairPath != "/tmp/compact/file0" || rt.renter.tracking["compact/renamed"].RepairPath != "/tmp/compact/file1" {
+		t.Error("tracking entries were not preserved:", rt.renter.tracking)
+	}
+
+	// Compacting again should not reclaim anything. Another orphan with the
+	// same name does not replace the one moved before.
+	if err := rt.renter.saveFile(orphan); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rt.renter.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(rt.renter.persistDir, orphanedDir, "compact", "orphan.1"+ShareExtension)); err != nil {
+		t.Error("second orphan was not moved next to the first:", err)
+	}
+	if reclaimed, err := rt.renter.Compact(); err != nil || reclaimed != 0 {
+		t.Error("expected another compaction to reclaim nothing, got", reclaimed, err)
+	}
+}
+
+// TestRenterAutoFlush checks that with auto-flush enabled, changes to the
+// renter's metadata are only saved when the renter is flushed or closed.
+func TestRenterAutoFlush(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	hc := onlineContractor{}
+	rt, err := newContractorTester(t.Name(), closeHostDB{}, hc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	rsc, _ := NewRSCode(1, 1)
+	for _, name := range []string{"one", "two"} {
+		f := newFile(name, rsc, 1, 1)
+		id := rt.renter.mu.Lock()
+		rt.renter.files[name] = f
+		rt.renter.mu.Unlock(id)
+		if err := rt.renter.saveFile(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// savedPins returns the pinned files recorded on disk.
+	savedPins := func() []string {
+		var data struct {
+			Pinned []string
+		}
+		err := persist.LoadJSON(saveMetadata, &data, filepath.Join(rt.renter.persistDir, PersistFilename))
+		if err != nil && !os.IsNotExist(err) {
+			t.Fatal(err)
+		}
+		return data.Pinned
+	}
+
+	if err := rt.renter.StartAutoFlush(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.renter.SetPinned("one", true); err != nil {
+		t.Fatal(err)
+	}
+	if pins := savedPins(); len(pins) != 0 {
+		t.Fatal("metadata was saved before being flushed:", pins)
+	}
+	if err := rt.renter.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if pins := savedPins(); len(pins) != 1 || pins[0] != "one" {
+		t.Fatal("flush did not save the metadata:", pins)
+	}
+
+	// Pending changes should be saved when the renter is closed.
+	if err := rt.renter.SetPinned("two", true); err != nil {
+		t.Fatal(err)
+	}
+	if pins := savedPins(); len(pins) != 1 {
+		t.Fatal("metadata was saved before being flushed:", pins)
+	}
+	if err := rt.renter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if pins := savedPins(); len(pins) != 2 {
+		t.Fatal("close did not flush the metadata:", pins)
+	}
+
+	// A closed renter cannot be modified or closed again.
+	if err := rt.renter.SetPinned("one", false); err != ErrRenterClosed {
+		t.Fatal("expected ErrRenterClosed, got", err)
+	}
+	if deleted := rt.renter.DeleteWhere(func(modules.FileInfo) bool { return true }); len(deleted) != 0 {
+		t.Fatal("closed renter deleted files:", deleted)
+	}
+	if err := rt.renter.Close(); err != ErrRenterClosed {
+		t.Fatal("expected ErrRenterClosed, got", err)
+	}
+	if pins := savedPins(); len(pins) != 2 {
+		t.Fatal("closed renter was modified:", pins)
+	}
+
+	// Without auto-flush, changes are saved immediately.
+	rt.renter, err = newRenter(rt.cs, rt.tpool, closeHostDB{}, hc, rt.renter.rateLimit, rt.renter.persistDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.renter.SetPinned("two", false); err != nil {
+		t.Fatal(err)
+	}
+	if pins := savedPins(); len(pins) != 1 {
+		t.Fatal("metadata was not saved immediately:", pins)
+	}
+}
+
+// TestRenterExportImportFile checks that a file exported with ExportFile
+// imports with identical metadata, and that the key is only exported when
+// requested.
+func TestRenterExportImportFile(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	if _, err := rt.renter.ExportFile("foo", false); err != ErrUnknownPath {
+		t.Fatal("expected ErrUnknownPath, got", err)
+	}
+
+	f := newTestingFile()
+	f.contracts = map[types.FileContractID]fileContract{
+		{1}: {ID: types.FileContractID{1}, IP: "foo:1", Pieces: []pieceData{{Chunk: 0, Piece: 0, MerkleRoot: crypto.Hash{1}}}, WindowStart: 5},
+		{2}: {ID: types.FileContractID{2}, IP: "bar:1", Pieces: []pieceData{{Chunk: 0, Piece: 1, MerkleRoot: crypto.Hash{2}}}, WindowStart: 6},
+	}
+	id := rt.renter.mu.Lock()
+	rt.renter.files[f.name] = f
+	rt.renter.mu.Unlock(id)
+
+	withKey, err := rt.renter.ExportFile(f.name, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	withoutKey, err := rt.renter.ExportFile(f.name, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The file's nickname is already in use.
+	if err := rt.renter.ImportFile(withKey); err != ErrPathOverload {
+		t.Fatal("expected ErrPathOverload, got", err)
+	}
+
+	id = rt.renter.mu.Lock()
+	delete(rt.renter.files, f.name)
+	rt.renter.mu.Unlock(id)
+	if err := rt.renter.ImportFile(withKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := compareFiles(f, rt.renter.files[f.name]); err != nil {
+		t.Fatal(err)
+	}
+
+	id = rt.renter.mu.Lock()
+	delete(rt.renter.files, f.name)
+	rt.renter.mu.Unlock(id)
+	if err := rt.renter.ImportFile(withoutKey); err != nil {
+		t.Fatal(err)
+	}
+	imported := rt.renter.files[f.name]
+	if imported.masterKey != (crypto.TwofishKey{}) {
+		t.Fatal("key was exported without includeKey")
+	}
+	if rt.renter.FileList()[0].Available {
+		t.Fatal("file imported without its key should not be available")
+	}
+	err = rt.renter.Download(modules.RenterDownloadParameters{Siapath: f.name, Destination: filepath.Join(rt.renter.persistDir, "foo")})
+	if err != errKeylessFile {
+		t.Fatal("expected errKeylessFile, got", err)
+	}
+	if _, err := rt.renter.Streamer(f.name); err != errKeylessFile {
+		t.Fatal("expected errKeylessFile, got", err)
+	}
+	imported.masterKey = f.masterKey
+	if err := compareFiles(f, imported); err != nil {
+		t.Fatal(err)
+	}
+	imported.masterKey = crypto.TwofishKey{}
+
+	// Importing the file with its key supplies the key, but importing it
+	// without a key again does not replace it.
+	if err := rt.renter.ImportFile(withKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := compareFiles(f, rt.renter.files[f.name]); err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.renter.ImportFile(withoutKey); err != ErrPathOverload {
+		t.Fatal("expected ErrPathOverload, got", err)
+	}
+
+	if err := rt.renter.ImportFile([]byte("foo")); err == nil {
+		t.Fatal("expected an error importing an invalid descriptor")
+	}
+}
+
+// TestRenterImportFileContracts checks that the pieces of an imported file
+// that are stored in another renter's contracts are moved to the importing
+// renter's contracts with the same hosts.
+func TestRenterImportFileContracts(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	f := newTestingFile()
+	f.contracts = map[types.FileContractID]fileContract{
+		{1}: {ID: types.FileContractID{1}, IP: "foo:1", Pieces: []pieceData{{Chunk: 0, Piece: 0, MerkleRoot: crypto.Hash{1}}}, WindowStart: 5},
+		{2}: {ID: types.FileContractID{2}, IP: "bar:1", Pieces: []pieceData{{Chunk: 0, Piece: 1, MerkleRoot: crypto.Hash{2}}}, WindowStart: 6},
+	}
+	id := rt.renter.mu.Lock()
+	rt.renter.files[f.name] = f
+	rt.renter.mu.Unlock(id)
+	data, err := rt.renter.ExportFile(f.name, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The importing renter only has a contract with one of the hosts.
+	hc := listContractor{onlineContractor{
+		contracts: map[types.FileContractID]modules.RenterContract{
+			{3}: {ID: types.FileContractID{3}, NetAddress: "foo:1", LastRevision: types.FileContractRevision{NewWindowStart: 10}},
+		},
+	}}
+	rt2, err := newContractorTester(t.Name()+"2", closeHostDB{}, hc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt2.Close()
+	if err := rt2.renter.ImportFile(data); err != nil {
+		t.Fatal(err)
+	}
+	exp := map[types.FileContractID]fileContract{
+		{3}: {ID: types.FileContractID{3}, IP: "foo:1", Pieces: []pieceData{{Chunk: 0, Piece: 0, MerkleRoot: crypto.Hash{1}}}, WindowStart: 10},
+		{2}: f.contracts[types.FileContractID{2}],
+	}
+	if imported := rt2.renter.files[f.name]; !reflect.DeepEqual(imported.contracts, exp) {
+		t.Fatalf("expected contracts %v, got %v", exp, imported.contracts)
+	}
+}
+
+// TestRenterPersistMigration checks that metadata saved before the schema was
+// versioned is upgraded on load, and that metadata saved by a newer version of
+// the renter is refused.
+func TestRenterPersistMigration(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Save a file, along with version 1 metadata that tracks it.
+	f := newTestingFile()
+	if err := rt.renter.saveFile(f); err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(rt.renter.persistDir, PersistFilename)
+	v1 := struct {
+		Tracking map[string]trackedFile
+	}{map[string]trackedFile{f.name: {RepairPath: "/foo"}}}
+	if err := persist.SaveJSON(saveMetadata, v1, filename); err != nil {
+		t.Fatal(err)
+	}
+
+	// The migration should fill in defaults for the new fields.
+	var data renterPersist
+	if err := persist.LoadJSON(saveMetadata, &data, filename); err != nil {
+		t.Fatal(err)
+	}
+	if err := migratePersist(&data); err != nil {
+		t.Fatal(err)
+	}
+	if data.Version != persistVersion || data.Tags == nil || data.Verified == nil {
+		t.Fatal("defaults were not filled in:", data)
+	}
+
+	id := rt.renter.mu.Lock()
+	err = rt.renter.load()
+	rt.renter.mu.Unlock(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rt.renter.tracking[f.name].RepairPath != "/foo" {
+		t.Fatal("tracked file was not loaded:", rt.renter.tracking)
+	}
+	loaded := rt.renter.files[f.name]
+	if err := equalFiles(f, loaded); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.pinned || loaded.sealed || len(loaded.tags) != 0 || len(loaded.verified) != 0 {
+		t.Fatal("loaded file should have default settings")
+	}
+
+	// Saving the metadata again should store the current version.
+	if err := rt.renter.saveSync(); err != nil {
+		t.Fatal(err)
+	}
+	data = renterPersist{}
+	if err := persist.LoadJSON(saveMetadata, &data, filename); err != nil {
+		t.Fatal(err)
+	}
+	if data.Version != persistVersion {
+		t.Fatal("expected version", persistVersion, "got", data.Version)
+	}
+
+	// Metadata from a newer version should be refused.
+	data.Version = persistVersion + 1
+	if err := persist.SaveJSON(saveMetadata, data, filename); err != nil {
+		t.Fatal(err)
+	}
+	id = rt.renter.mu.Lock()
+	err = rt.renter.load()
+	rt.renter.mu.Unlock(id)
+	if err == nil || !strings.Contains(err.Error(), errNewerPersist.Error()) {
+		t.Fatal("expected errNewerPersist, got", err)
+	}
+}
@@ -134,8 +134,9 @@ func (hd *Downloader) Close() error {
 }
 
 // NewDownloader initiates the download request loop with a host, and returns a
-// Downloader.
-func NewDownloader(host modules.HostDBEntry, contract modules.RenterContract, hdb hostDB, cancel <-chan struct{}) (_ *Downloader, err error) {
+// Downloader. The connection to the host is subject to the limits of rl, if rl
+// is not nil.
+func NewDownloader(host modules.HostDBEntry, contract modules.RenterContract, hdb hostDB, rl *RateLimit, cancel <-chan struct{}) (_ *Downloader, err error) {
 	// check that contract has enough value to support a download
 	if len(contract.LastRevision.NewValidProofOutputs) != 2 {
 		return nil, errors.New("invalid contract")
@@ -163,6 +164,7 @@ func NewDownloader(host modules.HostDBEntry, contract modules.RenterContract, hd
 	if err != nil {
 		return nil, err
 	}
+	conn = newRateLimitConn(conn, rl, cancel)
 
 	closeChan := make(chan struct{})
 	go func() {
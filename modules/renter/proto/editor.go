@@ -264,8 +264,9 @@ func (he *Editor) Modify(oldRoot, newRoot crypto.Hash, offset uint64, newData []
 }
 
 // NewEditor initiates the contract revision process with a host, and returns
-// an Editor.
-func NewEditor(host modules.HostDBEntry, contract modules.RenterContract, currentHeight types.BlockHeight, hdb hostDB, cancel <-chan struct{}) (_ *Editor, err error) {
+// an Editor. The connection to the host is subject to the limits of rl, if rl
+// is not nil.
+func NewEditor(host modules.HostDBEntry, contract modules.RenterContract, currentHeight types.BlockHeight, hdb hostDB, rl *RateLimit, cancel <-chan struct{}) (_ *Editor, err error) {
 	// check that contract has enough value to support an upload
 	if len(contract.LastRevision.NewValidProofOutputs) != 2 {
 		return nil, errors.New("invalid contract")
@@ -289,6 +290,7 @@ func NewEditor(host modules.HostDBEntry, contract modules.RenterContract, curren
 	if err != nil {
 		return nil, err
 	}
+	conn = newRateLimitConn(conn, rl, cancel)
 
 	closeChan := make(chan struct{})
 	go func() {
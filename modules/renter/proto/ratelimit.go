@@ -0,0 +1,187 @@
+package proto
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// rateLimitChunkSize is the largest amount of data that is transferred
+// without waiting on the rate limit, so that large writes, such as sectors,
+// are spread out evenly.
+const rateLimitChunkSize = 1 << 16
+
+// errRateLimitCancelled is returned by a rateLimitConn if its cancel channel
+// is closed while it waits on the limit.
+var errRateLimitCancelled = errors.New("transfer was cancelled while waiting on the bandwidth limit")
+
+// A RateLimit limits the rate at which data is read from and written to the
+// connections to hosts that use it. Each renter has its own RateLimit, which
+// is shared by the connections of its contracts.
+type RateLimit struct {
+	download rateLimit
+	upload   rateLimit
+}
+
+// NewRateLimit returns a RateLimit with the given download and upload limits
+// in bytes per second. A limit of 0 means unlimited.
+func NewRateLimit(download, upload int64) *RateLimit {
+	rl := new(RateLimit)
+	rl.SetLimits(download, upload)
+	return rl
+}
+
+// SetLimits sets the download and upload limits in bytes per second. A limit
+// of 0 means unlimited.
+func (rl *RateLimit) SetLimits(download, upload int64) {
+	rl.download.setLimit(download)
+	rl.upload.setLimit(upload)
+}
+
+// A rateLimit spaces out transfers so that they do not exceed a number of
+// bytes per second. Each transfer reserves time after the transfers before it,
+// so transfers that are shorter than the reservations wait for their turn.
+type rateLimit struct {
+	bps  int64
+	next time.Time
+	mu   sync.Mutex
+}
+
+// setLimit sets the limit in bytes per second. A limit of 0 means unlimited.
+func (rl *rateLimit) setLimit(bps int64) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.bps = bps
+	rl.next = time.Time{}
+}
+
+// reserve reserves the transfer of n bytes, and returns how long the caller
+// must wait before making the transfer.
+func (rl *rateLimit) reserve(n int) time.Duration {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	if rl.bps <= 0 {
+		return 0
+	}
+	now := time.Now()
+	if rl.next.Before(now) {
+		rl.next = now
+	}
+	wait := rl.next.Sub(now)
+	rl.next = rl.next.Add(time.Duration(int64(n) * int64(time.Second) / rl.bps))
+	return wait
+}
+
+// A rateLimitConn is a net.Conn whose reads and writes are subject to the
+// download and upload limits of a RateLimit. The time spent waiting on the
+// limits does not count against the deadlines of the connection.
+type rateLimitConn struct {
+	net.Conn
+	rl     *RateLimit
+	cancel <-chan struct{}
+
+	readDeadline  time.Time
+	writeDeadline time.Time
+	mu            sync.Mutex
+}
+
+// newRateLimitConn wraps conn so that it is subject to the limits of rl.
+// Waiting on the limits stops when cancel is closed. If rl is nil, conn is
+// returned unchanged.
+func newRateLimitConn(conn net.Conn, rl *RateLimit, cancel <-chan struct{}) net.Conn {
+	if rl == nil {
+		return conn
+	}
+	return &rateLimitConn{
+		Conn:   conn,
+		rl:     rl,
+		cancel: cancel,
+	}
+}
+
+// SetDeadline implements the net.Conn interface.
+func (c *rateLimitConn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.readDeadline, c.writeDeadline = t, t
+	c.mu.Unlock()
+	return c.Conn.SetDeadline(t)
+}
+
+// SetReadDeadline implements the net.Conn interface.
+func (c *rateLimitConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.readDeadline = t
+	c.mu.Unlock()
+	return c.Conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline implements the net.Conn interface.
+func (c *rateLimitConn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.writeDeadline = t
+	c.mu.Unlock()
+	return c.Conn.SetWriteDeadline(t)
+}
+
+// wait waits for d, extending the deadlines of the connection by d. It
+// returns early with errRateLimitCancelled if the cancel channel is closed.
+func (c *rateLimitConn) wait(d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	c.mu.Lock()
+	if !c.readDeadline.IsZero() {
+		c.readDeadline = c.readDeadline.Add(d)
+		c.Conn.SetReadDeadline(c.readDeadline)
+	}
+	if !c.writeDeadline.IsZero() {
+		c.writeDeadline = c.writeDeadline.Add(d)
+		c.Conn.SetWriteDeadline(c.writeDeadline)
+	}
+	c.mu.Unlock()
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-c.cancel:
+		return errRateLimitCancelled
+	}
+}
+
+// Read implements the io.Reader interface. The data that was read counts
+// against the download limit before the next read.
+func (c *rateLimitConn) Read(b []byte) (int, error) {
+	if len(b) > rateLimitChunkSize {
+		b = b[:rateLimitChunkSize]
+	}
+	n, err := c.Conn.Read(b)
+	if werr := c.wait(c.rl.download.reserve(n)); werr != nil && err == nil {
+		err = werr
+	}
+	return n, err
+}
+
+// Write implements the io.Writer interface, waiting on the upload limit
+// before writing each part of b.
+func (c *rateLimitConn) Write(b []byte) (int, error) {
+	var written int
+	for len(b) > 0 {
+		chunk := b
+		if len(chunk) > rateLimitChunkSize {
+			chunk = chunk[:rateLimitChunkSize]
+		}
+		if err := c.wait(c.rl.upload.reserve(len(chunk))); err != nil {
+			return written, err
+		}
+		n, err := c.Conn.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		b = b[len(chunk):]
+	}
+	return written, nil
+}
@@ -0,0 +1,68 @@
+package proto
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+)
+
+// TestRateLimitReserve checks that reservations are spaced out according to
+// the limit.
+func TestRateLimitReserve(t *testing.T) {
+	var rl rateLimit
+	if wait := rl.reserve(1e6); wait != 0 {
+		t.Fatal("unlimited transfers should not wait, got", wait)
+	}
+
+	rl.setLimit(1000)
+	if wait := rl.reserve(500); wait != 0 {
+		t.Fatal("the first transfer should not wait, got", wait)
+	}
+	// The second transfer must wait for the first 500 bytes, which take half
+	// a second at 1000 bytes per second.
+	if wait := rl.reserve(500); wait < 400*time.Millisecond || wait > 500*time.Millisecond {
+		t.Fatal("expected a wait of about 500ms, got", wait)
+	}
+	if wait := rl.reserve(1); wait < 900*time.Millisecond || wait > time.Second {
+		t.Fatal("expected a wait of about 1s, got", wait)
+	}
+
+	// Changing the limit discards the reservations.
+	rl.setLimit(0)
+	if wait := rl.reserve(1e6); wait != 0 {
+		t.Fatal("unlimited transfers should not wait, got", wait)
+	}
+}
+
+// TestRateLimitConnCancel checks that a rateLimitConn stops waiting on its
+// limit when it is cancelled, and that waiting extends its deadlines.
+func TestRateLimitConnCancel(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+	go io.Copy(ioutil.Discard, c2)
+
+	// At 1 byte per second, the second chunk of the write waits for about
+	// 18 hours.
+	cancel := make(chan struct{})
+	conn := newRateLimitConn(c1, NewRateLimit(0, 1), cancel).(*rateLimitConn)
+	deadline := time.Now().Add(time.Hour)
+	conn.SetDeadline(deadline)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		close(cancel)
+	}()
+	n, err := conn.Write(make([]byte, 2*rateLimitChunkSize))
+	if err != errRateLimitCancelled {
+		t.Fatal("expected errRateLimitCancelled, got", err)
+	} else if n != rateLimitChunkSize {
+		t.Fatal("expected one chunk to be written, got", n)
+	}
+	if !conn.writeDeadline.After(deadline.Add(time.Hour)) {
+		t.Fatal("write deadline was not extended:", conn.writeDeadline)
+	} else if !conn.readDeadline.After(deadline.Add(time.Hour)) {
+		t.Fatal("read deadline was not extended:", conn.readDeadline)
+	}
+}
@@ -0,0 +1,78 @@
+package proto
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// ProveSegments challenges the host of the contract to prove that it stores
+// the given segments of the contract's sectors, and returns the host's proofs
+// in the order of the challenges. The proofs are not verified; a host that
+// does not have a sector answers with an empty proof. The connection to the
+// host is subject to the limits of rl, if rl is not nil.
+func ProveSegments(contract modules.RenterContract, challenges []modules.SegmentChallenge, rl *RateLimit, cancel <-chan struct{}) ([]modules.SegmentProof, error) {
+	if len(challenges) > modules.NegotiateMaxSegmentChallenges {
+		return nil, errors.New("too many segment challenges")
+	}
+	conn, err := (&net.Dialer{
+		Cancel:  cancel,
+		Timeout: 15 * time.Second,
+	}).Dial("tcp", string(contract.NetAddress))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn = newRateLimitConn(conn, rl, cancel)
+
+	closeChan := make(chan struct{})
+	defer close(closeChan)
+	go func() {
+		select {
+		case <-cancel:
+			conn.Close()
+		case <-closeChan:
+		}
+	}()
+
+	extendDeadline(conn, modules.NegotiateSegmentProofTime)
+	if err := encoding.WriteObject(conn, modules.RPCProveSegments); err != nil {
+		return nil, errors.New("couldn't initiate RPC: " + err.Error())
+	}
+	// prove ownership of the contract
+	if err := encoding.WriteObject(conn, contract.ID); err != nil {
+		return nil, errors.New("couldn't send contract ID: " + err.Error())
+	}
+	var challenge crypto.Hash
+	if err := encoding.ReadObject(conn, &challenge, 32); err != nil {
+		return nil, errors.New("couldn't read challenge: " + err.Error())
+	}
+	crypto.SecureWipe(challenge[:16])
+	sig := crypto.SignHash(challenge, contract.SecretKey)
+	if err := encoding.WriteObject(conn, sig); err != nil {
+		return nil, errors.New("couldn't send challenge response: " + err.Error())
+	}
+	if err := modules.ReadNegotiationAcceptance(conn); err != nil {
+		return nil, errors.New("host did not accept segment proof request: " + err.Error())
+	}
+
+	// send the challenges and read the proofs
+	if err := encoding.WriteObject(conn, challenges); err != nil {
+		return nil, errors.New("couldn't send segment challenges: " + err.Error())
+	}
+	if err := modules.ReadNegotiationAcceptance(conn); err != nil {
+		return nil, errors.New("host did not accept segment challenges: " + err.Error())
+	}
+	var proofs []modules.SegmentProof
+	if err := encoding.ReadObject(conn, &proofs, modules.NegotiateMaxSegmentProofsSize); err != nil {
+		return nil, errors.New("couldn't read segment proofs: " + err.Error())
+	}
+	if len(proofs) != len(challenges) {
+		return nil, errors.New("host sent the wrong number of segment proofs")
+	}
+	return proofs, nil
+}
@@ -0,0 +1,123 @@
+package renter
+
+import (
+	"errors"
+	"math"
+	"sort"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+var errBadRedundancyPolicy = errors.New("redundancy targets must be 0 or at least 1, and the minimum cannot exceed the target")
+
+// validateRedundancyPolicy checks that the targets of p are either 0 or at
+// least 1, and that its minimum does not exceed its target.
+func validateRedundancyPolicy(p modules.RedundancyPolicy) error {
+	// The comparisons are written so that NaN is rejected.
+	if !(p.MinRedundancy == 0 || p.MinRedundancy >= 1) || !(p.TargetRedundancy == 0 || p.TargetRedundancy >= 1) {
+		return errBadRedundancyPolicy
+	}
+	if p.MinRedundancy != 0 && p.TargetRedundancy != 0 && p.MinRedundancy > p.TargetRedundancy {
+		return errBadRedundancyPolicy
+	}
+	return nil
+}
+
+// redundancyPolicy returns the redundancy policy that applies to f. The
+// renter's lock must be held.
+func (r *Renter) redundancyPolicy(f *file) modules.RedundancyPolicy {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if f.policy != (modules.RedundancyPolicy{}) {
+		return f.policy
+	}
+	return r.policy
+}
+
+// repairThresholds returns the number of pieces below which a chunk encoded
+// with ec is repaired under policy p, and the number of pieces that the repair
+// brings the chunk up to.
+func repairThresholds(p modules.RedundancyPolicy, ec modules.ErasureCoder) (minPieces, targetPieces int) {
+	pieces := func(redundancy float64) int {
+		n := math.Ceil(redundancy * float64(ec.MinPieces()))
+		if redundancy == 0 || n > float64(ec.NumPieces()) {
+			return ec.NumPieces()
+		}
+		return int(n)
+	}
+	targetPieces = pieces(p.TargetRedundancy)
+	minPieces = pieces(p.MinRedundancy)
+	if minPieces > targetPieces {
+		minPieces = targetPieces
+	}
+	return minPieces, targetPieces
+}
+
+// managedUpdateCheapWorkers sets the cheap workers of the repair state, which
+// are the active and available workers whose hosts charge at most the median
+// storage price among them. Workers whose hosts are not in the host database
+// are never cheap.
+func (r *Renter) managedUpdateCheapWorkers(rs *repairState) {
+	prices := make(map[types.FileContractID]types.Currency)
+	for _, workers := range []map[types.FileContractID]*worker{rs.activeWorkers, rs.availableWorkers} {
+		for id, worker := range workers {
+			if host, ok := r.hostDB.Host(worker.contract.HostPublicKey); ok {
+				prices[id] = host.StoragePrice
+			}
+		}
+	}
+	sorted := make([]types.Currency, 0, len(prices))
+	for _, price := range prices {
+		sorted = append(sorted, price)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Cmp(sorted[j]) < 0
+	})
+
+	rs.cheapWorkers = make(map[types.FileContractID]struct{})
+	for id, price := range prices {
+		if price.Cmp(sorted[(len(sorted)-1)/2]) <= 0 {
+			rs.cheapWorkers[id] = struct{}{}
+		}
+	}
+}
+
+// SetRedundancyPolicy sets the redundancy policy of the file with the given
+// nickname, and queues the file for repair. The zero policy makes the file use
+// the renter's policy. Lowering a file's redundancy does not remove any of its
+// pieces.
+func (r *Renter) SetRedundancyPolicy(nickname string, policy modules.RedundancyPolicy) error {
+	if err := r.addThread(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	if err := validateRedundancyPolicy(policy); err != nil {
+		return err
+	}
+	lockID := r.mu.Lock()
+	f, exists := r.files[nickname]
+	if !exists {
+		r.mu.Unlock(lockID)
+		return ErrUnknownPath
+	}
+	f.mu.Lock()
+	if f.sealed {
+		f.mu.Unlock()
+		r.mu.Unlock(lockID)
+		return ErrFileSealed
+	}
+	f.policy = policy
+	f.mu.Unlock()
+	err := r.save()
+	r.mu.Unlock(lockID)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case r.newRepairs <- f:
+	case <-r.tg.StopChan():
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package renter
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestRepairThresholds checks the number of pieces that chunks are repaired
+// below and up to under various redundancy policies.
+func TestRepairThresholds(t *testing.T) {
+	rsc, _ := NewRSCode(2, 4)
+	tests := []struct {
+		policy            modules.RedundancyPolicy
+		minPieces, target int
+	}{
+		{modules.RedundancyPolicy{}, 6, 6},
+		{modules.RedundancyPolicy{TargetRedundancy: 2}, 4, 4},
+		{modules.RedundancyPolicy{MinRedundancy: 1.5}, 3, 6},
+		{modules.RedundancyPolicy{MinRedundancy: 1.2, TargetRedundancy: 2.5}, 3, 5},
+		{modules.RedundancyPolicy{MinRedundancy: 10, TargetRedundancy: 10}, 6, 6},
+	}
+	for _, test := range tests {
+		if err := validateRedundancyPolicy(test.policy); err != nil {
+			t.Fatal(err)
+		}
+		minPieces, target := repairThresholds(test.policy, rsc)
+		if minPieces != test.minPieces || target != test.target {
+			t.Errorf("%+v: expected thresholds %v and %v, got %v and %v", test.policy, test.minPieces, test.target, minPieces, target)
+		}
+	}
+
+	for _, policy := range []modules.RedundancyPolicy{
+		{MinRedundancy: 0.5},
+		{TargetRedundancy: -1},
+		{MinRedundancy: 3, TargetRedundancy: 2},
+	} {
+		if err := validateRedundancyPolicy(policy); err != errBadRedundancyPolicy {
+			t.Errorf("%+v: expected errBadRedundancyPolicy, got %v", policy, err)
+		}
+	}
+}
+
+// TestRenterRedundancyPolicy checks that the repair loop repairs files
+// according to their own redundancy policy or the renter's, and that the
+// policies are persisted.
+func TestRenterRedundancyPolicy(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newContractorTester(t.Name(), closeHostDB{}, allowanceContractor{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Add a tracked file whose only chunk has 3 of its 6 pieces.
+	rsc, _ := NewRSCode(2, 4)
+	f := &file{
+		name:        "one",
+		size:        1,
+		pieceSize:   1,
+		erasureCode: rsc,
+		contracts: map[types.FileContractID]fileContract{
+			{1}: {ID: types.FileContractID{1}, IP: "foo:1", Pieces: []pieceData{{Chunk: 0, Piece: 0}, {Chunk: 0, Piece: 1}, {Chunk: 0, Piece: 2}}},
+		},
+	}
+	id := rt.renter.mu.Lock()
+	rt.renter.files[f.name] = f
+	rt.renter.tracking[f.name] = trackedFile{}
+	rt.renter.mu.Unlock(id)
+
+	incomplete := func() *chunkStatus {
+		rs := &repairState{
+			activeWorkers:    make(map[types.FileContractID]*worker),
+			availableWorkers: make(map[types.FileContractID]*worker),
+			gapCounts:        make(map[int]int),
+			incompleteChunks: make(map[chunkID]*chunkStatus),
+		}
+		id := rt.renter.mu.Lock()
+		rt.renter.addFileToRepairState(rs, f)
+		rt.renter.mu.Unlock(id)
+		return rs.incompleteChunks[chunkID{0, f.key()}]
+	}
+
+	// The renter's policy applies to files without their own.
+	if err := rt.renter.SetSettings(modules.RenterSettings{Redundancy: modules.RedundancyPolicy{MinRedundancy: 0.5}}); err != errBadRedundancyPolicy {
+		t.Fatal("expected errBadRedundancyPolicy, got", err)
+	}
+	if err := rt.renter.SetSettings(modules.RenterSettings{Redundancy: modules.RedundancyPolicy{TargetRedundancy: 2, Archival: true}}); err != nil {
+		t.Fatal(err)
+	}
+	if cs := incomplete(); cs == nil || cs.totalPieces != 4 || !cs.archival {
+		t.Fatalf("expected an archival chunk repaired up to 4 pieces, got %+v", cs)
+	}
+
+	// The file's own policy overrides the renter's.
+	if err := rt.renter.SetRedundancyPolicy("two", modules.RedundancyPolicy{}); err != ErrUnknownPath {
+		t.Fatal("expected ErrUnknownPath, got", err)
+	}
+	policy := modules.RedundancyPolicy{MinRedundancy: 1.5}
+	if err := rt.renter.SetRedundancyPolicy("one", policy); err != nil {
+		t.Fatal(err)
+	}
+	if cs := incomplete(); cs != nil {
+		t.Fatal("chunk above its minimum redundancy is being repaired")
+	}
+	if files := rt.renter.FileList(); files[0].RedundancyPolicy != policy {
+		t.Fatal("wrong redundancy policy:", files[0].RedundancyPolicy)
+	}
+
+	// Both policies are persisted.
+	id = rt.renter.mu.Lock()
+	f.policy = modules.RedundancyPolicy{}
+	rt.renter.policy = modules.RedundancyPolicy{}
+	err = rt.renter.load()
+	rt.renter.mu.Unlock(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rt.renter.FileList()[0].RedundancyPolicy != policy || !rt.renter.Settings().Redundancy.Archival {
+		t.Fatal("redundancy policies were not persisted:", rt.renter.Settings().Redundancy)
+	}
+}
+
+// TestCheapWorkers checks that archival chunks are only repaired using the
+// workers whose hosts have the cheaper storage prices.
+func TestCheapWorkers(t *testing.T) {
+	hdb := interactionHostDB{hosts: map[string]modules.HostDBEntry{
+		"a": {HostExternalSettings: modules.HostExternalSettings{StoragePrice: types.NewCurrency64(1)}},
+		"b": {HostExternalSettings: modules.HostExternalSettings{StoragePrice: types.NewCurrency64(2)}},
+		"c": {HostExternalSettings: modules.HostExternalSettings{StoragePrice: types.NewCurrency64(3)}},
+		"d": {HostExternalSettings: modules.HostExternalSettings{StoragePrice: types.NewCurrency64(4)}},
+	}}
+	r := &Renter{hostDB: hdb}
+	rs := &repairState{
+		activeWorkers:    make(map[types.FileContractID]*worker),
+		availableWorkers: make(map[types.FileContractID]*worker),
+	}
+	for i, key := range []string{"a", "b", "c", "d", "unknown"} {
+		id := types.FileContractID{byte(i)}
+		w := &worker{contract: modules.RenterContract{HostPublicKey: types.SiaPublicKey{Key: []byte(key)}}}
+		if i == 0 {
+			rs.activeWorkers[id] = w
+		} else {
+			rs.availableWorkers[id] = w
+		}
+	}
+	r.managedUpdateCheapWorkers(rs)
+	if len(rs.cheapWorkers) != 2 {
+		t.Fatal("expected the 2 cheapest workers, got", rs.cheapWorkers)
+	}
+	for _, id := range []types.FileContractID{{0}, {1}} {
+		if _, cheap := rs.cheapWorkers[id]; !cheap {
+			t.Fatal("cheap worker is missing:", id)
+		}
+	}
+
+	// An archival chunk that is stored by a cheap worker only has one gap,
+	// while other chunks can use every worker.
+	cs := &chunkStatus{
+		contracts:   map[types.FileContractID]struct{}{{0}: {}},
+		pieces:      map[uint64]struct{}{0: {}},
+		totalPieces: 6,
+		archival:    true,
+	}
+	if gaps := cs.numGaps(rs); gaps != 1 {
+		t.Fatal("expected 1 gap for the archival chunk, got", gaps)
+	}
+	cs.archival = false
+	if gaps := cs.numGaps(rs); gaps != 4 {
+		t.Fatal("expected 4 gaps, got", gaps)
+	}
+}
@@ -0,0 +1,104 @@
+package renter
+
+import (
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// interactionReliability estimates the probability that a host will keep
+// serving its pieces, based on the host's historic and recent interactions.
+// The estimate is (successes+1) / (successes+failures+2), so that a host
+// without any interactions has a reliability of 0.5.
+func interactionReliability(entry modules.HostDBEntry) float64 {
+	successes := float64(entry.HistoricSuccessfulInteractions + entry.RecentSuccessfulInteractions)
+	failures := float64(entry.HistoricFailedInteractions + entry.RecentFailedInteractions)
+	return (successes + 1) / (successes + failures + 2)
+}
+
+// reliability estimates the probability that every chunk of the file remains
+// recoverable. hostReliability returns the reliability of the host storing a
+// contract, and false if the pieces in the contract are not available.
+//
+// Hosts are assumed to fail independently. A piece survives if any of its
+// copies survives, so a piece stored on hosts with reliabilities p1...pn
+// survives with probability 1 - (1-p1)...(1-pn). A chunk survives if at least
+// MinPieces of its distinct pieces survive, which is computed exactly from the
+// piece probabilities. The reliability of the file is the product of the
+// reliabilities of its chunks.
+func (f *file) reliability(hostReliability func(types.FileContractID) (float64, bool)) float64 {
+	// Compute the probability that each piece of each chunk is lost.
+	numChunks := f.numChunks()
+	pieceLoss := make([]map[uint64]float64, numChunks)
+	for _, fc := range f.contracts {
+		p, ok := hostReliability(fc.ID)
+		if !ok {
+			continue
+		}
+		for _, pd := range fc.Pieces {
+			if pd.Chunk >= numChunks {
+				continue
+			}
+			if pieceLoss[pd.Chunk] == nil {
+				pieceLoss[pd.Chunk] = make(map[uint64]float64)
+			}
+			loss, exists := pieceLoss[pd.Chunk][pd.Piece]
+			if !exists {
+				loss = 1
+			}
+			pieceLoss[pd.Chunk][pd.Piece] = loss * (1 - p)
+		}
+	}
+
+	minPieces := f.erasureCode.MinPieces()
+	reliability := 1.0
+	for _, losses := range pieceLoss {
+		// survivors[i] is the probability that exactly i of the pieces
+		// considered so far survive.
+		survivors := []float64{1}
+		for _, loss := range losses {
+			next := make([]float64, len(survivors)+1)
+			for i, prob := range survivors {
+				next[i] += prob * loss
+				next[i+1] += prob * (1 - loss)
+			}
+			survivors = next
+		}
+		var chunkReliability float64
+		for i := minPieces; i < len(survivors); i++ {
+			chunkReliability += survivors[i]
+		}
+		reliability *= chunkReliability
+	}
+	return reliability
+}
+
+// FileReliability returns an estimate of the probability that the file with
+// the given nickname remains recoverable, based on the interaction history of
+// the hosts storing its pieces. Only pieces in online contracts are counted.
+// See the reliability method of the file type for how the estimate is
+// computed.
+func (r *Renter) FileReliability(nickname string) (float64, error) {
+	lockID := r.mu.RLock()
+	f, exists := r.files[nickname]
+	r.mu.RUnlock(lockID)
+	if !exists {
+		return 0, ErrUnknownPath
+	}
+
+	hostReliability := func(id types.FileContractID) (float64, bool) {
+		if r.contractOffline(id) {
+			return 0, false
+		}
+		contract, _ := r.hostContractor.ContractByID(r.hostContractor.ResolveID(id))
+		entry, exists := r.hostDB.Host(contract.HostPublicKey)
+		if !exists {
+			// Use the reliability of a host without any interactions.
+			return interactionReliability(modules.HostDBEntry{}), true
+		}
+		return interactionReliability(entry), true
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.reliability(hostReliability), nil
+}
@@ -0,0 +1,115 @@
+package renter
+
+import (
+	"math"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestInteractionReliability checks the interactionReliability function.
+func TestInteractionReliability(t *testing.T) {
+	tests := []struct {
+		entry modules.HostDBEntry
+		exp   float64
+	}{
+		{modules.HostDBEntry{}, 0.5},
+		{modules.HostDBEntry{HistoricSuccessfulInteractions: 3, HistoricFailedInteractions: 1}, 4.0 / 6},
+		{modules.HostDBEntry{HistoricSuccessfulInteractions: 2, RecentSuccessfulInteractions: 6}, 9.0 / 10},
+		{modules.HostDBEntry{HistoricFailedInteractions: 4, RecentFailedInteractions: 4}, 1.0 / 10},
+	}
+	for _, test := range tests {
+		if r := interactionReliability(test.entry); math.Abs(r-test.exp) > 1e-9 {
+			t.Errorf("expected %v, got %v", test.exp, r)
+		}
+	}
+}
+
+// TestFileReliability probes the reliability method of the file type using
+// hosts with mixed reliabilities.
+func TestFileReliability(t *testing.T) {
+	hosts := map[types.FileContractID]float64{
+		{1}: 0.9,
+		{2}: 0.5,
+		{3}: 0.8,
+	}
+	hostReliability := func(id types.FileContractID) (float64, bool) {
+		p, ok := hosts[id]
+		return p, ok
+	}
+
+	// A file that needs 2 of its 3 pieces. The chunk survives if all three
+	// hosts survive (0.36) or exactly two of them survive (0.49).
+	rsc, _ := NewRSCode(2, 1)
+	f := &file{
+		size:        200,
+		pieceSize:   100,
+		erasureCode: rsc,
+		contracts: map[types.FileContractID]fileContract{
+			{1}: {ID: types.FileContractID{1}, Pieces: []pieceData{{Chunk: 0, Piece: 0}}},
+			{2}: {ID: types.FileContractID{2}, Pieces: []pieceData{{Chunk: 0, Piece: 1}}},
+			{3}: {ID: types.FileContractID{3}, Pieces: []pieceData{{Chunk: 0, Piece: 2}}},
+			// a contract that is not available
+			{4}: {ID: types.FileContractID{4}, Pieces: []pieceData{{Chunk: 0, Piece: 2}}},
+		},
+	}
+	if r := f.reliability(hostReliability); math.Abs(r-0.85) > 1e-9 {
+		t.Error("expected reliability 0.85, got", r)
+	}
+
+	// Storing a second copy of piece 1 on the 0.8 host means that piece 1 is
+	// only lost if both hosts fail (0.1), and piece 2 is lost with the 0.8
+	// host. The chunk survives unless at least two pieces are lost.
+	fc := f.contracts[types.FileContractID{3}]
+	fc.Pieces = append(fc.Pieces, pieceData{Chunk: 0, Piece: 1})
+	f.contracts[types.FileContractID{3}] = fc
+	exp := 1 - (0.1*0.1*0.2 + 0.1*0.1*0.8 + 0.1*0.9*0.2 + 0.9*0.1*0.2)
+	if r := f.reliability(hostReliability); math.Abs(r-exp) > 1e-9 {
+		t.Errorf("expected reliability %v, got %v", exp, r)
+	}
+
+	// A file with two chunks, one of which has no pieces, cannot survive.
+	f.size = 400
+	if r := f.reliability(hostReliability); r != 0 {
+		t.Error("expected reliability 0 for a file with a missing chunk, got", r)
+	}
+}
+
+// TestRenterFileReliability probes the FileReliability method of the renter
+// type.
+func TestRenterFileReliability(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	if _, err := rt.renter.FileReliability("one"); err != ErrUnknownPath {
+		t.Fatal("expected ErrUnknownPath, got", err)
+	}
+
+	// The renter has no contracts, so none of the pieces are available.
+	rsc, _ := NewRSCode(1, 1)
+	id := rt.renter.mu.Lock()
+	rt.renter.files["one"] = &file{
+		name:        "one",
+		size:        1,
+		pieceSize:   1,
+		erasureCode: rsc,
+		contracts: map[types.FileContractID]fileContract{
+			{1}: {ID: types.FileContractID{1}, Pieces: []pieceData{{Chunk: 0, Piece: 0}}},
+		},
+	}
+	rt.renter.mu.Unlock(id)
+	r, err := rt.renter.FileReliability("one")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r != 0 {
+		t.Error("expected reliability 0, got", r)
+	}
+}
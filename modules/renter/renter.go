@@ -9,21 +9,31 @@ package renter
 
 import (
 	"errors"
+	"path/filepath"
 
 	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/modules/renter/contractor"
 	"github.com/NebulousLabs/Sia/modules/renter/hostdb"
+	"github.com/NebulousLabs/Sia/modules/renter/proto"
 	"github.com/NebulousLabs/Sia/persist"
 	"github.com/NebulousLabs/Sia/sync"
 	"github.com/NebulousLabs/Sia/types"
 )
 
 var (
+	// ErrRenterClosed is returned by methods that modify the renter after it
+	// has been closed.
+	ErrRenterClosed = errors.New("renter has been closed")
+
 	errNilContractor = errors.New("cannot create renter with nil contractor")
 	errNilCS         = errors.New("cannot create renter with nil consensus set")
 	errNilTpool      = errors.New("cannot create renter with nil transaction pool")
 	errNilHdb        = errors.New("cannot create renter with nil hostdb")
+
+	errNegativeSpeed   = errors.New("bandwidth limits cannot be negative")
+	errNegativeWorkers = errors.New("worker limits cannot be negative")
 )
 
 var (
@@ -70,6 +80,18 @@ type hostDB interface {
 	// EstimateHostScore returns the estimated score breakdown of a host with the
 	// provided settings.
 	EstimateHostScore(modules.HostDBEntry) modules.HostScoreBreakdown
+
+	// ScoreWeights returns the weights of the components of the host scores.
+	ScoreWeights() modules.HostScoreWeights
+
+	// SetScoreWeights changes the weights of the components of the host
+	// scores.
+	SetScoreWeights(modules.HostScoreWeights) error
+
+	// IncrementSuccessfulInteractions and IncrementFailedInteractions record
+	// the outcome of an interaction with a host, such as an audit.
+	IncrementSuccessfulInteractions(types.SiaPublicKey)
+	IncrementFailedInteractions(types.SiaPublicKey)
 }
 
 // A hostContractor negotiates, revises, renews, and provides access to file
@@ -126,6 +148,10 @@ type hostContractor interface {
 type trackedFile struct {
 	// location of original file on disk
 	RepairPath string
+
+	// Dedup indicates that the chunks of the file reuse the pieces of
+	// identical chunks that were already uploaded.
+	Dedup bool `json:",omitempty"`
 }
 
 // A Renter is responsible for tracking all of the files that a user has
@@ -138,6 +164,10 @@ type Renter struct {
 	files    map[string]*file
 	tracking map[string]trackedFile // map from nickname to metadata
 
+	// dirs contains the directories created using CreateDir. Directories
+	// that contain files exist regardless.
+	dirs map[string]struct{}
+
 	// Work management.
 	//
 	// chunkQueue contains a list of incomplete work that the download loop acts
@@ -145,12 +175,80 @@ type Renter struct {
 	// thread, which means it can be accessed and updated without locks.
 	//
 	// downloadQueue contains a complete history of work that has been
-	// submitted to the download loop.
-	chunkQueue    []*chunkDownload // Accessed without locks.
-	downloadQueue []*download
-	newDownloads  chan *download
-	newRepairs    chan *file
-	workerPool    map[types.FileContractID]*worker
+	// submitted to the download loop. lastDownloadID is the ID of the most
+	// recently queued download.
+	chunkQueue     []*chunkDownload // Accessed without locks.
+	downloadQueue  []*download
+	lastDownloadID uint64
+	newDownloads   chan *download
+	newRepairs     chan *file
+	workerPool     map[types.FileContractID]*worker
+
+	// nicknameValidator is run on every nickname before it is accepted by
+	// the renter.
+	nicknameValidator func(string) error
+
+	// hostUnusedHook, if set, is called with the key of every host that no
+	// longer stores pieces of any file after files are deleted.
+	hostUnusedHook func(types.SiaPublicKey)
+
+	// offlineHosts contains the hosts that have been marked offline. It is
+	// protected by its own lock.
+	offlineHosts offlineHostSet
+
+	// repairStarts records when the repair of each chunk started. It is
+	// protected by its own lock.
+	repairStarts repairTimes
+
+	// failingHosts contains the hosts whose pieces are being migrated to
+	// other hosts, and migrations records when each migration started. The
+	// set is protected by its own lock, and migrations by the renter's lock.
+	failingHosts offlineHostSet
+	migrations   []modules.HostMigration
+
+	// maxDownloadSpeed and maxUploadSpeed are the bandwidth limits set using
+	// SetSettings, in bytes per second.
+	maxDownloadSpeed int64
+	maxUploadSpeed   int64
+
+	// rateLimit enforces maxDownloadSpeed and maxUploadSpeed. It is shared
+	// with the contractor, which passes it to its editors and downloaders.
+	rateLimit *proto.RateLimit
+
+	// chunkCache caches recently downloaded chunks on disk. cacheSize is its
+	// maximum size in bytes, set using SetSettings.
+	chunkCache *chunkCache
+	cacheSize  uint64
+
+	// maxUploadWorkers and maxDownloadWorkers are the limits on the number of
+	// pieces in transit set using SetSettings. 0 selects the defaults.
+	maxUploadWorkers   int
+	maxDownloadWorkers int
+
+	// policy is the redundancy policy of the files that do not have their
+	// own, set using SetSettings.
+	policy modules.RedundancyPolicy
+
+	// schedule restricts when files are uploaded and repaired, set using
+	// SetSettings.
+	schedule modules.RepairSchedule
+
+	// chunkIndex maps the dedup hash of each uploaded chunk to the chunk, so
+	// that uploads with deduplication can reuse its pieces.
+	chunkIndex map[string]chunkIndexEntry
+
+	// buckets maps the name of each bucket to the hash of its key. A bucket's
+	// files are in the namespace with the bucket's name.
+	buckets map[string]crypto.Hash
+
+	// Persistence throttling.
+	//
+	// While autoFlush is set, changes to the renter's metadata only set dirty,
+	// and are saved by the next call to Flush. autoFlushStop stops the thread
+	// started by StartAutoFlush.
+	autoFlush     bool
+	autoFlushStop chan struct{}
+	dirty         bool
 
 	// Utilities.
 	cs             modules.ConsensusSet
@@ -169,16 +267,18 @@ func New(g modules.Gateway, cs modules.ConsensusSet, wallet modules.Wallet, tpoo
 	if err != nil {
 		return nil, err
 	}
-	hc, err := contractor.New(cs, wallet, tpool, hdb, persistDir)
+	rl := proto.NewRateLimit(0, 0)
+	hc, err := contractor.New(cs, wallet, tpool, hdb, rl, persistDir)
 	if err != nil {
 		return nil, err
 	}
 
-	return newRenter(cs, tpool, hdb, hc, persistDir)
+	return newRenter(cs, tpool, hdb, hc, rl, persistDir)
 }
 
-// newRenter initializes a renter and returns it.
-func newRenter(cs modules.ConsensusSet, tpool modules.TransactionPool, hdb hostDB, hc hostContractor, persistDir string) (*Renter, error) {
+// newRenter initializes a renter and returns it. rl must be the RateLimit used
+// by hc.
+func newRenter(cs modules.ConsensusSet, tpool modules.TransactionPool, hdb hostDB, hc hostContractor, rl *proto.RateLimit, persistDir string) (*Renter, error) {
 	if cs == nil {
 		return nil, errNilCS
 	}
@@ -197,18 +297,30 @@ func newRenter(cs modules.ConsensusSet, tpool modules.TransactionPool, hdb hostD
 		newRepairs: make(chan *file),
 		files:      make(map[string]*file),
 		tracking:   make(map[string]trackedFile),
+		dirs:       make(map[string]struct{}),
+		chunkIndex: make(map[string]chunkIndexEntry),
+		buckets:    make(map[string]crypto.Hash),
 
 		newDownloads: make(chan *download),
 		workerPool:   make(map[types.FileContractID]*worker),
+		chunkCache:   newChunkCache(filepath.Join(persistDir, chunkCacheDir)),
+
+		nicknameValidator: defaultNicknameValidator,
 
 		cs:             cs,
 		hostDB:         hdb,
 		hostContractor: hc,
+		rateLimit:      rl,
 		persistDir:     persistDir,
 		mu:             sync.New(modules.SafeMutexDelay, 1),
 		tg:             new(sync.ThreadGroup),
 		tpool:          tpool,
 	}
+	// Counting the callers waiting for the lock costs an extra lock per call,
+	// so it is only enabled in debug builds.
+	if build.DEBUG {
+		r.mu.CountWaiting()
+	}
 	if err := r.initPersist(); err != nil {
 		return nil, err
 	}
@@ -219,6 +331,8 @@ func newRenter(cs modules.ConsensusSet, tpool modules.TransactionPool, hdb hostD
 	go r.threadedRepairLoop()
 	go r.threadedDownloadLoop()
 	go r.threadedQueueRepairs()
+	go r.threadedMigrateFailingHosts()
+	go r.threadedAuditHosts()
 
 	// Kill workers on shutdown.
 	r.tg.OnStop(func() {
@@ -232,11 +346,20 @@ func newRenter(cs modules.ConsensusSet, tpool modules.TransactionPool, hdb hostD
 	return r, nil
 }
 
-// Close closes the Renter and its dependencies
+// Close closes the Renter and its dependencies. It waits for the methods that
+// are modifying the renter to return and for the background threads to exit,
+// and then saves any metadata that has not been saved yet. Calling Close
+// again returns ErrRenterClosed.
 func (r *Renter) Close() error {
-	r.tg.Stop()
+	if r.tg.Stop() != nil {
+		return ErrRenterClosed
+	}
+	flushErr := r.Flush()
 	r.hostDB.Close()
-	return r.hostContractor.Close()
+	if err := r.hostContractor.Close(); err != nil {
+		return err
+	}
+	return flushErr
 }
 
 // PriceEstimation estimates the cost in siacoins of performing various storage
@@ -298,6 +421,22 @@ func (r *Renter) PriceEstimation() modules.RenterPriceEstimation {
 
 // SetSettings will update the settings for the renter.
 func (r *Renter) SetSettings(s modules.RenterSettings) error {
+	if err := r.addThread(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	if s.MaxDownloadSpeed < 0 || s.MaxUploadSpeed < 0 {
+		return errNegativeSpeed
+	}
+	if s.MaxUploadWorkers < 0 || s.MaxDownloadWorkers < 0 {
+		return errNegativeWorkers
+	}
+	if err := validateRedundancyPolicy(s.Redundancy); err != nil {
+		return err
+	}
+	if err := validateRepairSchedule(s.RepairSchedule); err != nil {
+		return err
+	}
 	err := r.hostContractor.SetAllowance(s.Allowance)
 	if err != nil {
 		return err
@@ -306,10 +445,61 @@ func (r *Renter) SetSettings(s modules.RenterSettings) error {
 	contracts := r.hostContractor.Contracts()
 	id := r.mu.Lock()
 	r.updateWorkerPool(contracts)
+	r.maxDownloadSpeed, r.maxUploadSpeed = s.MaxDownloadSpeed, s.MaxUploadSpeed
+	r.rateLimit.SetLimits(s.MaxDownloadSpeed, s.MaxUploadSpeed)
+	r.maxUploadWorkers, r.maxDownloadWorkers = s.MaxUploadWorkers, s.MaxDownloadWorkers
+	r.policy = s.Redundancy
+	r.schedule = s.RepairSchedule
+	err = r.chunkCache.setMaxSize(s.CacheSize)
+	if err == nil {
+		r.cacheSize = s.CacheSize
+		err = r.save()
+	}
 	r.mu.Unlock(id)
+	return err
+}
+
+// addThread registers a call that modifies the renter with the renter's thread
+// group, so that Close waits for it to return. ErrRenterClosed is returned if
+// the renter has been closed. A successful call must be matched by a call to
+// r.tg.Done.
+func (r *Renter) addThread() error {
+	if r.tg.Add() != nil {
+		return ErrRenterClosed
+	}
 	return nil
 }
 
+// SetNicknameValidator sets the function that is used to validate nicknames
+// when files are uploaded, renamed, or imported. The validator's error is
+// returned to the caller when a nickname is rejected. A nil validator restores
+// the default, which rejects empty nicknames and nicknames containing NUL
+// bytes.
+func (r *Renter) SetNicknameValidator(validator func(string) error) {
+	if validator == nil {
+		validator = defaultNicknameValidator
+	}
+	id := r.mu.Lock()
+	r.nicknameValidator = validator
+	r.mu.Unlock(id)
+}
+
+// SetHostUnusedHook sets a function that is called with the public key of
+// every host that no longer stores pieces of any file after files are deleted,
+// such as HostDB.NoteHostUnused. A nil hook, the default, disables the calls.
+func (r *Renter) SetHostUnusedHook(hook func(types.SiaPublicKey)) {
+	id := r.mu.Lock()
+	r.hostUnusedHook = hook
+	r.mu.Unlock(id)
+}
+
+// LockStats returns the callers that currently hold the renter's lock, and, in
+// debug builds, the number of callers waiting for it. It can be used to find
+// deadlocks and locks that are held for too long.
+func (r *Renter) LockStats() sync.LockStats {
+	return r.mu.Stats()
+}
+
 // hostdb passthroughs
 func (r *Renter) ActiveHosts() []modules.HostDBEntry                      { return r.hostDB.ActiveHosts() }
 func (r *Renter) AllHosts() []modules.HostDBEntry                         { return r.hostDB.AllHosts() }
@@ -320,13 +510,26 @@ func (r *Renter) ScoreBreakdown(e modules.HostDBEntry) modules.HostScoreBreakdow
 func (r *Renter) EstimateHostScore(e modules.HostDBEntry) modules.HostScoreBreakdown {
 	return r.hostDB.EstimateHostScore(e)
 }
+func (r *Renter) HostScoreWeights() modules.HostScoreWeights { return r.hostDB.ScoreWeights() }
+func (r *Renter) SetHostScoreWeights(w modules.HostScoreWeights) error {
+	return r.hostDB.SetScoreWeights(w)
+}
 
 // contractor passthroughs
 func (r *Renter) Contracts() []modules.RenterContract { return r.hostContractor.Contracts() }
 func (r *Renter) CurrentPeriod() types.BlockHeight    { return r.hostContractor.CurrentPeriod() }
 func (r *Renter) Settings() modules.RenterSettings {
+	id := r.mu.RLock()
+	defer r.mu.RUnlock(id)
 	return modules.RenterSettings{
-		Allowance: r.hostContractor.Allowance(),
+		Allowance:          r.hostContractor.Allowance(),
+		MaxDownloadSpeed:   r.maxDownloadSpeed,
+		MaxUploadSpeed:     r.maxUploadSpeed,
+		CacheSize:          r.cacheSize,
+		MaxUploadWorkers:   r.maxUploadWorkers,
+		MaxDownloadWorkers: r.maxDownloadWorkers,
+		Redundancy:         r.policy,
+		RepairSchedule:     r.schedule,
 	}
 }
 func (r *Renter) AllContracts() []modules.RenterContract {
@@ -2,6 +2,7 @@ package renter
 
 import (
 	"path/filepath"
+	"testing"
 
 	"github.com/NebulousLabs/Sia/build"
 	"github.com/NebulousLabs/Sia/crypto"
@@ -10,6 +11,7 @@ import (
 	"github.com/NebulousLabs/Sia/modules/gateway"
 	"github.com/NebulousLabs/Sia/modules/miner"
 	"github.com/NebulousLabs/Sia/modules/renter/contractor"
+	"github.com/NebulousLabs/Sia/modules/renter/proto"
 	"github.com/NebulousLabs/Sia/modules/transactionpool"
 	"github.com/NebulousLabs/Sia/modules/wallet"
 	"github.com/NebulousLabs/Sia/types"
@@ -125,7 +127,7 @@ func newContractorTester(name string, hdb hostDB, hc hostContractor) (*renterTes
 	if err != nil {
 		return nil, err
 	}
-	r, err := newRenter(cs, tp, hdb, hc, filepath.Join(testdir, modules.RenterDir))
+	r, err := newRenter(cs, tp, hdb, hc, proto.NewRateLimit(0, 0), filepath.Join(testdir, modules.RenterDir))
 	if err != nil {
 		return nil, err
 	}
@@ -182,3 +184,108 @@ func (stubContractor) Editor(types.FileContractID) (contractor.Editor, error) {
 func (stubContractor) Downloader(types.FileContractID) (contractor.Downloader, error) {
 	return nil, nil
 }
+
+// allowanceContractor is an onlineContractor that accepts any allowance.
+type allowanceContractor struct {
+	onlineContractor
+}
+
+func (allowanceContractor) Allowance() modules.Allowance         { return modules.Allowance{} }
+func (allowanceContractor) SetAllowance(modules.Allowance) error { return nil }
+
+// TestRenterBandwidthLimits checks that the bandwidth limits set using
+// SetSettings are validated and persisted.
+func TestRenterBandwidthLimits(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newContractorTester(t.Name(), closeHostDB{}, allowanceContractor{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	if err := rt.renter.SetSettings(modules.RenterSettings{MaxDownloadSpeed: -1}); err != errNegativeSpeed {
+		t.Fatal("expected errNegativeSpeed, got", err)
+	}
+	if err := rt.renter.SetSettings(modules.RenterSettings{MaxDownloadSpeed: 1000, MaxUploadSpeed: 2000}); err != nil {
+		t.Fatal(err)
+	}
+	if s := rt.renter.Settings(); s.MaxDownloadSpeed != 1000 || s.MaxUploadSpeed != 2000 {
+		t.Fatal("wrong limits:", s.MaxDownloadSpeed, s.MaxUploadSpeed)
+	}
+
+	rt.renter.maxDownloadSpeed, rt.renter.maxUploadSpeed = 0, 0
+	id := rt.renter.mu.Lock()
+	err = rt.renter.load()
+	rt.renter.mu.Unlock(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := rt.renter.Settings(); s.MaxDownloadSpeed != 1000 || s.MaxUploadSpeed != 2000 {
+		t.Fatal("limits were not persisted:", s.MaxDownloadSpeed, s.MaxUploadSpeed)
+	}
+}
+
+// TestRenterWorkerLimits checks that the worker limits set using SetSettings
+// are validated and persisted.
+func TestRenterWorkerLimits(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newContractorTester(t.Name(), closeHostDB{}, allowanceContractor{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	if err := rt.renter.SetSettings(modules.RenterSettings{MaxUploadWorkers: -1}); err != errNegativeWorkers {
+		t.Fatal("expected errNegativeWorkers, got", err)
+	}
+	if err := rt.renter.SetSettings(modules.RenterSettings{MaxUploadWorkers: 3, MaxDownloadWorkers: 4}); err != nil {
+		t.Fatal(err)
+	}
+
+	id := rt.renter.mu.Lock()
+	rt.renter.maxUploadWorkers, rt.renter.maxDownloadWorkers = 0, 0
+	err = rt.renter.load()
+	rt.renter.mu.Unlock(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := rt.renter.Settings(); s.MaxUploadWorkers != 3 || s.MaxDownloadWorkers != 4 {
+		t.Fatal("limits were not persisted:", s.MaxUploadWorkers, s.MaxDownloadWorkers)
+	}
+}
+
+// TestRenterCacheSize checks that the chunk cache size set using SetSettings
+// is applied to the cache and persisted.
+func TestRenterCacheSize(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newContractorTester(t.Name(), closeHostDB{}, allowanceContractor{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	defer rt.renter.SetSettings(modules.RenterSettings{})
+
+	if err := rt.renter.SetSettings(modules.RenterSettings{CacheSize: 1 << 20}); err != nil {
+		t.Fatal(err)
+	}
+	if s := rt.renter.Settings(); s.CacheSize != 1<<20 || rt.renter.chunkCache.maxSize != 1<<20 {
+		t.Fatal("wrong cache size:", s.CacheSize, rt.renter.chunkCache.maxSize)
+	}
+
+	rt.renter.cacheSize = 0
+	id := rt.renter.mu.Lock()
+	err = rt.renter.load()
+	rt.renter.mu.Unlock(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := rt.renter.Settings(); s.CacheSize != 1<<20 {
+		t.Fatal("cache size was not persisted:", s.CacheSize)
+	}
+}
@@ -9,9 +9,12 @@ import (
 	"errors"
 	"io"
 	"os"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
 )
@@ -20,6 +23,12 @@ var (
 	// errFileDeleted indicates that a chunk which is trying to be repaired
 	// cannot be found in the renter.
 	errFileDeleted = errors.New("cannot repair chunk as the file is not being tracked by the renter")
+
+	// errFileRotated indicates that a chunk which is trying to be repaired
+	// belongs to a file whose key was rotated.
+	errFileRotated = errors.New("cannot repair chunk as the file's key was rotated")
+
+	errSourceMismatch = errors.New("local copy does not match the uploaded file")
 )
 
 type (
@@ -34,18 +43,23 @@ type (
 		//
 		// recordedGaps indicates the value that this chunk has recorded in the
 		// gapCounts map.
+		//
+		// totalPieces is the number of pieces that the chunk is repaired up
+		// to, and archival indicates that the chunk is only repaired using
+		// cheap workers.
 		activePieces int
 		contracts    map[types.FileContractID]struct{}
 		pieces       map[uint64]struct{}
 		recordedGaps int
 		totalPieces  int
+		archival     bool
 	}
 
 	// chunkID can be used to uniquely identify a chunk within the repair
 	// matrix.
 	chunkID struct {
 		index    uint64 // the index of the chunk within its file.
-		filename string
+		filename string // the key of the file in the renter's maps.
 	}
 
 	// repairState tracks a bunch of chunks that are being actively repaired.
@@ -70,8 +84,12 @@ type (
 		// from hosts.
 		//
 		// workerSet tracks the set of workers which can be used for uploading.
+		//
+		// cheapWorkers is the subset of the active and available workers that
+		// can be used to repair archival chunks.
 		activeWorkers     map[types.FileContractID]*worker
 		availableWorkers  map[types.FileContractID]*worker
+		cheapWorkers      map[types.FileContractID]struct{}
 		gapCounts         map[int]int
 		incompleteChunks  map[chunkID]*chunkStatus
 		downloadingChunks map[chunkID]struct{}
@@ -80,17 +98,83 @@ type (
 	}
 )
 
+// repairTimes records when the repair loop started repairing each chunk, and
+// when it last completed the repair of a chunk of each file. It has its own
+// lock, since it is updated by the repair loop without holding the renter's
+// lock.
+type repairTimes struct {
+	started   map[chunkID]time.Time
+	completed map[string]time.Time
+	mu        sync.Mutex
+}
+
+// start records that the repair of cid started at t.
+func (rt *repairTimes) start(cid chunkID, t time.Time) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if rt.started == nil {
+		rt.started = make(map[chunkID]time.Time)
+	}
+	rt.started[cid] = t
+}
+
+// finish records that the repair of cid has finished.
+func (rt *repairTimes) finish(cid chunkID) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	delete(rt.started, cid)
+}
+
+// complete records that the chunk cid reached full redundancy at t.
+func (rt *repairTimes) complete(cid chunkID, t time.Time) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if rt.completed == nil {
+		rt.completed = make(map[string]time.Time)
+	}
+	rt.completed[cid.filename] = t
+}
+
+// lastCompleted returns the last time that a chunk of the file with the given
+// key reached full redundancy, or the zero time if none has since the renter
+// started.
+func (rt *repairTimes) lastCompleted(key string) time.Time {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	return rt.completed[key]
+}
+
+// startedBefore returns the keys of the files with a chunk whose repair
+// started before t.
+func (rt *repairTimes) startedBefore(t time.Time) map[string]struct{} {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	keys := make(map[string]struct{})
+	for cid, started := range rt.started {
+		if started.Before(t) {
+			keys[cid.filename] = struct{}{}
+		}
+	}
+	return keys
+}
+
 // numGaps returns the number of gaps that a chunk has.
 func (cs *chunkStatus) numGaps(rs *repairState) int {
+	// Archival chunks can only use the cheap workers.
 	incompatContracts := 0
 	for contract := range cs.contracts {
 		_, exists1 := rs.activeWorkers[contract]
 		_, exists2 := rs.availableWorkers[contract]
-		if exists1 || exists2 {
+		_, cheap := rs.cheapWorkers[contract]
+		if (exists1 || exists2) && (cheap || !cs.archival) {
 			incompatContracts++
 		}
 	}
-	contractGaps := len(rs.activeWorkers) + len(rs.availableWorkers) - incompatContracts
+	workers := len(rs.activeWorkers) + len(rs.availableWorkers)
+	if cs.archival {
+		workers = len(rs.cheapWorkers)
+	}
+	contractGaps := workers - incompatContracts
 	pieceGaps := cs.totalPieces - len(cs.pieces)
 
 	if contractGaps < pieceGaps {
@@ -104,7 +188,7 @@ func (cs *chunkStatus) numGaps(rs *repairState) int {
 func (r *Renter) addFileToRepairState(rs *repairState, file *file) {
 	// Check that the file is being tracked, and therefor candidate for repair.
 	file.mu.Lock()
-	_, exists := r.tracking[file.name]
+	_, exists := r.tracking[file.key()]
 	file.mu.Unlock()
 	if !exists {
 		// File is not being tracked, don't add it to the repair state.
@@ -136,7 +220,7 @@ func (r *Renter) addFileToRepairState(rs *repairState, file *file) {
 		// offline, we want to record that the chunk has attempted to use this
 		// contract.
 		id := r.hostContractor.ResolveID(contract.ID)
-		stable := !r.hostContractor.IsOffline(id) && r.hostContractor.GoodForRenew(id)
+		stable := !r.hostContractor.IsOffline(id) && r.hostContractor.GoodForRenew(id) && !r.failingHosts.contains(contract.IP)
 
 		// Scan all of the pieces of the contract.
 		for _, piece := range contract.Pieces {
@@ -151,14 +235,17 @@ func (r *Renter) addFileToRepairState(rs *repairState, file *file) {
 
 	// Create the chunkStatus object for each chunk and add it to the set of
 	// incomplete chunks.
+	policy := r.redundancyPolicy(file)
+	minPieces, targetPieces := repairThresholds(policy, file.erasureCode)
 	for i := uint64(0); i < chunkCount; i++ {
-		// Skip this chunk if all pieces have been uploaded.
-		if len(availablePieces[i]) >= file.erasureCode.NumPieces() {
+		// Skip this chunk if its redundancy is above the minimum of the file's
+		// redundancy policy.
+		if len(availablePieces[i]) >= minPieces {
 			continue
 		}
 
 		// Skip this chunk if it's already in the set of incomplete chunks.
-		cid := chunkID{i, file.name}
+		cid := chunkID{i, file.key()}
 		_, exists := rs.incompleteChunks[cid]
 		if exists {
 			continue
@@ -169,10 +256,12 @@ func (r *Renter) addFileToRepairState(rs *repairState, file *file) {
 		cs := &chunkStatus{
 			contracts:   utilizedContracts[i],
 			pieces:      availablePieces[i],
-			totalPieces: file.erasureCode.NumPieces(),
+			totalPieces: targetPieces,
+			archival:    policy.Archival,
 		}
 		cs.recordedGaps = cs.numGaps(rs)
 		rs.incompleteChunks[cid] = cs
+		r.repairStarts.start(cid, time.Now())
 		rs.gapCounts[cs.recordedGaps]++
 	}
 }
@@ -194,10 +283,30 @@ func (r *Renter) managedRepairIteration(rs *repairState) {
 		}
 	}
 
+	// While the repair schedule pauses the repair loop, the pieces in transit
+	// are finished, and new files are added to the repair state, but nothing
+	// is uploaded.
+	if !r.managedRepairAllowed(time.Now()) {
+		if len(rs.activeWorkers) > 0 {
+			r.managedWaitOnRepairWork(rs)
+			return
+		}
+		select {
+		case <-r.tg.StopChan():
+		case file := <-r.newRepairs:
+			id := r.mu.Lock()
+			r.addFileToRepairState(rs, file)
+			r.mu.Unlock(id)
+		case <-time.After(repairScheduleInterval):
+		}
+		return
+	}
+
 	// Reset the available workers.
 	contracts := r.hostContractor.Contracts()
 	id := r.mu.Lock()
 	r.updateWorkerPool(contracts)
+	maxWorkers := r.maxUploadWorkers
 	rs.availableWorkers = make(map[types.FileContractID]*worker)
 	for id, worker := range r.workerPool {
 		// Ignore the workers that are not good for uploading.
@@ -211,6 +320,12 @@ func (r *Renter) managedRepairIteration(rs *repairState) {
 			continue
 		}
 
+		// Ignore workers whose hosts are failing, as their pieces are being
+		// migrated to other hosts.
+		if r.failingHosts.contains(worker.contract.NetAddress) {
+			continue
+		}
+
 		// Ignore workers that have had an upload failure recently. The cooldown
 		// time scales exponentially as the number of consecutive failures grow,
 		// stopping at 10 doublings, or about 17 hours total cooldown.
@@ -225,6 +340,7 @@ func (r *Renter) managedRepairIteration(rs *repairState) {
 		rs.availableWorkers[id] = worker
 	}
 	r.mu.Unlock(id)
+	r.managedUpdateCheapWorkers(rs)
 
 	// Determine the maximum number of gaps of any chunk in the repair matrix.
 	maxGaps := 0
@@ -258,6 +374,7 @@ func (r *Renter) managedRepairIteration(rs *repairState) {
 		// Remove this chunk from the set of incomplete chunks if it has been
 		// completed and there are no workers still working on it.
 		if numGaps == 0 && chunkStatus.activePieces == 0 {
+			r.repairStarts.complete(chunkID, time.Now())
 			chunksToDelete = append(chunksToDelete, chunkID)
 			continue
 		}
@@ -272,7 +389,8 @@ func (r *Renter) managedRepairIteration(rs *repairState) {
 		var usefulWorkers []types.FileContractID
 		for workerID, worker := range rs.availableWorkers {
 			_, exists := chunkStatus.contracts[workerID]
-			if !exists && worker.contract.GoodForUpload {
+			_, cheap := rs.cheapWorkers[workerID]
+			if !exists && worker.contract.GoodForUpload && (cheap || !chunkStatus.archival) {
 				usefulWorkers = append(usefulWorkers, workerID)
 			}
 		}
@@ -289,6 +407,18 @@ func (r *Renter) managedRepairIteration(rs *repairState) {
 			continue
 		}
 
+		// Only use as many workers as the upload limit allows. The pieces
+		// that are left out are uploaded once workers become available.
+		if maxWorkers != 0 {
+			free := maxWorkers - len(rs.activeWorkers)
+			if free <= 0 {
+				continue
+			}
+			if len(usefulWorkers) > free {
+				usefulWorkers = usefulWorkers[:free]
+			}
+		}
+
 		// Send off the work.
 		err := r.managedScheduleChunkRepair(rs, chunkID, chunkStatus, usefulWorkers)
 		if err != nil {
@@ -299,6 +429,7 @@ func (r *Renter) managedRepairIteration(rs *repairState) {
 	}
 	for _, cid := range chunksToDelete {
 		delete(rs.incompleteChunks, cid)
+		r.repairStarts.finish(cid)
 	}
 
 	// Block until some of the workers return.
@@ -314,7 +445,7 @@ func (r *Renter) managedGetChunkData(rs *repairState, file *file, trackedFile tr
 	offset := chunkIndex * file.chunkSize()
 
 	// try to read the chunk from disk
-	f, err := os.Open(trackedFile.RepairPath)
+	f, err := openRepairSource(trackedFile.RepairPath, file.size)
 	if err != nil {
 		// if that fails, try to download the chunk
 		// mark the chunk as being downloaded
@@ -372,6 +503,21 @@ func (r *Renter) managedGetChunkData(rs *repairState, file *file, trackedFile tr
 	return chunkData, nil
 }
 
+// openRepairSource opens the local copy of a file at path, so that chunks can
+// be read from it for repair. A copy whose size differs from the file's has
+// been modified since it was uploaded, and is not used.
+func openRepairSource(path string, size uint64) (*os.File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := f.Stat(); err != nil || uint64(info.Size()) != size {
+		f.Close()
+		return nil, errSourceMismatch
+	}
+	return f, nil
+}
+
 // managedScheduleChunkRepair takes a chunk and schedules some repair on that
 // chunk using the chunk state and a list of workers.
 func (r *Renter) managedScheduleChunkRepair(rs *repairState, chunkID chunkID, chunkStatus *chunkStatus, usefulWorkers []types.FileContractID) error {
@@ -399,6 +545,26 @@ func (r *Renter) managedScheduleChunkRepair(rs *repairState, chunkID chunkID, ch
 		rs.cachedChunks[chunkID] = data
 	}
 
+	// Reuse the pieces of an identical chunk if the file is uploaded with
+	// deduplication and the chunk has not been uploaded yet. The workers
+	// whose contracts store the reused pieces are no longer useful.
+	if meta.Dedup && len(chunkStatus.pieces) == 0 && chunkStatus.activePieces == 0 {
+		if err := r.managedDedupChunk(file, chunkID, chunkStatus, chunkData); err != nil {
+			return build.ExtendErr("unable to deduplicate chunk", err)
+		}
+		var remaining []types.FileContractID
+		for _, id := range usefulWorkers {
+			if _, exists := chunkStatus.contracts[id]; !exists {
+				remaining = append(remaining, id)
+			}
+		}
+		usefulWorkers = remaining
+		numGaps := chunkStatus.numGaps(rs)
+		rs.gapCounts[chunkStatus.recordedGaps]--
+		rs.gapCounts[numGaps]++
+		chunkStatus.recordedGaps = numGaps
+	}
+
 	// Erasure code the pieces.
 	pieces, err := file.erasureCode.Encode(chunkData)
 	if err != nil {
@@ -414,14 +580,29 @@ func (r *Renter) managedScheduleChunkRepair(rs *repairState, chunkID chunkID, ch
 		}
 	}
 
-	// Truncate the pieces so that they match the size of the useful workers.
+	// Only upload the pieces needed to reach the chunk's target, and truncate
+	// the pieces so that they match the size of the useful workers.
+	if needed := chunkStatus.totalPieces - len(chunkStatus.pieces); needed < len(missingPieces) {
+		missingPieces = missingPieces[:needed]
+	}
 	if len(usefulWorkers) < len(missingPieces) {
 		missingPieces = missingPieces[:len(usefulWorkers)]
 	}
 
+	// Record the uploads, unless the file was replaced by RotateKey since it
+	// was looked up.
+	file.mu.Lock()
+	if file.rotated {
+		file.mu.Unlock()
+		return errFileRotated
+	}
+	file.uploads += len(missingPieces)
+	chunkKeys := file.dedupKeys[chunkID.index]
+	file.mu.Unlock()
+
 	// Encrypt the missing pieces.
 	for _, missingPiece := range missingPieces {
-		key := deriveKey(file.masterKey, chunkID.index, uint64(missingPiece))
+		key := pieceKey(file.masterKey, chunkKeys, chunkID.index, uint64(missingPiece))
 		pieces[missingPiece] = key.EncryptBytes(pieces[missingPiece])
 	}
 
@@ -514,6 +695,91 @@ func (r *Renter) managedWaitOnRepairWork(rs *repairState) {
 	rs.incompleteChunks[finishedUpload.chunkID].pieces[finishedUpload.pieceIndex] = struct{}{}
 }
 
+// StuckRepairs returns the nicknames of the files in the default namespace, in
+// sorted order, with a chunk that the repair loop has been repairing for
+// longer than olderThan. A repair that does not finish usually means that the
+// chunk cannot be uploaded to any of the renter's hosts.
+func (r *Renter) StuckRepairs(olderThan time.Duration) []string {
+	keys := r.repairStarts.startedBefore(time.Now().Add(-olderThan))
+
+	lockID := r.mu.RLock()
+	defer r.mu.RUnlock(lockID)
+	var nicknames []string
+	for key := range keys {
+		if f, exists := r.files[key]; exists && f.namespace == "" {
+			nicknames = append(nicknames, f.name)
+		}
+	}
+	sort.Strings(nicknames)
+	return nicknames
+}
+
+// RepairFromDisk sets the local copy of the file with the given nickname, from
+// which the repair loop re-encodes the file's missing pieces instead of
+// downloading them from the file's hosts, and queues the file for repair. The
+// copy must have the same contents as the uploaded file. Imported files are
+// only repaired once a local copy has been set, and files restored from a
+// backup are otherwise repaired from the pieces their hosts can still serve.
+// Compressed files are repaired from the compressed copy they were uploaded
+// from, and cannot be given another.
+func (r *Renter) RepairFromDisk(nickname, path string) error {
+	if err := r.addThread(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	if err := validateSource(path); err != nil {
+		return err
+	}
+	lockID := r.mu.RLock()
+	f, exists := r.files[nickname]
+	r.mu.RUnlock(lockID)
+	if !exists {
+		return ErrUnknownPath
+	} else if f.compressed {
+		return errCompressedRepair
+	}
+
+	// Check the copy against the uploaded file. Files uploaded before
+	// checksums were recorded can only be checked by their size.
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if uint64(info.Size()) != f.size {
+		return errSourceMismatch
+	}
+	if f.checksum != (crypto.Hash{}) {
+		checksum, err := checksumFile(path)
+		if err != nil {
+			return err
+		}
+		if checksum != f.checksum {
+			return errSourceMismatch
+		}
+	}
+
+	lockID = r.mu.Lock()
+	if r.files[nickname] != f {
+		// The file was deleted or replaced while its copy was checked.
+		r.mu.Unlock(lockID)
+		return ErrUnknownPath
+	}
+	tf := r.tracking[nickname]
+	tf.RepairPath = path
+	r.tracking[nickname] = tf
+	err = r.save()
+	r.mu.Unlock(lockID)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case r.newRepairs <- f:
+	case <-r.tg.StopChan():
+	}
+	return nil
+}
+
 // threadedQueueRepairs is a goroutine that runs in the background and
 // continuously adds files to the repair loop, slow enough that it's not a
 // resource burden but fast enough that no file is ever at risk.
@@ -0,0 +1,127 @@
+package renter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestRenterStuckRepairs checks that StuckRepairs reports the files with a
+// chunk that has been repairing for longer than the threshold.
+func TestRenterStuckRepairs(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	rsc, _ := NewRSCode(1, 1)
+	for _, name := range []string{"one", "two"} {
+		id := rt.renter.mu.Lock()
+		rt.renter.files[name] = newFile(name, rsc, 1, 1)
+		rt.renter.mu.Unlock(id)
+	}
+	if stuck := rt.renter.StuckRepairs(0); len(stuck) != 0 {
+		t.Fatal("expected no stuck repairs, got", stuck)
+	}
+
+	// Mark a chunk of each file as repairing, one of them an hour ago.
+	rt.renter.repairStarts.start(chunkID{0, "one"}, time.Now().Add(-time.Hour))
+	rt.renter.repairStarts.start(chunkID{0, "two"}, time.Now())
+	// a repair of a deleted file
+	rt.renter.repairStarts.start(chunkID{0, "three"}, time.Now().Add(-time.Hour))
+
+	if stuck := rt.renter.StuckRepairs(time.Minute); len(stuck) != 1 || stuck[0] != "one" {
+		t.Fatal("expected one to be stuck, got", stuck)
+	}
+	if stuck := rt.renter.StuckRepairs(2 * time.Hour); len(stuck) != 0 {
+		t.Fatal("expected no stuck repairs, got", stuck)
+	}
+
+	// Finished repairs are not stuck.
+	rt.renter.repairStarts.finish(chunkID{0, "one"})
+	if stuck := rt.renter.StuckRepairs(time.Minute); len(stuck) != 0 {
+		t.Fatal("expected no stuck repairs, got", stuck)
+	}
+}
+
+// TestRenterRepairFromDisk checks that RepairFromDisk only accepts local
+// copies that match the uploaded file, and tracks the file for repair from
+// the copy.
+func TestRenterRepairFromDisk(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	dir, err := ioutil.TempDir("", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	source := filepath.Join(dir, "source")
+	if err := ioutil.WriteFile(source, []byte("foo"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	checksum, err := checksumFile(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Add an untracked file, as if it had been restored from a backup.
+	f := newTestingFile()
+	f.name = "foo"
+	f.size = 3
+	f.checksum = checksum
+	id := rt.renter.mu.Lock()
+	rt.renter.files[f.name] = f
+	rt.renter.mu.Unlock(id)
+
+	if err := rt.renter.RepairFromDisk("bar", source); err != ErrUnknownPath {
+		t.Fatal("expected ErrUnknownPath, got", err)
+	}
+	if err := rt.renter.RepairFromDisk("foo", dir); err != errUploadDirectory {
+		t.Fatal("expected errUploadDirectory, got", err)
+	}
+
+	// Copies with different contents are rejected, even if they have the
+	// same size.
+	other := filepath.Join(dir, "other")
+	for _, contents := range []string{"bar", "foobar"} {
+		if err := ioutil.WriteFile(other, []byte(contents), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := rt.renter.RepairFromDisk("foo", other); err != errSourceMismatch {
+			t.Fatal("expected errSourceMismatch, got", err)
+		}
+	}
+
+	if err := rt.renter.RepairFromDisk("foo", source); err != nil {
+		t.Fatal(err)
+	}
+	id = rt.renter.mu.RLock()
+	tf, tracked := rt.renter.tracking["foo"]
+	rt.renter.mu.RUnlock(id)
+	if !tracked || tf.RepairPath != source {
+		t.Fatal("file is not tracked for repair from its copy:", tf)
+	}
+
+	// The repair loop does not read from a copy that has changed size.
+	if _, err := openRepairSource(other, f.size); err != errSourceMismatch {
+		t.Fatal("expected errSourceMismatch, got", err)
+	}
+	rf, err := openRepairSource(source, f.size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rf.Close()
+}
@@ -0,0 +1,56 @@
+package renter
+
+import (
+	"errors"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+var errBadRepairSchedule = errors.New("repair schedule hours must be between 0 and 23")
+
+// validateRepairSchedule checks that the hours of s are hours of the day.
+func validateRepairSchedule(s modules.RepairSchedule) error {
+	if s.StartHour < 0 || s.StartHour > 23 || s.EndHour < 0 || s.EndHour > 23 {
+		return errBadRepairSchedule
+	}
+	return nil
+}
+
+// inRepairWindow reports whether t is within the hours of s.
+func inRepairWindow(s modules.RepairSchedule, t time.Time) bool {
+	hour := t.Hour()
+	switch {
+	case s.StartHour == s.EndHour:
+		return true
+	case s.StartHour < s.EndHour:
+		return s.StartHour <= hour && hour < s.EndHour
+	default:
+		return hour >= s.StartHour || hour < s.EndHour
+	}
+}
+
+// downloadsPending reports whether any of the downloads in the download queue
+// have not yet finished. The renter's lock must be held.
+func (r *Renter) downloadsPending() bool {
+	for _, d := range r.downloadQueue {
+		d.mu.Lock()
+		pending := d.downloadErr == nil && !d.downloadComplete
+		d.mu.Unlock()
+		if pending {
+			return true
+		}
+	}
+	return false
+}
+
+// managedRepairAllowed reports whether the repair schedule allows files to be
+// uploaded and repaired at time t.
+func (r *Renter) managedRepairAllowed(t time.Time) bool {
+	id := r.mu.RLock()
+	defer r.mu.RUnlock(id)
+	if !inRepairWindow(r.schedule, t) {
+		return false
+	}
+	return !r.schedule.LowPriority || !r.downloadsPending()
+}
@@ -0,0 +1,104 @@
+package renter
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// TestInRepairWindow checks the hours during which various repair schedules
+// allow files to be uploaded and repaired.
+func TestInRepairWindow(t *testing.T) {
+	at := func(hour int) time.Time {
+		return time.Date(2017, time.January, 1, hour, 30, 0, 0, time.Local)
+	}
+	tests := []struct {
+		schedule modules.RepairSchedule
+		hour     int
+		allowed  bool
+	}{
+		{modules.RepairSchedule{}, 12, true},
+		{modules.RepairSchedule{StartHour: 5, EndHour: 5}, 4, true},
+		{modules.RepairSchedule{StartHour: 1, EndHour: 6}, 1, true},
+		{modules.RepairSchedule{StartHour: 1, EndHour: 6}, 5, true},
+		{modules.RepairSchedule{StartHour: 1, EndHour: 6}, 6, false},
+		{modules.RepairSchedule{StartHour: 1, EndHour: 6}, 0, false},
+		{modules.RepairSchedule{StartHour: 22, EndHour: 3}, 23, true},
+		{modules.RepairSchedule{StartHour: 22, EndHour: 3}, 2, true},
+		{modules.RepairSchedule{StartHour: 22, EndHour: 3}, 3, false},
+		{modules.RepairSchedule{StartHour: 22, EndHour: 3}, 12, false},
+	}
+	for _, test := range tests {
+		if err := validateRepairSchedule(test.schedule); err != nil {
+			t.Fatal(err)
+		}
+		if allowed := inRepairWindow(test.schedule, at(test.hour)); allowed != test.allowed {
+			t.Errorf("%+v at %v: expected %v, got %v", test.schedule, test.hour, test.allowed, allowed)
+		}
+	}
+
+	for _, schedule := range []modules.RepairSchedule{
+		{StartHour: -1},
+		{EndHour: 24},
+	} {
+		if err := validateRepairSchedule(schedule); err != errBadRepairSchedule {
+			t.Errorf("%+v: expected errBadRepairSchedule, got %v", schedule, err)
+		}
+	}
+}
+
+// TestRenterRepairSchedule checks that low priority schedules pause repairs
+// while downloads are in progress, and that the schedule is persisted.
+func TestRenterRepairSchedule(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newContractorTester(t.Name(), closeHostDB{}, allowanceContractor{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	if err := rt.renter.SetSettings(modules.RenterSettings{RepairSchedule: modules.RepairSchedule{EndHour: 24}}); err != errBadRepairSchedule {
+		t.Fatal("expected errBadRepairSchedule, got", err)
+	}
+	schedule := modules.RepairSchedule{StartHour: 2, EndHour: 4, LowPriority: true}
+	if err := rt.renter.SetSettings(modules.RenterSettings{RepairSchedule: schedule}); err != nil {
+		t.Fatal(err)
+	}
+	inWindow := time.Date(2017, time.January, 1, 3, 0, 0, 0, time.Local)
+	if rt.renter.managedRepairAllowed(time.Date(2017, time.January, 1, 4, 0, 0, 0, time.Local)) {
+		t.Fatal("repairs allowed outside of the schedule's hours")
+	} else if !rt.renter.managedRepairAllowed(inWindow) {
+		t.Fatal("repairs not allowed during the schedule's hours")
+	}
+
+	// Repairs are paused while a download is in progress, and resume once it
+	// has finished.
+	d := newDownload(newTestingFile(), NewDownloadHttpWriter(new(bytes.Buffer), 0, 0))
+	id := rt.renter.mu.Lock()
+	rt.renter.downloadQueue = append(rt.renter.downloadQueue, d)
+	rt.renter.mu.Unlock(id)
+	if rt.renter.managedRepairAllowed(inWindow) {
+		t.Fatal("low priority repairs allowed during a download")
+	}
+	d.fail(errors.New("failed"))
+	if !rt.renter.managedRepairAllowed(inWindow) {
+		t.Fatal("repairs not allowed after the download finished")
+	}
+
+	// The schedule is persisted.
+	id = rt.renter.mu.Lock()
+	rt.renter.schedule = modules.RepairSchedule{}
+	err = rt.renter.load()
+	rt.renter.mu.Unlock(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rt.renter.Settings().RepairSchedule != schedule {
+		t.Fatal("repair schedule was not persisted:", rt.renter.Settings().RepairSchedule)
+	}
+}
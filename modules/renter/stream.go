@@ -0,0 +1,137 @@
+package renter
+
+import (
+	"bytes"
+	"errors"
+	"io"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+var (
+	errInvalidWhence  = errors.New("invalid whence")
+	errNegativeOffset = errors.New("cannot seek to a negative offset")
+)
+
+// A streamer reads a file from the renter's hosts, downloading one chunk at a
+// time as the reader advances. Only the chunk containing the current offset is
+// held in memory, so seeking within a large file only fetches the chunks that
+// are actually read.
+type streamer struct {
+	r      *Renter
+	file   *file
+	offset int64
+
+	// chunk holds the data of the chunk with index chunkIndex, or nil if no
+	// chunk has been downloaded yet.
+	chunk      []byte
+	chunkIndex uint64
+}
+
+// Streamer returns an io.ReadSeeker for the file with the given nickname. The
+// file's data is downloaded from the hosts as it is read. Compressed files
+// cannot be streamed, because their chunks cannot be decompressed on their own.
+func (r *Renter) Streamer(siapath string) (io.ReadSeeker, error) {
+	return r.StreamerNS("", siapath)
+}
+
+// StreamerNS returns an io.ReadSeeker for the file with the given nickname in
+// namespace ns, like Streamer.
+func (r *Renter) StreamerNS(ns, siapath string) (io.ReadSeeker, error) {
+	lockID := r.mu.RLock()
+	f, exists := r.files[nsKey(ns, siapath)]
+	r.mu.RUnlock(lockID)
+	if !exists {
+		return nil, ErrUnknownPath
+	} else if f.compressed {
+		return nil, errCompressedStream
+	} else if f.keyless() {
+		return nil, errKeylessFile
+	}
+	return &streamer{r: r, file: f}, nil
+}
+
+// managedDownloadChunk downloads the chunk with the given index of f, and
+// returns its data. The last chunk of a file is truncated to the file's size.
+func (r *Renter) managedDownloadChunk(f *file, index uint64) ([]byte, error) {
+	// build current contracts map
+	currentContracts := make(map[modules.NetAddress]types.FileContractID)
+	for _, contract := range r.hostContractor.Contracts() {
+		currentContracts[contract.NetAddress] = contract.ID
+	}
+
+	offset := index * f.chunkSize()
+	length := f.chunkSize()
+	if offset+length > f.size {
+		length = f.size - offset
+	}
+
+	// The download is assembled by hand rather than by newSectionDownload, so
+	// that only the one chunk is fetched.
+	buf := new(bytes.Buffer)
+	d := newDownload(f, NewDownloadHttpWriter(buf, offset, length))
+	d.offset = offset
+	d.length = length
+	d.finishedChunks[index] = false
+	d.initPieceSet(f, currentContracts, r)
+
+	select {
+	case r.newDownloads <- d:
+	case <-r.tg.StopChan():
+		return nil, errors.New("chunk download interrupted by shutdown")
+	}
+	select {
+	case <-d.downloadFinished:
+		if err := d.Err(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case <-r.tg.StopChan():
+		return nil, errors.New("chunk download interrupted by shutdown")
+	}
+}
+
+// Read implements the io.Reader interface. It downloads the chunk containing
+// the current offset if it is not already held in memory.
+func (s *streamer) Read(p []byte) (int, error) {
+	if s.offset >= int64(s.file.size) {
+		return 0, io.EOF
+	}
+	index := uint64(s.offset) / s.file.chunkSize()
+	if s.chunk == nil || index != s.chunkIndex {
+		chunk, err := s.r.managedDownloadChunk(s.file, index)
+		if err != nil {
+			return 0, err
+		}
+		s.chunk = chunk
+		s.chunkIndex = index
+	}
+
+	off := uint64(s.offset) - index*s.file.chunkSize()
+	if off >= uint64(len(s.chunk)) {
+		return 0, io.ErrUnexpectedEOF
+	}
+	n := copy(p, s.chunk[off:])
+	s.offset += int64(n)
+	return n, nil
+}
+
+// Seek implements the io.Seeker interface. Seeking past the end of the file is
+// allowed, but subsequent reads return io.EOF.
+func (s *streamer) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += s.offset
+	case io.SeekEnd:
+		offset += int64(s.file.size)
+	default:
+		return 0, errInvalidWhence
+	}
+	if offset < 0 {
+		return 0, errNegativeOffset
+	}
+	s.offset = offset
+	return offset, nil
+}
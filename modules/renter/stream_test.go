@@ -0,0 +1,49 @@
+package renter
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/NebulousLabs/fastrand"
+)
+
+// TestStreamerSeekRead checks that a streamer reads and seeks within the
+// chunk that it holds in memory.
+func TestStreamerSeekRead(t *testing.T) {
+	rsc, _ := NewRSCode(1, 1)
+	f := &file{size: 150, pieceSize: 100, erasureCode: rsc}
+	data := fastrand.Bytes(50)
+	s := &streamer{file: f, chunk: data, chunkIndex: 1}
+
+	if off, err := s.Seek(-40, io.SeekEnd); err != nil || off != 110 {
+		t.Fatal("wrong offset:", off, err)
+	}
+	buf := make([]byte, 20)
+	if n, err := s.Read(buf); err != nil || n != 20 || !bytes.Equal(buf, data[10:30]) {
+		t.Fatal("wrong read:", n, err)
+	}
+	if off, err := s.Seek(5, io.SeekCurrent); err != nil || off != 135 {
+		t.Fatal("wrong offset:", off, err)
+	}
+	// Reads stop at the end of the file.
+	if n, err := s.Read(buf); err != nil || n != 15 || !bytes.Equal(buf[:n], data[35:]) {
+		t.Fatal("wrong read:", n, err)
+	}
+	if _, err := s.Read(buf); err != io.EOF {
+		t.Fatal("expected EOF, got", err)
+	}
+
+	if _, err := s.Seek(-1, io.SeekStart); err != errNegativeOffset {
+		t.Fatal("expected errNegativeOffset, got", err)
+	}
+	if _, err := s.Seek(0, 3); err != errInvalidWhence {
+		t.Fatal("expected errInvalidWhence, got", err)
+	}
+	if off, err := s.Seek(200, io.SeekStart); err != nil || off != 200 {
+		t.Fatal("wrong offset:", off, err)
+	}
+	if _, err := s.Read(buf); err != io.EOF {
+		t.Fatal("expected EOF past the end of the file, got", err)
+	}
+}
@@ -0,0 +1,94 @@
+package renter
+
+import (
+	"errors"
+	"sort"
+)
+
+var errEmptyTag = errors.New("tag must be a nonempty string")
+
+// hasTag reports whether f carries tag. The file's lock must be held.
+func (f *file) hasTag(tag string) bool {
+	for _, t := range f.tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// updateTags applies update to the file with the given nickname and saves the
+// renter if update reports a change. Sealed files cannot be tagged.
+func (r *Renter) updateTags(nickname, tag string, update func(f *file) bool) error {
+	if err := r.addThread(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	if tag == "" {
+		return errEmptyTag
+	}
+	lockID := r.mu.Lock()
+	defer r.mu.Unlock(lockID)
+
+	f, exists := r.files[nickname]
+	if !exists {
+		return ErrUnknownPath
+	}
+	f.mu.Lock()
+	if f.sealed {
+		f.mu.Unlock()
+		return ErrFileSealed
+	}
+	changed := update(f)
+	f.mu.Unlock()
+	if !changed {
+		return nil
+	}
+	return r.save()
+}
+
+// AddTag adds tag to the file with the given nickname. Adding a tag that the
+// file already carries has no effect.
+func (r *Renter) AddTag(nickname, tag string) error {
+	return r.updateTags(nickname, tag, func(f *file) bool {
+		if f.hasTag(tag) {
+			return false
+		}
+		f.tags = append(f.tags, tag)
+		return true
+	})
+}
+
+// RemoveTag removes tag from the file with the given nickname. Removing a tag
+// that the file does not carry has no effect.
+func (r *Renter) RemoveTag(nickname, tag string) error {
+	return r.updateTags(nickname, tag, func(f *file) bool {
+		for i, t := range f.tags {
+			if t == tag {
+				f.tags = append(f.tags[:i], f.tags[i+1:]...)
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// SearchByTag returns the nicknames of the files in the default namespace that
+// carry tag, in sorted order.
+func (r *Renter) SearchByTag(tag string) []string {
+	lockID := r.mu.RLock()
+	defer r.mu.RUnlock(lockID)
+	var nicknames []string
+	for name, f := range r.files {
+		if f.namespace != "" {
+			continue
+		}
+		f.mu.RLock()
+		if f.hasTag(tag) {
+			nicknames = append(nicknames, name)
+		}
+		f.mu.RUnlock()
+	}
+	sort.Strings(nicknames)
+	return nicknames
+}
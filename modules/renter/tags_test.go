@@ -0,0 +1,89 @@
+package renter
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestRenterTags probes the AddTag, RemoveTag, and SearchByTag methods of the
+// renter type.
+func TestRenterTags(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	if err := rt.renter.AddTag("one", "foo"); err != ErrUnknownPath {
+		t.Fatal("expected ErrUnknownPath, got", err)
+	}
+	for _, name := range []string{"one", "two", "three"} {
+		f := newTestingFile()
+		f.name = name
+		id := rt.renter.mu.Lock()
+		rt.renter.files[name] = f
+		rt.renter.mu.Unlock(id)
+		id = rt.renter.mu.Lock()
+		err := rt.renter.saveFile(f)
+		rt.renter.mu.Unlock(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rt.renter.AddTag("one", ""); err != errEmptyTag {
+		t.Fatal("expected errEmptyTag, got", err)
+	}
+
+	// Duplicate tags are only stored once.
+	for _, tag := range []string{"foo", "bar", "foo"} {
+		if err := rt.renter.AddTag("one", tag); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rt.renter.AddTag("two", "foo"); err != nil {
+		t.Fatal(err)
+	}
+	if tags := rt.renter.files["one"].tags; !reflect.DeepEqual(tags, []string{"foo", "bar"}) {
+		t.Fatal("wrong tags:", tags)
+	}
+	if names := rt.renter.SearchByTag("foo"); !reflect.DeepEqual(names, []string{"one", "two"}) {
+		t.Fatal("wrong files tagged foo:", names)
+	}
+	if names := rt.renter.SearchByTag("baz"); len(names) != 0 {
+		t.Fatal("expected no files tagged baz, got", names)
+	}
+
+	// Remove a tag, and a tag the file does not carry.
+	if err := rt.renter.RemoveTag("one", "foo"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.renter.RemoveTag("three", "foo"); err != nil {
+		t.Fatal(err)
+	}
+	if names := rt.renter.SearchByTag("foo"); !reflect.DeepEqual(names, []string{"two"}) {
+		t.Fatal("wrong files tagged foo:", names)
+	}
+
+	// Tags should be persisted.
+	rt.renter.files = make(map[string]*file)
+	id := rt.renter.mu.Lock()
+	err = rt.renter.load()
+	rt.renter.mu.Unlock(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := rt.renter.SearchByTag("bar"); !reflect.DeepEqual(names, []string{"one"}) {
+		t.Fatal("tags were not persisted:", names)
+	}
+
+	// Sealed files cannot be tagged.
+	if err := rt.renter.Seal("two"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.renter.RemoveTag("two", "foo"); err != ErrFileSealed {
+		t.Fatal("expected ErrFileSealed, got", err)
+	}
+}
@@ -1,18 +1,31 @@
 package renter
 
 import (
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/NebulousLabs/Sia/build"
 	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/fastrand"
 )
 
+// uploadsDir is the directory within the renter's persist directory that
+// holds the copies of files that were uploaded from a reader rather than from
+// a local file. The repair loop reads the chunks of such files from these
+// copies.
+const uploadsDir = ".uploads"
+
 var (
 	errInsufficientContracts = errors.New("not enough contracts to upload file")
+	errNicknameNUL           = errors.New("nicknames cannot contain NUL bytes")
+	errSourceAndData         = errors.New("cannot upload from both a source and a reader")
 	errUploadDirectory       = errors.New("cannot upload directory")
 
 	// Erasure-coded piece size
@@ -69,6 +82,18 @@ func validateSiapath(siapath string) error {
 	return nil
 }
 
+// defaultNicknameValidator is the default nickname validator of the renter. It
+// rejects empty nicknames and nicknames that contain NUL bytes.
+func defaultNicknameValidator(nickname string) error {
+	if nickname == "" {
+		return ErrEmptyFilename
+	}
+	if strings.ContainsRune(nickname, 0) {
+		return errNicknameNUL
+	}
+	return nil
+}
+
 // validateSource verifies that a sourcePath meets the
 // requirements for upload.
 func validateSource(sourcePath string) error {
@@ -83,25 +108,108 @@ func validateSource(sourcePath string) error {
 	return nil
 }
 
+// checksumFile returns the checksum of the contents of the file at path.
+func checksumFile(path string) (crypto.Hash, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return crypto.Hash{}, err
+	}
+	defer file.Close()
+
+	var checksum crypto.Hash
+	h := crypto.NewHash()
+	if _, err := io.Copy(h, file); err != nil {
+		return crypto.Hash{}, err
+	}
+	copy(checksum[:], h.Sum(nil))
+	return checksum, nil
+}
+
+// stageUpload writes the contents of data to a new file in the uploads
+// directory, and returns the file's path.
+func (r *Renter) stageUpload(data io.Reader) (string, error) {
+	dir := filepath.Join(r.persistDir, uploadsDir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, hex.EncodeToString(fastrand.Bytes(16)))
+	out, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(out, data)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return "", err
+	}
+	return path, nil
+}
+
 // Upload instructs the renter to start tracking a file. The renter will
 // automatically upload and repair tracked files using a background loop.
-func (r *Renter) Upload(up modules.FileUploadParams) error {
+func (r *Renter) Upload(up modules.FileUploadParams) (err error) {
+	if err := r.addThread(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
 	// Enforce nickname rules.
 	if err := validateSiapath(up.SiaPath); err != nil {
 		return err
 	}
 
 	// Enforce source rules.
-	if err := validateSource(up.Source); err != nil {
-		return err
+	if up.Data != nil && up.Source != "" {
+		return errSourceAndData
+	} else if up.Data == nil {
+		if err := validateSource(up.Source); err != nil {
+			return err
+		}
 	}
 
-	// Check for a nickname conflict.
+	// Check that the nickname is accepted by the validator, and that there is
+	// no nickname conflict within the namespace.
+	if err := validateNamespace(up.Namespace); err != nil {
+		return err
+	}
+	metadata, err := mergeMetadata(nil, up.Metadata)
+	if err != nil {
+		return err
+	}
+	if up.KeepVersions < 0 {
+		return errors.New("number of versions to keep cannot be negative")
+	} else if up.KeepVersions > 0 && up.Namespace != "" {
+		return errUnversionedNS
+	}
+	key := nsKey(up.Namespace, up.SiaPath)
 	lockID := r.mu.RLock()
-	_, exists := r.files[up.SiaPath]
+	err = r.validateNickname(up.SiaPath)
+	existing, exists := r.files[key]
 	r.mu.RUnlock(lockID)
-	if exists {
+	if err != nil {
+		return err
+	}
+	if exists && up.KeepVersions == 0 {
 		return ErrPathOverload
+	} else if exists && existing.isSealed() {
+		return ErrFileSealed
+	}
+
+	// Uploads from a reader are copied to the uploads directory, and the copy
+	// is removed if the upload fails.
+	if up.Data != nil {
+		var staged string
+		if staged, err = r.stageUpload(up.Data); err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				os.Remove(staged)
+			}
+		}()
+		up.Source = staged
 	}
 
 	// Fill in any missing upload params with sensible defaults.
@@ -120,24 +228,123 @@ func (r *Renter) Upload(up modules.FileUploadParams) error {
 		return fmt.Errorf("not enough contracts to upload file: got %v, needed %v", nContracts, (up.ErasureCode.NumPieces()+up.ErasureCode.MinPieces())/2)
 	}
 
+	// Compute the checksum of the file's contents.
+	checksum, err := checksumFile(up.Source)
+	if err != nil {
+		return err
+	}
+
 	// Create file object.
 	f := newFile(up.SiaPath, up.ErasureCode, pieceSize, uint64(fileInfo.Size()))
 	f.mode = uint32(fileInfo.Mode())
+	f.checksum = checksum
+	f.namespace = up.Namespace
+	f.metadata = metadata
+
+	// Compressed files are uploaded from a compressed copy of the source,
+	// which replaces the copy of an upload from a reader.
+	repairPath := up.Source
+	if up.Compress {
+		if err := r.compressSource(f, up.Source); err != nil {
+			return err
+		}
+		repairPath = r.compressedPath(f)
+		if up.Data != nil {
+			os.Remove(up.Source)
+		}
+	}
 
-	// Add file to renter.
+	// Add file to renter. If a file already exists at the nickname, it becomes
+	// the latest previous version of the new file.
 	lockID = r.mu.Lock()
-	r.files[up.SiaPath] = f
-	r.tracking[up.SiaPath] = trackedFile{
-		RepairPath: up.Source,
+	var pruned []*file
+	if existing, exists := r.files[key]; exists {
+		if up.KeepVersions == 0 {
+			r.mu.Unlock(lockID)
+			os.Remove(r.compressedPath(f))
+			return ErrPathOverload
+		}
+		pruned, err = r.archiveFile(existing, up.KeepVersions)
+		if err != nil {
+			r.mu.Unlock(lockID)
+			os.Remove(r.compressedPath(f))
+			return err
+		}
+		r.noteUnusedHosts(pruned)
+	}
+	r.files[key] = f
+	r.tracking[key] = trackedFile{
+		RepairPath: repairPath,
+		Dedup:      up.Dedup,
 	}
-	r.saveSync()
-	err = r.saveFile(f)
+	r.save()
+	saveErr := r.saveFile(f)
+	sectors := r.unusedSectors(pruned)
 	r.mu.Unlock(lockID)
-	if err != nil {
-		return err
+	go r.threadedDeleteSectors(sectors)
+	if saveErr != nil {
+		// The file is tracked, so its copy is still needed for repairs.
+		return saveErr
 	}
 
 	// Send the upload to the repair loop.
-	r.newRepairs <- f
+	select {
+	case r.newRepairs <- f:
+	case <-r.tg.StopChan():
+	}
 	return nil
 }
+
+// UploadProgress reports how much of the file with the given nickname has been
+// uploaded, and how many of its pieces each host stores. Hosts are listed in
+// sorted order. Progress is updated as each piece is uploaded, so it can be
+// polled while the upload is in progress.
+func (r *Renter) UploadProgress(nickname string) (modules.UploadProgress, error) {
+	lockID := r.mu.RLock()
+	defer r.mu.RUnlock(lockID)
+	f, exists := r.files[nickname]
+	if !exists {
+		return modules.UploadProgress{}, ErrUnknownPath
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	progress := modules.UploadProgress{
+		SiaPath:    f.name,
+		BytesTotal: f.pieceSize * uint64(f.erasureCode.NumPieces()) * f.numChunks(),
+		Chunks:     f.numChunks(),
+	}
+	chunkPieces := make([]map[uint64]struct{}, f.numChunks())
+	hosts := make(map[modules.NetAddress]*modules.HostUploadProgress)
+	for _, fc := range f.contracts {
+		progress.BytesUploaded += uint64(len(fc.Pieces)) * f.pieceSize
+		for _, p := range fc.Pieces {
+			if p.Chunk >= uint64(len(chunkPieces)) {
+				continue
+			}
+			if chunkPieces[p.Chunk] == nil {
+				chunkPieces[p.Chunk] = make(map[uint64]struct{})
+			}
+			chunkPieces[p.Chunk][p.Piece] = struct{}{}
+		}
+		hp, exists := hosts[fc.IP]
+		if !exists {
+			hp = &modules.HostUploadProgress{NetAddress: fc.IP}
+			hosts[fc.IP] = hp
+		}
+		hp.Pieces += len(fc.Pieces)
+		hp.Online = hp.Online || !r.contractOffline(fc.ID)
+	}
+	for _, pieces := range chunkPieces {
+		if len(pieces) >= f.erasureCode.NumPieces() {
+			progress.ChunksCompleted++
+		}
+	}
+	for _, hp := range hosts {
+		progress.Hosts = append(progress.Hosts, *hp)
+	}
+	sort.Slice(progress.Hosts, func(i, j int) bool {
+		return progress.Hosts[i].NetAddress < progress.Hosts[j].NetAddress
+	})
+	return progress, nil
+}
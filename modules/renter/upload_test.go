@@ -1,11 +1,15 @@
 package renter
 
 import (
+	"errors"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
 
 	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
 )
 
 // TestRenterSiapathValidate verifies that the validateSiapath function correctly validates SiaPaths.
@@ -72,3 +76,135 @@ func TestRenterUploadInode(t *testing.T) {
 		t.Fatal("expected errUploadDirectory, got", err)
 	}
 }
+
+// TestRenterNicknameValidator checks that the renter runs the nickname
+// validator on uploads and renames, and passes the validator's error through.
+func TestRenterNicknameValidator(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// The default validator rejects empty nicknames and NUL bytes.
+	if err := defaultNicknameValidator(""); err != ErrEmptyFilename {
+		t.Error("expected ErrEmptyFilename, got", err)
+	}
+	if err := defaultNicknameValidator("foo\x00bar"); err != errNicknameNUL {
+		t.Error("expected errNicknameNUL, got", err)
+	}
+	if err := defaultNicknameValidator("foo"); err != nil {
+		t.Error("default validator rejected a valid nickname:", err)
+	}
+
+	// Set a validator that rejects long nicknames.
+	errTooLong := errors.New("nickname too long")
+	rt.renter.SetNicknameValidator(func(nickname string) error {
+		if len(nickname) > 3 {
+			return errTooLong
+		}
+		return nil
+	})
+
+	// Upload should return the validator's error.
+	testUploadPath, err := ioutil.TempDir("", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(testUploadPath)
+	source := filepath.Join(testUploadPath, "source")
+	if err := ioutil.WriteFile(source, []byte{1, 2, 3}, 0600); err != nil {
+		t.Fatal(err)
+	}
+	ec, err := NewRSCode(defaultDataPieces, defaultParityPieces)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rt.renter.Upload(modules.FileUploadParams{
+		Source:      source,
+		SiaPath:     "toolong",
+		ErasureCode: ec,
+	})
+	if err != errTooLong {
+		t.Fatal("expected errTooLong, got", err)
+	}
+
+	// Rename should return the validator's error.
+	id := rt.renter.mu.Lock()
+	rt.renter.files["one"] = &file{name: "one", erasureCode: ec, pieceSize: 1}
+	rt.renter.mu.Unlock(id)
+	if err := rt.renter.RenameFile("one", "toolong"); err != errTooLong {
+		t.Fatal("expected errTooLong, got", err)
+	}
+	if err := rt.renter.RenameFile("one", "two"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A nil validator restores the default.
+	rt.renter.SetNicknameValidator(nil)
+	if err := rt.renter.RenameFile("two", "toolong"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestRenterUploadProgress checks that UploadProgress reports the uploaded
+// bytes, completed chunks, and pieces stored on each host.
+func TestRenterUploadProgress(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	hc := onlineContractor{
+		contracts: map[types.FileContractID]modules.RenterContract{
+			{1}: {ID: types.FileContractID{1}, NetAddress: "foo:1", GoodForRenew: true},
+		},
+	}
+	rt, err := newContractorTester(t.Name(), closeHostDB{}, hc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	if _, err := rt.renter.UploadProgress("dne"); err != ErrUnknownPath {
+		t.Fatal("expected ErrUnknownPath, got", err)
+	}
+
+	// Add a file with two chunks of two pieces each. The first chunk is
+	// fully uploaded, and one piece of the second chunk is stored on a host
+	// whose contract is unknown.
+	rsc, _ := NewRSCode(1, 1)
+	f := &file{
+		name:        "one",
+		size:        20,
+		pieceSize:   10,
+		erasureCode: rsc,
+		contracts: map[types.FileContractID]fileContract{
+			{1}: {ID: types.FileContractID{1}, IP: "foo:1", Pieces: []pieceData{{Chunk: 0, Piece: 0}, {Chunk: 0, Piece: 1}}},
+			{2}: {ID: types.FileContractID{2}, IP: "bar:1", Pieces: []pieceData{{Chunk: 1, Piece: 0}}},
+		},
+	}
+	id := rt.renter.mu.Lock()
+	rt.renter.files[f.name] = f
+	rt.renter.mu.Unlock(id)
+
+	progress, err := rt.renter.UploadProgress("one")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := modules.UploadProgress{
+		SiaPath:         "one",
+		BytesUploaded:   30,
+		BytesTotal:      40,
+		ChunksCompleted: 1,
+		Chunks:          2,
+		Hosts: []modules.HostUploadProgress{
+			{NetAddress: "bar:1", Pieces: 1, Online: false},
+			{NetAddress: "foo:1", Pieces: 2, Online: true},
+		},
+	}
+	if !reflect.DeepEqual(progress, exp) {
+		t.Fatalf("expected %+v, got %+v", exp, progress)
+	}
+}
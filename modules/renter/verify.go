@@ -0,0 +1,110 @@
+package renter
+
+import (
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/modules/renter/proto"
+	"github.com/NebulousLabs/fastrand"
+)
+
+var (
+	errInvalidSegmentProof = errors.New("host did not prove that it stores the piece")
+	errNoHostContract      = errors.New("no contract with the host")
+)
+
+// VerifyFile challenges each host that stores pieces of the file with the
+// given nickname to prove that it stores a random segment of each piece,
+// using a Merkle proof against the piece's Merkle root. Only the challenged
+// segments are transferred, so verifying a file is much cheaper than
+// downloading it. A valid proof shows that the host still has the piece, and
+// makes it unlikely that the host has lost parts of it.
+func (r *Renter) VerifyFile(nickname string) ([]modules.PieceVerification, error) {
+	if err := r.addThread(); err != nil {
+		return nil, err
+	}
+	defer r.tg.Done()
+	lockID := r.mu.RLock()
+	f, exists := r.files[nickname]
+	r.mu.RUnlock(lockID)
+	if !exists {
+		return nil, ErrUnknownPath
+	}
+
+	// Group the pieces by host, and challenge the hosts in parallel.
+	f.mu.RLock()
+	hosts := make(map[modules.NetAddress][]pieceData)
+	for _, fc := range f.contracts {
+		hosts[fc.IP] = append(hosts[fc.IP], fc.Pieces...)
+	}
+	f.mu.RUnlock()
+	var verifications []modules.PieceVerification
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for addr, pieces := range hosts {
+		wg.Add(1)
+		go func(addr modules.NetAddress, pieces []pieceData) {
+			defer wg.Done()
+			v := r.managedVerifyPieces(addr, pieces)
+			mu.Lock()
+			verifications = append(verifications, v...)
+			mu.Unlock()
+		}(addr, pieces)
+	}
+	wg.Wait()
+
+	sort.Slice(verifications, func(i, j int) bool {
+		vi, vj := verifications[i], verifications[j]
+		if vi.Chunk != vj.Chunk {
+			return vi.Chunk < vj.Chunk
+		} else if vi.Piece != vj.Piece {
+			return vi.Piece < vj.Piece
+		}
+		return vi.NetAddress < vj.NetAddress
+	})
+	return verifications, nil
+}
+
+// managedVerifyPieces challenges the host at addr to prove that it stores a
+// random segment of each of the pieces.
+func (r *Renter) managedVerifyPieces(addr modules.NetAddress, pieces []pieceData) []modules.PieceVerification {
+	verifications := make([]modules.PieceVerification, len(pieces))
+	for i, p := range pieces {
+		verifications[i] = modules.PieceVerification{Chunk: p.Chunk, Piece: p.Piece, NetAddress: addr}
+	}
+	contract, ok := r.hostContractor.Contract(addr)
+	if !ok {
+		for i := range verifications {
+			verifications[i].Error = errNoHostContract.Error()
+		}
+		return verifications
+	}
+
+	numSegments := modules.SectorSize / crypto.SegmentSize
+	for start := 0; start < len(pieces); start += modules.NegotiateMaxSegmentChallenges {
+		end := start + modules.NegotiateMaxSegmentChallenges
+		if end > len(pieces) {
+			end = len(pieces)
+		}
+		challenges := make([]modules.SegmentChallenge, end-start)
+		for i, p := range pieces[start:end] {
+			challenges[i] = modules.SegmentChallenge{
+				MerkleRoot:   p.MerkleRoot,
+				SegmentIndex: fastrand.Uint64n(numSegments),
+			}
+		}
+		proofs, err := proto.ProveSegments(contract, challenges, r.rateLimit, r.tg.StopChan())
+		for i, c := range challenges {
+			v := &verifications[start+i]
+			if err != nil {
+				v.Error = err.Error()
+			} else if v.Intact = crypto.VerifySegment(proofs[i].Base, proofs[i].HashSet, numSegments, c.SegmentIndex, c.MerkleRoot); !v.Intact {
+				v.Error = errInvalidSegmentProof.Error()
+			}
+		}
+	}
+	return verifications
+}
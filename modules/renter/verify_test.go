@@ -0,0 +1,117 @@
+package renter
+
+import (
+	"net"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+	"github.com/NebulousLabs/fastrand"
+)
+
+// addressContractor is an onlineContractor that can look up its contracts by
+// the address of the host.
+type addressContractor struct {
+	onlineContractor
+}
+
+func (ac addressContractor) Contract(addr modules.NetAddress) (modules.RenterContract, bool) {
+	for _, c := range ac.contracts {
+		if c.NetAddress == addr {
+			return c, true
+		}
+	}
+	return modules.RenterContract{}, false
+}
+
+// serveSegmentProofs answers a single segment proof request on l, proving the
+// segments of the given sectors and sending empty proofs for other sectors.
+func serveSegmentProofs(l net.Listener, sectors map[crypto.Hash][]byte) {
+	conn, err := l.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	var id types.Specifier
+	var fcid types.FileContractID
+	var sig crypto.Signature
+	var challenges []modules.SegmentChallenge
+	encoding.ReadObject(conn, &id, 16)
+	encoding.ReadObject(conn, &fcid, 32)
+	encoding.WriteObject(conn, crypto.Hash{})
+	encoding.ReadObject(conn, &sig, uint64(len(sig)))
+	modules.WriteNegotiationAcceptance(conn)
+	encoding.ReadObject(conn, &challenges, modules.NegotiateMaxSegmentChallengesSize)
+	proofs := make([]modules.SegmentProof, len(challenges))
+	for i, c := range challenges {
+		if sector, ok := sectors[c.MerkleRoot]; ok {
+			proofs[i].Base, proofs[i].HashSet = crypto.MerkleProof(sector, c.SegmentIndex)
+		}
+	}
+	modules.WriteNegotiationAcceptance(conn)
+	encoding.WriteObject(conn, proofs)
+}
+
+// TestRenterVerifyFile checks that VerifyFile reports the pieces whose hosts
+// prove that they store them as intact, and the other pieces as not intact.
+func TestRenterVerifyFile(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	addr := modules.NetAddress(l.Addr().String())
+	sector := fastrand.Bytes(int(modules.SectorSize))
+	root := crypto.MerkleRoot(sector)
+	go serveSegmentProofs(l, map[crypto.Hash][]byte{root: sector})
+
+	hc := addressContractor{onlineContractor{contracts: map[types.FileContractID]modules.RenterContract{
+		{1}: {ID: types.FileContractID{1}, NetAddress: addr},
+	}}}
+	rt, err := newContractorTester(t.Name(), closeHostDB{}, hc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	if _, err := rt.renter.VerifyFile("foo"); err != ErrUnknownPath {
+		t.Fatal("expected ErrUnknownPath, got", err)
+	}
+
+	// The host stores the first piece of the file and has lost the second,
+	// while the third piece is stored on a host without a contract.
+	rsc, _ := NewRSCode(1, 2)
+	f := &file{
+		name:        "foo",
+		erasureCode: rsc,
+		contracts: map[types.FileContractID]fileContract{
+			{1}: {ID: types.FileContractID{1}, IP: addr, Pieces: []pieceData{{0, 1, crypto.Hash{1}}, {0, 0, root}}},
+			{2}: {ID: types.FileContractID{2}, IP: "unknown:1", Pieces: []pieceData{{0, 2, crypto.Hash{2}}}},
+		},
+	}
+	id := rt.renter.mu.Lock()
+	rt.renter.files[f.name] = f
+	rt.renter.mu.Unlock(id)
+
+	verifications, err := rt.renter.VerifyFile("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []modules.PieceVerification{
+		{Chunk: 0, Piece: 0, NetAddress: addr, Intact: true},
+		{Chunk: 0, Piece: 1, NetAddress: addr, Error: errInvalidSegmentProof.Error()},
+		{Chunk: 0, Piece: 2, NetAddress: "unknown:1", Error: errNoHostContract.Error()},
+	}
+	if len(verifications) != len(exp) {
+		t.Fatalf("expected %v verifications, got %v", len(exp), verifications)
+	}
+	for i := range exp {
+		if verifications[i] != exp[i] {
+			t.Errorf("verification %v: expected %+v, got %+v", i, exp[i], verifications[i])
+		}
+	}
+}
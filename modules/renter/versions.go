@@ -0,0 +1,176 @@
+package renter
+
+import (
+	"errors"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// versionNamespace is the namespace that holds the previous versions of the
+// files in the default namespace. It is reserved, so that versions are only
+// created and deleted through uploads and PruneVersions.
+const versionNamespace = ".versions"
+
+var (
+	errNamespaceReserved = errors.New("the " + versionNamespace + " namespace is reserved for file versions")
+	errUnversionedNS     = errors.New("only files in the default namespace can be versioned")
+)
+
+// A fileVersion is a previous version of a file.
+type fileVersion struct {
+	version uint64
+	file    *file
+}
+
+// versionName returns the nickname of a previous version of the file with the
+// given nickname. Versions are stored in versionNamespace.
+func versionName(nickname string, version uint64) string {
+	return nickname + "." + strconv.FormatUint(version, 10)
+}
+
+// fileVersions returns the previous versions of the file with the given
+// nickname, ordered from oldest to newest. The renter's lock must be held.
+func (r *Renter) fileVersions(nickname string) []fileVersion {
+	var versions []fileVersion
+	for _, f := range r.files {
+		if f.namespace != versionNamespace || !strings.HasPrefix(f.name, nickname+".") {
+			continue
+		}
+		// Only accept the exact form written by versionName, so that the
+		// versions of "foo.1" are not mistaken for versions of "foo".
+		suffix := strings.TrimPrefix(f.name, nickname+".")
+		version, err := strconv.ParseUint(suffix, 10, 64)
+		if err != nil || strconv.FormatUint(version, 10) != suffix {
+			continue
+		}
+		versions = append(versions, fileVersion{version, f})
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].version < versions[j].version
+	})
+	return versions
+}
+
+// archiveFile replaces the file f in the default namespace with a new
+// previous version that keeps the file's data, and then prunes the file's
+// versions down to keep. It returns the pruned versions. The renter's lock
+// must be held.
+func (r *Renter) archiveFile(f *file, keep int) ([]*file, error) {
+	versions := r.fileVersions(f.name)
+	next := uint64(1)
+	if len(versions) > 0 {
+		next = versions[len(versions)-1].version + 1
+	}
+
+	// The contracts are copied, because the repair loop may still be adding
+	// pieces to f.
+	f.mu.RLock()
+	v := &file{
+		name:        versionName(f.name, next),
+		namespace:   versionNamespace,
+		size:        f.size,
+		contracts:   make(map[types.FileContractID]fileContract, len(f.contracts)),
+		masterKey:   f.masterKey,
+		erasureCode: f.erasureCode,
+		pieceSize:   f.pieceSize,
+		checksum:    f.checksum,
+		mode:        f.mode,
+		policy:      f.policy,
+		verified:    make(map[uint64]types.BlockHeight, len(f.verified)),
+		compressed:  f.compressed,
+		rawSize:     f.rawSize,
+		metadata:    f.metadata,
+	}
+	for id, fc := range f.contracts {
+		fc.Pieces = append([]pieceData(nil), fc.Pieces...)
+		v.contracts[id] = fc
+	}
+	for i, height := range f.verified {
+		v.verified[i] = height
+	}
+	if len(f.dedupKeys) > 0 {
+		v.dedupKeys = make(map[uint64][]crypto.TwofishKey, len(f.dedupKeys))
+		for i, keys := range f.dedupKeys {
+			v.dedupKeys[i] = keys
+		}
+	}
+	f.mu.RUnlock()
+	if err := r.saveFile(v); err != nil {
+		return nil, err
+	}
+
+	delete(r.files, f.key())
+	r.untrack(f.key())
+	r.files[v.key()] = v
+	return r.pruneVersions(append(versions, fileVersion{next, v}), keep), nil
+}
+
+// pruneVersions deletes the oldest of the given versions, so that at most keep
+// versions remain, and returns the deleted versions. The renter's lock must be
+// held.
+func (r *Renter) pruneVersions(versions []fileVersion, keep int) []*file {
+	var pruned []*file
+	for ; len(versions) > keep; versions = versions[1:] {
+		f := versions[0].file
+		delete(r.files, f.key())
+		os.RemoveAll(r.sharePath(versionNamespace, f.name))
+		pruned = append(pruned, f)
+	}
+	return pruned
+}
+
+// FileVersions returns the previous versions of the file with the given
+// nickname, ordered from oldest to newest. Versions are created by uploading
+// a file with KeepVersions set, and can be downloaded by setting the Version
+// download parameter. They remain when the current file is deleted or
+// renamed.
+func (r *Renter) FileVersions(nickname string) []modules.FileVersion {
+	lockID := r.mu.RLock()
+	versions := r.fileVersions(nickname)
+	r.mu.RUnlock(lockID)
+
+	fileVersions := make([]modules.FileVersion, 0, len(versions))
+	for _, v := range versions {
+		v.file.mu.RLock()
+		info := r.fileInfo(v.file)
+		v.file.mu.RUnlock()
+		info.SiaPath = nickname
+		fileVersions = append(fileVersions, modules.FileVersion{
+			Version:  v.version,
+			FileInfo: info,
+		})
+	}
+	return fileVersions
+}
+
+// PruneVersions deletes the oldest previous versions of the file with the
+// given nickname, including their data on the hosts, so that at most keep
+// versions remain.
+func (r *Renter) PruneVersions(nickname string, keep int) error {
+	if err := r.addThread(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	if keep < 0 {
+		return errors.New("number of versions to keep cannot be negative")
+	}
+	lockID := r.mu.Lock()
+	pruned := r.pruneVersions(r.fileVersions(nickname), keep)
+	if len(pruned) == 0 {
+		r.mu.Unlock(lockID)
+		return nil
+	}
+	err := r.save()
+	r.noteUnusedHosts(pruned)
+	sectors := r.unusedSectors(pruned)
+	r.mu.Unlock(lockID)
+
+	go r.threadedDeleteSectors(sectors)
+	return err
+}
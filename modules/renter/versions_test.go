@@ -0,0 +1,123 @@
+package renter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestRenterFileVersions checks that uploading over a file with KeepVersions
+// set retains the previous versions of the file, and that versions can be
+// listed, looked up for download, and pruned.
+func TestRenterFileVersions(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	dir, err := ioutil.TempDir("", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	source := filepath.Join(dir, "source")
+	if err := ioutil.WriteFile(source, []byte("foo"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	up := modules.FileUploadParams{Source: source, SiaPath: "foo"}
+	if err := rt.renter.Upload(up); err != nil {
+		t.Fatal(err)
+	}
+	original := map[types.FileContractID]fileContract{
+		{1}: {ID: types.FileContractID{1}, IP: "foo:1", Pieces: []pieceData{{0, 0, crypto.Hash{1}}}},
+	}
+	id := rt.renter.mu.Lock()
+	f := rt.renter.files["foo"]
+	f.mu.Lock()
+	f.contracts = original
+	f.mu.Unlock()
+	rt.renter.mu.Unlock(id)
+
+	// Without KeepVersions, the file cannot be replaced.
+	if err := rt.renter.Upload(up); err != ErrPathOverload {
+		t.Fatal("expected ErrPathOverload, got", err)
+	}
+	// Only files in the default namespace can be versioned, and the version
+	// namespace cannot be used directly.
+	if err := rt.renter.Upload(modules.FileUploadParams{Source: source, SiaPath: "foo", Namespace: "ns", KeepVersions: 1}); err != errUnversionedNS {
+		t.Fatal("expected errUnversionedNS, got", err)
+	}
+	if err := rt.renter.Upload(modules.FileUploadParams{Source: source, SiaPath: "foo", Namespace: versionNamespace}); err != errNamespaceReserved {
+		t.Fatal("expected errNamespaceReserved, got", err)
+	}
+
+	// Upload a new version of the file. The original file becomes version 1,
+	// and keeps its data.
+	up.KeepVersions = 2
+	if err := rt.renter.Upload(up); err != nil {
+		t.Fatal(err)
+	}
+	id = rt.renter.mu.RLock()
+	v := rt.renter.files[nsKey(versionNamespace, versionName("foo", 1))]
+	rt.renter.mu.RUnlock(id)
+	v.mu.RLock()
+	if !reflect.DeepEqual(v.contracts, original) {
+		t.Fatalf("expected contracts %v, got %v", original, v.contracts)
+	}
+	v.mu.RUnlock()
+
+	// Upload two more versions. Only two previous versions are kept.
+	for i := 0; i < 2; i++ {
+		if err := rt.renter.Upload(up); err != nil {
+			t.Fatal(err)
+		}
+	}
+	versions := rt.renter.FileVersions("foo")
+	if len(versions) != 2 || versions[0].Version != 2 || versions[1].Version != 3 {
+		t.Fatalf("expected versions 2 and 3, got %v", versions)
+	}
+	if versions[0].SiaPath != "foo" || versions[0].Filesize != 3 {
+		t.Fatalf("unexpected version info: %+v", versions[0])
+	}
+	if len(rt.renter.FileVersions("fo")) != 0 || len(rt.renter.FileVersions("foo.2")) != 0 {
+		t.Fatal("versions of another file were listed")
+	}
+	if _, err := os.Stat(rt.renter.sharePath(versionNamespace, versionName("foo", 1))); !os.IsNotExist(err) {
+		t.Fatal("pruned version was not removed from disk:", err)
+	}
+
+	// Downloads look up the requested version.
+	err = rt.renter.Download(modules.RenterDownloadParameters{Siapath: "foo", Version: 3})
+	if err == nil || !strings.Contains(err.Error(), "destination not supplied") {
+		t.Fatal("expected the download of version 3 to fail on its destination, got", err)
+	}
+	err = rt.renter.Download(modules.RenterDownloadParameters{Siapath: "foo", Version: 1})
+	if err == nil || !strings.Contains(err.Error(), "no file with that path") {
+		t.Fatal("expected the download of a pruned version to fail, got", err)
+	}
+
+	// Pruning to zero versions deletes every version, but not the file.
+	if err := rt.renter.PruneVersions("foo", -1); err == nil {
+		t.Fatal("expected an error for a negative number of versions")
+	}
+	if err := rt.renter.PruneVersions("foo", 0); err != nil {
+		t.Fatal(err)
+	}
+	if versions := rt.renter.FileVersions("foo"); len(versions) != 0 {
+		t.Fatal("versions were not pruned:", versions)
+	}
+	if len(rt.renter.FileList()) != 1 {
+		t.Fatal("current file was deleted")
+	}
+}
@@ -5,6 +5,7 @@ package renter
 // will be different.
 
 import (
+	"errors"
 	"time"
 
 	"github.com/NebulousLabs/Sia/crypto"
@@ -12,6 +13,12 @@ import (
 	"github.com/NebulousLabs/Sia/types"
 )
 
+var (
+	// errHostHoldsChunk is returned if a piece would be uploaded to a host
+	// that already stores the maximum number of pieces of the chunk.
+	errHostHoldsChunk = errors.New("host already stores the maximum number of pieces of this chunk")
+)
+
 type (
 	// downloadWork contains instructions to download a piece from a host, and
 	// a channel for returning the results.
@@ -35,6 +42,7 @@ type (
 		err           error
 		pieceIndex    uint64
 		workerID      types.FileContractID
+		downloadTime  time.Duration
 	}
 
 	// finishedUpload contains the Merkle root and error from performing an
@@ -88,6 +96,11 @@ type (
 		// has failed.
 		recentDownloadFailure time.Time // Only modified by the primary download loop.
 
+		// downloadLatency is a moving average of the time taken by the
+		// worker's successful piece downloads, or zero if the worker has not
+		// downloaded a piece yet.
+		downloadLatency time.Duration // Only modified by the primary download loop.
+
 		// Utilities.
 		renter *Renter
 	}
@@ -95,10 +108,11 @@ type (
 
 // download will perform some download work.
 func (w *worker) download(dw downloadWork) {
+	start := time.Now()
 	d, err := w.renter.hostContractor.Downloader(w.contractID, w.renter.tg.StopChan())
 	if err != nil {
 		select {
-		case dw.resultChan <- finishedDownload{dw.chunkDownload, nil, err, dw.pieceIndex, w.contractID}:
+		case dw.resultChan <- finishedDownload{dw.chunkDownload, nil, err, dw.pieceIndex, w.contractID, time.Since(start)}:
 		case <-w.renter.tg.StopChan():
 		}
 		return
@@ -107,13 +121,24 @@ func (w *worker) download(dw downloadWork) {
 
 	data, err := d.Sector(dw.dataRoot)
 	select {
-	case dw.resultChan <- finishedDownload{dw.chunkDownload, data, err, dw.pieceIndex, w.contractID}:
+	case dw.resultChan <- finishedDownload{dw.chunkDownload, data, err, dw.pieceIndex, w.contractID, time.Since(start)}:
 	case <-w.renter.tg.StopChan():
 	}
 }
 
+// noteDownloadTime adds the duration of a successful piece download to the
+// worker's moving average download latency.
+func (w *worker) noteDownloadTime(d time.Duration) {
+	if w.downloadLatency == 0 {
+		w.downloadLatency = d
+		return
+	}
+	w.downloadLatency = (w.downloadLatency*3 + d) / 4
+}
+
 // upload will perform some upload work.
 func (w *worker) upload(uw uploadWork) {
+	defer w.renter.managedFinishUpload(uw.file)
 	e, err := w.renter.hostContractor.Editor(w.contractID, w.renter.tg.StopChan())
 	if err != nil {
 		w.recentUploadFailure = time.Now()
@@ -126,6 +151,21 @@ func (w *worker) upload(uw uploadWork) {
 	}
 	defer e.Close()
 
+	// Check that the host is not already storing too many pieces of this
+	// chunk. This is not the host's fault, so it does not count as an upload
+	// failure.
+	addr := e.Address()
+	uw.file.mu.RLock()
+	hostPieces := uw.file.hostPieceCount(uw.chunkID.index, addr)
+	uw.file.mu.RUnlock()
+	if hostPieces >= maxPiecesPerHost {
+		select {
+		case uw.resultChan <- finishedUpload{uw.chunkID, crypto.Hash{}, errHostHoldsChunk, uw.pieceIndex, w.contractID}:
+		case <-w.renter.tg.StopChan():
+		}
+		return
+	}
+
 	root, err := e.Upload(uw.data)
 	if err != nil {
 		w.recentUploadFailure = time.Now()
@@ -141,7 +181,6 @@ func (w *worker) upload(uw uploadWork) {
 	w.consecutiveUploadFailures = 0
 
 	// Update the renter metadata.
-	addr := e.Address()
 	endHeight := e.EndHeight()
 	id := w.renter.mu.Lock()
 	uw.file.mu.Lock()
@@ -159,7 +198,11 @@ func (w *worker) upload(uw uploadWork) {
 		MerkleRoot: root,
 	})
 	uw.file.contracts[w.contractID] = contract
-	w.renter.saveFile(uw.file)
+	// A file that was replaced by RotateKey shares its .sia file with its
+	// replacement, so it is not saved.
+	if w.renter.files[uw.file.key()] == uw.file {
+		w.renter.saveFile(uw.file)
+	}
 	uw.file.mu.Unlock()
 	w.renter.mu.Unlock(id)
 
@@ -169,6 +212,25 @@ func (w *worker) upload(uw uploadWork) {
 	}
 }
 
+// managedFinishUpload records that a worker has finished uploading a piece of
+// f. When the last upload of a file whose key was rotated finishes, the
+// sectors of the file are deleted.
+func (r *Renter) managedFinishUpload(f *file) {
+	lockID := r.mu.Lock()
+	f.mu.Lock()
+	f.uploads--
+	done := f.rotated && f.uploads == 0
+	f.mu.Unlock()
+	var sectors map[types.FileContractID][]crypto.Hash
+	if done {
+		sectors = r.unusedSectors([]*file{f})
+	}
+	r.mu.Unlock(lockID)
+	if done {
+		go r.threadedDeleteSectors(sectors)
+	}
+}
+
 // work will perform one unit of work, exiting early if there is a kill signal
 // given before work is completed.
 func (w *worker) work() {
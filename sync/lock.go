@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"runtime"
+	"sort"
 	"sync"
 	"time"
 )
@@ -18,6 +19,13 @@ type RWMutex struct {
 	callDepth   int
 	maxLockTime time.Duration
 
+	// waiting is the number of callers that are waiting to acquire the lock.
+	// It is protected by openLocksMutex, and only counted if countWaiting is
+	// set. countWaiting is read without synchronization, so it can only be
+	// set before any goroutine uses the RWMutex.
+	countWaiting bool
+	waiting      int
+
 	mu sync.RWMutex
 }
 
@@ -34,6 +42,33 @@ type lockInfo struct {
 	callingLines []int
 }
 
+// A LockHolder describes a caller that currently holds a RWMutex.
+type LockHolder struct {
+	ID      int
+	Read    bool
+	HeldFor time.Duration
+	Caller  string // file and line of the call to Lock or RLock
+}
+
+// LockStats describes the callers that hold a RWMutex, and the number of
+// callers that are waiting to acquire it.
+type LockStats struct {
+	Holders []LockHolder
+	Waiting int
+}
+
+// HeldLongerThan returns the holders that have held the lock for longer than
+// d.
+func (ls LockStats) HeldLongerThan(d time.Duration) []LockHolder {
+	var holders []LockHolder
+	for _, h := range ls.Holders {
+		if h.HeldFor > d {
+			holders = append(holders, h)
+		}
+	}
+	return holders
+}
+
 // New takes a maxLockTime and returns a lock. The lock will never stay locked
 // for more than maxLockTime, instead printing an error and unlocking after
 // maxLockTime has passed.
@@ -91,7 +126,12 @@ func (rwm *RWMutex) safeLock(read bool) int {
 		_, li.callingFiles[i], li.callingLines[i], _ = runtime.Caller(2 + i)
 	}
 
-	// Lock the mutex.
+	// Lock the mutex, recording that the caller is waiting.
+	if rwm.countWaiting {
+		rwm.openLocksMutex.Lock()
+		rwm.waiting++
+		rwm.openLocksMutex.Unlock()
+	}
 	if read {
 		rwm.mu.RLock()
 	} else {
@@ -100,6 +140,9 @@ func (rwm *RWMutex) safeLock(read bool) int {
 
 	// Safely register that a lock has been triggered.
 	rwm.openLocksMutex.Lock()
+	if rwm.countWaiting {
+		rwm.waiting--
+	}
 	li.lockTime = time.Now()
 	id := rwm.openLocksCounter
 	rwm.openLocks[id] = li
@@ -141,6 +184,39 @@ func (rwm *RWMutex) safeUnlock(read bool, id int) {
 	delete(rwm.openLocks, id)
 }
 
+// CountWaiting enables counting the callers that are waiting to acquire the
+// RWMutex, which are reported by Stats. Counting costs an extra lock of the
+// RWMutex's bookkeeping per call, so it is disabled by default. CountWaiting
+// is not synchronized with the other methods, so it must be called before any
+// goroutine uses the RWMutex.
+func (rwm *RWMutex) CountWaiting() {
+	rwm.countWaiting = true
+}
+
+// Stats returns the callers that currently hold the RWMutex, sorted by lock
+// id, and the number of callers waiting to acquire it if CountWaiting has been
+// called.
+func (rwm *RWMutex) Stats() LockStats {
+	rwm.openLocksMutex.Lock()
+	defer rwm.openLocksMutex.Unlock()
+
+	stats := LockStats{
+		Waiting: rwm.waiting,
+	}
+	for id, info := range rwm.openLocks {
+		stats.Holders = append(stats.Holders, LockHolder{
+			ID:      id,
+			Read:    info.read,
+			HeldFor: time.Since(info.lockTime),
+			Caller:  fmt.Sprintf("%v:%v", info.callingFiles[0], info.callingLines[0]),
+		})
+	}
+	sort.Slice(stats.Holders, func(i, j int) bool {
+		return stats.Holders[i].ID < stats.Holders[j].ID
+	})
+	return stats
+}
+
 // RLock will read lock the RWMutex. The return value must be used as input
 // when calling RUnlock.
 func (rwm *RWMutex) RLock() int {
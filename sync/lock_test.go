@@ -2,6 +2,7 @@ package sync
 
 import (
 	"runtime"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -147,3 +148,82 @@ func TestLockSafety(t *testing.T) {
 		t.Error("test took too long to complete")
 	}
 }
+
+// TestLockStats checks that the stats of a RWMutex report the current
+// holders, the callers waiting for the lock, and locks that have been held
+// for too long.
+func TestLockStats(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+
+	rwm := New(time.Minute, 0)
+	rwm.CountWaiting()
+	if stats := rwm.Stats(); len(stats.Holders) != 0 || stats.Waiting != 0 {
+		t.Fatal("unused lock has holders or waiters:", stats)
+	}
+
+	// Hold a read lock and a second read lock.
+	id1 := rwm.RLock()
+	id2 := rwm.RLock()
+	stats := rwm.Stats()
+	if len(stats.Holders) != 2 || stats.Holders[0].ID != id1 || stats.Holders[1].ID != id2 || !stats.Holders[0].Read {
+		t.Fatal("wrong holders:", stats.Holders)
+	}
+	if !strings.Contains(stats.Holders[0].Caller, "lock_test.go") {
+		t.Error("caller should be in lock_test.go, got", stats.Holders[0].Caller)
+	}
+
+	// A writer should be reported as waiting.
+	locked := make(chan struct{})
+	go func() {
+		id := rwm.Lock()
+		close(locked)
+		rwm.Unlock(id)
+	}()
+	for i := 0; i < 100 && rwm.Stats().Waiting != 1; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	if waiting := rwm.Stats().Waiting; waiting != 1 {
+		t.Fatal("expected 1 waiting caller, got", waiting)
+	}
+
+	// Only locks held beyond the threshold should be reported.
+	time.Sleep(20 * time.Millisecond)
+	rwm.RUnlock(id2)
+	if long := rwm.Stats().HeldLongerThan(10 * time.Millisecond); len(long) != 1 || long[0].ID != id1 {
+		t.Fatal("expected the first lock to be held too long, got", long)
+	}
+	if long := rwm.Stats().HeldLongerThan(time.Hour); len(long) != 0 {
+		t.Fatal("no lock should be held for an hour, got", long)
+	}
+
+	rwm.RUnlock(id1)
+	<-locked
+	if stats := rwm.Stats(); len(stats.Holders) != 0 || stats.Waiting != 0 {
+		t.Fatal("lock has holders or waiters after being released:", stats)
+	}
+}
+
+// TestLockStatsWaitingDisabled checks that callers waiting for a RWMutex are
+// not counted unless CountWaiting has been called.
+func TestLockStatsWaitingDisabled(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+
+	rwm := New(time.Minute, 0)
+	id := rwm.Lock()
+	locked := make(chan struct{})
+	go func() {
+		id := rwm.Lock()
+		close(locked)
+		rwm.Unlock(id)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	if waiting := rwm.Stats().Waiting; waiting != 0 {
+		t.Fatal("waiting callers should not be counted, got", waiting)
+	}
+	rwm.Unlock(id)
+	<-locked
+}